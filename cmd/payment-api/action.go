@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/logging"
+	"github.com/Shodske/payment-api/pkg/source"
+	"github.com/manyminds/api2go"
+	"github.com/manyminds/api2go/jsonapi"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Server information used to generate links when marshaling the results of custom actions, the same as api2go uses
+// for the resources it routes itself.
+type serverInformation struct {
+	prefix string
+}
+
+// GetBaseURL method required to implement `jsonapi.ServerInformation`.
+func (info serverInformation) GetBaseURL() string {
+	return ""
+}
+
+// GetPrefix method required to implement `jsonapi.ServerInformation`.
+func (info serverInformation) GetPrefix() string {
+	return info.prefix
+}
+
+// Register all custom actions of a source on the router of the API. The middlewares are executed before every action,
+// just like api2go does for the resources it routes itself.
+func registerActions(api *api2go.API, name string, src source.ActionSource, middlewares ...api2go.HandlerFunc) {
+	for action, handle := range src.Actions() {
+		route := fmt.Sprintf("/%s/%s/:id/%s", apiPrefix, name, action)
+		handleRoute(api, http.MethodPost, route, func(handle source.Action) routeHandler {
+			return func(params map[string]string, req api2go.Request) (api2go.Responder, error) {
+				return handle(params["id"], req)
+			}
+		}(handle), middlewares...)
+	}
+}
+
+// Handler of a custom route, which gets the parameters of the route together with the request.
+type routeHandler func(params map[string]string, req api2go.Request) (api2go.Responder, error)
+
+// Register a custom route on the router of the API, of which the response is marshaled the same way api2go marshals
+// the responses of the resources it routes itself. The middlewares are executed before the handler.
+func handleRoute(api *api2go.API, method, route string, handle routeHandler, middlewares ...api2go.HandlerFunc) {
+	info := serverInformation{prefix: apiPrefix}
+
+	api.Router().Handle(method, route, func(w http.ResponseWriter, r *http.Request, params map[string]string, _ map[string]interface{}) {
+		ctx := &api2go.APIContext{}
+		for _, middleware := range middlewares {
+			middleware(ctx, w, r)
+		}
+
+		res, err := handle(params, buildRequest(ctx, r))
+		if err != nil {
+			writeError(w, r, err, api.ContentType)
+			return
+		}
+		if res.StatusCode() == http.StatusNoContent {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		data, err := jsonapi.MarshalWithURLs(res.Result(), info)
+		if err != nil {
+			writeError(w, r, err, api.ContentType)
+			return
+		}
+
+		w.Header().Set("Content-Type", api.ContentType)
+		w.WriteHeader(res.StatusCode())
+		w.Write(data)
+	})
+}
+
+// Build an `api2go.Request` from an incoming request, in the same way api2go does for its own routes.
+func buildRequest(ctx api2go.APIContexter, r *http.Request) api2go.Request {
+	params := make(map[string][]string)
+	pagination := make(map[string]string)
+	for key, values := range r.URL.Query() {
+		params[key] = strings.Split(values[0], ",")
+		if strings.HasPrefix(key, "page[") && strings.HasSuffix(key, "]") {
+			pagination[key[5:len(key)-1]] = values[0]
+		}
+	}
+
+	return api2go.Request{
+		PlainRequest: r,
+		QueryParams:  params,
+		Pagination:   pagination,
+		Header:       r.Header,
+		Context:      ctx,
+	}
+}
+
+// Write an error as a json:api error document, with the status of its first error object, see `source.NewHTTPError`.
+// Any other error results in an internal server error, of which the details are only logged.
+func writeError(w http.ResponseWriter, r *http.Request, err error, contentType string) {
+	logger := logging.FromContext(r.Context())
+
+	httpErr, ok := err.(api2go.HTTPError)
+	if ok && len(httpErr.Errors) > 0 {
+		logger.WithError(err).Debug("request rejected")
+	} else {
+		logger.WithError(err).Error("cannot handle request")
+		httpErr = source.NewHTTPError(err, "internal server error", http.StatusInternalServerError)
+	}
+
+	status, _ := strconv.Atoi(httpErr.Errors[0].Status)
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(httpErr); err != nil {
+		logger.WithError(err).Error("cannot write error")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/auth"
+	"github.com/Shodske/payment-api/pkg/config"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/Shodske/payment-api/pkg/source"
+	"github.com/manyminds/api2go"
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// Register the routes of the API keys, nested under the organisation they belong to.
+func registerAPIKeys(api *api2go.API, src *source.APIKeySource, middlewares ...api2go.HandlerFunc) {
+	route := fmt.Sprintf("/%s/organisations/:id/api-keys", apiPrefix)
+
+	handleRoute(api, http.MethodGet, route, func(params map[string]string, req api2go.Request) (api2go.Responder, error) {
+		return src.FindAll(params["id"], req)
+	}, middlewares...)
+
+	handleRoute(api, http.MethodPost, route, func(params map[string]string, req api2go.Request) (api2go.Responder, error) {
+		body, err := ioutil.ReadAll(req.PlainRequest.Body)
+		if err != nil {
+			return nil, err
+		}
+		key := &model.APIKey{}
+		if err := jsonapi.Unmarshal(body, key); err != nil {
+			return nil, source.NewHTTPError(err, err.Error(), http.StatusNotAcceptable)
+		}
+
+		return src.Create(params["id"], key, req)
+	}, middlewares...)
+
+	handleRoute(api, http.MethodDelete, route+"/:key", func(params map[string]string, req api2go.Request) (api2go.Responder, error) {
+		return src.Revoke(params["id"], params["key"], req)
+	}, middlewares...)
+}
+
+// Run the api-key command, which creates an API key outside of the API. Without an API key the API can't be used at
+// all, so this is how the first key of an organisation is created. The key is printed to stdout.
+func runAPIKey(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "create" {
+		return fmt.Errorf("usage: %s api-key create -organisation <id>|-new-organisation <name> [-name <name>] [-role <role>]", os.Args[0])
+	}
+	if cfg.Database.Driver != config.DriverPostgres {
+		return fmt.Errorf("api keys can only be created for the %s driver", config.DriverPostgres)
+	}
+
+	flags := flag.NewFlagSet("api-key create", flag.ContinueOnError)
+	orgID := flags.String("organisation", "", "id of the organisation the key belongs to")
+	newOrg := flags.String("new-organisation", "", "name of a new organisation to create, which the key belongs to")
+	name := flags.String("name", "default", "name of the key")
+	role := flags.String("role", string(model.RoleAdmin), "role of the key: viewer, operator or admin")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if (*orgID == "") == (*newOrg == "") {
+		return errors.New("either -organisation or -new-organisation is required")
+	}
+	if !model.Role(*role).IsValid() {
+		return fmt.Errorf("invalid role %q", *role)
+	}
+
+	conn, err := openDatabaseConnection(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	key, err := createAPIKey(repository.NewGorm(conn), *orgID, *newOrg, *name, model.Role(*role))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("organisation: %s\nrole: %s\napi key: %s\n", key.OrganisationID, key.Role, key.Key)
+
+	return nil
+}
+
+// Create an API key with the role for the existing organisation with the id, or for a new organisation with the name.
+func createAPIKey(repos repository.Repositories, orgID, newOrg, name string, role model.Role) (*model.APIKey, error) {
+	var org *model.Organisation
+	if newOrg != "" {
+		org = &model.Organisation{Name: newOrg}
+		// The organisation is created exactly like with the API, but with the command line as actor.
+		ctx := &api2go.APIContext{}
+		ctx.Set(auth.ActorContextKey, "cli")
+		if err := source.CreateOrganisation(repos, api2go.Request{Context: ctx}, org); err != nil {
+			return nil, err
+		}
+	} else {
+		id, err := uuid.FromString(orgID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid organisation id: %v", err)
+		}
+		if org, err = repos.Organisations.Find(id); err != nil {
+			return nil, fmt.Errorf("cannot find organisation %s: %v", id, err)
+		}
+	}
+
+	key, err := model.NewAPIKey(org.ID, name, role)
+	if err != nil {
+		return nil, err
+	}
+
+	return key, repos.APIKeys.Create(key)
+}
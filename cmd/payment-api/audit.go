@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/source"
+	"github.com/manyminds/api2go"
+	"net/http"
+)
+
+// Register the read-only route of the audit log of payments.
+func registerAuditEvents(api *api2go.API, src *source.PaymentSource, middlewares ...api2go.HandlerFunc) {
+	route := fmt.Sprintf("/%s/payments/:id/audit-events", apiPrefix)
+
+	handleRoute(api, http.MethodGet, route, func(params map[string]string, req api2go.Request) (api2go.Responder, error) {
+		return src.AuditEvents(params["id"], req)
+	}, middlewares...)
+}
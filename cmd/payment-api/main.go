@@ -2,107 +2,263 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"github.com/Shodske/payment-api/pkg/auth"
+	"github.com/Shodske/payment-api/pkg/config"
+	"github.com/Shodske/payment-api/pkg/database"
+	"github.com/Shodske/payment-api/pkg/logging"
+	"github.com/Shodske/payment-api/pkg/metrics"
+	"github.com/Shodske/payment-api/pkg/migrate"
 	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
 	"github.com/Shodske/payment-api/pkg/source"
+	"github.com/Shodske/payment-api/pkg/tracing"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 	"github.com/manyminds/api2go"
+	"github.com/sirupsen/logrus"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 )
 
+// Prefix of all routes of the API.
+const apiPrefix = "v0"
+
+// Usage of the commands, printed after the usage of the flags.
+const commandUsage = `
+Commands:
+  (none)            start the API server
+  migrate up        apply all pending migrations
+  migrate down      revert the most recently applied migration
+  migrate status    list all migrations and whether they are applied
+  migrate baseline  record the first migration as applied, for a database created by AutoMigrate
+  api-key create    create an API key, for an existing or a new organisation
+`
+
 func main() {
-	log.Print("starting payment-api server")
+	cfg, args, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		fmt.Fprint(os.Stderr, commandUsage)
+		os.Exit(0)
+	}
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		logrus.Fatal(err)
+	}
+	if err := logging.Configure(logrus.StandardLogger(), cfg.Log.Level, cfg.Log.Format); err != nil {
+		logrus.Fatal(err)
+	}
 
-	// Open a database connection to auto migrate the schemas.
-	log.Print("migrating schemas...")
-	conn, err := openDatabaseConnection()
+	switch {
+	case len(args) == 0:
+		err = serve(cfg)
+	case args[0] == "migrate":
+		err = runMigrate(cfg, args[1:])
+	case args[0] == "api-key":
+		err = runAPIKey(cfg, args[1:])
+	default:
+		err = fmt.Errorf("unknown command `%s`, see `%s -h`", args[0], os.Args[0])
+	}
 	if err != nil {
-		log.Fatal(err)
+		logrus.Fatal(err)
 	}
+}
 
-	conn.AutoMigrate(
-		&model.Organisation{},
-		&model.Party{},
-		&model.Charge{},
-		&model.CurrencyAmount{},
-		&model.FX{},
-		&model.Payment{},
-	)
+// Start the API server, which refuses to start when the database schema isn't up to date.
+func serve(cfg *config.Config) error {
+	logrus.Info("starting payment-api server")
+	logrus.Infof("effective configuration:\n%s", cfg)
 
-	// Close the connection after we're done.
-	if err = conn.Close(); err != nil {
-		log.Fatal(err)
+	stopTracing, err := startTracing(cfg)
+	if err != nil {
+		return err
 	}
+	defer stopTracing()
 
-	log.Print("initialising api...")
-	api := initAPI()
+	if cfg.Database.Driver == config.DriverMemory {
+		logrus.Info("storing all resources in memory, they are lost when the server exits")
+		repos := repository.NewMemory()
+		key, err := createAPIKey(repos, "", "Demo", "demo", model.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("created demo organisation %s with %s api key %s", key.OrganisationID, key.Role, key.Key)
 
-	port := os.Getenv("PORT")
-	log.Printf("server listening on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, api.Handler()))
+		stop, err := startDispatcher(cfg, repos)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		defer startWebhookWorker(cfg, repos)()
+		defer startAdminServer(cfg)()
+
+		return listen(cfg, auth.Authenticate(repos, newTokenVerifier(cfg), initAPI(cfg, repos).Handler()))
+	}
+
+	// Open the database connections shared by all requests.
+	conn, err := openDatabaseConnection(cfg)
+	if err != nil {
+		return err
+	}
+	pool := database.NewPool(conn, database.PoolConfig{
+		MaxOpenConns:    cfg.Database.MaxOpenConns,
+		ReservedConns:   config.ReservedConns,
+		MaxIdleConns:    cfg.Database.MaxIdleConns,
+		ConnMaxLifetime: cfg.Database.ConnMaxLifetime,
+		AcquireTimeout:  cfg.Database.AcquireTimeout,
+	})
+	defer pool.Close()
+	if err := metrics.RegisterDB(pool.DB().DB()); err != nil {
+		return err
+	}
+
+	logrus.Info("checking migrations...")
+	migrator, err := newMigrator(cfg, conn)
+	if err != nil {
+		return err
+	}
+	pending, err := migrator.Pending(context.Background())
+	if err == migrate.ErrUnversioned {
+		return fmt.Errorf("%v, run `%s migrate baseline` first", err, os.Args[0])
+	}
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending migrations, run `%s migrate up` first", len(pending), os.Args[0])
+	}
+
+	logrus.Info("initialising api...")
+	repos := repository.NewGorm(pool.DB())
+	api := initAPI(cfg, repos)
+
+	stop, err := startDispatcher(cfg, repos)
+	if err != nil {
+		return err
+	}
+	defer stop()
+	defer startWebhookWorker(cfg, repos)()
+	defer startAdminServer(cfg)()
+
+	return listen(cfg, limitConnections(pool, api.ContentType, auth.Authenticate(repos, newTokenVerifier(cfg), api.Handler())))
+}
+
+// Create the verifier of bearer tokens, or nil when bearer tokens are disabled because no JWKS is configured.
+func newTokenVerifier(cfg *config.Config) *auth.TokenVerifier {
+	jwt := cfg.Auth.JWT
+	if jwt.JWKS == "" {
+		return nil
+	}
+	logrus.Infof("accepting bearer tokens of %s, verified with %s", jwt.Issuer, jwt.JWKS)
+
+	return auth.NewTokenVerifier(auth.TokenConfig{
+		JWKS:              jwt.JWKS,
+		JWKSCacheTTL:      jwt.JWKSCacheTTL,
+		Issuer:            jwt.Issuer,
+		Audience:          jwt.Audience,
+		OrganisationClaim: jwt.OrganisationClaim,
+		RolesClaim:        jwt.RolesClaim,
+		Leeway:            jwt.Leeway,
+	})
+}
+
+// Listen for requests to the handler, until the server fails. Every request is logged with its id, see
+// `logging.Middleware`, traced, see `tracing.Middleware`, and counted in the metrics, see `metrics.Middleware`. Errors of
+// the server itself, like panics of handlers, are logged as warnings.
+func listen(cfg *config.Config, handler http.Handler) error {
+	handler = metrics.Middleware(apiPrefix, resources, handler)
+	handler = tracing.Middleware(spanName, handler)
+	handler = logging.Middleware(logrus.StandardLogger(), handler)
+
+	server := &http.Server{
+		Addr:         ":" + strconv.Itoa(cfg.Server.Port),
+		Handler:      handler,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		ErrorLog:     log.New(logrus.StandardLogger().WriterLevel(logrus.WarnLevel), "", 0),
+	}
+	logrus.Infof("server listening on port %d", cfg.Server.Port)
+
+	return server.ListenAndServe()
 }
 
-// Open a `gorm.DB` database connection, which can be used to migrate the database tables and execute CRUD actions on
-// Models.
-func openDatabaseConnection() (*gorm.DB, error) {
-	host := os.Getenv("DB_HOST")
-	port := os.Getenv("DB_PORT")
-	database := os.Getenv("DB_DATABASE")
-	username := os.Getenv("DB_USERNAME")
-	password := os.Getenv("DB_PASSWORD")
-
-	conn, err := gorm.Open(
-		"postgres",
-		fmt.Sprintf(
-			"host=%s port=%s dbname=%s user=%s password=%s sslmode=disable",
-			host,
-			port,
-			database,
-			username,
-			password,
-		),
-	)
+// Open a `gorm.DB` database connection, which can be used to execute CRUD actions on Models. Queries are logged when
+// the log level is debug.
+func openDatabaseConnection(cfg *config.Config) (*gorm.DB, error) {
+	conn, err := gorm.Open("postgres", cfg.Database.DSN())
 
 	if conn != nil {
-		// TODO Set LogMode based on the current log level, which should be set through an env variable.
-		conn.LogMode(true)
+		conn.SetLogger(logging.NewGormLogger(logrus.NewEntry(logrus.StandardLogger())))
+		conn.LogMode(cfg.Log.Level == config.LevelDebug)
+		tracing.RegisterCallbacks(conn)
 		conn = conn.Set("gorm:auto_preload", true)
 	}
 
 	return conn, err
 }
 
-// Initialise the API with required middleware and registered resources.
-func initAPI() *api2go.API {
-	api := api2go.NewAPI("v0")
-
-	// Allow cross origin requests
-	api.UseMiddleware(func(_ api2go.APIContexter, res http.ResponseWriter, _ *http.Request) {
-		res.Header().Set("Access-Control-Allow-Origin", "*")
-		res.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE")
-		res.Header().Set("Access-Control-Allow-Headers", "*")
-	})
+// Wrap the handler of the API, so every request acquires a slot of the database connection pool before it's handled.
+// Requests fail with a 503 error when all connections stay in use for longer than the acquire timeout. Preflight
+// requests and the currencies don't use any repository, so they're handled without a slot, and don't fail when the
+// pool is exhausted.
+func limitConnections(pool *database.Pool, contentType string, handler http.Handler) http.Handler {
+	currencies := "/" + apiPrefix + "/currencies"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || r.URL.Path == currencies || strings.HasPrefix(r.URL.Path, currencies+"/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
 
-	// For every request open a database connection.
-	api.UseMiddleware(func(ctx api2go.APIContexter, _ http.ResponseWriter, req *http.Request) {
-		db, err := openDatabaseConnection()
+		_, span := tracing.Tracer().Start(r.Context(), "acquire connection")
+		release, err := pool.Acquire(r.Context())
+		span.End()
 		if err != nil {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, r, source.NewHTTPError(err, err.Error(), http.StatusServiceUnavailable), contentType)
 			return
 		}
-		ctx.Set("db", db)
+		defer release()
 
-		// Whenever the request is done, close the database connection.
-		go func(conn *gorm.DB, ctx context.Context) {
-			<-ctx.Done()
-			conn.Close()
-		}(db, req.Context())
+		handler.ServeHTTP(w, r)
 	})
+}
+
+// Initialise the API with required middleware and registered resources, which all share the given repositories.
+// Requests must be authenticated with `auth.Authenticate` before they are handled by the API.
+func initAPI(cfg *config.Config, repos repository.Repositories) *api2go.API {
+	api := api2go.NewAPI(apiPrefix)
+
+	middlewares := []api2go.HandlerFunc{
+		// Allow cross origin requests
+		func(_ api2go.APIContexter, res http.ResponseWriter, _ *http.Request) {
+			res.Header().Set("Access-Control-Allow-Origin", "*")
+			res.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE")
+			res.Header().Set("Access-Control-Allow-Headers", "*")
+		},
+		// Make the organisation of the caller available to the sources
+		auth.Middleware,
+	}
+	api.UseMiddleware(middlewares...)
+
+	paymentSource := source.NewPaymentSource(repos)
+	webhookSource := source.NewWebhookSource(repos, cfg.Webhooks.AllowInsecure)
+
+	api.AddResource(&model.Organisation{}, source.NewOrganisationSource(repos))
+	api.AddResource(&model.Payment{}, paymentSource)
+	api.AddResource(&model.Currency{}, &source.CurrencySource{})
+	api.AddResource(&model.Webhook{}, webhookSource)
 
-	api.AddResource(&model.Organisation{}, &source.OrganisationSource{})
-	api.AddResource(&model.Payment{}, &source.PaymentSource{})
+	registerActions(api, "payments", paymentSource, middlewares...)
+	registerAuditEvents(api, paymentSource, middlewares...)
+	registerAPIKeys(api, source.NewAPIKeySource(repos), middlewares...)
+	registerWebhookDeliveries(api, webhookSource, middlewares...)
 
 	return api
 }
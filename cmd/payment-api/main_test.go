@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Shodske/payment-api/pkg/auth"
+	"github.com/Shodske/payment-api/pkg/config"
+	"github.com/Shodske/payment-api/pkg/database"
+	"github.com/Shodske/payment-api/pkg/logging"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/Shodske/payment-api/pkg/source"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/manyminds/api2go"
+	"github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The handlers run on the in-memory repositories, so no database is needed.
+func TestAPI(t *testing.T) {
+	repos := repository.NewMemory()
+	handler := auth.Authenticate(repos, nil, initAPI(config.Default(), repos).Handler())
+	key, err := createAPIKey(repos, "", "Organisation", "test", model.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := repos.AuditEvents.List("organisations", key.OrganisationID)
+	if err != nil || len(events) != 1 || events[0].Operation != model.AuditCreate || events[0].Actor != "cli" {
+		t.Errorf("createAPIKey() audit events = %+v, %v, want the creation by %q", events, err, "cli")
+	}
+	apiKey := key.Key
+	request := func(method, path, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/vnd.api+json")
+		req.Header.Set(auth.Header, apiKey)
+		res := httptest.NewRecorder()
+		handler.ServeHTTP(res, req)
+
+		var doc map[string]interface{}
+		json.Unmarshal(res.Body.Bytes(), &doc)
+
+		return res.Code, doc
+	}
+	id := func(doc map[string]interface{}) string {
+		return doc["data"].(map[string]interface{})["id"].(string)
+	}
+
+	orgID := key.OrganisationID.String()
+
+	code, doc := request("POST", "/v0/payments", `{"data": {"type": "payments", "attributes": {"amount": "13.37", "currency": "GBP"},
+		"relationships": {"organisation": {"data": {"type": "organisations", "id": "`+orgID+`"}}}}}`)
+	if code != http.StatusCreated {
+		t.Fatalf("POST /v0/payments status = %v, want %v", code, http.StatusCreated)
+	}
+	paymentID := id(doc)
+
+	// Other organisations can't see or change the payment.
+	otherKey, err := createAPIKey(repos, "", "Other Organisation", "test", model.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey = otherKey.Key
+	for _, path := range []string{"/v0/payments/" + paymentID, "/v0/organisations/" + orgID + "/payments"} {
+		if code, _ := request("GET", path, ""); code != http.StatusNotFound {
+			t.Errorf("GET %s status = %v, want %v", path, code, http.StatusNotFound)
+		}
+	}
+	if code, _ := request("DELETE", "/v0/payments/"+paymentID, ""); code != http.StatusNotFound {
+		t.Errorf("DELETE /v0/payments/:id status = %v, want %v", code, http.StatusNotFound)
+	}
+	if code, doc := request("GET", "/v0/payments", ""); code != http.StatusOK || len(doc["data"].([]interface{})) != 0 {
+		t.Errorf("GET /v0/payments = %v %v, want no payments", code, doc)
+	}
+	apiKey = key.Key
+
+	code, doc = request("POST", "/v0/organisations/"+orgID+"/api-keys", `{"data": {"type": "api-keys", "attributes": {"name": "CI"}}}`)
+	if code != http.StatusCreated {
+		t.Fatalf("POST /v0/organisations/:id/api-keys status = %v, want %v", code, http.StatusCreated)
+	}
+	keyID := id(doc)
+	// Keys created through the API are viewers, unless another role is asked for.
+	newKey, _ := doc["data"].(map[string]interface{})["attributes"].(map[string]interface{})["key"].(string)
+	if newKey == "" {
+		t.Fatalf("POST /v0/organisations/:id/api-keys = %v, want the key", doc)
+	}
+
+	code, doc = request("POST", "/v0/webhooks", `{"data": {"type": "webhooks", "attributes": {"url": "https://example.com/webhooks",
+		"event_types": ["payment.created", "payment.deleted"]}}}`)
+	if code != http.StatusCreated {
+		t.Fatalf("POST /v0/webhooks status = %v, want %v", code, http.StatusCreated)
+	}
+	webhookID := id(doc)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"list", "GET", "/v0/payments?filter[currency]=GBP", http.StatusOK},
+		{"find", "GET", "/v0/payments/" + paymentID + "?include=organisation", http.StatusOK},
+		{"organisation-payments", "GET", "/v0/organisations/" + orgID + "/payments", http.StatusOK},
+		{"submit", "POST", "/v0/payments/" + paymentID + "/submit", http.StatusOK},
+		{"invalid-transition", "POST", "/v0/payments/" + paymentID + "/submit", http.StatusConflict},
+		{"delete", "DELETE", "/v0/payments/" + paymentID, http.StatusNoContent},
+		{"not-found", "GET", "/v0/payments/" + paymentID, http.StatusNotFound},
+		{"audit-events", "GET", "/v0/payments/" + paymentID + "/audit-events", http.StatusOK},
+		{"api-keys", "GET", "/v0/organisations/" + orgID + "/api-keys", http.StatusOK},
+		{"webhooks", "GET", "/v0/webhooks", http.StatusOK},
+		{"webhook-deliveries", "GET", "/v0/webhooks/" + webhookID + "/deliveries", http.StatusOK},
+		{"unknown-webhook-deliveries", "GET", "/v0/webhooks/" + keyID + "/deliveries", http.StatusNotFound},
+		{"other-api-keys", "GET", "/v0/organisations/" + key.ID.String() + "/api-keys", http.StatusNotFound},
+		{"revoke", "DELETE", "/v0/organisations/" + orgID + "/api-keys/" + key.GetID(), http.StatusNoContent},
+		{"revoked", "GET", "/v0/payments", http.StatusUnauthorized},
+		{"other-key", "GET", "/v0/payments", http.StatusOK},
+		{"viewer-delete", "DELETE", "/v0/payments/" + paymentID, http.StatusForbidden},
+		{"viewer-submit", "POST", "/v0/payments/" + paymentID + "/cancel", http.StatusForbidden},
+		{"viewer-revoke", "DELETE", "/v0/organisations/" + orgID + "/api-keys/" + keyID, http.StatusForbidden},
+		{"viewer-delete-webhook", "DELETE", "/v0/webhooks/" + webhookID, http.StatusForbidden},
+		{"missing-key", "GET", "/v0/payments", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			switch tt.name {
+			case "other-key":
+				apiKey = newKey
+			case "missing-key":
+				apiKey = ""
+			}
+			if code, _ := request(tt.method, tt.path, ""); code != tt.want {
+				t.Errorf("%s %s status = %v, want %v", tt.method, tt.path, code, tt.want)
+			}
+		})
+	}
+}
+
+// Every response has the id of its request, which is recorded with the changes the request makes.
+func TestAPI_RequestID(t *testing.T) {
+	repos := repository.NewMemory()
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	handler := logging.Middleware(logger, auth.Authenticate(repos, nil, initAPI(config.Default(), repos).Handler()))
+	key, err := createAPIKey(repos, "", "Organisation", "test", model.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/v0/payments", strings.NewReader(`{"data": {"type": "payments",
+		"attributes": {"amount": "13.37", "currency": "GBP"}, "relationships": {"organisation": {"data": {"type":
+		"organisations", "id": "`+key.OrganisationID.String()+`"}}}}}`))
+	req.Header.Set("Content-Type", "application/vnd.api+json")
+	req.Header.Set(auth.Header, key.Key)
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("POST /v0/payments status = %v, want %v", res.Code, http.StatusCreated)
+	}
+
+	requestID := res.Header().Get(logging.RequestIDHeader)
+	if requestID == "" {
+		t.Fatalf("POST /v0/payments %s = %v, want a generated id", logging.RequestIDHeader, requestID)
+	}
+	var doc map[string]interface{}
+	json.Unmarshal(res.Body.Bytes(), &doc)
+	paymentID, _ := uuid.FromString(doc["data"].(map[string]interface{})["id"].(string))
+	events, err := repos.AuditEvents.List("payments", paymentID)
+	if err != nil || len(events) != 1 || events[0].RequestID != requestID {
+		t.Errorf("AuditEventRepository.List() = %v, %v, want an event of request %v", events, err, requestID)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantTitle  string
+	}{
+		{"http-error", source.NewHTTPError(errors.New("missing id"), "missing id", http.StatusConflict), http.StatusConflict, "missing id"},
+		{"without-error-objects", api2go.NewHTTPError(errors.New("invalid"), "invalid", http.StatusBadRequest), http.StatusInternalServerError, "internal server error"},
+		{"internal", errors.New("pq: connection refused"), http.StatusInternalServerError, "internal server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			writeError(res, httptest.NewRequest("GET", "/v0/payments", nil), tt.err, "application/vnd.api+json")
+
+			var doc struct {
+				Errors []api2go.Error `json:"errors"`
+			}
+			if err := json.Unmarshal(res.Body.Bytes(), &doc); err != nil || len(doc.Errors) != 1 {
+				t.Fatalf("writeError() wrote %s, want a single error", res.Body.Bytes())
+			}
+			if res.Code != tt.wantStatus || doc.Errors[0].Status != strconv.Itoa(tt.wantStatus) || doc.Errors[0].Title != tt.wantTitle {
+				t.Errorf("writeError() = %v %+v, want %v %v", res.Code, doc.Errors[0], tt.wantStatus, tt.wantTitle)
+			}
+		})
+	}
+}
+
+// Requests that don't use the database are handled without a slot of the pool, even when it's exhausted.
+func TestLimitConnections(t *testing.T) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	pool := database.NewPool(db, database.PoolConfig{MaxOpenConns: 3, ReservedConns: 2, AcquireTimeout: 10 * time.Millisecond})
+	release, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	handler := limitConnections(pool, "application/vnd.api+json", http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"payments", "GET", "/v0/payments", http.StatusServiceUnavailable},
+		{"preflight", "OPTIONS", "/v0/payments", http.StatusOK},
+		{"currencies", "GET", "/v0/currencies", http.StatusOK},
+		{"currency", "GET", "/v0/currencies/GBP", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, httptest.NewRequest(tt.method, tt.path, nil))
+			if res.Code != tt.want {
+				t.Errorf("%s %s status = %v, want %v", tt.method, tt.path, res.Code, tt.want)
+			}
+		})
+	}
+}
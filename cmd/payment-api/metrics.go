@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"github.com/Shodske/payment-api/pkg/config"
+	"github.com/Shodske/payment-api/pkg/metrics"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+)
+
+// Resources routed by the API, by which the metrics of requests are labeled, see `metrics.Middleware`.
+var resources = []string{"organisations", "payments", "currencies", "webhooks", "api-keys", "audit-events", "deliveries"}
+
+// Start the admin server, which serves the Prometheus metrics at `/metrics` on its own port, so they aren't reachable
+// through the API. The returned function shuts the server down.
+func startAdminServer(cfg *config.Config) func() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	server := &http.Server{
+		Addr:         ":" + strconv.Itoa(cfg.Server.AdminPort),
+		Handler:      mux,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+	logrus.Infof("serving metrics on admin port %d", cfg.Server.AdminPort)
+
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			logrus.WithError(err).Error("admin server stopped")
+		}
+	}()
+
+	return func() {
+		server.Shutdown(context.Background())
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/config"
+	"github.com/Shodske/payment-api/pkg/migrate"
+	"github.com/jinzhu/gorm"
+	"github.com/sirupsen/logrus"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// Run the migrate command, which applies, reverts, lists or records the migrations depending on its subcommand.
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s migrate up|down|status|baseline", os.Args[0])
+	}
+	if cfg.Database.Driver != config.DriverPostgres {
+		return fmt.Errorf("migrations only apply to the %s driver", config.DriverPostgres)
+	}
+
+	conn, err := openDatabaseConnection(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	migrator, err := newMigrator(cfg, conn)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			logrus.Infof("applied migration %d_%s", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			logrus.Info("no pending migrations")
+		}
+		return err
+	case "down":
+		reverted, err := migrator.Down(ctx)
+		if reverted != nil {
+			logrus.Infof("reverted migration %d_%s", reverted.Version, reverted.Name)
+		}
+		if err == nil && reverted == nil {
+			logrus.Info("no applied migrations")
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err == migrate.ErrUnversioned {
+			return fmt.Errorf("%v, run `%s migrate baseline` to adopt its schema", err, os.Args[0])
+		}
+		if err != nil {
+			return err
+		}
+		return printStatus(statuses)
+	case "baseline":
+		baseline, err := migrator.Baseline(ctx)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("recorded migration %d_%s as applied", baseline.Version, baseline.Name)
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command `%s`, expected up, down, status or baseline", args[0])
+	}
+}
+
+// Create a Migrator for the migrations in the configured directory.
+func newMigrator(cfg *config.Config, conn *gorm.DB) (*migrate.Migrator, error) {
+	migrations, err := migrate.Load(cfg.Database.Migrations)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load migrations: %v", err)
+	}
+
+	return migrate.New(conn.DB(), conn.Dialect().GetName(), migrations), nil
+}
+
+// Print the status of the migrations as a table.
+func printStatus(statuses []migrate.Status) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.Format(time.RFC3339)
+		}
+		if status.Missing {
+			applied += " (missing)"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, applied)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"github.com/Shodske/payment-api/pkg/config"
+	"github.com/Shodske/payment-api/pkg/outbox"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/Shodske/payment-api/pkg/webhook"
+	"github.com/sirupsen/logrus"
+	"os"
+)
+
+// Start dispatching the domain events in the outbox of the repositories to the webhooks, and to the configured sink
+// unless it's none. The returned function stops dispatching, and closes the sink.
+func startDispatcher(cfg *config.Config, repos repository.Repositories) (func(), error) {
+	sinks := []outbox.Sink{webhook.NewSink()}
+	var sink *outbox.WriterSink
+	switch cfg.Outbox.Sink {
+	case config.SinkStdout:
+		sink = outbox.NewWriterSink(os.Stdout)
+	case config.SinkFile:
+		var err error
+		if sink, err = outbox.OpenFileSink(cfg.Outbox.File); err != nil {
+			return nil, err
+		}
+	}
+	if sink != nil {
+		sinks = append(sinks, sink)
+	}
+	logrus.Infof("dispatching domain events to the webhooks and %s every %s", cfg.Outbox.Sink, cfg.Outbox.Interval)
+
+	dispatcher := outbox.NewDispatcher(repos, outbox.DispatcherConfig{
+		Interval:  cfg.Outbox.Interval,
+		BatchSize: cfg.Outbox.BatchSize,
+	}, sinks...)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(done)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		// Standard output is left open for the rest of the process.
+		if cfg.Outbox.Sink == config.SinkFile {
+			sink.Close()
+		}
+	}, nil
+}
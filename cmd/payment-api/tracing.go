@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"github.com/Shodske/payment-api/pkg/config"
+	"github.com/Shodske/payment-api/pkg/metrics"
+	"github.com/Shodske/payment-api/pkg/tracing"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+)
+
+// Start tracing requests with the configured exporter. The returned function exports the spans that are left.
+func startTracing(cfg *config.Config) (func(), error) {
+	shutdown, err := tracing.Start(tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		ServiceName: cfg.Tracing.ServiceName,
+		Output:      os.Stdout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("exporting spans to %s", cfg.Tracing.Exporter)
+
+	return func() {
+		if err := shutdown(context.Background()); err != nil {
+			logrus.WithError(err).Error("cannot export spans")
+		}
+	}, nil
+}
+
+// Name the span of a request by its method and resource, e.g. `PATCH payments`.
+func spanName(r *http.Request) string {
+	return r.Method + " " + metrics.Resource(apiPrefix, resources, r.URL.Path)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/config"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/Shodske/payment-api/pkg/source"
+	"github.com/Shodske/payment-api/pkg/webhook"
+	"github.com/manyminds/api2go"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// Register the read-only route of the deliveries to a webhook.
+func registerWebhookDeliveries(api *api2go.API, src *source.WebhookSource, middlewares ...api2go.HandlerFunc) {
+	route := fmt.Sprintf("/%s/webhooks/:id/deliveries", apiPrefix)
+
+	handleRoute(api, http.MethodGet, route, func(params map[string]string, req api2go.Request) (api2go.Responder, error) {
+		return src.Deliveries(params["id"], req)
+	}, middlewares...)
+}
+
+// Start posting the due deliveries of the repositories to their webhooks. The returned function stops the worker,
+// after the attempts in progress are finished.
+func startWebhookWorker(cfg *config.Config, repos repository.Repositories) func() {
+	logrus.Infof("delivering webhooks every %s, at most %d attempts each", cfg.Webhooks.Interval, cfg.Webhooks.MaxAttempts)
+
+	worker := webhook.NewWorker(repos, webhook.WorkerConfig{
+		Interval:      cfg.Webhooks.Interval,
+		BatchSize:     cfg.Webhooks.BatchSize,
+		Timeout:       cfg.Webhooks.Timeout,
+		MaxAttempts:   cfg.Webhooks.MaxAttempts,
+		Backoff:       cfg.Webhooks.Backoff,
+		MaxBackoff:    cfg.Webhooks.MaxBackoff,
+		DisableAfter:  cfg.Webhooks.DisableAfter,
+		AllowInsecure: cfg.Webhooks.AllowInsecure,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		worker.Run(ctx)
+		close(done)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
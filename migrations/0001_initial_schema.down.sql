@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS idempotency_keys;
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS fxes;
+DROP TABLE IF EXISTS currency_amounts;
+DROP TABLE IF EXISTS charges;
+DROP TABLE IF EXISTS parties;
+DROP TABLE IF EXISTS organisations;
@@ -0,0 +1,90 @@
+-- The schema exactly as it was created by gorm's AutoMigrate, including the amounts rounded to 2 decimals. Databases
+-- that were migrated with AutoMigrate adopt the versioned migrations with `migrate baseline`, which records this
+-- migration as applied without running it.
+CREATE TABLE IF NOT EXISTS organisations (
+    id uuid,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    name text,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_organisations_deleted_at ON organisations (deleted_at);
+
+CREATE TABLE IF NOT EXISTS parties (
+    id serial,
+    account_name text,
+    account_number text,
+    account_number_code text,
+    account_type integer,
+    address text,
+    bank_id text,
+    bank_id_code text,
+    name text,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS charges (
+    id serial,
+    bearer_code text,
+    receiver_charges_amount decimal(1000, 2),
+    receiver_charges_currency text,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS currency_amounts (
+    id serial,
+    charge_id integer REFERENCES charges (id),
+    amount decimal(1000, 2),
+    currency text,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS fxes (
+    id serial,
+    contract_reference text,
+    exchange_rate decimal(10, 5),
+    original_amount decimal(1000, 2),
+    original_currency text,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE IF NOT EXISTS payments (
+    id uuid,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    organisation_id uuid REFERENCES organisations (id),
+    status varchar(16) NOT NULL DEFAULT 'pending',
+    amount decimal(1000, 2),
+    currency text,
+    end_to_end_reference text,
+    numeric_reference text,
+    payment_id text,
+    payment_purpose text,
+    payment_scheme text,
+    payment_type text,
+    processing_date text,
+    reference text,
+    scheme_payment_sub_type text,
+    scheme_payment_type text,
+    beneficiary_party_id integer REFERENCES parties (id),
+    debtor_party_id integer REFERENCES parties (id),
+    sponsor_party_id integer REFERENCES parties (id),
+    charges_information_id integer REFERENCES charges (id),
+    fx_id integer REFERENCES fxes (id),
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_payments_deleted_at ON payments (deleted_at);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id serial,
+    organisation_id uuid,
+    key varchar(255),
+    fingerprint char(64),
+    response_code integer,
+    response text,
+    created_at timestamp with time zone,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_keys_organisation_key ON idempotency_keys (organisation_id, key);
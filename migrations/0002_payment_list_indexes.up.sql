@@ -0,0 +1,3 @@
+-- Payments are listed per organisation and in (created_at, id) order, which cursor pagination depends on.
+CREATE INDEX IF NOT EXISTS idx_payments_organisation_id ON payments (organisation_id);
+CREATE INDEX IF NOT EXISTS idx_payments_created_at_id ON payments (created_at, id);
@@ -0,0 +1,16 @@
+-- API keys organisations authenticate with. Only a hash of every key is stored, which keys are looked up by.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id uuid,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    organisation_id uuid REFERENCES organisations (id),
+    name text,
+    prefix varchar(16),
+    hash char(64),
+    revoked_at timestamp with time zone,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_deleted_at ON api_keys (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_api_keys_organisation_id ON api_keys (organisation_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_api_keys_hash ON api_keys (hash);
@@ -0,0 +1,20 @@
+-- Not every database can drop columns, so the table is recreated without the role instead.
+CREATE TABLE api_keys_without_role (
+    id uuid,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    organisation_id uuid REFERENCES organisations (id),
+    name text,
+    prefix varchar(16),
+    hash char(64),
+    revoked_at timestamp with time zone,
+    PRIMARY KEY (id)
+);
+INSERT INTO api_keys_without_role
+SELECT id, created_at, updated_at, deleted_at, organisation_id, name, prefix, hash, revoked_at FROM api_keys;
+DROP TABLE api_keys;
+ALTER TABLE api_keys_without_role RENAME TO api_keys;
+CREATE INDEX IF NOT EXISTS idx_api_keys_deleted_at ON api_keys (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_api_keys_organisation_id ON api_keys (organisation_id);
+CREATE UNIQUE INDEX IF NOT EXISTS uix_api_keys_hash ON api_keys (hash);
@@ -0,0 +1,2 @@
+-- The role callers get with an API key. Keys that existed before roles keep the full access they had.
+ALTER TABLE api_keys ADD COLUMN role varchar(16) NOT NULL DEFAULT 'admin';
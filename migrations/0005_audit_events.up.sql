@@ -0,0 +1,15 @@
+-- Append-only audit log of the changes to payments and organisations. The API never updates or deletes events.
+CREATE TABLE IF NOT EXISTS audit_events (
+    id bigserial,
+    created_at timestamp with time zone,
+    organisation_id uuid,
+    resource_type varchar(32),
+    resource_id uuid,
+    operation varchar(16),
+    actor text,
+    request_id text,
+    changes text,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_organisation_id ON audit_events (organisation_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_resource ON audit_events (resource_type, resource_id);
@@ -0,0 +1,18 @@
+-- Domain events of payments and organisations, added in the same transaction as the change they describe and removed
+-- from the outbox by marking them as dispatched.
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id bigserial,
+    type varchar(64),
+    created_at timestamp with time zone,
+    organisation_id uuid,
+    resource_type varchar(32),
+    resource_id uuid,
+    data text,
+    changes text,
+    dispatched_at timestamp with time zone,
+    attempts integer DEFAULT 0,
+    last_error text,
+    PRIMARY KEY (id)
+);
+-- Only the events that are yet to be dispatched are queried, which are few compared to the ones that have been.
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending ON outbox_events (id) WHERE dispatched_at IS NULL;
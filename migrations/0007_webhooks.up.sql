@@ -0,0 +1,37 @@
+-- Webhooks organisations subscribe to domain events with, and the delivery of every event to each of them.
+CREATE TABLE IF NOT EXISTS webhooks (
+    id uuid,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    organisation_id uuid REFERENCES organisations (id),
+    url text,
+    event_types text,
+    secret text,
+    enabled boolean,
+    failures integer DEFAULT 0,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_webhooks_deleted_at ON webhooks (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_webhooks_organisation_id ON webhooks (organisation_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id bigserial,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    webhook_id uuid REFERENCES webhooks (id),
+    event_id bigint,
+    event_type varchar(64),
+    payload text,
+    status varchar(16),
+    attempts integer DEFAULT 0,
+    next_attempt_at timestamp with time zone,
+    last_attempt_at timestamp with time zone,
+    response_code integer,
+    last_error text,
+    PRIMARY KEY (id)
+);
+-- Every event is delivered to a webhook only once, even when it's dispatched from the outbox again.
+CREATE UNIQUE INDEX IF NOT EXISTS uix_webhook_deliveries_event ON webhook_deliveries (webhook_id, event_id);
+-- Only the pending deliveries are looked up by when they are due, which are few compared to the ones that are done.
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,4 @@
+ALTER TABLE payments ALTER COLUMN amount TYPE decimal(1000, 2);
+ALTER TABLE fxes ALTER COLUMN original_amount TYPE decimal(1000, 2);
+ALTER TABLE currency_amounts ALTER COLUMN amount TYPE decimal(1000, 2);
+ALTER TABLE charges ALTER COLUMN receiver_charges_amount TYPE decimal(1000, 2);
@@ -0,0 +1,5 @@
+-- Amounts are stored exactly, with the decimals of their currency, instead of rounded to 2 decimals, e.g. 3 for KWD.
+ALTER TABLE charges ALTER COLUMN receiver_charges_amount TYPE numeric;
+ALTER TABLE currency_amounts ALTER COLUMN amount TYPE numeric;
+ALTER TABLE fxes ALTER COLUMN original_amount TYPE numeric;
+ALTER TABLE payments ALTER COLUMN amount TYPE numeric;
@@ -0,0 +1,2 @@
+-- Sqlite stores decimals without a fixed scale, so amounts keep their decimals without changing the columns.
+SELECT 1;
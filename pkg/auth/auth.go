@@ -0,0 +1,228 @@
+// Package auth authenticates the callers of the API and authorizes what they can do. Every caller acts on behalf of an
+// organisation with a role, which are identified by the API key or bearer token the caller sends with every request.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Shodske/payment-api/pkg/logging"
+	"github.com/Shodske/payment-api/pkg/metrics"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/Shodske/payment-api/pkg/tracing"
+	"github.com/manyminds/api2go"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Header callers send their API key in.
+const Header = "X-API-Key"
+
+// Header callers send their bearer token in, instead of an API key.
+const AuthorizationHeader = "Authorization"
+
+// Key of the organisation of the caller in the api2go context.
+const ContextKey = "organisation"
+
+// Key of the role of the caller in the api2go context.
+const RoleContextKey = "role"
+
+// Key of the actor of the caller in the api2go context.
+const ActorContextKey = "actor"
+
+// Key of the caller in the context of a request.
+type contextKey struct{}
+
+// The organisation and role of an authenticated caller, and the actor that identifies the credentials of the caller.
+type caller struct {
+	org   *model.Organisation
+	role  model.Role
+	actor string
+}
+
+// Content type of the error documents, the same as api2go uses.
+const contentType = "application/vnd.api+json"
+
+// Authenticate wraps the handler of the API, so only requests with a valid API key or bearer token are handled. The
+// organisation and role of the caller are put into the context of the request, from which `Middleware` moves them into
+// the api2go context. Requests without valid credentials are refused with a 401 error. Bearer tokens are only accepted
+// when there is a verifier for them, tokens is nil otherwise.
+//
+// Preflight requests are handled without credentials, as browsers never send them along.
+func Authenticate(repos repository.Repositories, tokens *TokenVerifier, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		var c *caller
+		var err error
+		reason := metrics.ReasonInvalidAPIKey
+		ctx, span := tracing.Tracer().Start(r.Context(), "authenticate")
+		repos := repos.WithContext(ctx)
+		if authorization := r.Header.Get(AuthorizationHeader); authorization != "" {
+			reason = metrics.ReasonInvalidBearerToken
+			c, err = authenticateToken(repos, tokens, authorization)
+		} else {
+			c, err = authenticate(repos, r.Header.Get(Header))
+		}
+		span.End()
+		if err != nil {
+			if _, ok := err.(api2go.HTTPError); ok {
+				metrics.AuthFailed(reason)
+			}
+			writeError(w, r, err)
+			return
+		}
+
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, c)))
+	})
+}
+
+// Middleware of api2go, which puts the organisation and role of the caller into the api2go context of the request.
+// Requests must have been authenticated by `Authenticate`.
+func Middleware(ctx api2go.APIContexter, _ http.ResponseWriter, r *http.Request) {
+	if c, ok := r.Context().Value(contextKey{}).(*caller); ok {
+		ctx.Set(ContextKey, c.org)
+		ctx.Set(RoleContextKey, c.role)
+		ctx.Set(ActorContextKey, c.actor)
+	}
+}
+
+// Organisation of the caller, from the api2go context of a request.
+func Organisation(ctx api2go.APIContexter) (*model.Organisation, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+
+	value, ok := ctx.Get(ContextKey)
+	if !ok {
+		return nil, false
+	}
+	org, ok := value.(*model.Organisation)
+
+	return org, ok && org != nil
+}
+
+// Role of the caller, from the api2go context of a request.
+func Role(ctx api2go.APIContexter) (model.Role, bool) {
+	if ctx == nil {
+		return "", false
+	}
+
+	value, ok := ctx.Get(RoleContextKey)
+	if !ok {
+		return "", false
+	}
+	role, ok := value.(model.Role)
+
+	return role, ok
+}
+
+// Actor of the caller, from the api2go context of a request. The actor identifies the credentials the caller
+// authenticated with: `api-key:<id>` for API keys and `token:<subject>` for bearer tokens.
+func Actor(ctx api2go.APIContexter) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+
+	value, ok := ctx.Get(ActorContextKey)
+	if !ok {
+		return "", false
+	}
+	actor, ok := value.(string)
+
+	return actor, ok
+}
+
+// Find the organisation and role of an API key. Keys that don't exist, are revoked or belong to an organisation that
+// has been deleted are all refused the same way, so callers can't tell them apart.
+func authenticate(repos repository.Repositories, key string) (*caller, error) {
+	if key == "" {
+		return nil, newUnauthorizedError(errors.New("missing api key"), "missing `"+Header+"` header")
+	}
+
+	apiKey, err := repos.APIKeys.FindByHash(model.HashAPIKey(key))
+	if err == repository.ErrNotFound || (err == nil && apiKey.Revoked()) {
+		return nil, newUnauthorizedError(errors.New("invalid api key"), "invalid api key")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := repos.Organisations.Find(apiKey.OrganisationID)
+	if err == repository.ErrNotFound {
+		return nil, newUnauthorizedError(errors.New("organisation of api key deleted"), "invalid api key")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &caller{org: org, role: apiKey.Role, actor: "api-key:" + apiKey.ID.String()}, nil
+}
+
+// Find the organisation and role of the caller of a bearer token. Tokens of organisations that don't exist, or have
+// been deleted, are refused like any other invalid token.
+func authenticateToken(repos repository.Repositories, tokens *TokenVerifier, authorization string) (*caller, error) {
+	// The scheme is followed by the token, see RFC 7235.
+	parts := strings.SplitN(authorization, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], bearerScheme) {
+		return nil, newUnauthorizedError(errors.New("unsupported authorization scheme"), "unsupported authorization scheme")
+	}
+	if tokens == nil {
+		return nil, newUnauthorizedError(errors.New("bearer tokens disabled"), "bearer tokens are not supported")
+	}
+
+	claims, err := tokens.Verify(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := repos.Organisations.Find(claims.OrganisationID)
+	if err == repository.ErrNotFound {
+		return nil, newUnauthorizedError(errors.New("organisation of bearer token not found"), "invalid bearer token")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &caller{org: org, role: claims.Role, actor: "token:" + claims.Subject}, nil
+}
+
+// Create a json:api error for a request that couldn't be authenticated.
+func newUnauthorizedError(err error, detail string) api2go.HTTPError {
+	httpErr := api2go.NewHTTPError(err, "unauthorized", http.StatusUnauthorized)
+	httpErr.Errors = []api2go.Error{
+		{
+			Status: strconv.Itoa(http.StatusUnauthorized),
+			Code:   "unauthorized",
+			Title:  "unauthorized",
+			Detail: detail,
+		},
+	}
+
+	return httpErr
+}
+
+// Write an error as a json:api error document. Errors other than an `api2go.HTTPError` result in an internal server
+// error, without exposing the error itself.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	httpErr, ok := err.(api2go.HTTPError)
+	if !ok {
+		logging.FromContext(r.Context()).WithError(err).Error("cannot authenticate request")
+		httpErr = api2go.NewHTTPError(err, "internal server error", http.StatusInternalServerError)
+		httpErr.Errors = []api2go.Error{
+			{Status: strconv.Itoa(http.StatusInternalServerError), Title: "internal server error"},
+		}
+	}
+
+	status, _ := strconv.Atoi(httpErr.Errors[0].Status)
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(httpErr); err != nil {
+		logging.FromContext(r.Context()).WithError(err).Error("cannot write error")
+	}
+}
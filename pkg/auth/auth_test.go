@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/manyminds/api2go"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Create an organisation with an API key in the repositories.
+func newKey(t *testing.T, repos repository.Repositories, name string, role model.Role) (*model.Organisation, *model.APIKey) {
+	org := &model.Organisation{Name: name}
+	if err := repos.Organisations.Create(org); err != nil {
+		t.Fatal(err)
+	}
+	key, err := model.NewAPIKey(org.ID, name, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.APIKeys.Create(key); err != nil {
+		t.Fatal(err)
+	}
+
+	return org, key
+}
+
+func TestAuthenticate(t *testing.T) {
+	repos := repository.NewMemory()
+	org, key := newKey(t, repos, "Organisation", model.RoleOperator)
+	_, revoked := newKey(t, repos, "Revoked", model.RoleAdmin)
+	repos.APIKeys.Revoke(revoked)
+	deletedOrg, deleted := newKey(t, repos, "Deleted", model.RoleAdmin)
+	repos.Organisations.Delete(deletedOrg)
+
+	var caller *model.Organisation
+	var role model.Role
+	var actor string
+	handler := Authenticate(repos, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := &api2go.APIContext{}
+		Middleware(ctx, w, r)
+		caller, _ = Organisation(ctx)
+		role, _ = Role(ctx)
+		actor, _ = Actor(ctx)
+	}))
+
+	tests := []struct {
+		name     string
+		method   string
+		key      string
+		want     int
+		wantOrg  *model.Organisation
+		wantRole model.Role
+	}{
+		{"valid", http.MethodGet, key.Key, http.StatusOK, org, model.RoleOperator},
+		{"missing", http.MethodGet, "", http.StatusUnauthorized, nil, ""},
+		{"invalid", http.MethodGet, "pk_invalid", http.StatusUnauthorized, nil, ""},
+		{"hash", http.MethodGet, key.Hash, http.StatusUnauthorized, nil, ""},
+		{"revoked", http.MethodGet, revoked.Key, http.StatusUnauthorized, nil, ""},
+		{"deleted-organisation", http.MethodGet, deleted.Key, http.StatusUnauthorized, nil, ""},
+		{"preflight", http.MethodOptions, "", http.StatusOK, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller = nil
+			role = ""
+			actor = ""
+			req := httptest.NewRequest(tt.method, "/v0/payments", nil)
+			if tt.key != "" {
+				req.Header.Set(Header, tt.key)
+			}
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			if res.Code != tt.want {
+				t.Errorf("Authenticate() status = %v, want %v", res.Code, tt.want)
+			}
+			if res.Code == http.StatusUnauthorized && res.Header().Get("Content-Type") != contentType {
+				t.Errorf("Authenticate() content type = %v, want %v", res.Header().Get("Content-Type"), contentType)
+			}
+			if (caller == nil) != (tt.wantOrg == nil) || (caller != nil && caller.ID != tt.wantOrg.ID) {
+				t.Errorf("Organisation() = %+v, want %+v", caller, tt.wantOrg)
+			}
+			if role != tt.wantRole {
+				t.Errorf("Role() = %v, want %v", role, tt.wantRole)
+			}
+			if wantActor := "api-key:" + key.ID.String(); tt.wantOrg != nil && actor != wantActor {
+				t.Errorf("Actor() = %v, want %v", actor, wantActor)
+			}
+		})
+	}
+}
+
+func TestOrganisation(t *testing.T) {
+	if _, ok := Organisation(nil); ok {
+		t.Errorf("Organisation() ok = %v, want %v", ok, false)
+	}
+	if _, ok := Organisation(&api2go.APIContext{}); ok {
+		t.Errorf("Organisation() ok = %v, want %v", ok, false)
+	}
+
+	org := &model.Organisation{Name: "Organisation"}
+	ctx := &api2go.APIContext{}
+	ctx.Set(ContextKey, org)
+	if got, ok := Organisation(ctx); !ok || got != org {
+		t.Errorf("Organisation() = %v, %v, want %v", got, ok, org)
+	}
+}
+
+func TestRole(t *testing.T) {
+	if _, ok := Role(nil); ok {
+		t.Errorf("Role() ok = %v, want %v", ok, false)
+	}
+	if _, ok := Role(&api2go.APIContext{}); ok {
+		t.Errorf("Role() ok = %v, want %v", ok, false)
+	}
+
+	ctx := &api2go.APIContext{}
+	ctx.Set(RoleContextKey, model.RoleViewer)
+	if got, ok := Role(ctx); !ok || got != model.RoleViewer {
+		t.Errorf("Role() = %v, %v, want %v", got, ok, model.RoleViewer)
+	}
+}
+
+func TestActor(t *testing.T) {
+	if _, ok := Actor(nil); ok {
+		t.Errorf("Actor() ok = %v, want %v", ok, false)
+	}
+	if _, ok := Actor(&api2go.APIContext{}); ok {
+		t.Errorf("Actor() ok = %v, want %v", ok, false)
+	}
+
+	ctx := &api2go.APIContext{}
+	ctx.Set(ActorContextKey, "api-key:1")
+	if got, ok := Actor(ctx); !ok || got != "api-key:1" {
+		t.Errorf("Actor() = %v, %v, want %v", got, ok, "api-key:1")
+	}
+}
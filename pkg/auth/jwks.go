@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimum duration between loading the keys again because a token is signed with an unknown key, or because loading
+// them failed before any were loaded, so tokens with made up key ids or an unavailable source can't make the API hammer
+// the source of the keys.
+const minJWKSRefresh = 10 * time.Second
+
+// Maximum size of a JSON Web Key Set fetched from a URL.
+const maxJWKSSize = 1 << 20
+
+// Maximum duration of fetching the keys from a URL.
+const jwksFetchTimeout = 5 * time.Second
+
+// JWKS is the set of public keys bearer tokens are signed with, loaded from a local JSON Web Key Set file or URL. The
+// keys are cached for a while, after which they're loaded again, so rotated keys are picked up.
+type JWKS struct {
+	source string
+	ttl    time.Duration
+	client *http.Client
+	now    func() time.Time
+
+	mu     sync.Mutex
+	keys   map[string]crypto.PublicKey
+	loaded time.Time
+	// Error of the last time the keys were loaded, if it failed.
+	err error
+	// Closed once the keys that are being loaded are loaded, nil when they aren't being loaded.
+	loading chan struct{}
+}
+
+// Error returned for keys that aren't part of the JWKS, as opposed to errors loading the JWKS itself.
+type unknownKeyError struct {
+	kid string
+}
+
+// Error method required to implement `error`.
+func (err *unknownKeyError) Error() string {
+	return fmt.Sprintf("unknown key `%s`", err.kid)
+}
+
+// A single key of a JSON Web Key Set, see RFC 7517. Only the members of RSA and elliptic curve keys are supported.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewJWKS creates a JWKS loaded from the source, either the path of a file or an http(s) URL, which is cached for the
+// ttl. The keys are only loaded once they're needed.
+func NewJWKS(source string, ttl time.Duration) *JWKS {
+	return &JWKS{
+		source: source,
+		ttl:    ttl,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+		now:    time.Now,
+	}
+}
+
+// Key returns the key with the id, or an `*unknownKeyError` when there is no such key. Tokens without a key id can only
+// be verified when the set has a single key. The keys are loaded again when they have expired, or when the key is
+// unknown and they haven't been loaded very recently. A key that is already loaded is returned right away, while the
+// keys are loaded again in the background, otherwise Key waits for them to be loaded. When loading fails, the
+// previously loaded keys are used until loading succeeds again. Without any previously loaded keys, the error is
+// returned until the keys are loaded again, see `minJWKSRefresh`.
+func (jwks *JWKS) Key(kid string) (crypto.PublicKey, error) {
+	jwks.mu.Lock()
+	defer jwks.mu.Unlock()
+
+	age := jwks.now().Sub(jwks.loaded)
+	if jwks.loaded.IsZero() || age >= jwks.ttl || (jwks.find(kid) == nil && age >= minJWKSRefresh) {
+		loading := jwks.refresh()
+		if jwks.find(kid) == nil {
+			jwks.mu.Unlock()
+			<-loading
+			jwks.mu.Lock()
+		}
+	}
+	if jwks.keys == nil {
+		return nil, jwks.err
+	}
+
+	key := jwks.find(kid)
+	if key == nil {
+		return nil, &unknownKeyError{kid: kid}
+	}
+
+	return key, nil
+}
+
+// Start loading the keys without holding the lock, unless they're being loaded already, so requests with a known key
+// don't wait for it. Returns a channel that's closed once the keys are loaded. The lock must be held.
+func (jwks *JWKS) refresh() <-chan struct{} {
+	if jwks.loading != nil {
+		return jwks.loading
+	}
+
+	loading := make(chan struct{})
+	jwks.loading = loading
+	go func() {
+		keys, err := jwks.load()
+
+		jwks.mu.Lock()
+		defer jwks.mu.Unlock()
+		if err != nil && jwks.keys != nil {
+			logrus.WithError(err).WithField("jwks", jwks.source).Warn("cannot load jwks, using the previously loaded keys")
+		}
+		if err == nil {
+			jwks.keys = keys
+		}
+		jwks.err = err
+		jwks.loaded = jwks.now()
+		jwks.loading = nil
+		close(loading)
+	}()
+
+	return loading
+}
+
+// Find the key with the id among the loaded keys, or the only key when the id is empty.
+func (jwks *JWKS) find(kid string) crypto.PublicKey {
+	if kid == "" && len(jwks.keys) == 1 {
+		for _, key := range jwks.keys {
+			return key
+		}
+	}
+
+	return jwks.keys[kid]
+}
+
+// Load the keys from the source. Keys that aren't meant for signatures or of an unsupported type are skipped.
+func (jwks *JWKS) load() (map[string]crypto.PublicKey, error) {
+	data, err := jwks.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{"jwks": jwks.source, "kid": k.Kid}).Warn("skipping key of jwks")
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks has no usable keys")
+	}
+
+	return keys, nil
+}
+
+// Read the JSON Web Key Set from the file or URL.
+func (jwks *JWKS) read() ([]byte, error) {
+	if !strings.HasPrefix(jwks.source, "http://") && !strings.HasPrefix(jwks.source, "https://") {
+		return ioutil.ReadFile(jwks.source)
+	}
+
+	res, err := jwks.client.Get(jwks.source)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching jwks: %s", res.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxJWKSSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxJWKSSize {
+		return nil, errors.New("jwks too large")
+	}
+
+	return data, nil
+}
+
+// Create the public key of the JSON Web Key.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("rsa exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve `%s`", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type `%s`", k.Kty)
+}
+
+// Decode a base64url encoded, unsigned big-endian integer of a JSON Web Key.
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
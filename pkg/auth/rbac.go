@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+)
+
+// Operation callers perform on a resource, which their role must allow.
+type Operation string
+
+// All operations of the API. Reading covers every way of finding resources, transitions cover all actions that move a
+// payment through its lifecycle.
+const (
+	OperationRead       Operation = "read"
+	OperationCreate     Operation = "create"
+	OperationUpdate     Operation = "update"
+	OperationDelete     Operation = "delete"
+	OperationTransition Operation = "transition"
+)
+
+// The least privileged role that may perform each operation, per type of resource. Operations that aren't listed are
+// never allowed.
+var permissions = map[string]map[Operation]model.Role{
+	"payments": {
+		OperationRead:       model.RoleViewer,
+		OperationCreate:     model.RoleOperator,
+		OperationUpdate:     model.RoleOperator,
+		OperationTransition: model.RoleOperator,
+		OperationDelete:     model.RoleAdmin,
+	},
+	"organisations": {
+		OperationRead:   model.RoleViewer,
+		OperationCreate: model.RoleAdmin,
+		OperationUpdate: model.RoleAdmin,
+		OperationDelete: model.RoleAdmin,
+	},
+	// Keys can be created with any role, so managing them is as privileged as it gets.
+	"api-keys": {
+		OperationRead:   model.RoleAdmin,
+		OperationCreate: model.RoleAdmin,
+		OperationDelete: model.RoleAdmin,
+	},
+	// The audit log can only be read, its events are appended by changes to other resources.
+	"audit-events": {
+		OperationRead: model.RoleViewer,
+	},
+	// Webhooks receive the events of the whole organisation, so only admins can point them somewhere.
+	"webhooks": {
+		OperationRead:   model.RoleViewer,
+		OperationCreate: model.RoleAdmin,
+		OperationUpdate: model.RoleAdmin,
+		OperationDelete: model.RoleAdmin,
+	},
+	// Deliveries are made by the API, they can only be read.
+	"webhook-deliveries": {
+		OperationRead: model.RoleViewer,
+	},
+}
+
+// Allowed checks whether callers with the role may perform the operation on resources of the type.
+func Allowed(role model.Role, typ string, op Operation) bool {
+	required, ok := permissions[typ][op]
+	return ok && role.Includes(required)
+}
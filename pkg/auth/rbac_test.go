@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+	"testing"
+)
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		name string
+		role model.Role
+		typ  string
+		op   Operation
+		want bool
+	}{
+		{"viewer-read-payments", model.RoleViewer, "payments", OperationRead, true},
+		{"viewer-create-payments", model.RoleViewer, "payments", OperationCreate, false},
+		{"viewer-cancel-payments", model.RoleViewer, "payments", OperationTransition, false},
+		{"operator-create-payments", model.RoleOperator, "payments", OperationCreate, true},
+		{"operator-transition-payments", model.RoleOperator, "payments", OperationTransition, true},
+		{"operator-delete-payments", model.RoleOperator, "payments", OperationDelete, false},
+		{"admin-delete-payments", model.RoleAdmin, "payments", OperationDelete, true},
+		{"viewer-read-organisations", model.RoleViewer, "organisations", OperationRead, true},
+		{"operator-update-organisations", model.RoleOperator, "organisations", OperationUpdate, false},
+		{"admin-update-organisations", model.RoleAdmin, "organisations", OperationUpdate, true},
+		{"operator-read-api-keys", model.RoleOperator, "api-keys", OperationRead, false},
+		{"admin-create-api-keys", model.RoleAdmin, "api-keys", OperationCreate, true},
+		{"viewer-read-audit-events", model.RoleViewer, "audit-events", OperationRead, true},
+		{"admin-delete-audit-events", model.RoleAdmin, "audit-events", OperationDelete, false},
+		{"viewer-read-webhooks", model.RoleViewer, "webhooks", OperationRead, true},
+		{"operator-create-webhooks", model.RoleOperator, "webhooks", OperationCreate, false},
+		{"admin-update-webhooks", model.RoleAdmin, "webhooks", OperationUpdate, true},
+		{"viewer-read-webhook-deliveries", model.RoleViewer, "webhook-deliveries", OperationRead, true},
+		{"admin-create-webhook-deliveries", model.RoleAdmin, "webhook-deliveries", OperationCreate, false},
+		{"unknown-operation", model.RoleAdmin, "organisations", OperationTransition, false},
+		{"unknown-type", model.RoleAdmin, "currencies", OperationRead, false},
+		{"unknown-role", "owner", "payments", OperationRead, false},
+		{"no-role", "", "payments", OperationRead, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Allowed(tt.role, tt.typ, tt.op); got != tt.want {
+				t.Errorf("Allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/satori/go.uuid"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Scheme of the `Authorization` header bearer tokens are sent with, which is case-insensitive.
+const bearerScheme = "Bearer"
+
+// TokenConfig configures the verification of bearer tokens.
+type TokenConfig struct {
+	// Path of a JSON Web Key Set file, or an http(s) URL it's fetched from, with the keys tokens are signed with.
+	JWKS string
+	// Duration the keys are cached, before they're loaded again.
+	JWKSCacheTTL time.Duration
+	// Issuer and audience every token must have.
+	Issuer   string
+	Audience string
+	// Claims with the id of the organisation and the roles of the caller. The roles claim is either a single role or
+	// a list of them, the caller gets the most privileged one.
+	OrganisationClaim string
+	RolesClaim        string
+	// Clock skew allowed when checking the expiry and not before time of tokens.
+	Leeway time.Duration
+}
+
+// TokenVerifier verifies JSON Web Tokens signed with RS256 or ES256, which callers send as bearer tokens instead of an
+// API key, and maps their claims to the organisation and role of the caller.
+type TokenVerifier struct {
+	cfg  TokenConfig
+	keys *JWKS
+	now  func() time.Time
+}
+
+// Claims of a verified bearer token, which identify the caller.
+type Claims struct {
+	// Subject of the token, e.g. the user of the session it was issued for.
+	Subject        string
+	OrganisationID uuid.UUID
+	// The most privileged known role of the roles claim.
+	Role model.Role
+}
+
+// The header of a JSON Web Token.
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// NewTokenVerifier creates a TokenVerifier for tokens signed with the keys of the JWKS of the config.
+func NewTokenVerifier(cfg TokenConfig) *TokenVerifier {
+	return &TokenVerifier{cfg: cfg, keys: NewJWKS(cfg.JWKS, cfg.JWKSCacheTTL), now: time.Now}
+}
+
+// Verify the signature and claims of the token, returning the claims that identify the caller. Tokens that can't be
+// verified are refused with a 401 error.
+func (v *TokenVerifier) Verify(token string) (*Claims, error) {
+	claims, err := v.verifySignature(token)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.verifyClaims(claims); err != nil {
+		return nil, err
+	}
+
+	orgClaim, _ := claims[v.cfg.OrganisationClaim].(string)
+	orgID, err := uuid.FromString(orgClaim)
+	if err != nil {
+		return nil, newUnauthorizedError(fmt.Errorf("invalid %s claim", v.cfg.OrganisationClaim), "invalid bearer token")
+	}
+
+	role := highestRole(claims[v.cfg.RolesClaim])
+	if role == "" {
+		return nil, newUnauthorizedError(fmt.Errorf("no known role in %s claim", v.cfg.RolesClaim), "invalid bearer token")
+	}
+	subject, _ := claims["sub"].(string)
+
+	return &Claims{Subject: subject, OrganisationID: orgID, Role: role}, nil
+}
+
+// Verify the signature of the token, returning its claims.
+func (v *TokenVerifier) verifySignature(token string) (map[string]interface{}, error) {
+	invalid := func(err error) error {
+		return newUnauthorizedError(err, "invalid bearer token")
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalid(errors.New("malformed token"))
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalid(err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalid(err)
+	}
+
+	key, err := v.keys.Key(header.Kid)
+	if err != nil {
+		if _, ok := err.(*unknownKeyError); ok {
+			return nil, invalid(err)
+		}
+		return nil, err
+	}
+
+	// The algorithm of the header is only trusted as far as it matches the type of the key, so tokens can't pick
+	// another algorithm than the key was meant for.
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" {
+			return nil, invalid(fmt.Errorf("algorithm `%s` doesn't match rsa key", header.Alg))
+		}
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], signature); err != nil {
+			return nil, invalid(err)
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" {
+			return nil, invalid(fmt.Errorf("algorithm `%s` doesn't match ecdsa key", header.Alg))
+		}
+		if len(signature) != 64 {
+			return nil, invalid(errors.New("invalid signature length"))
+		}
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(k, hash[:], r, s) {
+			return nil, invalid(errors.New("invalid signature"))
+		}
+	default:
+		return nil, invalid(fmt.Errorf("unsupported key %T", key))
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, invalid(err)
+	}
+
+	return claims, nil
+}
+
+// Verify the issuer, audience, expiry and not before time of the token.
+func (v *TokenVerifier) verifyClaims(claims map[string]interface{}) error {
+	if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+		return newUnauthorizedError(fmt.Errorf("invalid issuer `%s`", iss), "invalid bearer token")
+	}
+	if !hasAudience(claims["aud"], v.cfg.Audience) {
+		return newUnauthorizedError(errors.New("invalid audience"), "invalid bearer token")
+	}
+
+	now := v.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return newUnauthorizedError(errors.New("missing exp claim"), "invalid bearer token")
+	}
+	if now.Add(-v.cfg.Leeway).After(time.Unix(int64(exp), 0)) {
+		return newUnauthorizedError(errors.New("token expired"), "expired bearer token")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.cfg.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return newUnauthorizedError(errors.New("token not valid yet"), "invalid bearer token")
+	}
+
+	return nil
+}
+
+// Decode a base64url encoded JSON segment of a token.
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// Whether the aud claim, either a single audience or a list of them, contains the audience.
+func hasAudience(claim interface{}, audience string) bool {
+	switch aud := claim.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// The most privileged known role of the roles claim, either a single role or a list of them. Unknown roles are
+// ignored, returns an empty role when none of the roles is known.
+func highestRole(claim interface{}) model.Role {
+	var roles []interface{}
+	switch r := claim.(type) {
+	case string:
+		roles = []interface{}{r}
+	case []interface{}:
+		roles = r
+	}
+
+	var highest model.Role
+	for _, r := range roles {
+		s, _ := r.(string)
+		if role := model.Role(s); role.IsValid() && !highest.Includes(role) {
+			highest = role
+		}
+	}
+
+	return highest
+}
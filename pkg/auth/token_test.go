@@ -0,0 +1,434 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/manyminds/api2go"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Keys generated for the tests, to sign tokens with.
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testKeys{rsa: rsaKey, ec: ecKey}
+}
+
+// The JSON Web Key Set with the public keys, with the key ids `rsa` and `ec`.
+func (keys testKeys) jwks() []byte {
+	encode := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+	data, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encode(keys.rsa.N), "e": encode(big.NewInt(int64(keys.rsa.E)))},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(keys.ec.X), "y": encode(keys.ec.Y)},
+		// Keys for encryption and of unsupported types are skipped.
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": encode(keys.rsa.N), "e": "AQAB"},
+		{"kty": "oct", "kid": "secret", "k": "c2VjcmV0"},
+	}})
+
+	return data
+}
+
+// Sign the claims with the key of the algorithm, with the key id and algorithm in the header.
+func (keys testKeys) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	switch kid {
+	case "ec":
+		r, s, err := ecdsa.Sign(rand.Reader, keys.ec, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		rBytes, sBytes := r.Bytes(), s.Bytes()
+		copy(signature[32-len(rBytes):32], rBytes)
+		copy(signature[64-len(sBytes):], sBytes)
+	default:
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, keys.rsa, crypto.SHA256, hash[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// Write the JWKS of the keys to a temporary file, returning its path.
+func writeJWKS(t *testing.T, keys testKeys) string {
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "jwks.json")
+	if err := ioutil.WriteFile(path, keys.jwks(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func newTestVerifier(jwks string, now time.Time) *TokenVerifier {
+	v := NewTokenVerifier(TokenConfig{
+		JWKS:              jwks,
+		JWKSCacheTTL:      time.Hour,
+		Issuer:            "https://sso.example.com",
+		Audience:          "payment-api",
+		OrganisationClaim: "org_id",
+		RolesClaim:        "roles",
+		Leeway:            time.Minute,
+	})
+	v.now = func() time.Time { return now }
+	v.keys.now = v.now
+
+	return v
+}
+
+func TestTokenVerifier_Verify(t *testing.T) {
+	keys := newTestKeys(t)
+	path := writeJWKS(t, keys)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	now := time.Now()
+	orgID := uuid.NewV4()
+	v := newTestVerifier(path, now)
+
+	claims := func(modify func(c map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":    "https://sso.example.com",
+			"sub":    "user",
+			"aud":    "payment-api",
+			"exp":    now.Add(time.Hour).Unix(),
+			"org_id": orgID.String(),
+			"roles":  []string{"viewer"},
+		}
+		if modify != nil {
+			modify(c)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantRole model.Role
+		wantErr  bool
+	}{
+		{"rs256", keys.sign(t, "RS256", "rsa", claims(nil)), model.RoleViewer, false},
+		{"es256", keys.sign(t, "ES256", "ec", claims(nil)), model.RoleViewer, false},
+		{"highest-role", keys.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) {
+			c["roles"] = []string{"viewer", "admin", "owner", "operator"}
+		})), model.RoleAdmin, false},
+		{"single-role", keys.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { c["roles"] = "operator" })), model.RoleOperator, false},
+		{"audiences", keys.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) {
+			c["aud"] = []string{"other", "payment-api"}
+		})), model.RoleViewer, false},
+		{"expired-within-leeway", keys.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) {
+			c["exp"] = now.Add(-30 * time.Second).Unix()
+		})), model.RoleViewer, false},
+		{"expired", keys.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) {
+			c["exp"] = now.Add(-2 * time.Minute).Unix()
+		})), "", true},
+		{"missing-exp", keys.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { delete(c, "exp") })), "", true},
+		{"not-before", keys.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) {
+			c["nbf"] = now.Add(time.Hour).Unix()
+		})), "", true},
+		{"issuer", keys.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { c["iss"] = "https://evil" })), "", true},
+		{"audience", keys.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { c["aud"] = []string{"other"} })), "", true},
+		{"missing-organisation", keys.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { delete(c, "org_id") })), "", true},
+		{"invalid-organisation", keys.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { c["org_id"] = "abc" })), "", true},
+		{"unknown-role", keys.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { c["roles"] = []string{"owner"} })), "", true},
+		{"missing-roles", keys.sign(t, "RS256", "rsa", claims(func(c map[string]interface{}) { delete(c, "roles") })), "", true},
+		{"unknown-key", keys.sign(t, "RS256", "other", claims(nil)), "", true},
+		{"encryption-key", keys.sign(t, "RS256", "enc", claims(nil)), "", true},
+		{"algorithm-mismatch", keys.sign(t, "ES256", "rsa", claims(nil)), "", true},
+		{"none", strings.Join(strings.Split(keys.sign(t, "none", "rsa", claims(nil)), ".")[:2], ".") + ".", "", true},
+		{"tampered", tamper(keys.sign(t, "RS256", "rsa", claims(nil))), "", true},
+		{"malformed", "not-a-token", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Verify(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("TokenVerifier.Verify() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				if _, ok := err.(api2go.HTTPError); !ok {
+					t.Errorf("TokenVerifier.Verify() error = %v, want api2go.HTTPError", err)
+				}
+				return
+			}
+			want := &Claims{Subject: "user", OrganisationID: orgID, Role: tt.wantRole}
+			if *got != *want {
+				t.Errorf("TokenVerifier.Verify() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// Replace the claims of a token with other claims, keeping the original signature.
+func tamper(token string) string {
+	parts := strings.Split(token, ".")
+	payload, _ := json.Marshal(map[string]interface{}{"roles": "admin"})
+	parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+
+	return strings.Join(parts, ".")
+}
+
+// Wait until the keys that are being loaded in the background, if any, are loaded.
+func waitLoaded(jwks *JWKS) {
+	jwks.mu.Lock()
+	loading := jwks.loading
+	jwks.mu.Unlock()
+	if loading != nil {
+		<-loading
+	}
+}
+
+func TestJWKS_Key(t *testing.T) {
+	keys := newTestKeys(t)
+	var fetches int32
+	var failing atomic.Value
+	failing.Store(false)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		if failing.Load().(bool) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(keys.jwks())
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	jwks := NewJWKS(server.URL, time.Hour)
+	jwks.now = func() time.Time { return now }
+
+	steps := []struct {
+		name        string
+		after       time.Duration
+		kid         string
+		fail        bool
+		wantFetches int32
+		wantErr     bool
+	}{
+		{"first", 0, "rsa", false, 1, false},
+		{"cached", time.Minute, "ec", false, 1, false},
+		{"unknown-refreshes", time.Minute, "other", false, 2, true},
+		{"unknown-rate-limited", time.Second, "other", false, 2, true},
+		{"expired", time.Hour, "rsa", false, 3, false},
+		{"failing-uses-cache", time.Hour, "rsa", true, 4, false},
+		{"failing-unknown", time.Minute, "other", true, 5, true},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			now = now.Add(step.after)
+			failing.Store(step.fail)
+
+			key, err := jwks.Key(step.kid)
+			waitLoaded(jwks)
+			if (err != nil) != step.wantErr {
+				t.Errorf("JWKS.Key() error = %v, wantErr %v", err, step.wantErr)
+			}
+			if err == nil && key == nil {
+				t.Errorf("JWKS.Key() = %v, want a key", key)
+			}
+			if got := atomic.LoadInt32(&fetches); got != step.wantFetches {
+				t.Errorf("JWKS.Key() fetches = %v, want %v", got, step.wantFetches)
+			}
+		})
+	}
+
+	// Without any keys loaded, failing to load them is an error of the API instead of the token, and they're only loaded
+	// again once the minimum duration between refreshes has passed.
+	failing.Store(true)
+	atomic.StoreInt32(&fetches, 0)
+	unloaded := NewJWKS(server.URL, time.Hour)
+	unloaded.now = func() time.Time { return now }
+	retries := []struct {
+		name        string
+		after       time.Duration
+		fail        bool
+		wantFetches int32
+		wantErr     bool
+	}{
+		{"failing", 0, true, 1, true},
+		{"failing-rate-limited", time.Second, false, 1, true},
+		{"recovered", minJWKSRefresh, false, 2, false},
+	}
+	for _, retry := range retries {
+		t.Run(retry.name, func(t *testing.T) {
+			now = now.Add(retry.after)
+			failing.Store(retry.fail)
+
+			_, err := unloaded.Key("rsa")
+			waitLoaded(unloaded)
+			if (err != nil) != retry.wantErr {
+				t.Errorf("JWKS.Key() error = %v, wantErr %v", err, retry.wantErr)
+			}
+			if _, ok := err.(*unknownKeyError); ok {
+				t.Errorf("JWKS.Key() error = %v, want an error loading the keys", err)
+			}
+			if got := atomic.LoadInt32(&fetches); got != retry.wantFetches {
+				t.Errorf("JWKS.Key() fetches = %v, want %v", got, retry.wantFetches)
+			}
+		})
+	}
+}
+
+// Key sets fetched from a URL are only read up to a maximum size.
+func TestJWKS_KeyTooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"keys":[],"padding":"`))
+		w.Write(bytes.Repeat([]byte("a"), maxJWKSSize))
+		w.Write([]byte(`"}`))
+	}))
+	defer server.Close()
+
+	if _, err := NewJWKS(server.URL, time.Hour).Key("rsa"); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("JWKS.Key() error = %v, want an error about the size", err)
+	}
+}
+
+// Expired keys are loaded again in the background, without holding up the tokens signed with a key that's loaded.
+func TestJWKS_KeyRefresh(t *testing.T) {
+	keys := newTestKeys(t)
+	var fetches int32
+	blocked := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			<-blocked
+		}
+		w.Write(keys.jwks())
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	jwks := NewJWKS(server.URL, time.Hour)
+	jwks.now = func() time.Time { return now }
+	if _, err := jwks.Key("rsa"); err != nil {
+		t.Fatalf("JWKS.Key() error = %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if key, err := jwks.Key("ec"); err != nil || key == nil {
+			t.Errorf("JWKS.Key() = %v, %v, want the loaded key", key, err)
+		}
+	}
+	close(blocked)
+	waitLoaded(jwks)
+
+	// The keys are only loaded once at a time.
+	if got := atomic.LoadInt32(&fetches); got != 2 {
+		t.Errorf("JWKS.Key() fetches = %v, want %v", got, 2)
+	}
+}
+
+func TestAuthenticate_BearerToken(t *testing.T) {
+	keys := newTestKeys(t)
+	path := writeJWKS(t, keys)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	repos := repository.NewMemory()
+	org, _ := newKey(t, repos, "Organisation", model.RoleAdmin)
+	deletedOrg, _ := newKey(t, repos, "Deleted", model.RoleAdmin)
+	repos.Organisations.Delete(deletedOrg)
+
+	now := time.Now()
+	token := func(orgID uuid.UUID, roles ...string) string {
+		return "Bearer " + keys.sign(t, "ES256", "ec", map[string]interface{}{
+			"iss":    "https://sso.example.com",
+			"aud":    "payment-api",
+			"sub":    "user",
+			"exp":    now.Add(time.Hour).Unix(),
+			"org_id": orgID.String(),
+			"roles":  roles,
+		})
+	}
+
+	var caller *model.Organisation
+	var role model.Role
+	var actor string
+	handle := func(w http.ResponseWriter, r *http.Request) {
+		ctx := &api2go.APIContext{}
+		Middleware(ctx, w, r)
+		caller, _ = Organisation(ctx)
+		role, _ = Role(ctx)
+		actor, _ = Actor(ctx)
+	}
+
+	tests := []struct {
+		name          string
+		tokens        *TokenVerifier
+		authorization string
+		want          int
+		wantRole      model.Role
+	}{
+		{"valid", newTestVerifier(path, now), token(org.ID, "operator"), http.StatusOK, model.RoleOperator},
+		{"lowercase-scheme", newTestVerifier(path, now), "bearer" + strings.TrimPrefix(token(org.ID, "viewer"), "Bearer"), http.StatusOK, model.RoleViewer},
+		{"unknown-organisation", newTestVerifier(path, now), token(uuid.NewV4(), "admin"), http.StatusUnauthorized, ""},
+		{"deleted-organisation", newTestVerifier(path, now), token(deletedOrg.ID, "admin"), http.StatusUnauthorized, ""},
+		{"expired", newTestVerifier(path, now.Add(2*time.Hour)), token(org.ID, "admin"), http.StatusUnauthorized, ""},
+		{"disabled", nil, token(org.ID, "admin"), http.StatusUnauthorized, ""},
+		{"other-scheme", newTestVerifier(path, now), "Basic dXNlcjpwYXNz", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller, role, actor = nil, "", ""
+			req := httptest.NewRequest(http.MethodGet, "/v0/payments", nil)
+			req.Header.Set(AuthorizationHeader, tt.authorization)
+			res := httptest.NewRecorder()
+			Authenticate(repos, tt.tokens, http.HandlerFunc(handle)).ServeHTTP(res, req)
+
+			if res.Code != tt.want {
+				t.Errorf("Authenticate() status = %v, want %v", res.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && (caller == nil || caller.ID != org.ID) {
+				t.Errorf("Organisation() = %+v, want %+v", caller, org)
+			}
+			if tt.want == http.StatusOK && actor != "token:user" {
+				t.Errorf("Actor() = %v, want %v", actor, "token:user")
+			}
+			if role != tt.wantRole {
+				t.Errorf("Role() = %v, want %v", role, tt.wantRole)
+			}
+		})
+	}
+}
@@ -0,0 +1,560 @@
+// Package config loads the configuration of the payment API. Every setting has a default, which can be overridden by
+// a YAML file, environment variables and command-line flags, in that order of precedence: flags override environment
+// variables, which override the file, which overrides the defaults.
+//
+// The YAML file is read from the path in the `-config` flag or the `CONFIG_FILE` environment variable. See
+// `configs/payment-api.yml` for an example with all settings.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Value printed instead of secrets.
+const redacted = "[redacted]"
+
+// Log levels, from most to least verbose.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// Formats of log lines. JSON is meant for log aggregation, text for reading logs locally.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Drivers of the database. Postgres stores all resources, while memory keeps them in memory until the API exits, for
+// local demos without a database.
+const (
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
+// Number of database connections reserved for the background workers, the outbox dispatcher and the webhook worker,
+// which use a single connection each. Requests share the other connections.
+const ReservedConns = 2
+
+// Sinks the domain events in the outbox are dispatched to, besides the webhooks. None only dispatches them to the
+// webhooks, stdout and file also write them as JSON lines for local use.
+const (
+	SinkNone   = "none"
+	SinkStdout = "stdout"
+	SinkFile   = "file"
+)
+
+// All sinks of the outbox.
+var sinks = []string{SinkNone, SinkStdout, SinkFile}
+
+// Exporters of the spans of requests. None doesn't export them, OTLP exports them to a collector and stdout writes
+// them as JSON for local debugging.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// All exporters of spans.
+var exporters = []string{ExporterNone, ExporterOTLP, ExporterStdout}
+
+// SSL modes supported by the Postgres driver, from least to most secure.
+var sslModes = []string{"disable", "require", "verify-ca", "verify-full"}
+
+// Config of the payment API.
+type Config struct {
+	Server   Server   `yaml:"server"`
+	Database Database `yaml:"database"`
+	Auth     Auth     `yaml:"auth"`
+	Outbox   Outbox   `yaml:"outbox"`
+	Webhooks Webhooks `yaml:"webhooks"`
+	Log      Log      `yaml:"log"`
+	Tracing  Tracing  `yaml:"tracing"`
+}
+
+// Server configures the HTTP server of the API.
+type Server struct {
+	Port int `yaml:"port"`
+	// Maximum duration for reading a request, including its body.
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// Maximum duration for writing a response, from the end of reading the request.
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// Maximum duration an idle keep-alive connection is kept open.
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// Port of the admin server with the Prometheus metrics, which must not be reachable through the API.
+	AdminPort int `yaml:"admin_port"`
+}
+
+// Database configures the connection to Postgres and the pool of connections shared by all requests.
+type Database struct {
+	// Driver of the database, either `postgres` or `memory`. None of the other settings are used by `memory`.
+	Driver string `yaml:"driver"`
+
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Name     string `yaml:"name"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// TLS of the connection, one of `disable`, `require`, `verify-ca` and `verify-full`.
+	SSLMode string `yaml:"ssl_mode"`
+	// Paths of the root certificate to verify the server with, and the certificate and key of the client.
+	SSLRootCert string `yaml:"ssl_root_cert"`
+	SSLCert     string `yaml:"ssl_cert"`
+	SSLKey      string `yaml:"ssl_key"`
+
+	// Maximum duration for connecting to the database, at a precision of seconds.
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	// Maximum duration of a single statement, aborted by Postgres when it takes longer.
+	StatementTimeout time.Duration `yaml:"statement_timeout"`
+
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	// Maximum duration a request waits for a connection when all are in use, before it fails with a 503.
+	AcquireTimeout time.Duration `yaml:"acquire_timeout"`
+
+	// Directory of the versioned SQL migrations.
+	Migrations string `yaml:"migrations"`
+}
+
+// Auth configures how callers authenticate. API keys are always accepted, bearer tokens only when configured.
+type Auth struct {
+	JWT JWT `yaml:"jwt"`
+}
+
+// JWT configures the verification of bearer tokens, which are JSON Web Tokens signed with RS256 or ES256. Bearer tokens
+// are disabled unless a JWKS is configured.
+type JWT struct {
+	// Path of a JSON Web Key Set file, or an http(s) URL it's fetched from, with the keys tokens are signed with.
+	JWKS string `yaml:"jwks"`
+	// Duration the keys are cached, before they're loaded again to pick up rotated keys.
+	JWKSCacheTTL time.Duration `yaml:"jwks_cache_ttl"`
+	// Issuer and audience every token must have.
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// Claims with the id of the organisation and the roles of the caller.
+	OrganisationClaim string `yaml:"organisation_claim"`
+	RolesClaim        string `yaml:"roles_claim"`
+	// Clock skew allowed when checking the expiry of tokens.
+	Leeway time.Duration `yaml:"leeway"`
+}
+
+// Outbox configures the dispatching of the domain events of payments and organisations to downstream systems.
+type Outbox struct {
+	// Sink the events are dispatched to besides the webhooks, one of `none`, `stdout` and `file`.
+	Sink string `yaml:"sink"`
+	// Path of the file the events are appended to, for the `file` sink.
+	File string `yaml:"file"`
+	// Duration between looking for pending events.
+	Interval time.Duration `yaml:"interval"`
+	// Maximum number of events dispatched in a single transaction.
+	BatchSize int `yaml:"batch_size"`
+}
+
+// Webhooks configures the delivery of domain events to the webhooks of organisations.
+type Webhooks struct {
+	// Duration between looking for due deliveries.
+	Interval time.Duration `yaml:"interval"`
+	// Maximum number of deliveries attempted at a time.
+	BatchSize int `yaml:"batch_size"`
+	// Maximum duration of a single attempt, including reading the response.
+	Timeout time.Duration `yaml:"timeout"`
+	// Number of attempts after which a delivery fails permanently.
+	MaxAttempts int `yaml:"max_attempts"`
+	// Delay before the first retry of a failed delivery, doubling for every retry up to the maximum.
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	// Number of failed attempts in a row after which a webhook is disabled.
+	DisableAfter int `yaml:"disable_after"`
+	// Whether webhooks may use http URLs and receive deliveries on loopback and private addresses. Only for local use,
+	// as it lets callers make the API post to internal services.
+	AllowInsecure bool `yaml:"allow_insecure"`
+}
+
+// Log configures the logging of the API.
+type Log struct {
+	// Minimum level of logged messages, one of `debug`, `info`, `warn` and `error`. Database queries are logged at the
+	// debug level.
+	Level string `yaml:"level"`
+	// Format of every log line, either `json` or `text`.
+	Format string `yaml:"format"`
+}
+
+// Tracing configures the tracing of requests and their database queries with OpenTelemetry.
+type Tracing struct {
+	// Exporter of the spans, one of `none`, `otlp` and `stdout`.
+	Exporter string `yaml:"exporter"`
+	// URL of the OTLP/HTTP endpoint of the collector, for the `otlp` exporter.
+	Endpoint string `yaml:"endpoint"`
+	// Name of the API in the traces.
+	ServiceName string `yaml:"service_name"`
+}
+
+// Default returns the Config used for all settings that aren't configured otherwise.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:         80,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+			IdleTimeout:  2 * time.Minute,
+			AdminPort:    9090,
+		},
+		Database: Database{
+			Driver:           DriverPostgres,
+			Host:             "localhost",
+			Port:             5432,
+			Name:             "api",
+			Username:         "payment-api",
+			SSLMode:          "require",
+			ConnectTimeout:   5 * time.Second,
+			StatementTimeout: 30 * time.Second,
+			MaxOpenConns:     25,
+			MaxIdleConns:     5,
+			ConnMaxLifetime:  5 * time.Minute,
+			AcquireTimeout:   5 * time.Second,
+			Migrations:       "migrations",
+		},
+		Auth: Auth{
+			JWT: JWT{
+				JWKSCacheTTL:      time.Hour,
+				OrganisationClaim: "org_id",
+				RolesClaim:        "roles",
+				Leeway:            time.Minute,
+			},
+		},
+		Outbox: Outbox{
+			Sink:      SinkNone,
+			Interval:  time.Second,
+			BatchSize: 100,
+		},
+		Webhooks: Webhooks{
+			Interval:     5 * time.Second,
+			BatchSize:    50,
+			Timeout:      10 * time.Second,
+			MaxAttempts:  8,
+			Backoff:      30 * time.Second,
+			MaxBackoff:   time.Hour,
+			DisableAfter: 20,
+		},
+		Log: Log{
+			Level:  LevelInfo,
+			Format: FormatJSON,
+		},
+		Tracing: Tracing{
+			Exporter:    ExporterNone,
+			Endpoint:    "http://localhost:4318",
+			ServiceName: "payment-api",
+		},
+	}
+}
+
+// A single setting of the Config, with the environment variable and flag it can be set with.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	// Pointer to the field of the Config.
+	value interface{}
+	// Whether the value must be redacted when printed.
+	secret bool
+}
+
+// All settings of the Config.
+func (cfg *Config) settings() []setting {
+	server, db, jwt, outbox, webhooks, log := &cfg.Server, &cfg.Database, &cfg.Auth.JWT, &cfg.Outbox, &cfg.Webhooks, &cfg.Log
+	tracing := &cfg.Tracing
+
+	return []setting{
+		{env: "PORT", flag: "port", usage: "port the API listens on", value: &server.Port},
+		{env: "SERVER_READ_TIMEOUT", flag: "read-timeout", usage: "maximum duration for reading a request", value: &server.ReadTimeout},
+		{env: "SERVER_WRITE_TIMEOUT", flag: "write-timeout", usage: "maximum duration for writing a response", value: &server.WriteTimeout},
+		{env: "SERVER_IDLE_TIMEOUT", flag: "idle-timeout", usage: "maximum duration of idle keep-alive connections", value: &server.IdleTimeout},
+		{env: "ADMIN_PORT", flag: "admin-port", usage: "port of the admin server with the metrics", value: &server.AdminPort},
+
+		{env: "DB_DRIVER", flag: "db-driver", usage: "driver of the database: postgres, or memory for local demos", value: &db.Driver},
+		{env: "DB_HOST", flag: "db-host", usage: "host of the database", value: &db.Host},
+		{env: "DB_PORT", flag: "db-port", usage: "port of the database", value: &db.Port},
+		{env: "DB_DATABASE", flag: "db-name", usage: "name of the database", value: &db.Name},
+		{env: "DB_USERNAME", flag: "db-username", usage: "username to connect to the database with", value: &db.Username},
+		{env: "DB_PASSWORD", flag: "db-password", usage: "password to connect to the database with", value: &db.Password, secret: true},
+		{env: "DB_SSLMODE", flag: "db-ssl-mode", usage: "TLS of the database connection: " + strings.Join(sslModes, ", "), value: &db.SSLMode},
+		{env: "DB_SSLROOTCERT", flag: "db-ssl-root-cert", usage: "path of the root certificate of the database", value: &db.SSLRootCert},
+		{env: "DB_SSLCERT", flag: "db-ssl-cert", usage: "path of the client certificate", value: &db.SSLCert},
+		{env: "DB_SSLKEY", flag: "db-ssl-key", usage: "path of the key of the client certificate", value: &db.SSLKey},
+		{env: "DB_CONNECT_TIMEOUT", flag: "db-connect-timeout", usage: "maximum duration for connecting to the database", value: &db.ConnectTimeout},
+		{env: "DB_STATEMENT_TIMEOUT", flag: "db-statement-timeout", usage: "maximum duration of a statement", value: &db.StatementTimeout},
+		{env: "DB_MAX_OPEN_CONNS", flag: "db-max-open-conns", usage: "maximum number of open database connections", value: &db.MaxOpenConns},
+		{env: "DB_MAX_IDLE_CONNS", flag: "db-max-idle-conns", usage: "maximum number of idle database connections", value: &db.MaxIdleConns},
+		{env: "DB_CONN_MAX_LIFETIME", flag: "db-conn-max-lifetime", usage: "maximum duration a database connection is reused", value: &db.ConnMaxLifetime},
+		{env: "DB_ACQUIRE_TIMEOUT", flag: "db-acquire-timeout", usage: "maximum duration to wait for a database connection", value: &db.AcquireTimeout},
+		{env: "DB_MIGRATIONS", flag: "db-migrations", usage: "directory of the SQL migrations", value: &db.Migrations},
+
+		{env: "JWT_JWKS", flag: "jwt-jwks", usage: "path or URL of the JWKS bearer tokens are verified with, disabled when empty", value: &jwt.JWKS},
+		{env: "JWT_JWKS_CACHE_TTL", flag: "jwt-jwks-cache-ttl", usage: "duration the JWKS is cached", value: &jwt.JWKSCacheTTL},
+		{env: "JWT_ISSUER", flag: "jwt-issuer", usage: "issuer of bearer tokens", value: &jwt.Issuer},
+		{env: "JWT_AUDIENCE", flag: "jwt-audience", usage: "audience of bearer tokens", value: &jwt.Audience},
+		{env: "JWT_ORGANISATION_CLAIM", flag: "jwt-organisation-claim", usage: "claim of bearer tokens with the organisation id", value: &jwt.OrganisationClaim},
+		{env: "JWT_ROLES_CLAIM", flag: "jwt-roles-claim", usage: "claim of bearer tokens with the roles", value: &jwt.RolesClaim},
+		{env: "JWT_LEEWAY", flag: "jwt-leeway", usage: "clock skew allowed when checking the expiry of bearer tokens", value: &jwt.Leeway},
+
+		{env: "OUTBOX_SINK", flag: "outbox-sink", usage: "sink the domain events are dispatched to besides the webhooks: " + strings.Join(sinks, ", "), value: &outbox.Sink},
+		{env: "OUTBOX_FILE", flag: "outbox-file", usage: "path of the file the domain events are appended to", value: &outbox.File},
+		{env: "OUTBOX_INTERVAL", flag: "outbox-interval", usage: "duration between looking for pending domain events", value: &outbox.Interval},
+		{env: "OUTBOX_BATCH_SIZE", flag: "outbox-batch-size", usage: "maximum number of domain events dispatched at a time", value: &outbox.BatchSize},
+
+		{env: "WEBHOOKS_INTERVAL", flag: "webhooks-interval", usage: "duration between looking for due webhook deliveries", value: &webhooks.Interval},
+		{env: "WEBHOOKS_BATCH_SIZE", flag: "webhooks-batch-size", usage: "maximum number of webhook deliveries attempted at a time", value: &webhooks.BatchSize},
+		{env: "WEBHOOKS_TIMEOUT", flag: "webhooks-timeout", usage: "maximum duration of a webhook delivery attempt", value: &webhooks.Timeout},
+		{env: "WEBHOOKS_MAX_ATTEMPTS", flag: "webhooks-max-attempts", usage: "number of attempts after which a webhook delivery fails", value: &webhooks.MaxAttempts},
+		{env: "WEBHOOKS_BACKOFF", flag: "webhooks-backoff", usage: "delay before the first retry of a webhook delivery", value: &webhooks.Backoff},
+		{env: "WEBHOOKS_MAX_BACKOFF", flag: "webhooks-max-backoff", usage: "maximum delay between retries of a webhook delivery", value: &webhooks.MaxBackoff},
+		{env: "WEBHOOKS_DISABLE_AFTER", flag: "webhooks-disable-after", usage: "number of failed attempts in a row after which a webhook is disabled", value: &webhooks.DisableAfter},
+		{env: "WEBHOOKS_ALLOW_INSECURE", flag: "webhooks-allow-insecure", usage: "allow http webhooks and deliveries to private addresses, only for local use", value: &webhooks.AllowInsecure},
+
+		{env: "LOG_LEVEL", flag: "log-level", usage: "minimum log level: debug, info, warn, error", value: &log.Level},
+		{env: "LOG_FORMAT", flag: "log-format", usage: "format of log lines: json, text", value: &log.Format},
+
+		{env: "TRACING_EXPORTER", flag: "tracing-exporter", usage: "exporter of the spans of requests: " + strings.Join(exporters, ", "), value: &tracing.Exporter},
+		{env: "TRACING_ENDPOINT", flag: "tracing-endpoint", usage: "URL of the OTLP/HTTP endpoint spans are exported to", value: &tracing.Endpoint},
+		{env: "TRACING_SERVICE_NAME", flag: "tracing-service-name", usage: "name of the API in traces", value: &tracing.ServiceName},
+	}
+}
+
+// Load the Config from the YAML file, environment variables and command-line arguments, on top of the defaults. The
+// environment is read with `getenv`, usually `os.Getenv`. Returns the arguments after the flags, e.g. a subcommand.
+// The loaded Config is not validated, see `Validate`.
+func Load(name string, args []string, getenv func(string) string) (*Config, []string, error) {
+	cfg := Default()
+	settings := cfg.settings()
+
+	// Flags are parsed first to know the path of the file, but only applied after the file and environment.
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	file := flags.String("config", getenv("CONFIG_FILE"), "path of a YAML config file (env CONFIG_FILE)")
+	for _, s := range settings {
+		flags.String(s.flag, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *file != "" {
+		data, err := ioutil.ReadFile(*file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, nil, fmt.Errorf("invalid config file `%s`: %v", *file, err)
+		}
+	}
+
+	for _, s := range settings {
+		if env := getenv(s.env); env != "" {
+			if err := set(s.value, env); err != nil {
+				return nil, nil, fmt.Errorf("invalid value for %s: %v", s.env, err)
+			}
+		}
+	}
+
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && err == nil {
+				if setErr := set(s.value, f.Value.String()); setErr != nil {
+					err = fmt.Errorf("invalid value for -%s: %v", s.flag, setErr)
+				}
+			}
+		}
+	})
+
+	return cfg, flags.Args(), err
+}
+
+// Set the value of a setting from its string representation.
+func set(value interface{}, s string) error {
+	switch v := value.(type) {
+	case *string:
+		*v = s
+	case *int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("`%s` is not a number", s)
+		}
+		*v = n
+	case *bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("`%s` is not a boolean, e.g. `true` or `false`", s)
+		}
+		*v = b
+	case *time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("`%s` is not a duration, e.g. `30s` or `5m`", s)
+		}
+		*v = d
+	default:
+		return fmt.Errorf("unsupported type %T", value)
+	}
+
+	return nil
+}
+
+// Validate the Config, reporting all invalid settings at once.
+func (cfg *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(cfg.Server.Port > 0 && cfg.Server.Port < 65536, "server.port must be from 1 to 65535")
+	check(cfg.Server.ReadTimeout >= 0, "server.read_timeout must not be negative")
+	check(cfg.Server.WriteTimeout >= 0, "server.write_timeout must not be negative")
+	check(cfg.Server.IdleTimeout >= 0, "server.idle_timeout must not be negative")
+	check(cfg.Server.AdminPort > 0 && cfg.Server.AdminPort < 65536, "server.admin_port must be from 1 to 65535")
+	check(cfg.Server.AdminPort != cfg.Server.Port, "server.admin_port must differ from server.port")
+
+	db := cfg.Database
+	check(db.Driver == DriverPostgres || db.Driver == DriverMemory, "database.driver must be one of %s, %s", DriverPostgres, DriverMemory)
+	check(db.Host != "", "database.host is required")
+	check(db.Port > 0 && db.Port < 65536, "database.port must be from 1 to 65535")
+	check(db.Name != "", "database.name is required")
+	check(db.Username != "", "database.username is required")
+	check(contains(sslModes, db.SSLMode), "database.ssl_mode must be one of %s", strings.Join(sslModes, ", "))
+	check((db.SSLCert == "") == (db.SSLKey == ""), "database.ssl_cert and database.ssl_key must be set together")
+	check(db.ConnectTimeout >= 0, "database.connect_timeout must not be negative")
+	check(db.StatementTimeout >= 0, "database.statement_timeout must not be negative")
+	check(db.MaxOpenConns >= 0, "database.max_open_conns must not be negative")
+	check(db.MaxOpenConns <= 0 || db.MaxOpenConns > ReservedConns,
+		"database.max_open_conns must be more than the %d connections reserved for background workers", ReservedConns)
+	check(db.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	check(db.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	check(db.AcquireTimeout >= 0, "database.acquire_timeout must not be negative")
+	check(db.Migrations != "", "database.migrations is required")
+
+	if jwt := cfg.Auth.JWT; jwt.JWKS != "" {
+		check(jwt.JWKSCacheTTL > 0, "auth.jwt.jwks_cache_ttl must be positive")
+		check(jwt.Issuer != "", "auth.jwt.issuer is required")
+		check(jwt.Audience != "", "auth.jwt.audience is required")
+		check(jwt.OrganisationClaim != "", "auth.jwt.organisation_claim is required")
+		check(jwt.RolesClaim != "", "auth.jwt.roles_claim is required")
+		check(jwt.Leeway >= 0, "auth.jwt.leeway must not be negative")
+	}
+
+	check(contains(sinks, cfg.Outbox.Sink), "outbox.sink must be one of %s", strings.Join(sinks, ", "))
+	check(cfg.Outbox.Sink != SinkFile || cfg.Outbox.File != "", "outbox.file is required for the file sink")
+	check(cfg.Outbox.Interval > 0, "outbox.interval must be positive")
+	check(cfg.Outbox.BatchSize > 0, "outbox.batch_size must be positive")
+
+	webhooks := cfg.Webhooks
+	check(webhooks.Interval > 0, "webhooks.interval must be positive")
+	check(webhooks.BatchSize > 0, "webhooks.batch_size must be positive")
+	check(webhooks.Timeout > 0, "webhooks.timeout must be positive")
+	check(webhooks.MaxAttempts > 0, "webhooks.max_attempts must be positive")
+	check(webhooks.Backoff > 0, "webhooks.backoff must be positive")
+	check(webhooks.MaxBackoff >= webhooks.Backoff, "webhooks.max_backoff must not be less than webhooks.backoff")
+	check(webhooks.DisableAfter > 0, "webhooks.disable_after must be positive")
+
+	levels := []string{LevelDebug, LevelInfo, LevelWarn, LevelError}
+	check(contains(levels, cfg.Log.Level), "log.level must be one of %s", strings.Join(levels, ", "))
+	formats := []string{FormatJSON, FormatText}
+	check(contains(formats, cfg.Log.Format), "log.format must be one of %s", strings.Join(formats, ", "))
+
+	tracing := cfg.Tracing
+	check(contains(exporters, tracing.Exporter), "tracing.exporter must be one of %s", strings.Join(exporters, ", "))
+	if tracing.Exporter == ExporterOTLP {
+		endpoint, err := url.Parse(tracing.Endpoint)
+		check(err == nil && (endpoint.Scheme == "http" || endpoint.Scheme == "https") && endpoint.Host != "", "tracing.endpoint must be an http(s) URL")
+	}
+	check(tracing.ServiceName != "", "tracing.service_name is required")
+
+	if problems != nil {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// String returns the Config as YAML, with all secrets redacted, so it can be logged safely.
+func (cfg *Config) String() string {
+	printed := *cfg
+	for _, s := range printed.settings() {
+		if v, ok := s.value.(*string); ok && s.secret && *v != "" {
+			*v = redacted
+		}
+	}
+
+	data, err := yaml.Marshal(&printed)
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(data)
+}
+
+// DSN returns the data source name to connect to Postgres with.
+func (db Database) DSN() string {
+	params := [][2]string{
+		{"host", db.Host},
+		{"port", strconv.Itoa(db.Port)},
+		{"dbname", db.Name},
+		{"user", db.Username},
+		{"password", db.Password},
+		{"sslmode", db.SSLMode},
+		{"sslrootcert", db.SSLRootCert},
+		{"sslcert", db.SSLCert},
+		{"sslkey", db.SSLKey},
+	}
+	if db.ConnectTimeout > 0 {
+		// Postgres only supports whole seconds, so round up to not end up without a timeout.
+		seconds := (db.ConnectTimeout + time.Second - 1) / time.Second
+		params = append(params, [2]string{"connect_timeout", strconv.Itoa(int(seconds))})
+	}
+	if db.StatementTimeout > 0 {
+		// Unknown parameters are sent to Postgres as run-time parameters of the session.
+		params = append(params, [2]string{"statement_timeout", strconv.FormatInt(int64(db.StatementTimeout/time.Millisecond), 10)})
+	}
+
+	parts := make([]string, 0, len(params))
+	for _, param := range params {
+		if param[1] != "" {
+			parts = append(parts, param[0]+"="+quote(param[1]))
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Quote a value of a data source name, when it contains characters that would otherwise be misinterpreted.
+func quote(value string) string {
+	if !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	return "'" + replacer.Replace(value) + "'"
+}
+
+// Whether the values contain the value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
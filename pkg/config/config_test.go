@@ -0,0 +1,313 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Mock the environment with the given variables.
+func env(vars map[string]string) func(string) string {
+	return func(name string) string {
+		return vars[name]
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	file := writeFile(t, "server:\n  port: 8080\ndatabase:\n  host: file-host\n  name: file-name\nlog:\n  level: warn\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		want    func(cfg *Config)
+		wantErr bool
+	}{
+		{"defaults", nil, nil, func(cfg *Config) {}, false},
+		{
+			"file",
+			[]string{"-config", file},
+			nil,
+			func(cfg *Config) {
+				cfg.Server.Port = 8080
+				cfg.Database.Host = "file-host"
+				cfg.Database.Name = "file-name"
+				cfg.Log.Level = LevelWarn
+			},
+			false,
+		},
+		{
+			"file-from-env",
+			nil,
+			map[string]string{"CONFIG_FILE": file},
+			func(cfg *Config) {
+				cfg.Server.Port = 8080
+				cfg.Database.Host = "file-host"
+				cfg.Database.Name = "file-name"
+				cfg.Log.Level = LevelWarn
+			},
+			false,
+		},
+		{
+			"env-overrides-file",
+			[]string{"-config", file},
+			map[string]string{"DB_HOST": "env-host", "DB_ACQUIRE_TIMEOUT": "1s", "DB_MAX_OPEN_CONNS": "10"},
+			func(cfg *Config) {
+				cfg.Server.Port = 8080
+				cfg.Database.Host = "env-host"
+				cfg.Database.Name = "file-name"
+				cfg.Database.AcquireTimeout = time.Second
+				cfg.Database.MaxOpenConns = 10
+				cfg.Log.Level = LevelWarn
+			},
+			false,
+		},
+		{
+			"flags-override-env",
+			[]string{"-config", file, "-db-host", "flag-host", "-log-level=debug"},
+			map[string]string{"DB_HOST": "env-host", "DB_SSLMODE": "verify-full"},
+			func(cfg *Config) {
+				cfg.Server.Port = 8080
+				cfg.Database.Host = "flag-host"
+				cfg.Database.Name = "file-name"
+				cfg.Database.SSLMode = "verify-full"
+				cfg.Log.Level = LevelDebug
+			},
+			false,
+		},
+		{
+			"jwt-env",
+			nil,
+			map[string]string{"JWT_JWKS": "https://sso/jwks.json", "JWT_JWKS_CACHE_TTL": "5m", "JWT_AUDIENCE": "payment-api"},
+			func(cfg *Config) {
+				cfg.Auth.JWT.JWKS = "https://sso/jwks.json"
+				cfg.Auth.JWT.JWKSCacheTTL = 5 * time.Minute
+				cfg.Auth.JWT.Audience = "payment-api"
+			},
+			false,
+		},
+		{
+			"outbox-env",
+			nil,
+			map[string]string{"OUTBOX_SINK": "file", "OUTBOX_FILE": "events.jsonl", "OUTBOX_BATCH_SIZE": "10"},
+			func(cfg *Config) {
+				cfg.Outbox.Sink = SinkFile
+				cfg.Outbox.File = "events.jsonl"
+				cfg.Outbox.BatchSize = 10
+			},
+			false,
+		},
+		{
+			"webhooks-env",
+			nil,
+			map[string]string{"WEBHOOKS_TIMEOUT": "3s", "WEBHOOKS_MAX_ATTEMPTS": "3", "WEBHOOKS_DISABLE_AFTER": "5", "WEBHOOKS_ALLOW_INSECURE": "true"},
+			func(cfg *Config) {
+				cfg.Webhooks.Timeout = 3 * time.Second
+				cfg.Webhooks.MaxAttempts = 3
+				cfg.Webhooks.DisableAfter = 5
+				cfg.Webhooks.AllowInsecure = true
+			},
+			false,
+		},
+		{"missing-file", []string{"-config", file + ".missing"}, nil, nil, true},
+		{"unknown-flag", []string{"-unknown"}, nil, nil, true},
+		{"invalid-env-number", nil, map[string]string{"PORT": "eighty"}, nil, true},
+		{"invalid-env-duration", nil, map[string]string{"DB_CONNECT_TIMEOUT": "5"}, nil, true},
+		{"invalid-env-boolean", nil, map[string]string{"WEBHOOKS_ALLOW_INSECURE": "sure"}, nil, true},
+		{"invalid-flag-number", []string{"-db-port", "abc"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := Load("payment-api", tt.args, env(tt.env))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+
+			want := Default()
+			tt.want(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Load() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestLoad_Args(t *testing.T) {
+	_, args, err := Load("payment-api", []string{"-log-level", "debug", "migrate", "up"}, env(nil))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := []string{"migrate", "up"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("Load() args = %v, want %v", args, want)
+	}
+}
+
+func TestLoad_UnknownFileSetting(t *testing.T) {
+	file := writeFile(t, "database:\n  hostname: localhost\n")
+	defer os.RemoveAll(filepath.Dir(file))
+
+	if _, _, err := Load("payment-api", []string{"-config", file}, env(nil)); err == nil {
+		t.Errorf("Load() error = %v, wantErr %v", err, true)
+	}
+}
+
+func TestLoad_ExampleFile(t *testing.T) {
+	// The example file documents the defaults, so loading it must not change anything.
+	got, _, err := Load("payment-api", []string{"-config", "../../configs/payment-api.yml"}, env(nil))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := Default(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *Config)
+		wantErr string
+	}{
+		{"default", func(cfg *Config) {}, ""},
+		{"invalid-port", func(cfg *Config) { cfg.Server.Port = 0 }, "server.port"},
+		{"negative-timeout", func(cfg *Config) { cfg.Server.WriteTimeout = -time.Second }, "server.write_timeout"},
+		{"invalid-admin-port", func(cfg *Config) { cfg.Server.AdminPort = 70000 }, "server.admin_port"},
+		{"same-admin-port", func(cfg *Config) { cfg.Server.AdminPort = cfg.Server.Port }, "server.admin_port"},
+		{"invalid-driver", func(cfg *Config) { cfg.Database.Driver = "mysql" }, "database.driver"},
+		{"missing-host", func(cfg *Config) { cfg.Database.Host = "" }, "database.host"},
+		{"invalid-ssl-mode", func(cfg *Config) { cfg.Database.SSLMode = "prefer" }, "database.ssl_mode"},
+		{"cert-without-key", func(cfg *Config) { cfg.Database.SSLCert = "client.crt" }, "database.ssl_cert"},
+		{"negative-conns", func(cfg *Config) { cfg.Database.MaxOpenConns = -1 }, "database.max_open_conns"},
+		{"reserved-conns", func(cfg *Config) { cfg.Database.MaxOpenConns = ReservedConns }, "database.max_open_conns"},
+		{"invalid-log-level", func(cfg *Config) { cfg.Log.Level = "verbose" }, "log.level"},
+		{"text-log-format", func(cfg *Config) { cfg.Log.Format = FormatText }, ""},
+		{"otlp-exporter", func(cfg *Config) { cfg.Tracing.Exporter = ExporterOTLP }, ""},
+		{"invalid-exporter", func(cfg *Config) { cfg.Tracing.Exporter = "jaeger" }, "tracing.exporter"},
+		{"invalid-endpoint", func(cfg *Config) {
+			cfg.Tracing.Exporter = ExporterOTLP
+			cfg.Tracing.Endpoint = "localhost:4318"
+		}, "tracing.endpoint"},
+		{"invalid-log-format", func(cfg *Config) { cfg.Log.Format = "logfmt" }, "log.format"},
+		{"jwt", func(cfg *Config) {
+			cfg.Auth.JWT.JWKS, cfg.Auth.JWT.Issuer, cfg.Auth.JWT.Audience = "jwks.json", "https://sso", "payment-api"
+		}, ""},
+		{"jwt-without-issuer", func(cfg *Config) { cfg.Auth.JWT.JWKS = "jwks.json" }, "auth.jwt.issuer"},
+		{"jwt-disabled", func(cfg *Config) { cfg.Auth.JWT.JWKSCacheTTL = 0 }, ""},
+		{"invalid-outbox-sink", func(cfg *Config) { cfg.Outbox.Sink = "kafka" }, "outbox.sink"},
+		{"outbox-file", func(cfg *Config) { cfg.Outbox.Sink, cfg.Outbox.File = SinkFile, "events.jsonl" }, ""},
+		{"outbox-file-without-path", func(cfg *Config) { cfg.Outbox.Sink = SinkFile }, "outbox.file"},
+		{"outbox-without-batch", func(cfg *Config) { cfg.Outbox.Sink, cfg.Outbox.BatchSize = SinkStdout, 0 }, "outbox.batch_size"},
+		{"outbox-without-interval", func(cfg *Config) { cfg.Outbox.Interval = 0 }, "outbox.interval"},
+		{"webhooks-without-attempts", func(cfg *Config) { cfg.Webhooks.MaxAttempts = 0 }, "webhooks.max_attempts"},
+		{"webhooks-backoff-above-max", func(cfg *Config) { cfg.Webhooks.Backoff = 2 * time.Hour }, "webhooks.max_backoff"},
+		{
+			"multiple",
+			func(cfg *Config) {
+				cfg.Database.Name = ""
+				cfg.Log.Level = ""
+			},
+			"database.name is required; log.level",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if (err != nil) != (tt.wantErr != "") {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Config.Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_String(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "secret"
+
+	got := cfg.String()
+	if strings.Contains(got, "secret") {
+		t.Errorf("Config.String() = %v, want the password redacted", got)
+	}
+	if !strings.Contains(got, "password: '[redacted]'") {
+		t.Errorf("Config.String() = %v, want %v", got, "password: '[redacted]'")
+	}
+	if cfg.Database.Password != "secret" {
+		t.Errorf("Config.String() changed the password to %v", cfg.Database.Password)
+	}
+
+	// Empty secrets aren't redacted, so it's visible that they're missing.
+	cfg.Database.Password = ""
+	if got := cfg.String(); !strings.Contains(got, `password: ""`) {
+		t.Errorf("Config.String() = %v, want %v", got, `password: ""`)
+	}
+}
+
+func TestDatabase_DSN(t *testing.T) {
+	tests := []struct {
+		name string
+		db   Database
+		want string
+	}{
+		{
+			"minimal",
+			Database{Host: "localhost", Port: 5432, Name: "api", Username: "payment-api", SSLMode: "disable"},
+			"host=localhost port=5432 dbname=api user=payment-api sslmode=disable",
+		},
+		{
+			"tls-and-timeouts",
+			Database{
+				Host:             "db.example.com",
+				Port:             5432,
+				Name:             "api",
+				Username:         "payment-api",
+				Password:         "s3cret",
+				SSLMode:          "verify-full",
+				SSLRootCert:      "/etc/ssl/root.crt",
+				ConnectTimeout:   1500 * time.Millisecond,
+				StatementTimeout: 30 * time.Second,
+			},
+			"host=db.example.com port=5432 dbname=api user=payment-api password=s3cret sslmode=verify-full " +
+				"sslrootcert=/etc/ssl/root.crt connect_timeout=2 statement_timeout=30000",
+		},
+		{
+			"quoted",
+			Database{Host: "localhost", Port: 5432, Name: "api", Username: "payment-api", Password: `it's a \ secret`},
+			`host=localhost port=5432 dbname=api user=payment-api password='it\'s a \\ secret'`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.db.DSN(); got != tt.want {
+				t.Errorf("Database.DSN() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
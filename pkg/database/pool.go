@@ -0,0 +1,95 @@
+// Package database manages the connections to the database that are shared by all requests.
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// ErrExhausted is returned when no connection became available in time, because all connections of the pool are in
+// use.
+var ErrExhausted = errors.New("database connection pool exhausted")
+
+// PoolConfig configures the limits of a Pool. Zero values mean no limit, like they do for `sql.DB`.
+type PoolConfig struct {
+	// Maximum number of open connections to the database.
+	MaxOpenConns int
+	// Number of the open connections reserved for background workers, which use the database without acquiring a slot.
+	ReservedConns int
+	// Maximum number of idle connections kept open for reuse.
+	MaxIdleConns int
+	// Maximum amount of time a connection may be reused, after which it's closed and reopened.
+	ConnMaxLifetime time.Duration
+	// Maximum amount of time to wait for a connection when all connections are in use.
+	AcquireTimeout time.Duration
+}
+
+// Pool of database connections shared by all requests. Every request acquires a slot of the pool before it uses the
+// database and releases it when it's done. There are as many slots as connections that aren't reserved for background
+// workers, so as long as every worker uses at most one connection at a time, a request never waits on the database for
+// a connection, but fails fast with `ErrExhausted` when all connections stay in use for too long.
+type Pool struct {
+	db      *gorm.DB
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// NewPool creates a Pool of the connections of the database, applying the limits of the config to it. The config must
+// leave at least one connection that isn't reserved, unless the number of open connections isn't limited.
+func NewPool(db *gorm.DB, config PoolConfig) *Pool {
+	sqlDB := db.DB()
+	sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+
+	pool := &Pool{db: db, timeout: config.AcquireTimeout}
+	if config.MaxOpenConns > 0 {
+		pool.slots = make(chan struct{}, config.MaxOpenConns-config.ReservedConns)
+	}
+
+	return pool
+}
+
+// DB returns the database of the Pool, to be injected into the sources.
+func (pool *Pool) DB() *gorm.DB {
+	return pool.db
+}
+
+// Acquire a slot of the Pool, waiting at most the acquire timeout for one to become available. The returned function
+// releases the slot again and must be called once the database is no longer used. Returns `ErrExhausted` when no slot
+// became available in time, or the error of the context when it's done before that.
+func (pool *Pool) Acquire(ctx context.Context) (func(), error) {
+	if pool.slots == nil {
+		return func() {}, nil
+	}
+
+	release := func() {
+		<-pool.slots
+	}
+
+	// Don't start a timer when a slot is available right away.
+	select {
+	case pool.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	timer := time.NewTimer(pool.timeout)
+	defer timer.Stop()
+
+	select {
+	case pool.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, ErrExhausted
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close the Pool and all its connections.
+func (pool *Pool) Close() error {
+	return pool.db.Close()
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"testing"
+	"time"
+)
+
+func newTestPool(t *testing.T, config PoolConfig) *Pool {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewPool(db, config)
+}
+
+func TestNewPool(t *testing.T) {
+	pool := newTestPool(t, PoolConfig{MaxOpenConns: 5, ReservedConns: 2, MaxIdleConns: 2, ConnMaxLifetime: time.Minute})
+	defer pool.Close()
+
+	if got := pool.DB().DB().Stats().MaxOpenConnections; got != 5 {
+		t.Errorf("NewPool() max open connections = %v, want %v", got, 5)
+	}
+	// The reserved connections don't have a slot.
+	if got := cap(pool.slots); got != 3 {
+		t.Errorf("NewPool() slots = %v, want %v", got, 3)
+	}
+}
+
+func TestPool_Acquire(t *testing.T) {
+	pool := newTestPool(t, PoolConfig{MaxOpenConns: 2, AcquireTimeout: 10 * time.Millisecond})
+	defer pool.Close()
+
+	first, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Pool.Acquire() error = %v", err)
+	}
+	if _, err := pool.Acquire(context.Background()); err != nil {
+		t.Fatalf("Pool.Acquire() error = %v", err)
+	}
+
+	// All slots are in use, so acquiring another one times out.
+	if _, err := pool.Acquire(context.Background()); err != ErrExhausted {
+		t.Errorf("Pool.Acquire() error = %v, want %v", err, ErrExhausted)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := pool.Acquire(ctx); err != context.Canceled {
+		t.Errorf("Pool.Acquire() error = %v, want %v", err, context.Canceled)
+	}
+
+	// A released slot can be acquired by a waiting request.
+	go func() {
+		time.Sleep(time.Millisecond)
+		first()
+	}()
+	pool.timeout = time.Second
+	if _, err := pool.Acquire(context.Background()); err != nil {
+		t.Errorf("Pool.Acquire() error = %v", err)
+	}
+}
+
+func TestPool_AcquireUnlimited(t *testing.T) {
+	pool := newTestPool(t, PoolConfig{})
+	defer pool.Close()
+
+	for i := 0; i < 10; i++ {
+		if _, err := pool.Acquire(context.Background()); err != nil {
+			t.Fatalf("Pool.Acquire() error = %v", err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package logging
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Placeholders of the values of a query, either numbered (Postgres) or not (SQLite).
+var placeholderRegexp = regexp.MustCompile(`\$(\d+)|\?`)
+
+// Column compared to the placeholder at the end of a query, e.g. `"parties"."account_number" = $1` or
+// `"id" IN ($1,$2,`.
+var comparisonRegexp = regexp.MustCompile(`"?(\w+)"?\s*(?:=|<>|!=|<=|>=|<|>|(?i:like|in)\s*\()\s*(?:(?:\$\d+|\?)\s*,\s*)*$`)
+
+// Limit or offset of a query with the placeholder at the end, e.g. `LIMIT 10 OFFSET $3`.
+var paginationRegexp = regexp.MustCompile(`(?i)\b(limit|offset)\s*$`)
+
+// Columns of which the values are safe to log, as they describe payments and deliveries without identifying any of
+// their parties, as well as ids, see `safeColumn`.
+var safeColumns = []string{
+	"id",
+	"status",
+	"currency",
+	"receiver_charges_currency",
+	"original_currency",
+	"processing_date",
+	"payment_scheme",
+	"payment_type",
+	"scheme_payment_type",
+	"scheme_payment_sub_type",
+	"account_type",
+	"bank_id",
+	"bank_id_code",
+	"bearer_code",
+	"type",
+	"event_type",
+	"resource_type",
+	"operation",
+	"role",
+	"enabled",
+	"failures",
+	"attempts",
+	"response_code",
+	"limit",
+	"offset",
+}
+
+// Columns and values of an insert, e.g. `INSERT INTO "parties" ("account_name","account_number") VALUES ($1,$2)`.
+var insertRegexp = regexp.MustCompile(`(?is)^\s*INSERT\s+INTO\s+\S+\s*\(([^)]*)\)\s*VALUES\s*\(([^)]*)\)`)
+
+// GormLogger logs the queries of gorm at the debug level, and its errors at the error level. Only the values of columns
+// that are known to be safe are logged, the others are redacted, see `safeColumn`.
+type GormLogger struct {
+	logger *logrus.Entry
+}
+
+// NewGormLogger creates a GormLogger that logs to the logger, usually the logger of a request, see `FromContext`.
+func NewGormLogger(logger *logrus.Entry) GormLogger {
+	return GormLogger{logger: logger}
+}
+
+// Print method required to implement the logger of gorm. Queries are logged as `sql`, the source, duration, query,
+// values and number of affected rows, errors as `log` and the source and error, or just the source and error.
+func (l GormLogger) Print(values ...interface{}) {
+	switch {
+	case len(values) == 6 && values[0] == "sql":
+		query, _ := values[3].(string)
+		vars, _ := values[4].([]interface{})
+		duration, _ := values[2].(time.Duration)
+		l.logger.WithFields(logrus.Fields{
+			"source":      values[1],
+			"duration_ms": float64(duration) / float64(time.Millisecond),
+			"sql":         query,
+			"vars":        redactVars(query, vars),
+			"rows":        values[5],
+		}).Debug("query")
+	case len(values) > 2 && values[0] == "log":
+		l.logger.WithField("source", values[1]).Error(values[2:]...)
+	case len(values) > 1:
+		l.logger.WithField("source", values[0]).Error(values[1:]...)
+	default:
+		l.logger.Error(values...)
+	}
+}
+
+// Format the values of the query to be logged, redacting all but the ones compared to, or inserted into, safe columns.
+// Values of which the column is unknown are redacted too.
+func redactVars(query string, vars []interface{}) []interface{} {
+	columns := placeholderColumns(query, len(vars))
+	formatted := make([]interface{}, len(vars))
+	for i, v := range vars {
+		if safeColumn(columns[i]) {
+			formatted[i] = formatVar(v)
+		} else {
+			formatted[i] = Redacted
+		}
+	}
+
+	return formatted
+}
+
+// Whether the values of the column are safe to log: one of `safeColumns`, an id like `organisation_id` or a
+// timestamp like `created_at`, as long as it isn't sensitive.
+func safeColumn(column string) bool {
+	if column == "" || Sensitive(column) {
+		return false
+	}
+	if strings.HasSuffix(column, "_id") || strings.HasSuffix(column, "_at") {
+		return true
+	}
+	for _, safe := range safeColumns {
+		if column == safe {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Find the column of every value of the query, which is empty when it's unknown.
+func placeholderColumns(query string, n int) []string {
+	columns := make([]string, n)
+	column := func(i int, name string) {
+		if i >= 0 && i < n {
+			columns[i] = strings.Trim(strings.TrimSpace(name), `"`)
+		}
+	}
+
+	// Numbered placeholders refer to their value, the others to the values in order.
+	index := func(i int, match []string) int {
+		if match[1] == "" {
+			return i
+		}
+		number, _ := strconv.Atoi(match[1])
+		return number - 1
+	}
+
+	// The values of an insert are matched to its columns by position.
+	if match := insertRegexp.FindStringSubmatchIndex(query); match != nil {
+		names := strings.Split(query[match[2]:match[3]], ",")
+		for i, value := range strings.Split(query[match[4]:match[5]], ",") {
+			if m := placeholderRegexp.FindStringSubmatch(value); m != nil && i < len(names) {
+				column(index(i, m), names[i])
+			}
+		}
+		return columns
+	}
+
+	for i, loc := range placeholderRegexp.FindAllStringSubmatchIndex(query, -1) {
+		match := []string{query[loc[0]:loc[1]], ""}
+		if loc[2] >= 0 {
+			match[1] = query[loc[2]:loc[3]]
+		}
+		if m := comparisonRegexp.FindStringSubmatch(query[:loc[0]]); m != nil {
+			column(index(i, match), m[1])
+		} else if m := paginationRegexp.FindStringSubmatch(query[:loc[0]]); m != nil {
+			column(index(i, match), strings.ToLower(m[1]))
+		}
+	}
+
+	return columns
+}
+
+// Format a value of a query, so it's logged the way it's stored.
+func formatVar(v interface{}) interface{} {
+	value := reflect.ValueOf(v)
+	if !value.IsValid() || (value.Kind() == reflect.Ptr && value.IsNil()) {
+		return nil
+	}
+	if valuer, ok := v.(driver.Valuer); ok {
+		stored, err := valuer.Value()
+		if err != nil || stored == nil {
+			return nil
+		}
+		return formatVar(stored)
+	}
+	v = reflect.Indirect(value).Interface()
+
+	switch t := v.(type) {
+	case time.Time:
+		return t.Format(time.RFC3339Nano)
+	case []byte:
+		if s := string(t); isPrintable(s) {
+			return s
+		}
+		return "<binary>"
+	case fmt.Stringer:
+		return t.String()
+	}
+
+	return v
+}
+
+// Whether the string only consists of printable characters.
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"github.com/satori/go.uuid"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGormLogger_Print(t *testing.T) {
+	logger, buf := newTestLogger(t, "debug", FormatJSON)
+	gormLogger := NewGormLogger(logger.WithField("request_id", "req-123"))
+
+	id := uuid.NewV4()
+	account := "GB29NWBK60161331926819"
+	gormLogger.Print(
+		"sql",
+		"/repository/gorm.go:42",
+		1500*time.Microsecond,
+		`INSERT INTO "parties" ("account_number","bank_id","organisation_id") VALUES ($1,$2,$3) RETURNING "parties"."id"`,
+		[]interface{}{account, "400300", id},
+		int64(1),
+	)
+	gormLogger.Print("log", "/repository/gorm.go:43", "pq: relation does not exist")
+
+	got := lines(t, buf)
+	if len(got) != 2 {
+		t.Fatalf("GormLogger.Print() logged %v, want 2 lines", got)
+	}
+	query := got[0]
+	if query["level"] != "debug" || query["request_id"] != "req-123" || query["duration_ms"] != 1.5 || query["rows"] != float64(1) {
+		t.Errorf("GormLogger.Print() logged %v, want a debug line of the query", query)
+	}
+	if want := []interface{}{Redacted, "400300", id.String()}; !reflect.DeepEqual(query["vars"], want) {
+		t.Errorf("GormLogger.Print() vars = %v, want %v", query["vars"], want)
+	}
+	if got[1]["level"] != "error" || got[1]["msg"] != "pq: relation does not exist" {
+		t.Errorf("GormLogger.Print() logged %v, want the error", got[1])
+	}
+}
+
+// Only the values of safe columns are logged, unknown columns are redacted too.
+func TestRedactVars(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		vars  []interface{}
+		want  []interface{}
+	}{
+		{
+			"safe",
+			`SELECT * FROM "payments" WHERE "currency" = $1 AND "created_at" < $2 LIMIT 10 OFFSET $3`,
+			[]interface{}{"GBP", "2020-01-01", 20},
+			[]interface{}{"GBP", "2020-01-01", 20},
+		},
+		{
+			"party-name",
+			`UPDATE "parties" SET "name" = $1 WHERE "parties"."id" = $2`,
+			[]interface{}{"Jane Doe", 3},
+			[]interface{}{Redacted, 3},
+		},
+		{
+			"unknown-column",
+			`UPDATE "payments" SET "reference" = $1 WHERE "payments"."id" = $2`,
+			[]interface{}{"Rent for Jane Doe", 3},
+			[]interface{}{Redacted, 3},
+		},
+		{
+			"unknown-placeholder",
+			`SELECT * FROM "payments" WHERE lower(reference) LIKE lower($1)`,
+			[]interface{}{"%jane%"},
+			[]interface{}{Redacted},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactVars(tt.query, tt.vars); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactVars() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaceholderColumns(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		n     int
+		want  []string
+	}{
+		{
+			"insert",
+			`INSERT INTO "parties" ("account_name","account_number") VALUES ($1,$2) RETURNING "parties"."id"`,
+			2,
+			[]string{"account_name", "account_number"},
+		},
+		{
+			"insert-sqlite",
+			`INSERT INTO "api_keys" ("name","hash") VALUES (?,?)`,
+			2,
+			[]string{"name", "hash"},
+		},
+		{
+			"update",
+			`UPDATE "webhooks" SET "secret" = $1, "url" = $2 WHERE "webhooks"."id" = $3`,
+			3,
+			[]string{"secret", "url", "id"},
+		},
+		{
+			"select",
+			`SELECT * FROM "parties" WHERE (account_number = ?) AND "id" IN (?,?) LIMIT 10 OFFSET ?`,
+			4,
+			[]string{"account_number", "id", "id", "offset"},
+		},
+		{
+			"numbered-out-of-order",
+			`SELECT * FROM "payments" WHERE "currency" = $2 AND "organisation_id" = $1`,
+			2,
+			[]string{"organisation_id", "currency"},
+		},
+		{"more-placeholders-than-values", `SELECT * FROM "payments" WHERE "id" = $3`, 1, []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := placeholderColumns(tt.query, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("placeholderColumns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
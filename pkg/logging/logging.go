@@ -0,0 +1,65 @@
+// Package logging writes structured, levelled logs with logrus. Every request gets an id, which is attached to all
+// lines logged while handling it, including the queries of the database, see `Middleware` and `FromContext`.
+//
+// Values of fields that may hold sensitive data, like account numbers and secrets, are redacted from every line, see
+// `Sensitive`.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"log"
+	"time"
+)
+
+// Formats of log lines.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Key of the logger of a request in its context.
+type contextKey struct{}
+
+// Configure the logger to write lines of the format, at the level or above, with sensitive values redacted. The
+// standard library logger writes to the logger as well, so nothing is logged unstructured. It does so at the debug
+// level, because api2go logs every error it writes with it, without the id of the request; unexpected errors are
+// logged with the id by the handlers instead, see `FromContext`.
+func Configure(logger *logrus.Logger, level, format string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logger.SetLevel(lvl)
+
+	switch format {
+	case FormatJSON:
+		logger.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339Nano})
+	case FormatText:
+		logger.SetFormatter(&logrus.TextFormatter{FullTimestamp: true, TimestampFormat: time.RFC3339Nano})
+	default:
+		return fmt.Errorf("unknown log format `%s`", format)
+	}
+	logger.AddHook(redactHook{})
+
+	log.SetFlags(0)
+	log.SetOutput(logger.WriterLevel(logrus.DebugLevel))
+
+	return nil
+}
+
+// NewContext returns a copy of the context that carries the logger, see `FromContext`.
+func NewContext(ctx context.Context, logger *logrus.Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger of the context, with the id of the request when the context is of a request. Contexts
+// without a logger get the standard logger.
+func FromContext(ctx context.Context) *logrus.Entry {
+	if logger, ok := ctx.Value(contextKey{}).(*logrus.Entry); ok {
+		return logger
+	}
+
+	return logrus.NewEntry(logrus.StandardLogger())
+}
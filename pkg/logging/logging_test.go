@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/sirupsen/logrus"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Create a logger configured with the level and format, which logs to the returned buffer.
+func newTestLogger(t *testing.T, level, format string) (*logrus.Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	logger := logrus.New()
+	if err := Configure(logger, level, format); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	logger.SetOutput(buf)
+	// The standard library logger is configured as well, which is restored for the other tests.
+	log.SetOutput(os.Stderr)
+
+	return logger, buf
+}
+
+// Decode the JSON log lines in the buffer.
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("json.Unmarshal(%s) error = %v", line, err)
+		}
+		lines = append(lines, fields)
+	}
+
+	return lines
+}
+
+func TestConfigure(t *testing.T) {
+	logger, buf := newTestLogger(t, "info", FormatJSON)
+	logger.Debug("hidden")
+	logger.WithFields(logrus.Fields{"account_number": "GB29NWBK60161331926819", "currency": "GBP"}).Warn("shown")
+
+	got := lines(t, buf)
+	if len(got) != 1 {
+		t.Fatalf("Configure() logged %v, want only the warning", got)
+	}
+	if got[0]["level"] != "warning" || got[0]["msg"] != "shown" || got[0]["time"] == nil {
+		t.Errorf("Configure() logged %v, want a JSON line with level, message and time", got[0])
+	}
+	if got[0]["account_number"] != Redacted || got[0]["currency"] != "GBP" {
+		t.Errorf("Configure() logged %v, want only the account number redacted", got[0])
+	}
+
+	logger, buf = newTestLogger(t, "debug", FormatText)
+	logger.WithField("secret", "whsec_123").Debug("text")
+	if line := buf.String(); !strings.Contains(line, "msg=text") || strings.Contains(line, "whsec_123") {
+		t.Errorf("Configure() logged %v, want a redacted text line", line)
+	}
+
+	if err := Configure(logrus.New(), "verbose", FormatJSON); err == nil {
+		t.Errorf("Configure() error = %v, wantErr %v", err, true)
+	}
+	if err := Configure(logrus.New(), "info", "logfmt"); err == nil {
+		t.Errorf("Configure() error = %v, wantErr %v", err, true)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if got := FromContext(context.Background()); got.Logger != logrus.StandardLogger() {
+		t.Errorf("FromContext() = %v, want the standard logger", got)
+	}
+
+	logger := logrus.New().WithField("request_id", "abc")
+	if got := FromContext(NewContext(context.Background(), logger)); got != logger {
+		t.Errorf("FromContext() = %v, want %v", got, logger)
+	}
+}
+
+func TestSensitive(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"account_number", true},
+		{"filter[beneficiary_party.account_number]", true},
+		{"account_name", true},
+		{"name", true},
+		{"filter[beneficiary_party.name]", true},
+		{"secret", true},
+		{"X-API-Key", true},
+		{"Authorization", true},
+		{"hash", true},
+		{"data", true},
+		{"metadata", false},
+		{"service_name", false},
+		{"username", false},
+		{"filename", false},
+		{"key_id", false},
+		{"currency", false},
+		{"request_id", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sensitive(tt.name); got != tt.want {
+				t.Errorf("Sensitive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// RequestIDHeader is the header with the id of a request, which is generated unless the client sent a valid one.
+const RequestIDHeader = "X-Request-ID"
+
+// Ids of requests sent by clients are only used when they're reasonably short and can't break log lines.
+var requestIDRegexp = regexp.MustCompile(`^[\w.:-]{1,128}$`)
+
+// Middleware gives every request an id, logs it at the end of the request, and makes a logger that adds the id to every
+// line available to the handler, see `FromContext`. The id is set in the header of both the request and the response,
+// so it's recorded with the changes the request makes and clients can refer to it.
+func Middleware(logger *logrus.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !requestIDRegexp.MatchString(id) {
+			id = uuid.NewV4().String()
+		}
+		r.Header.Set(RequestIDHeader, id)
+		w.Header().Set(RequestIDHeader, id)
+
+		entry := logger.WithField("request_id", id)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(NewContext(r.Context(), entry)))
+
+		entry = entry.WithFields(logrus.Fields{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"query":       redactQuery(r.URL.Query()),
+			"status":      rec.status,
+			"bytes":       rec.bytes,
+			"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+		})
+		if rec.status >= http.StatusInternalServerError {
+			entry.Error("request failed")
+		} else {
+			entry.Info("request handled")
+		}
+	})
+}
+
+// Encode the query parameters of a request, with the values of sensitive parameters redacted, e.g. filters on the
+// account numbers of payments.
+func redactQuery(query url.Values) string {
+	for key := range query {
+		if Sensitive(key) {
+			query[key] = []string{Redacted}
+		}
+	}
+
+	return query.Encode()
+}
+
+// ResponseWriter that records the status and size of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+// WriteHeader method required to implement `http.ResponseWriter`.
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Write method required to implement `http.ResponseWriter`.
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+
+	return n, err
+}
@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		status int
+		// Whether the id of the request is used, instead of a generated one.
+		wantID    bool
+		wantLevel string
+	}{
+		{"generated", "", http.StatusOK, false, "info"},
+		{"propagated", "req-123", http.StatusNotFound, true, "info"},
+		{"invalid", "req 123\n", http.StatusOK, false, "info"},
+		{"too-long", strings.Repeat("a", 129), http.StatusOK, false, "info"},
+		{"failed", "req-456", http.StatusInternalServerError, true, "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, buf := newTestLogger(t, "info", FormatJSON)
+
+			var handled string
+			handler := Middleware(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled = r.Header.Get(RequestIDHeader)
+				FromContext(r.Context()).Info("handling")
+				w.WriteHeader(tt.status)
+				w.Write([]byte("body"))
+			}))
+
+			req := httptest.NewRequest("GET", "/v0/payments?filter[debtor_party.account_number]=123&page[size]=10", nil)
+			if tt.id != "" {
+				req.Header.Set(RequestIDHeader, tt.id)
+			}
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+
+			id := res.Header().Get(RequestIDHeader)
+			if (id == tt.id) != tt.wantID || id == "" || handled != id {
+				t.Errorf("Middleware() id = %v, handled %v, want the id of the request %v", id, handled, tt.wantID)
+			}
+
+			got := lines(t, buf)
+			if len(got) != 2 {
+				t.Fatalf("Middleware() logged %v, want 2 lines", got)
+			}
+			for _, line := range got {
+				if line["request_id"] != id {
+					t.Errorf("Middleware() logged %v, want request_id %v", line, id)
+				}
+			}
+			line := got[1]
+			if line["level"] != tt.wantLevel || line["status"] != float64(tt.status) || line["bytes"] != float64(4) {
+				t.Errorf("Middleware() logged %v, want status %v at level %v", line, tt.status, tt.wantLevel)
+			}
+			if line["method"] != "GET" || line["path"] != "/v0/payments" || strings.Contains(line["query"].(string), "123") {
+				t.Errorf("Middleware() logged %v, want the request with a redacted query", line)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+// Value logged instead of sensitive values.
+const Redacted = "[redacted]"
+
+// Names of fields, columns and parameters of which the values are sensitive: details of the parties of payments, like
+// `beneficiary_party.name` and `account_name`, credentials, and columns with JSON documents of payments, which contain
+// the details of their parties. Names are compared exactly, so e.g. `service_name` and `filename` are logged.
+var sensitiveNames = map[string]bool{
+	"account_name":   true,
+	"account_number": true,
+	"name":           true,
+	"address":        true,
+	"iban":           true,
+	"password":       true,
+	"secret":         true,
+	"token":          true,
+	"key":            true,
+	"api_key":        true,
+	"x_api_key":      true,
+	"hash":           true,
+	"authorization":  true,
+	"data":           true,
+	"changes":        true,
+	"payload":        true,
+	"response":       true,
+}
+
+// Sensitive reports whether values of the field, column or parameter with the name must be redacted from the logs. Only
+// the last part of a nested name is compared, e.g. `name` of `filter[beneficiary_party.name]`, and dashes are read as
+// underscores, e.g. `X-API-Key`.
+func Sensitive(name string) bool {
+	name = strings.TrimRight(strings.ToLower(name), "]")
+	if i := strings.LastIndexAny(name, ".["); i >= 0 {
+		name = name[i+1:]
+	}
+
+	return sensitiveNames[strings.Replace(name, "-", "_", -1)]
+}
+
+// Hook that redacts the values of sensitive fields from every line.
+type redactHook struct{}
+
+// Levels method required to implement `logrus.Hook`.
+func (redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire method required to implement `logrus.Hook`. The fields are shared with the logger the line is logged with, so
+// they are copied before they are redacted.
+func (redactHook) Fire(entry *logrus.Entry) error {
+	for key := range entry.Data {
+		if Sensitive(key) {
+			data := make(logrus.Fields, len(entry.Data))
+			for k, v := range entry.Data {
+				if Sensitive(k) {
+					v = Redacted
+				}
+				data[k] = v
+			}
+			entry.Data = data
+			break
+		}
+	}
+
+	return nil
+}
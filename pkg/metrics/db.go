@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector of the statistics of a pool of database connections, which are read when the metrics are collected.
+type dbStatsCollector struct {
+	db *sql.DB
+
+	maxOpen           *prometheus.Desc
+	open              *prometheus.Desc
+	inUse             *prometheus.Desc
+	idle              *prometheus.Desc
+	waitCount         *prometheus.Desc
+	waitDuration      *prometheus.Desc
+	maxIdleClosed     *prometheus.Desc
+	maxLifetimeClosed *prometheus.Desc
+}
+
+// RegisterDB registers the statistics of the pool of connections of the database, like the number of connections
+// in use and how long requests waited for one.
+func RegisterDB(db *sql.DB) error {
+	return prometheus.Register(newDBStatsCollector(db))
+}
+
+// Create the collector of the statistics of the pool of connections of the database.
+func newDBStatsCollector(db *sql.DB) *dbStatsCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", name), help, nil, nil)
+	}
+
+	return &dbStatsCollector{
+		db:                db,
+		maxOpen:           desc("max_open_connections", "Maximum number of open connections to the database."),
+		open:              desc("open_connections", "Number of open connections to the database, in use or idle."),
+		inUse:             desc("in_use_connections", "Number of connections to the database in use."),
+		idle:              desc("idle_connections", "Number of idle connections to the database."),
+		waitCount:         desc("wait_count_total", "Number of times a connection to the database was waited for."),
+		waitDuration:      desc("wait_duration_seconds_total", "Total duration waited for connections to the database."),
+		maxIdleClosed:     desc("max_idle_closed_total", "Number of connections closed because of the maximum of idle connections."),
+		maxLifetimeClosed: desc("max_lifetime_closed_total", "Number of connections closed because of their maximum lifetime."),
+	}
+}
+
+// Describe method required to implement `prometheus.Collector`.
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.open
+	ch <- c.inUse
+	ch <- c.idle
+	ch <- c.waitCount
+	ch <- c.waitDuration
+	ch <- c.maxIdleClosed
+	ch <- c.maxLifetimeClosed
+}
+
+// Collect method required to implement `prometheus.Collector`.
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.open, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.inUse, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.maxIdleClosed, prometheus.CounterValue, float64(stats.MaxIdleClosed))
+	ch <- prometheus.MustNewConstMetric(c.maxLifetimeClosed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed))
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"strings"
+	"testing"
+)
+
+func TestDBStatsCollector(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(3)
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	want := `
+		# HELP payment_api_db_in_use_connections Number of connections to the database in use.
+		# TYPE payment_api_db_in_use_connections gauge
+		payment_api_db_in_use_connections 1
+		# HELP payment_api_db_max_open_connections Maximum number of open connections to the database.
+		# TYPE payment_api_db_max_open_connections gauge
+		payment_api_db_max_open_connections 3
+		# HELP payment_api_db_open_connections Number of open connections to the database, in use or idle.
+		# TYPE payment_api_db_open_connections gauge
+		payment_api_db_open_connections 1
+	`
+	err = testutil.CollectAndCompare(
+		newDBStatsCollector(db),
+		strings.NewReader(want),
+		"payment_api_db_in_use_connections",
+		"payment_api_db_max_open_connections",
+		"payment_api_db_open_connections",
+	)
+	if err != nil {
+		t.Errorf("dbStatsCollector.Collect() error = %v", err)
+	}
+}
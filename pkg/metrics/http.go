@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Label of requests for anything other than a known resource, e.g. a path that doesn't exist.
+const resourceUnknown = "unknown"
+
+// Label of requests with a method the API doesn't route.
+const methodOther = "other"
+
+// Methods counted by their own label value.
+var methods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests handled, by resource, method and status.",
+	}, []string{"resource", "method", "status"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of handling HTTP requests, by resource, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"resource", "method", "status"})
+)
+
+// Middleware counts every request and observes its duration, by the resource it's for, its method and the status of
+// the response. Requests are for the resource of the routes under the prefix, e.g. `/v0/payments/:id/submit` is for
+// `payments` and `/v0/organisations/:id/api-keys` for `api-keys`, as long as it's one of the resources. Requests for
+// anything else are all counted as `unknown`, so clients can't create new label values.
+func Middleware(prefix string, resources []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		method := r.Method
+		if !contains(methods, method) {
+			method = methodOther
+		}
+		labels := prometheus.Labels{
+			"resource": Resource(prefix, resources, r.URL.Path),
+			"method":   method,
+			"status":   strconv.Itoa(rec.status),
+		}
+		requests.With(labels).Inc()
+		requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Resource finds the resource of the path, or `unknown` when it isn't one of the resources. Routes alternate between
+// resources and their ids, and end with either a resource or an action on it, so the resource is the last of the
+// segments at an even position that is a resource. A relationship like `/organisations/:id/relationships/payments` is
+// for the resource that has it.
+func Resource(prefix string, resources []string, path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if prefix != "" {
+		if !strings.HasPrefix(path, prefix+"/") {
+			return resourceUnknown
+		}
+		path = strings.TrimPrefix(path, prefix+"/")
+	}
+
+	found := resourceUnknown
+	for i, segment := range strings.Split(path, "/") {
+		if i%2 == 0 && contains(resources, segment) {
+			found = segment
+		} else if i == 0 {
+			break
+		}
+	}
+
+	return found
+}
+
+// ResponseWriter that records the status of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader method required to implement `http.ResponseWriter`.
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Resources of the routes in the tests.
+var testResources = []string{"organisations", "payments", "api-keys", "deliveries", "webhooks"}
+
+func TestMiddleware(t *testing.T) {
+	handler := Middleware("v0", testResources, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v0/payments" {
+			w.WriteHeader(http.StatusCreated)
+		}
+		w.Write([]byte("{}"))
+	}))
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		wantResource string
+		wantMethod   string
+		wantStatus   string
+	}{
+		{"created", "POST", "/v0/payments", "payments", "POST", "201"},
+		{"default-status", "GET", "/v0/organisations/1", "organisations", "GET", "200"},
+		{"unknown-method", "BREW", "/v0/webhooks", "webhooks", methodOther, "200"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := requests.WithLabelValues(tt.wantResource, tt.wantMethod, tt.wantStatus)
+			before := testutil.ToFloat64(counter)
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("Middleware() counted %v, want 1 with labels %v, %v, %v", got, tt.wantResource, tt.wantMethod, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestResource(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"collection", "/v0/payments", "payments"},
+		{"resource", "/v0/payments/7d537aa2-c00c-4703-9f23-df0e577e8e8d", "payments"},
+		{"action", "/v0/payments/7d537aa2-c00c-4703-9f23-df0e577e8e8d/submit", "payments"},
+		{"nested", "/v0/organisations/1/payments", "payments"},
+		{"nested-resource", "/v0/organisations/1/api-keys/2", "api-keys"},
+		{"relationship", "/v0/organisations/1/relationships/payments", "organisations"},
+		{"deliveries", "/v0/webhooks/1/deliveries", "deliveries"},
+		{"unknown-resource", "/v0/invoices", resourceUnknown},
+		{"unknown-parent", "/v0/invoices/1/payments", resourceUnknown},
+		{"without-prefix", "/payments", resourceUnknown},
+		{"metrics", "/metrics", resourceUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Resource("v0", testResources, tt.path); got != tt.want {
+				t.Errorf("Resource() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// Package metrics exposes metrics of the API to Prometheus: the requests it handles, the pool of database connections,
+// the payments created and the requests that fail validation or authentication. The metrics are registered with the
+// default registry of Prometheus, and served by `Handler` on the admin port, which isn't reachable through the API.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// Namespace of all metrics of the API.
+const namespace = "payment_api"
+
+// Reasons requests fail authentication or authorization, see `AuthFailed`.
+const (
+	ReasonInvalidAPIKey      = "invalid_api_key"
+	ReasonInvalidBearerToken = "invalid_bearer_token"
+	ReasonForbidden          = "forbidden"
+)
+
+// Label of the payment scheme of payments that don't have one.
+const schemeNone = "none"
+
+// Label of payment schemes other than the known ones, which keeps the number of label values bounded.
+const schemeOther = "other"
+
+// Payment schemes counted by their own label value, see `PaymentCreated`.
+var schemes = []string{"FPS", "Bacs", "CHAPS", "SEPA", "SWIFT"}
+
+var (
+	paymentsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payments_created_total",
+		Help:      "Number of payments created, by currency and payment scheme.",
+	}, []string{"currency", "scheme"})
+
+	validationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validation_failures_total",
+		Help:      "Number of requests with invalid attributes, by resource.",
+	}, []string{"resource"})
+
+	authFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_failures_total",
+		Help:      "Number of requests that failed authentication or authorization, by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(requests, requestDuration, paymentsCreated, validationFailures, authFailures)
+}
+
+// Handler serves all registered metrics in the exposition format of Prometheus.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// PaymentCreated counts a created payment by its currency and payment scheme. Schemes are free text, so only the
+// known ones are counted by their own label, all others as `other`.
+func PaymentCreated(currency, scheme string) {
+	switch {
+	case scheme == "":
+		scheme = schemeNone
+	case !contains(schemes, scheme):
+		scheme = schemeOther
+	}
+
+	paymentsCreated.WithLabelValues(currency, scheme).Inc()
+}
+
+// ValidationFailed counts a request with invalid attributes of a resource of the type.
+func ValidationFailed(resource string) {
+	validationFailures.WithLabelValues(resource).Inc()
+}
+
+// AuthFailed counts a request that failed authentication or authorization for the reason, one of `ReasonInvalidAPIKey`,
+// `ReasonInvalidBearerToken` and `ReasonForbidden`.
+func AuthFailed(reason string) {
+	authFailures.WithLabelValues(reason).Inc()
+}
+
+// Whether the values contain the value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"testing"
+)
+
+func TestPaymentCreated(t *testing.T) {
+	tests := []struct {
+		name      string
+		currency  string
+		scheme    string
+		wantLabel string
+	}{
+		{"known", "GBP", "FPS", "FPS"},
+		{"none", "GBP", "", schemeNone},
+		{"other", "EUR", "Faster Payments", schemeOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := paymentsCreated.WithLabelValues(tt.currency, tt.wantLabel)
+			before := testutil.ToFloat64(counter)
+
+			PaymentCreated(tt.currency, tt.scheme)
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("PaymentCreated() counted %v, want 1 for scheme %v", got, tt.wantLabel)
+			}
+		})
+	}
+}
+
+func TestFailures(t *testing.T) {
+	validation := validationFailures.WithLabelValues("payments")
+	before := testutil.ToFloat64(validation)
+	ValidationFailed("payments")
+	if got := testutil.ToFloat64(validation) - before; got != 1 {
+		t.Errorf("ValidationFailed() counted %v, want 1", got)
+	}
+
+	auth := authFailures.WithLabelValues(ReasonForbidden)
+	before = testutil.ToFloat64(auth)
+	AuthFailed(ReasonForbidden)
+	if got := testutil.ToFloat64(auth) - before; got != 1 {
+		t.Errorf("AuthFailed() counted %v, want 1", got)
+	}
+}
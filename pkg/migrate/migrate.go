@@ -0,0 +1,457 @@
+// Package migrate applies versioned SQL migrations to the database. Every migration is a pair of files in the
+// migrations directory, `<version>_<name>.up.sql` to apply it and `<version>_<name>.down.sql` to revert it, e.g.
+// `0002_payment_list_indexes.up.sql`. The applied versions are recorded in the `schema_migrations` table. SQL that only
+// works on some databases is replaced for a dialect by `<version>_<name>.up.<dialect>.sql` and
+// `<version>_<name>.down.<dialect>.sql`, e.g. `0008_numeric_amounts.up.sqlite3.sql`.
+//
+// Every migration is applied in its own transaction. On Postgres, migrations are run while holding an advisory lock,
+// so replicas starting at the same time don't apply the same migration twice.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key of the Postgres advisory lock held while migrating, which is arbitrary but must be the same for all replicas.
+const lockKey = 4829301721
+
+// Name of the table the applied migrations are recorded in.
+const table = "schema_migrations"
+
+// ErrUnversioned is returned for a database that has tables, but no applied migrations, e.g. one that was migrated with
+// gorm's AutoMigrate. Such a database adopts the migrations with `Baseline`.
+var ErrUnversioned = errors.New("the database has tables, but no applied migrations")
+
+var fileRegex = regexp.MustCompile(`^([0-9]+)_([a-z0-9_]+)\.(up|down)(?:\.([a-z0-9]+))?\.sql$`)
+
+// Migration is a versioned change of the database schema, together with the SQL to revert it.
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+	// The SQL that replaces Up and Down on a specific dialect, by dialect.
+	dialects map[string]*dialectSQL
+}
+
+// The SQL of a Migration for a specific dialect.
+type dialectSQL struct {
+	up   string
+	down string
+}
+
+// Status of a Migration in the database.
+type Status struct {
+	Migration
+	// When the Migration was applied, nil when it's pending.
+	AppliedAt *time.Time
+	// Whether the Migration was applied, but no longer exists in the migrations directory.
+	Missing bool
+}
+
+// Load the migrations from the files in the directory, ordered by version. Every migration needs both an up and a
+// down file, also for every dialect it has files for, and versions must be unique.
+func Load(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	for _, file := range files {
+		match := fileRegex.FindStringSubmatch(file.Name())
+		if file.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version of migration `%s`: %v", file.Name(), err)
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations `%s` and `%s` have the same version %d", m.Name, match[2], version)
+		}
+
+		up, down := &m.Up, &m.Down
+		if dialect := match[4]; dialect != "" {
+			if m.dialects == nil {
+				m.dialects = make(map[string]*dialectSQL)
+			}
+			if _, ok := m.dialects[dialect]; !ok {
+				m.dialects[dialect] = &dialectSQL{}
+			}
+			up, down = &m.dialects[dialect].up, &m.dialects[dialect].down
+		}
+		if match[3] == "up" {
+			*up = string(data)
+		} else {
+			*down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		for dialect, sql := range m.dialects {
+			if strings.TrimSpace(sql.up) == "" || strings.TrimSpace(sql.down) == "" {
+				return nil, fmt.Errorf("migration %d_%s needs both an up and a down file for %s", m.Version, m.Name, dialect)
+			}
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrator applies and reverts migrations on a database.
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// New creates a Migrator for the migrations, as loaded by `Load`. The dialect is the name of the database driver, e.g.
+// `postgres`, and determines the placeholders and locking used, and which SQL of the migrations is run.
+func New(db *sql.DB, dialect string, migrations []Migration) *Migrator {
+	resolved := make([]Migration, 0, len(migrations))
+	for _, migration := range migrations {
+		if sql, ok := migration.dialects[dialect]; ok {
+			migration.Up, migration.Down = sql.up, sql.down
+		}
+		resolved = append(resolved, migration)
+	}
+
+	return &Migrator{db: db, dialect: dialect, migrations: resolved}
+}
+
+// Up applies all pending migrations in order of their version, and returns the applied migrations. Stops at the
+// first migration that fails, the migrations before it stay applied. Returns `ErrUnversioned` when the database has
+// tables, but none of the migrations were applied.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied := make([]Migration, 0)
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := m.versions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+
+			insert := m.query("INSERT INTO "+table+" (version, name, applied_at) VALUES (?, ?, ?)")
+			err := m.transaction(ctx, conn, migration.Up, insert, migration.Version, migration.Name, time.Now().UTC())
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %v", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the most recently applied migration, and returns it. Returns nil when no migration is applied.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var reverted *Migration
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		if len(versions) == 0 {
+			return nil
+		}
+		var latest uint64
+		for version := range versions {
+			if version > latest {
+				latest = version
+			}
+		}
+
+		for i := range m.migrations {
+			migration := &m.migrations[i]
+			if migration.Version != latest {
+				continue
+			}
+
+			remove := m.query("DELETE FROM " + table + " WHERE version = ?")
+			if err := m.transaction(ctx, conn, migration.Down, remove, migration.Version); err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %v", migration.Version, migration.Name, err)
+			}
+			reverted = migration
+			return nil
+		}
+
+		return fmt.Errorf("cannot revert migration %d_%s, its files are missing", latest, versions[latest].Name)
+	})
+
+	return reverted, err
+}
+
+// Baseline records the first migration as applied without running it, and returns it. A database that was migrated
+// with gorm's AutoMigrate already has the schema of the first migration, so it adopts the migrations this way. Only
+// applies to a database that has tables, but no applied migrations.
+func (m *Migrator) Baseline(ctx context.Context) (*Migration, error) {
+	if len(m.migrations) == 0 {
+		return nil, errors.New("there are no migrations to record")
+	}
+
+	baseline := &m.migrations[0]
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := m.versions(ctx, conn)
+		switch {
+		case err == ErrUnversioned:
+		case err != nil:
+			return err
+		case len(versions) > 0:
+			return errors.New("the database already has applied migrations")
+		default:
+			return errors.New("the database is empty, apply the migrations instead")
+		}
+
+		insert := m.query("INSERT INTO " + table + " (version, name, applied_at) VALUES (?, ?, ?)")
+		_, err = conn.ExecContext(ctx, insert, baseline.Version, baseline.Name, time.Now().UTC())
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return baseline, nil
+}
+
+// Status returns the status of all migrations, both the ones in the migrations directory and the ones that have been
+// applied, ordered by version. Doesn't change the database, and returns `ErrUnversioned` when the database has tables,
+// but none of the migrations were applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	versions, err := m.versions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if applied, ok := versions[migration.Version]; ok {
+			status.AppliedAt = applied.AppliedAt
+			delete(versions, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, applied := range versions {
+		applied.Missing = true
+		statuses = append(statuses, applied)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// Pending returns the migrations that haven't been applied yet.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]Migration, 0)
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, status.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// Run the function on a single connection, while holding the advisory lock on Postgres. The migrations table is
+// created when it doesn't exist yet.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	// Advisory locks are held by a session, so the lock must be acquired and released on the same connection.
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dialect == "postgres" {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+	}
+
+	if err := m.createTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// Create the migrations table when it doesn't exist yet.
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	// The sqlite driver only reads columns declared as plain timestamps as times.
+	timestamp := "timestamp with time zone"
+	if m.dialect == "sqlite3" {
+		timestamp = "timestamp"
+	}
+
+	_, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+table+" ("+
+		"version bigint NOT NULL, "+
+		"name varchar(255) NOT NULL, "+
+		"applied_at "+timestamp+" NOT NULL, "+
+		"PRIMARY KEY (version))")
+
+	return err
+}
+
+// Get the status of the applied migrations, by version.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[uint64]Status, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, applied_at FROM "+table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[uint64]Status)
+	for rows.Next() {
+		var status Status
+		var appliedAt time.Time
+		if err := rows.Scan(&status.Version, &status.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		status.AppliedAt = &appliedAt
+		versions[status.Version] = status
+	}
+
+	return versions, rows.Err()
+}
+
+// Get the status of the applied migrations, by version, without creating the migrations table. Returns
+// `ErrUnversioned` when the database has tables, but no applied migrations.
+func (m *Migrator) versions(ctx context.Context, conn *sql.Conn) (map[uint64]Status, error) {
+	tables, err := m.tables(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[uint64]Status)
+	others := 0
+	for _, name := range tables {
+		if name != table {
+			others++
+			continue
+		}
+		if versions, err = m.applied(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+	if len(versions) == 0 && others > 0 {
+		return nil, ErrUnversioned
+	}
+
+	return versions, nil
+}
+
+// Get the names of the tables of the database.
+func (m *Migrator) tables(ctx context.Context, conn *sql.Conn) ([]string, error) {
+	query := "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema()"
+	if m.dialect == "sqlite3" {
+		query = "SELECT name FROM sqlite_master WHERE type = 'table'"
+	}
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		tables = append(tables, name)
+	}
+
+	return tables, rows.Err()
+}
+
+// Execute the SQL of a migration and the statement recording it in a single transaction.
+func (m *Migrator) transaction(ctx context.Context, conn *sql.Conn, migration, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Replace the `?` placeholders of the query with numbered placeholders on Postgres.
+func (m *Migrator) query(query string) string {
+	if m.dialect != "postgres" {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,331 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Open an empty sqlite database, removed again by the returned function.
+func newTestDatabase(t *testing.T) (*sql.DB, func()) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// Get the versions of the migrations.
+func versions(migrations []Migration) []uint64 {
+	got := make([]uint64, 0, len(migrations))
+	for _, m := range migrations {
+		got = append(got, m.Version)
+	}
+	return got
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		dir     string
+		want    []uint64
+		wantErr bool
+	}{
+		{"valid", "testdata/valid", []uint64{1, 2}, false},
+		{"missing-down", "testdata/missing-down", nil, true},
+		{"dialects", "testdata/dialects", []uint64{1, 2}, false},
+		{"missing-dialect-down", "testdata/missing-dialect-down", nil, true},
+		{"duplicate", "testdata/duplicate", nil, true},
+		{"missing-dir", "testdata/missing", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(tt.dir)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && !reflect.DeepEqual(versions(got), tt.want) {
+				t.Errorf("Load() = %v, want %v", versions(got), tt.want)
+			}
+		})
+	}
+
+	got, _ := Load("testdata/valid")
+	if got[1].Name != "add_account_name" || got[1].Up != "ALTER TABLE accounts ADD COLUMN name text;\n" {
+		t.Errorf("Load() = %+v, want the name and SQL of the files", got[1])
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	migrations, err := Load("testdata/valid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(db, "sqlite3", migrations)
+	ctx := context.Background()
+
+	pending, err := m.Pending(ctx)
+	if err != nil || !reflect.DeepEqual(versions(pending), []uint64{1, 2}) {
+		t.Errorf("Migrator.Pending() = %v, %v, want %v", versions(pending), err, []uint64{1, 2})
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil || !reflect.DeepEqual(versions(applied), []uint64{1, 2}) {
+		t.Fatalf("Migrator.Up() = %v, %v, want %v", versions(applied), err, []uint64{1, 2})
+	}
+	if _, err := db.Exec("INSERT INTO accounts (id, name) VALUES (1, 'Acme')"); err != nil {
+		t.Errorf("Migrator.Up() didn't apply the migrations: %v", err)
+	}
+
+	// Applying again doesn't do anything.
+	applied, err = m.Up(ctx)
+	if err != nil || len(applied) != 0 {
+		t.Errorf("Migrator.Up() = %v, %v, want none", versions(applied), err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Migrator.Status() error = %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil || status.Missing {
+			t.Errorf("Migrator.Status() = %+v, want applied", status)
+		}
+	}
+
+	// Reverting goes back one migration at a time.
+	reverted, err := m.Down(ctx)
+	if err != nil || reverted == nil || reverted.Version != 2 {
+		t.Fatalf("Migrator.Down() = %+v, %v, want %v", reverted, err, 2)
+	}
+	if _, err := db.Exec("INSERT INTO accounts (id, name) VALUES (2, 'Acme')"); err == nil {
+		t.Errorf("Migrator.Down() didn't revert migration %d", 2)
+	}
+	pending, _ = m.Pending(ctx)
+	if !reflect.DeepEqual(versions(pending), []uint64{2}) {
+		t.Errorf("Migrator.Pending() = %v, want %v", versions(pending), []uint64{2})
+	}
+
+	if reverted, err = m.Down(ctx); err != nil || reverted == nil || reverted.Version != 1 {
+		t.Fatalf("Migrator.Down() = %+v, %v, want %v", reverted, err, 1)
+	}
+	if reverted, err = m.Down(ctx); err != nil || reverted != nil {
+		t.Errorf("Migrator.Down() = %+v, %v, want nil", reverted, err)
+	}
+}
+
+// The SQL of a dialect replaces the SQL that only works on other databases.
+func TestMigrator_Dialect(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	migrations, err := Load("testdata/dialects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(db, "sqlite3", migrations)
+	ctx := context.Background()
+
+	if applied, err := m.Up(ctx); err != nil || len(applied) != 2 {
+		t.Fatalf("Migrator.Up() = %v, %v, want %v", versions(applied), err, []uint64{1, 2})
+	}
+	if _, err := db.Exec("INSERT INTO accounts (id, name) VALUES (1, 'Acme')"); err != nil {
+		t.Errorf("Migrator.Up() didn't apply the migrations: %v", err)
+	}
+	if reverted, err := m.Down(ctx); err != nil || reverted == nil || reverted.Version != 2 {
+		t.Errorf("Migrator.Down() = %+v, %v, want %v", reverted, err, 2)
+	}
+
+	if migrations[1].Up != "ALTER TABLE accounts ADD COLUMN IF NOT EXISTS name text;\n" {
+		t.Errorf("New() changed the SQL of the loaded migrations to %q", migrations[1].Up)
+	}
+}
+
+// Databases with tables that weren't created by the migrations aren't migrated without a baseline.
+func TestMigrator_UpUnversioned(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	if _, err := db.Exec("CREATE TABLE accounts (id integer, name text)"); err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := Load("testdata/valid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(db, "sqlite3", migrations)
+	ctx := context.Background()
+
+	if applied, err := m.Up(ctx); err != ErrUnversioned || len(applied) != 0 {
+		t.Errorf("Migrator.Up() = %v, %v, want %v", versions(applied), err, ErrUnversioned)
+	}
+	if _, err := m.Pending(ctx); err != ErrUnversioned {
+		t.Errorf("Migrator.Pending() error = %v, want %v", err, ErrUnversioned)
+	}
+}
+
+// Checking the status doesn't change the database, not even by creating the migrations table.
+func TestMigrator_StatusReadOnly(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	migrations, err := Load("testdata/valid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(db, "sqlite3", migrations)
+
+	pending, err := m.Pending(context.Background())
+	if err != nil || !reflect.DeepEqual(versions(pending), []uint64{1, 2}) {
+		t.Errorf("Migrator.Pending() = %v, %v, want %v", versions(pending), err, []uint64{1, 2})
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&n); err != nil || n != 0 {
+		t.Errorf("Migrator.Pending() created %d tables, %v, want none", n, err)
+	}
+}
+
+// Databases that were migrated with AutoMigrate adopt the migrations by recording the first one as applied.
+func TestMigrator_Baseline(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	migrations, err := Load("testdata/valid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(db, "sqlite3", migrations)
+	ctx := context.Background()
+
+	if _, err := m.Baseline(ctx); err == nil {
+		t.Errorf("Migrator.Baseline() error = %v, wantErr %v for an empty database", err, true)
+	}
+
+	if _, err := db.Exec("CREATE TABLE accounts (id integer, PRIMARY KEY (id))"); err != nil {
+		t.Fatal(err)
+	}
+	baseline, err := m.Baseline(ctx)
+	if err != nil || baseline == nil || baseline.Version != 1 {
+		t.Fatalf("Migrator.Baseline() = %+v, %v, want %v", baseline, err, 1)
+	}
+	if _, err := m.Baseline(ctx); err == nil {
+		t.Errorf("Migrator.Baseline() error = %v, wantErr %v for a versioned database", err, true)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil || !reflect.DeepEqual(versions(applied), []uint64{2}) {
+		t.Fatalf("Migrator.Up() = %v, %v, want %v", versions(applied), err, []uint64{2})
+	}
+	if _, err := db.Exec("INSERT INTO accounts (id, name) VALUES (1, 'Acme')"); err != nil {
+		t.Errorf("Migrator.Up() didn't apply the migrations after the baseline: %v", err)
+	}
+}
+
+func TestMigrator_UpFailing(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	migrations, err := Load("testdata/failing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(db, "sqlite3", migrations)
+	ctx := context.Background()
+
+	// The first migration stays applied, the failing one is rolled back completely.
+	applied, err := m.Up(ctx)
+	if err == nil || !reflect.DeepEqual(versions(applied), []uint64{1}) {
+		t.Errorf("Migrator.Up() = %v, %v, want %v and an error", versions(applied), err, []uint64{1})
+	}
+	if _, err := db.Exec("SELECT * FROM users"); err == nil {
+		t.Errorf("Migrator.Up() didn't roll back the failing migration")
+	}
+	pending, _ := m.Pending(ctx)
+	if !reflect.DeepEqual(versions(pending), []uint64{2}) {
+		t.Errorf("Migrator.Pending() = %v, want %v", versions(pending), []uint64{2})
+	}
+}
+
+func TestMigrator_StatusMissing(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	migrations, err := Load("testdata/valid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := New(db, "sqlite3", migrations).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// A binary without the second migration still reports it, but cannot revert it.
+	m := New(db, "sqlite3", migrations[:1])
+	statuses, err := m.Status(ctx)
+	if err != nil || len(statuses) != 2 || !statuses[1].Missing || statuses[1].Name != "add_account_name" {
+		t.Errorf("Migrator.Status() = %+v, %v, want the second migration missing", statuses, err)
+	}
+	if _, err := m.Down(ctx); err == nil {
+		t.Errorf("Migrator.Down() error = %v, wantErr %v", err, true)
+	}
+}
+
+func TestMigrator_Query(t *testing.T) {
+	query := "INSERT INTO t (a, b) VALUES (?, ?)"
+	if got := New(nil, "postgres", nil).query(query); got != "INSERT INTO t (a, b) VALUES ($1, $2)" {
+		t.Errorf("Migrator.query() = %v, want numbered placeholders", got)
+	}
+	if got := New(nil, "sqlite3", nil).query(query); got != query {
+		t.Errorf("Migrator.query() = %v, want %v", got, query)
+	}
+}
+
+// The migrations of the API are written for Postgres, but must at least apply and revert cleanly.
+func TestMigrations(t *testing.T) {
+	db, cleanup := newTestDatabase(t)
+	defer cleanup()
+
+	migrations, err := Load("../../migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(db, "sqlite3", migrations)
+	ctx := context.Background()
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("Migrator.Up() error = %v", err)
+	}
+	for range migrations {
+		if _, err := m.Down(ctx); err != nil {
+			t.Fatalf("Migrator.Down() error = %v", err)
+		}
+	}
+
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name != ?", table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		t.Errorf("Migrator.Down() left table %s", name)
+	}
+}
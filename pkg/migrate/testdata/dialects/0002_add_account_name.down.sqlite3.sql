@@ -0,0 +1,3 @@
+CREATE TABLE accounts_backup AS SELECT id FROM accounts;
+DROP TABLE accounts;
+ALTER TABLE accounts_backup RENAME TO accounts;
@@ -0,0 +1 @@
+CREATE TABLE users (id integer); INSERT INTO unknown VALUES (1);
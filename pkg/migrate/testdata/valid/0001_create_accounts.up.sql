@@ -0,0 +1 @@
+CREATE TABLE accounts (id integer, PRIMARY KEY (id));
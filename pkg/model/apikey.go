@@ -0,0 +1,78 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/Shodske/payment-api/pkg/validation"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// Every API key starts with this prefix, so keys are easily recognised, e.g. by secret scanners.
+const apiKeyPrefix = "pk_"
+
+// Number of random bytes in an API key.
+const apiKeyBytes = 32
+
+// Number of characters of a key that are stored in the clear, so clients can tell their keys apart.
+const apiKeyVisibleLength = len(apiKeyPrefix) + 8
+
+// APIKey model that represents a key an organisation authenticates with. Only a hash of the key is stored, the key
+// itself is only known right after it has been created. Can be marshaled to a json resource according to the json:api
+// specification.
+type APIKey struct {
+	Model          `json:"-"`
+	OrganisationID uuid.UUID  `json:"-" gorm:"type:uuid REFERENCES organisations(id)"`
+	Name           string     `json:"name"`
+	Prefix         string     `json:"prefix" gorm:"type:varchar(16)"`
+	Hash           string     `json:"-" gorm:"type:char(64);unique_index"`
+	Role           Role       `json:"role" gorm:"type:varchar(16)"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+
+	// The key itself, only set when the key has just been created.
+	Key string `json:"key,omitempty" gorm:"-"`
+}
+
+// NewAPIKey generates a new random key for the organisation, with which callers get the role.
+func NewAPIKey(orgID uuid.UUID, name string, role Role) (*APIKey, error) {
+	random := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	key := apiKeyPrefix + hex.EncodeToString(random)
+
+	return &APIKey{
+		OrganisationID: orgID,
+		Name:           name,
+		Prefix:         key[:apiKeyVisibleLength],
+		Hash:           HashAPIKey(key),
+		Role:           role,
+		Key:            key,
+	}, nil
+}
+
+// HashAPIKey hashes a key, to store it or to look it up. Keys are random and long enough that a plain hash can't be
+// brute forced, so no salt or key stretching is needed.
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// GetName method required to implement `jsonapi.EntityNamer`.
+func (key *APIKey) GetName() string {
+	return "api-keys"
+}
+
+// Validate the attributes of an API key that can be set by clients.
+func (key *APIKey) Validate(v *validation.Validator) {
+	if v.Required("name", key.Name) {
+		v.MaxLength("name", key.Name, 255)
+	}
+	v.OneOf("role", string(key.Role), string(RoleViewer), string(RoleOperator), string(RoleAdmin))
+}
+
+// Revoked reports whether the key can no longer be used.
+func (key *APIKey) Revoked() bool {
+	return key.RevokedAt != nil
+}
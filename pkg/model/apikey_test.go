@@ -0,0 +1,66 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Shodske/payment-api/pkg/validation"
+	"github.com/satori/go.uuid"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	orgID := uuid.NewV4()
+	key, err := NewAPIKey(orgID, "CI", RoleOperator)
+	if err != nil {
+		t.Fatalf("NewAPIKey() error = %v", err)
+	}
+
+	if !strings.HasPrefix(key.Key, "pk_") || len(key.Key) != 67 {
+		t.Errorf("NewAPIKey() key = %v, want pk_ and 64 hex characters", key.Key)
+	}
+	if !strings.HasPrefix(key.Key, key.Prefix) || len(key.Prefix) != 11 {
+		t.Errorf("NewAPIKey() prefix = %v, want the start of %v", key.Prefix, key.Key)
+	}
+	if key.Hash != HashAPIKey(key.Key) || strings.Contains(key.Hash, key.Key[3:]) {
+		t.Errorf("NewAPIKey() hash = %v, want the hash of the key", key.Hash)
+	}
+	if key.OrganisationID != orgID || key.Name != "CI" || key.Role != RoleOperator || key.Revoked() {
+		t.Errorf("NewAPIKey() = %+v, want an active key of the organisation", key)
+	}
+
+	other, _ := NewAPIKey(orgID, "CI", RoleOperator)
+	if other.Key == key.Key {
+		t.Errorf("NewAPIKey() key = %v, want a random key", other.Key)
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	if got, want := HashAPIKey("pk_key"), HashAPIKey("pk_key"); got != want || len(got) != 64 {
+		t.Errorf("HashAPIKey() = %v, want a stable sha256 hash", got)
+	}
+	if HashAPIKey("pk_key") == HashAPIKey("pk_other") {
+		t.Errorf("HashAPIKey() must differ for different keys")
+	}
+}
+
+func TestAPIKey_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     *APIKey
+		wantErr bool
+	}{
+		{"base", &APIKey{Name: "CI"}, false},
+		{"role", &APIKey{Name: "CI", Role: RoleViewer}, false},
+		{"missing-name", &APIKey{Role: RoleAdmin}, true},
+		{"unknown-role", &APIKey{Name: "CI", Role: "owner"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validation.New()
+			tt.key.Validate(v)
+			if errs := v.Errors(); (errs != nil) != tt.wantErr {
+				t.Errorf("APIKey.Validate() errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
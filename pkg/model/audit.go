@@ -0,0 +1,140 @@
+package model
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/satori/go.uuid"
+	"strconv"
+	"time"
+)
+
+// AuditOperation is the kind of change an AuditEvent records.
+type AuditOperation string
+
+// Operations recorded in the audit log.
+const (
+	AuditCreate     AuditOperation = "create"
+	AuditUpdate     AuditOperation = "update"
+	AuditDelete     AuditOperation = "delete"
+	AuditTransition AuditOperation = "transition"
+)
+
+// AuditEvent model that records a single change to a resource: who changed it, when, in which request and how. Events
+// are only ever appended to the audit log, never changed or deleted. Can be marshaled to a json resource according to
+// the json:api specification.
+type AuditEvent struct {
+	ID             uint           `json:"-" gorm:"primary_key"`
+	CreatedAt      time.Time      `json:"created_at"`
+	OrganisationID uuid.UUID      `json:"-" gorm:"type:uuid;index"`
+	ResourceType   string         `json:"resource_type" gorm:"type:varchar(32);index:idx_audit_events_resource"`
+	ResourceID     uuid.UUID      `json:"resource_id" gorm:"type:uuid;index:idx_audit_events_resource"`
+	Operation      AuditOperation `json:"operation" gorm:"type:varchar(16)"`
+	// The API key or bearer token the change was made with, e.g. `api-key:<id>`.
+	Actor     string `json:"actor"`
+	RequestID string `json:"request_id,omitempty"`
+	// The attributes that changed, with their values before and after the change.
+	Changes AuditChanges `json:"changes" gorm:"type:text"`
+}
+
+// AuditChange is the value of an attribute before and after a change, as JSON. Attributes that didn't exist before or
+// after the change, because the resource was created or deleted, are null.
+type AuditChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// AuditChanges maps the attributes of a resource to their change. Stored as a JSON document.
+type AuditChanges map[string]AuditChange
+
+// DiffJSON compares the JSON objects of a resource before and after a change, returning the attributes of which the
+// value changed. Either may be nil, for resources that are created or deleted.
+func DiffJSON(before, after []byte) (AuditChanges, error) {
+	beforeAttributes, err := decodeAttributes(before)
+	if err != nil {
+		return nil, err
+	}
+	afterAttributes, err := decodeAttributes(after)
+	if err != nil {
+		return nil, err
+	}
+
+	// Attributes that are missing are the same as attributes that are null.
+	changes := AuditChanges{}
+	for _, attributes := range []map[string]json.RawMessage{beforeAttributes, afterAttributes} {
+		for name := range attributes {
+			from, to := nullJSON(beforeAttributes[name]), nullJSON(afterAttributes[name])
+			if !bytes.Equal(from, to) {
+				changes[name] = AuditChange{Before: from, After: to}
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// Value method required to implement `driver.Valuer`.
+func (changes AuditChanges) Value() (driver.Value, error) {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+// Scan method required to implement `sql.Scanner`.
+func (changes *AuditChanges) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case nil:
+		*changes = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(data, changes)
+	case string:
+		return json.Unmarshal([]byte(data), changes)
+	}
+
+	return errors.New("cannot scan audit changes")
+}
+
+// GetID method required to implement `jsonapi.MarshalIdentifier`.
+func (event *AuditEvent) GetID() string {
+	return strconv.FormatUint(uint64(event.ID), 10)
+}
+
+// GetName method required to implement `jsonapi.EntityNamer`.
+func (event *AuditEvent) GetName() string {
+	return "audit-events"
+}
+
+// Decode a JSON object into its attributes, compacting their values so they can be compared. Nil has no attributes.
+func decodeAttributes(data []byte) (map[string]json.RawMessage, error) {
+	attributes := make(map[string]json.RawMessage)
+	if data == nil {
+		return attributes, nil
+	}
+	if err := json.Unmarshal(data, &attributes); err != nil {
+		return nil, err
+	}
+
+	for name, value := range attributes {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, value); err != nil {
+			return nil, err
+		}
+		attributes[name] = compact.Bytes()
+	}
+
+	return attributes, nil
+}
+
+// A JSON value, or null when there is none.
+func nullJSON(value json.RawMessage) json.RawMessage {
+	if value == nil {
+		return json.RawMessage("null")
+	}
+
+	return value
+}
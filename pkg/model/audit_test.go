@@ -0,0 +1,89 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+	change := func(before, after string) AuditChange {
+		return AuditChange{Before: json.RawMessage(before), After: json.RawMessage(after)}
+	}
+
+	tests := []struct {
+		name    string
+		before  string
+		after   string
+		want    AuditChanges
+		wantErr bool
+	}{
+		{"create", "", `{"amount": "13.37", "fx": {"rate": "1.1"}, "reference": null}`, AuditChanges{
+			"amount": change(`null`, `"13.37"`),
+			"fx":     change(`null`, `{"rate":"1.1"}`),
+		}, false},
+		{"update", `{"amount": "13.37", "currency": "GBP", "fx": {"rate": "1.1"}}`, `{"amount":"1.00","currency":"GBP","fx":{"rate":"1.1"}}`, AuditChanges{
+			"amount": change(`"13.37"`, `"1.00"`),
+		}, false},
+		{"nested", `{"fx": {"rate": "1.1", "reference": "A"}}`, `{"fx": {"rate": "1.2", "reference": "A"}}`, AuditChanges{
+			"fx": change(`{"rate":"1.1","reference":"A"}`, `{"rate":"1.2","reference":"A"}`),
+		}, false},
+		{"removed", `{"status": "pending", "reference": "A"}`, `{"status": "pending"}`, AuditChanges{
+			"reference": change(`"A"`, `null`),
+		}, false},
+		{"delete", `{"name": "Organisation"}`, "", AuditChanges{
+			"name": change(`"Organisation"`, `null`),
+		}, false},
+		{"unchanged", `{"name": "Organisation"}`, `{"name": "Organisation"}`, AuditChanges{}, false},
+		{"invalid", `{"name": "Organisation"}`, `[]`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before, after []byte
+			if tt.before != "" {
+				before = []byte(tt.before)
+			}
+			if tt.after != "" {
+				after = []byte(tt.after)
+			}
+
+			got, err := DiffJSON(before, after)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DiffJSON() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffJSON() = %s, want %s", marshal(got), marshal(tt.want))
+			}
+		})
+	}
+}
+
+func TestAuditChanges_Scan(t *testing.T) {
+	changes := AuditChanges{"amount": {Before: json.RawMessage(`"13.37"`), After: json.RawMessage(`"1.00"`)}}
+	value, err := changes.Value()
+	if err != nil {
+		t.Fatalf("AuditChanges.Value() error = %v", err)
+	}
+
+	for _, src := range []interface{}{value, []byte(value.(string))} {
+		var got AuditChanges
+		if err := got.Scan(src); err != nil || !reflect.DeepEqual(got, changes) {
+			t.Errorf("AuditChanges.Scan() = %v, %v, want %v", got, err, changes)
+		}
+	}
+
+	var got AuditChanges
+	if err := got.Scan(nil); err != nil || got != nil {
+		t.Errorf("AuditChanges.Scan() = %v, %v, want %v", got, err, nil)
+	}
+	if err := got.Scan(42); err == nil {
+		t.Errorf("AuditChanges.Scan() error = %v, wantErr %v", err, true)
+	}
+}
+
+// Marshal the changes for error messages, as the raw messages aren't readable otherwise.
+func marshal(changes AuditChanges) string {
+	data, _ := json.Marshal(changes)
+	return string(data)
+}
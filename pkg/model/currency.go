@@ -0,0 +1,244 @@
+package model
+
+import "sort"
+
+// Currency as defined by ISO 4217.
+type Currency struct {
+	// Alphabetic code, e.g. `GBP`, which is used as the ID of the resource.
+	Code        string `json:"-"`
+	NumericCode string `json:"numeric_code"`
+	// Number of digits after the decimal point, e.g. 2 for GBP and 0 for JPY.
+	MinorUnits int    `json:"minor_units"`
+	Name       string `json:"name"`
+	// Whether the currency is still in use. Inactive currencies are kept, so historic amounts can still be handled.
+	Active bool `json:"active"`
+}
+
+// GetID method required to implement `jsonapi.MarshalIdentifier`.
+func (currency *Currency) GetID() string {
+	return currency.Code
+}
+
+// Table of ISO 4217 currencies, ordered by code. Funds and precious metals, which don't have minor units, are left out.
+var currencies = []Currency{
+	{"AED", "784", 2, "UAE Dirham", true},
+	{"AFN", "971", 2, "Afghani", true},
+	{"ALL", "008", 2, "Lek", true},
+	{"AMD", "051", 2, "Armenian Dram", true},
+	{"ANG", "532", 2, "Netherlands Antillean Guilder", false},
+	{"AOA", "973", 2, "Kwanza", true},
+	{"ARS", "032", 2, "Argentine Peso", true},
+	{"AUD", "036", 2, "Australian Dollar", true},
+	{"AWG", "533", 2, "Aruban Florin", true},
+	{"AZN", "944", 2, "Azerbaijan Manat", true},
+	{"BAM", "977", 2, "Convertible Mark", true},
+	{"BBD", "052", 2, "Barbados Dollar", true},
+	{"BDT", "050", 2, "Taka", true},
+	{"BGN", "975", 2, "Bulgarian Lev", true},
+	{"BHD", "048", 3, "Bahraini Dinar", true},
+	{"BIF", "108", 0, "Burundi Franc", true},
+	{"BMD", "060", 2, "Bermudian Dollar", true},
+	{"BND", "096", 2, "Brunei Dollar", true},
+	{"BOB", "068", 2, "Boliviano", true},
+	{"BOV", "984", 2, "Mvdol", true},
+	{"BRL", "986", 2, "Brazilian Real", true},
+	{"BSD", "044", 2, "Bahamian Dollar", true},
+	{"BTN", "064", 2, "Ngultrum", true},
+	{"BWP", "072", 2, "Pula", true},
+	{"BYN", "933", 2, "Belarusian Ruble", true},
+	{"BYR", "974", 0, "Belarusian Ruble", false},
+	{"BZD", "084", 2, "Belize Dollar", true},
+	{"CAD", "124", 2, "Canadian Dollar", true},
+	{"CDF", "976", 2, "Congolese Franc", true},
+	{"CHE", "947", 2, "WIR Euro", true},
+	{"CHF", "756", 2, "Swiss Franc", true},
+	{"CHW", "948", 2, "WIR Franc", true},
+	{"CLF", "990", 4, "Unidad de Fomento", true},
+	{"CLP", "152", 0, "Chilean Peso", true},
+	{"CNY", "156", 2, "Yuan Renminbi", true},
+	{"COP", "170", 2, "Colombian Peso", true},
+	{"COU", "970", 2, "Unidad de Valor Real", true},
+	{"CRC", "188", 2, "Costa Rican Colon", true},
+	{"CUC", "931", 2, "Peso Convertible", false},
+	{"CUP", "192", 2, "Cuban Peso", true},
+	{"CVE", "132", 2, "Cabo Verde Escudo", true},
+	{"CZK", "203", 2, "Czech Koruna", true},
+	{"DJF", "262", 0, "Djibouti Franc", true},
+	{"DKK", "208", 2, "Danish Krone", true},
+	{"DOP", "214", 2, "Dominican Peso", true},
+	{"DZD", "012", 2, "Algerian Dinar", true},
+	{"EEK", "233", 2, "Kroon", false},
+	{"EGP", "818", 2, "Egyptian Pound", true},
+	{"ERN", "232", 2, "Nakfa", true},
+	{"ETB", "230", 2, "Ethiopian Birr", true},
+	{"EUR", "978", 2, "Euro", true},
+	{"FJD", "242", 2, "Fiji Dollar", true},
+	{"FKP", "238", 2, "Falkland Islands Pound", true},
+	{"GBP", "826", 2, "Pound Sterling", true},
+	{"GEL", "981", 2, "Lari", true},
+	{"GHS", "936", 2, "Ghana Cedi", true},
+	{"GIP", "292", 2, "Gibraltar Pound", true},
+	{"GMD", "270", 2, "Dalasi", true},
+	{"GNF", "324", 0, "Guinean Franc", true},
+	{"GTQ", "320", 2, "Quetzal", true},
+	{"GYD", "328", 2, "Guyana Dollar", true},
+	{"HKD", "344", 2, "Hong Kong Dollar", true},
+	{"HNL", "340", 2, "Lempira", true},
+	{"HRK", "191", 2, "Kuna", false},
+	{"HTG", "332", 2, "Gourde", true},
+	{"HUF", "348", 2, "Forint", true},
+	{"IDR", "360", 2, "Rupiah", true},
+	{"ILS", "376", 2, "New Israeli Sheqel", true},
+	{"INR", "356", 2, "Indian Rupee", true},
+	{"IQD", "368", 3, "Iraqi Dinar", true},
+	{"IRR", "364", 2, "Iranian Rial", true},
+	{"ISK", "352", 0, "Iceland Krona", true},
+	{"JMD", "388", 2, "Jamaican Dollar", true},
+	{"JOD", "400", 3, "Jordanian Dinar", true},
+	{"JPY", "392", 0, "Yen", true},
+	{"KES", "404", 2, "Kenyan Shilling", true},
+	{"KGS", "417", 2, "Som", true},
+	{"KHR", "116", 2, "Riel", true},
+	{"KMF", "174", 0, "Comorian Franc", true},
+	{"KPW", "408", 2, "North Korean Won", true},
+	{"KRW", "410", 0, "Won", true},
+	{"KWD", "414", 3, "Kuwaiti Dinar", true},
+	{"KYD", "136", 2, "Cayman Islands Dollar", true},
+	{"KZT", "398", 2, "Tenge", true},
+	{"LAK", "418", 2, "Lao Kip", true},
+	{"LBP", "422", 2, "Lebanese Pound", true},
+	{"LKR", "144", 2, "Sri Lanka Rupee", true},
+	{"LRD", "430", 2, "Liberian Dollar", true},
+	{"LSL", "426", 2, "Loti", true},
+	{"LTL", "440", 2, "Lithuanian Litas", false},
+	{"LVL", "428", 2, "Latvian Lats", false},
+	{"LYD", "434", 3, "Libyan Dinar", true},
+	{"MAD", "504", 2, "Moroccan Dirham", true},
+	{"MDL", "498", 2, "Moldovan Leu", true},
+	{"MGA", "969", 2, "Malagasy Ariary", true},
+	{"MKD", "807", 2, "Denar", true},
+	{"MMK", "104", 2, "Kyat", true},
+	{"MNT", "496", 2, "Tugrik", true},
+	{"MOP", "446", 2, "Pataca", true},
+	{"MRO", "478", 2, "Ouguiya", false},
+	{"MRU", "929", 2, "Ouguiya", true},
+	{"MUR", "480", 2, "Mauritius Rupee", true},
+	{"MVR", "462", 2, "Rufiyaa", true},
+	{"MWK", "454", 2, "Malawi Kwacha", true},
+	{"MXN", "484", 2, "Mexican Peso", true},
+	{"MXV", "979", 2, "Mexican Unidad de Inversion (UDI)", true},
+	{"MYR", "458", 2, "Malaysian Ringgit", true},
+	{"MZN", "943", 2, "Mozambique Metical", true},
+	{"NAD", "516", 2, "Namibia Dollar", true},
+	{"NGN", "566", 2, "Naira", true},
+	{"NIO", "558", 2, "Cordoba Oro", true},
+	{"NOK", "578", 2, "Norwegian Krone", true},
+	{"NPR", "524", 2, "Nepalese Rupee", true},
+	{"NZD", "554", 2, "New Zealand Dollar", true},
+	{"OMR", "512", 3, "Rial Omani", true},
+	{"PAB", "590", 2, "Balboa", true},
+	{"PEN", "604", 2, "Sol", true},
+	{"PGK", "598", 2, "Kina", true},
+	{"PHP", "608", 2, "Philippine Peso", true},
+	{"PKR", "586", 2, "Pakistan Rupee", true},
+	{"PLN", "985", 2, "Zloty", true},
+	{"PYG", "600", 0, "Guarani", true},
+	{"QAR", "634", 2, "Qatari Rial", true},
+	{"RON", "946", 2, "Romanian Leu", true},
+	{"RSD", "941", 2, "Serbian Dinar", true},
+	{"RUB", "643", 2, "Russian Ruble", true},
+	{"RWF", "646", 0, "Rwanda Franc", true},
+	{"SAR", "682", 2, "Saudi Riyal", true},
+	{"SBD", "090", 2, "Solomon Islands Dollar", true},
+	{"SCR", "690", 2, "Seychelles Rupee", true},
+	{"SDG", "938", 2, "Sudanese Pound", true},
+	{"SEK", "752", 2, "Swedish Krona", true},
+	{"SGD", "702", 2, "Singapore Dollar", true},
+	{"SHP", "654", 2, "Saint Helena Pound", true},
+	{"SLE", "925", 2, "Leone", true},
+	{"SLL", "694", 2, "Leone", false},
+	{"SOS", "706", 2, "Somali Shilling", true},
+	{"SRD", "968", 2, "Surinam Dollar", true},
+	{"SSP", "728", 2, "South Sudanese Pound", true},
+	{"STD", "678", 2, "Dobra", false},
+	{"STN", "930", 2, "Dobra", true},
+	{"SVC", "222", 2, "El Salvador Colon", true},
+	{"SYP", "760", 2, "Syrian Pound", true},
+	{"SZL", "748", 2, "Lilangeni", true},
+	{"THB", "764", 2, "Baht", true},
+	{"TJS", "972", 2, "Somoni", true},
+	{"TMT", "934", 2, "Turkmenistan New Manat", true},
+	{"TND", "788", 3, "Tunisian Dinar", true},
+	{"TOP", "776", 2, "Pa'anga", true},
+	{"TRY", "949", 2, "Turkish Lira", true},
+	{"TTD", "780", 2, "Trinidad and Tobago Dollar", true},
+	{"TWD", "901", 2, "New Taiwan Dollar", true},
+	{"TZS", "834", 2, "Tanzanian Shilling", true},
+	{"UAH", "980", 2, "Hryvnia", true},
+	{"UGX", "800", 0, "Uganda Shilling", true},
+	{"USD", "840", 2, "US Dollar", true},
+	{"USN", "997", 2, "US Dollar (Next day)", true},
+	{"UYI", "940", 0, "Uruguay Peso en Unidades Indexadas (UI)", true},
+	{"UYU", "858", 2, "Peso Uruguayo", true},
+	{"UYW", "927", 4, "Unidad Previsional", true},
+	{"UZS", "860", 2, "Uzbekistan Sum", true},
+	{"VED", "926", 2, "Bolívar Soberano", true},
+	{"VEF", "937", 2, "Bolívar", false},
+	{"VES", "928", 2, "Bolívar Soberano", true},
+	{"VND", "704", 0, "Dong", true},
+	{"VUV", "548", 0, "Vatu", true},
+	{"WST", "882", 2, "Tala", true},
+	{"XAF", "950", 0, "CFA Franc BEAC", true},
+	{"XCD", "951", 2, "East Caribbean Dollar", true},
+	{"XCG", "532", 2, "Caribbean Guilder", true},
+	{"XOF", "952", 0, "CFA Franc BCEAO", true},
+	{"XPF", "953", 0, "CFP Franc", true},
+	{"YER", "886", 2, "Yemeni Rial", true},
+	{"ZAR", "710", 2, "Rand", true},
+	{"ZMW", "967", 2, "Zambian Kwacha", true},
+	{"ZWG", "924", 2, "Zimbabwe Gold", true},
+	{"ZWL", "932", 2, "Zimbabwe Dollar", false},
+}
+
+var currenciesByCode = indexCurrencies(currencies)
+
+// Currencies returns all known ISO 4217 currencies, including inactive ones, ordered by code.
+func Currencies() []*Currency {
+	all := make([]*Currency, len(currencies))
+	for i := range currencies {
+		currency := currencies[i]
+		all[i] = &currency
+	}
+
+	return all
+}
+
+// LookupCurrency returns the ISO 4217 currency with the given alphabetic code. Returns false for unknown currencies.
+func LookupCurrency(code string) (*Currency, bool) {
+	currency, ok := currenciesByCode[code]
+	if !ok {
+		return nil, false
+	}
+
+	return &currency, true
+}
+
+// MinorUnits returns the number of digits after the decimal point of an ISO 4217 currency, e.g. 2 for GBP, 0 for JPY
+// and 3 for KWD. Returns false for unknown currencies.
+func MinorUnits(code string) (int, bool) {
+	currency, ok := currenciesByCode[code]
+	return currency.MinorUnits, ok
+}
+
+func indexCurrencies(currencies []Currency) map[string]Currency {
+	if !sort.SliceIsSorted(currencies, func(i, j int) bool { return currencies[i].Code < currencies[j].Code }) {
+		panic("currencies must be ordered by code")
+	}
+
+	index := make(map[string]Currency, len(currencies))
+	for _, currency := range currencies {
+		index[currency.Code] = currency
+	}
+
+	return index
+}
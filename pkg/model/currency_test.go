@@ -0,0 +1,69 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookupCurrency(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   string
+		want   *Currency
+		wantOk bool
+	}{
+		{"GBP", "GBP", &Currency{"GBP", "826", 2, "Pound Sterling", true}, true},
+		{"JPY", "JPY", &Currency{"JPY", "392", 0, "Yen", true}, true},
+		{"KWD", "KWD", &Currency{"KWD", "414", 3, "Kuwaiti Dinar", true}, true},
+		{"inactive", "HRK", &Currency{"HRK", "191", 2, "Kuna", false}, true},
+		{"lowercase", "gbp", nil, false},
+		{"unknown", "XYZ", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := LookupCurrency(tt.code)
+			if ok != tt.wantOk {
+				t.Errorf("LookupCurrency() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LookupCurrency() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrencies(t *testing.T) {
+	all := Currencies()
+	if len(all) != len(currencies) {
+		t.Errorf("Currencies() length = %v, want %v", len(all), len(currencies))
+	}
+
+	// Modifying the returned currencies must not affect the table.
+	all[0].MinorUnits = 42
+	if units, _ := MinorUnits(all[0].Code); units == 42 {
+		t.Errorf("MinorUnits() = %v, want the table to be unaffected", units)
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   string
+		want   int
+		wantOk bool
+	}{
+		{"GBP", "GBP", 2, true},
+		{"JPY", "JPY", 0, true},
+		{"KWD", "KWD", 3, true},
+		{"UYW", "UYW", 4, true},
+		{"unknown", "XYZ", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := MinorUnits(tt.code)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("MinorUnits() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// IdempotencyKey model stores the outcome of a request that was sent with an `Idempotency-Key` header, so retries of
+// that request can be answered with the same response instead of executing it again. Keys are unique per organisation.
+type IdempotencyKey struct {
+	ID             uint      `gorm:"primary_key"`
+	OrganisationID uuid.UUID `gorm:"type:uuid;unique_index:idx_idempotency_keys_organisation_key"`
+	Key            string    `gorm:"type:varchar(255);unique_index:idx_idempotency_keys_organisation_key"`
+	Fingerprint    string    `gorm:"type:char(64)"`
+	ResponseCode   int
+	Response       string `gorm:"type:text"`
+	CreatedAt      time.Time
+}
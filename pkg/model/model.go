@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"errors"
 	"github.com/satori/go.uuid"
 	"time"
@@ -52,3 +53,29 @@ func (m *Model) BeforeCreate() error {
 	}
 	return nil
 }
+
+// Marshal the attributes of a model, limited to the given fields. Fields without a value, which are omitted when
+// marshaling all attributes, are marshaled as null, so they are still part of a sparse fieldset. Nil fields marshal
+// all attributes.
+func marshalFields(attributes interface{}, fields []string) ([]byte, error) {
+	data, err := json.Marshal(attributes)
+	if err != nil || fields == nil {
+		return data, err
+	}
+
+	all := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	sparse := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			sparse[field] = value
+		} else {
+			sparse[field] = json.RawMessage("null")
+		}
+	}
+
+	return json.Marshal(sparse)
+}
@@ -0,0 +1,351 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RoundingMode type and constants. Money never rounds implicitly, every operation that could lose precision requires
+// one of these modes.
+type RoundingMode int
+
+// All supported rounding modes.
+const (
+	// RoundHalfEven rounds to the nearest neighbour, or to the even neighbour when both are equally near. Also known as
+	// banker's rounding, e.g. 2.345 → 2.34 and 2.355 → 2.36.
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds to the nearest neighbour, or away from zero when both are equally near, e.g. 2.345 → 2.35 and
+	// -2.345 → -2.35.
+	RoundHalfUp
+	// RoundDown rounds towards zero, i.e. truncates, e.g. 2.349 → 2.34 and -2.349 → -2.34.
+	RoundDown
+	// RoundUp rounds away from zero, e.g. 2.341 → 2.35 and -2.341 → -2.35.
+	RoundUp
+)
+
+var moneyRegex = regexp.MustCompile(`^(-?)(\d+)(?:\.(\d+))?$`)
+
+var bigTen = big.NewInt(10)
+
+// Money is an exact decimal amount of money, represented by an unscaled integer and a scale, i.e. the number of digits
+// after the decimal point. The value of Money is `unscaled × 10^-scale`, e.g. 13.37 has unscaled value 1337 and scale
+// 2. Money is immutable, all operations return new Money.
+//
+// Money is serialised to json and the database as a decimal string, e.g. "13.37", keeping its scale intact.
+type Money struct {
+	unscaled *big.Int
+	scale    int
+
+	// The raw json value, when it couldn't be parsed. Kept, so the violation can be reported by validation along with
+	// all other violations, instead of failing to decode the whole request document.
+	invalid string
+}
+
+// ParseMoney parses a decimal string, e.g. "13.37" or "-0.5", into Money.
+func ParseMoney(s string) (Money, error) {
+	matches := moneyRegex.FindStringSubmatch(s)
+	if matches == nil {
+		return Money{}, fmt.Errorf("invalid amount of money `%s`", s)
+	}
+
+	unscaled, _ := new(big.Int).SetString(matches[2]+matches[3], 10)
+	if matches[1] == "-" {
+		unscaled.Neg(unscaled)
+	}
+
+	return Money{unscaled: unscaled, scale: len(matches[3])}, nil
+}
+
+// MustParseMoney is like ParseMoney, but panics when the string cannot be parsed. Intended for constant amounts.
+func MustParseMoney(s string) Money {
+	m, err := ParseMoney(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return m
+}
+
+// NewMoneyFromMinorUnits creates Money from an amount of minor units of a currency, e.g. 1337 GBP pence is 13.37.
+func NewMoneyFromMinorUnits(units int64, currency string) (Money, error) {
+	scale, ok := MinorUnits(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("unknown currency `%s`", currency)
+	}
+
+	return Money{unscaled: big.NewInt(units), scale: scale}, nil
+}
+
+// Err returns an error when the Money was decoded from an invalid json value.
+func (m Money) Err() error {
+	if m.invalid != "" {
+		return fmt.Errorf("invalid amount of money `%s`", m.invalid)
+	}
+
+	return nil
+}
+
+// Scale returns the number of digits after the decimal point.
+func (m Money) Scale() int {
+	return m.scale
+}
+
+// Sign returns -1, 0 or 1 for negative, zero and positive Money.
+func (m Money) Sign() int {
+	return m.int().Sign()
+}
+
+// IsZero checks whether the Money is zero, regardless of its scale.
+func (m Money) IsZero() bool {
+	return m.Sign() == 0
+}
+
+// Cmp compares the Money with another, returning -1, 0 or 1 when it is less than, equal to or greater than the other.
+func (m Money) Cmp(other Money) int {
+	a, b := align(m, other)
+	return a.Cmp(b)
+}
+
+// Equal checks whether the Money has the same value as another, regardless of their scales, e.g. 1.5 equals 1.50.
+func (m Money) Equal(other Money) bool {
+	return m.Cmp(other) == 0
+}
+
+// Neg returns the negated Money.
+func (m Money) Neg() Money {
+	return Money{unscaled: new(big.Int).Neg(m.int()), scale: m.scale}
+}
+
+// Add returns the sum of the Money and another. The scale of the sum is the largest of both scales.
+func (m Money) Add(other Money) Money {
+	a, b := align(m, other)
+	return Money{unscaled: a.Add(a, b), scale: maxInt(m.scale, other.scale)}
+}
+
+// Sub returns the difference of the Money and another. The scale of the difference is the largest of both scales.
+func (m Money) Sub(other Money) Money {
+	a, b := align(m, other)
+	return Money{unscaled: a.Sub(a, b), scale: maxInt(m.scale, other.scale)}
+}
+
+// Mul returns the exact product of the Money and a factor, e.g. an exchange rate. The scale of the product is the sum
+// of both scales, use Round to bring it back to the precision of a currency.
+func (m Money) Mul(factor Money) Money {
+	return Money{unscaled: new(big.Int).Mul(m.int(), factor.int()), scale: m.scale + factor.scale}
+}
+
+// Div returns the quotient of the Money and a divisor, rounded to the given scale using the rounding mode. Returns an
+// error when dividing by zero.
+func (m Money) Div(divisor Money, scale int, mode RoundingMode) (Money, error) {
+	if divisor.IsZero() {
+		return Money{}, errors.New("division by zero")
+	}
+
+	// m / d = (m.unscaled × 10^-m.scale) / (d.unscaled × 10^-d.scale). Scale the numerator up so the integer
+	// division yields one more digit than the requested scale, the remainder decides the rounding of that result.
+	exp := scale + divisor.scale - m.scale
+	numerator := new(big.Int).Set(m.int())
+	denominator := new(big.Int).Set(divisor.int())
+	if exp >= 0 {
+		numerator.Mul(numerator, pow10(exp))
+	} else {
+		denominator.Mul(denominator, pow10(-exp))
+	}
+
+	return Money{unscaled: roundQuo(numerator, denominator, mode), scale: scale}, nil
+}
+
+// Round returns the Money with the given scale, rounded using the rounding mode when the scale is decreased.
+func (m Money) Round(scale int, mode RoundingMode) Money {
+	if scale < 0 {
+		scale = 0
+	}
+	if scale >= m.scale {
+		return Money{unscaled: new(big.Int).Mul(m.int(), pow10(scale-m.scale)), scale: scale}
+	}
+
+	return Money{unscaled: roundQuo(m.int(), pow10(m.scale-scale), mode), scale: scale}
+}
+
+// RoundToCurrency returns the Money with the scale of the minor units of the currency, e.g. 2 for GBP and 0 for JPY,
+// rounded using the rounding mode. Returns an error for unknown currencies.
+func (m Money) RoundToCurrency(currency string, mode RoundingMode) (Money, error) {
+	scale, ok := MinorUnits(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("unknown currency `%s`", currency)
+	}
+
+	return m.Round(scale, mode), nil
+}
+
+// FitsCurrency checks whether the Money can be expressed in the minor units of the currency without rounding, e.g.
+// 13.37 fits GBP, but not JPY. Unknown currencies never fit.
+func (m Money) FitsCurrency(currency string) bool {
+	rounded, err := m.RoundToCurrency(currency, RoundDown)
+	return err == nil && rounded.Equal(m)
+}
+
+// MinorUnits returns the Money as an amount of minor units of the currency, e.g. 13.37 GBP is 1337 pence. Returns an
+// error for unknown currencies and Money that doesn't fit the currency or an int64.
+func (m Money) MinorUnits(currency string) (int64, error) {
+	if !m.FitsCurrency(currency) {
+		return 0, fmt.Errorf("amount `%s` cannot be expressed in minor units of `%s`", m, currency)
+	}
+
+	rounded, _ := m.RoundToCurrency(currency, RoundDown)
+	if !rounded.unscaled.IsInt64() {
+		return 0, fmt.Errorf("amount `%s` is too large", m)
+	}
+
+	return rounded.unscaled.Int64(), nil
+}
+
+// String returns the Money as a decimal string, with exactly `scale` digits after the decimal point.
+func (m Money) String() string {
+	if m.invalid != "" {
+		return m.invalid
+	}
+
+	digits := new(big.Int).Abs(m.int()).String()
+	if len(digits) <= m.scale {
+		digits = strings.Repeat("0", m.scale-len(digits)+1) + digits
+	}
+
+	s := digits
+	if m.scale > 0 {
+		s = digits[:len(digits)-m.scale] + "." + digits[len(digits)-m.scale:]
+	}
+	if m.Sign() < 0 {
+		s = "-" + s
+	}
+
+	return s
+}
+
+// MarshalJSON method required to implement `json.Marshaler`. Money is marshaled as a decimal string.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON method required to implement `json.Unmarshaler`. Accepts both decimal strings and numbers, invalid
+// values are kept and reported through Err.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		// Not a string, so it is either a number or an invalid value.
+		s = string(data)
+	}
+
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		*m = Money{invalid: s}
+		return nil
+	}
+
+	*m = parsed
+
+	return nil
+}
+
+// Value method required to implement `driver.Valuer`. Money is stored as a decimal string.
+func (m Money) Value() (driver.Value, error) {
+	if err := m.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.String(), nil
+}
+
+// Scan method required to implement `sql.Scanner`.
+func (m *Money) Scan(src interface{}) error {
+	var s string
+	switch value := src.(type) {
+	case []byte:
+		s = string(value)
+	case string:
+		s = value
+	case int64:
+		s = strconv.FormatInt(value, 10)
+	case float64:
+		s = strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+
+	return nil
+}
+
+// The unscaled value, where the zero value of Money represents zero.
+func (m Money) int() *big.Int {
+	if m.unscaled == nil {
+		return new(big.Int)
+	}
+
+	return m.unscaled
+}
+
+// Return copies of the unscaled values of both Money, scaled to the largest of both scales.
+func align(a, b Money) (*big.Int, *big.Int) {
+	scale := maxInt(a.scale, b.scale)
+	return new(big.Int).Mul(a.int(), pow10(scale-a.scale)), new(big.Int).Mul(b.int(), pow10(scale-b.scale))
+}
+
+// Divide the numerator by the denominator, rounding the quotient using the rounding mode.
+func roundQuo(numerator, denominator *big.Int, mode RoundingMode) *big.Int {
+	quo, rem := new(big.Int).QuoRem(numerator, denominator, new(big.Int))
+	if rem.Sign() == 0 {
+		return quo
+	}
+
+	// The sign of the exact result, which is the direction to round away from zero in.
+	sign := numerator.Sign() * denominator.Sign()
+
+	// Compare twice the remainder to the denominator, to know whether the remainder is below, at or above half.
+	half := new(big.Int).Abs(rem)
+	half.Mul(half, big.NewInt(2))
+	cmpHalf := half.Cmp(new(big.Int).Abs(denominator))
+
+	awayFromZero := false
+	switch mode {
+	case RoundHalfEven:
+		awayFromZero = cmpHalf > 0 || (cmpHalf == 0 && quo.Bit(0) == 1)
+	case RoundHalfUp:
+		awayFromZero = cmpHalf >= 0
+	case RoundUp:
+		awayFromZero = true
+	case RoundDown:
+		awayFromZero = false
+	}
+
+	if awayFromZero {
+		quo.Add(quo, big.NewInt(int64(sign)))
+	}
+
+	return quo
+}
+
+// Return 10^n.
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
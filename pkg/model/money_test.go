@@ -0,0 +1,307 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Parse a constant amount of money, for use in struct literals.
+func money(s string) *Money {
+	m := MustParseMoney(s)
+	return &m
+}
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    string
+		wantErr bool
+	}{
+		{"integer", "12", "12", false},
+		{"decimal", "13.37", "13.37", false},
+		{"trailing-zeroes", "5.00", "5.00", false},
+		{"leading-zeroes", "007.5", "7.5", false},
+		{"fraction", "0.05", "0.05", false},
+		{"negative", "-0.5", "-0.5", false},
+		{"large", "123456789012345678901234567890.12", "123456789012345678901234567890.12", false},
+		{"empty", "", "", true},
+		{"letters", "abc", "", true},
+		{"comma", "12,34", "", true},
+		{"exponent", "1e3", "", true},
+		{"trailing-point", "12.", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMoney(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseMoney() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("ParseMoney() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewMoneyFromMinorUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		units    int64
+		currency string
+		want     string
+		wantErr  bool
+	}{
+		{"GBP", 1337, "GBP", "13.37", false},
+		{"JPY", 1337, "JPY", "1337", false},
+		{"KWD", 1337, "KWD", "1.337", false},
+		{"negative", -5, "GBP", "-0.05", false},
+		{"unknown", 1337, "XXX", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewMoneyFromMinorUnits(tt.units, tt.currency)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewMoneyFromMinorUnits() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("NewMoneyFromMinorUnits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoney_Arithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Money
+		want string
+	}{
+		{"add", MustParseMoney("13.37").Add(MustParseMoney("0.005")), "13.375"},
+		{"add-float-trap", MustParseMoney("0.1").Add(MustParseMoney("0.2")), "0.3"},
+		{"sub", MustParseMoney("5.00").Sub(MustParseMoney("7.5")), "-2.50"},
+		{"mul", MustParseMoney("200.42").Mul(MustParseMoney("1.77700")), "356.1463400"},
+		{"neg", MustParseMoney("1.50").Neg(), "-1.50"},
+		{"zero-value", Money{}.Add(MustParseMoney("1.5")), "1.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.got.String(); got != tt.want {
+				t.Errorf("Money = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoney_Cmp(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want int
+	}{
+		{"equal-scales", "1.5", "1.50", 0},
+		{"less", "1.49", "1.5", -1},
+		{"greater", "10", "9.99", 1},
+		{"negative", "-1", "0", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MustParseMoney(tt.a).Cmp(MustParseMoney(tt.b)); got != tt.want {
+				t.Errorf("Money.Cmp() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoney_Round(t *testing.T) {
+	tests := []struct {
+		name  string
+		m     string
+		scale int
+		mode  RoundingMode
+		want  string
+	}{
+		{"half-even-down", "2.345", 2, RoundHalfEven, "2.34"},
+		{"half-even-up", "2.355", 2, RoundHalfEven, "2.36"},
+		{"half-even-above-half", "2.3451", 2, RoundHalfEven, "2.35"},
+		{"half-even-negative", "-2.345", 2, RoundHalfEven, "-2.34"},
+		{"half-up", "2.345", 2, RoundHalfUp, "2.35"},
+		{"half-up-below-half", "2.3449", 2, RoundHalfUp, "2.34"},
+		{"half-up-negative", "-2.345", 2, RoundHalfUp, "-2.35"},
+		{"down", "2.349", 2, RoundDown, "2.34"},
+		{"down-negative", "-2.349", 2, RoundDown, "-2.34"},
+		{"up", "2.341", 2, RoundUp, "2.35"},
+		{"up-negative", "-2.341", 2, RoundUp, "-2.35"},
+		{"exact", "2.340", 2, RoundUp, "2.34"},
+		{"increase-scale", "2.3", 3, RoundDown, "2.300"},
+		{"integer", "0.5", 0, RoundHalfEven, "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MustParseMoney(tt.m).Round(tt.scale, tt.mode).String(); got != tt.want {
+				t.Errorf("Money.Round() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoney_Div(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       string
+		divisor string
+		scale   int
+		mode    RoundingMode
+		want    string
+		wantErr bool
+	}{
+		{"exact", "10.00", "4", 2, RoundDown, "2.50", false},
+		{"third-half-even", "10.00", "3", 2, RoundHalfEven, "3.33", false},
+		{"third-up", "10.00", "3", 2, RoundUp, "3.34", false},
+		{"scaled-divisor", "1", "0.03", 3, RoundHalfUp, "33.333", false},
+		{"negative", "-10", "3", 2, RoundHalfUp, "-3.33", false},
+		{"zero", "10", "0.00", 2, RoundDown, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MustParseMoney(tt.m).Div(MustParseMoney(tt.divisor), tt.scale, tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Money.Div() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("Money.Div() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoney_RoundToCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        string
+		currency string
+		want     string
+		wantFits bool
+		wantErr  bool
+	}{
+		{"GBP", "13.375", "GBP", "13.38", false, false},
+		{"GBP-fits", "13.30", "GBP", "13.30", true, false},
+		{"JPY", "1337.5", "JPY", "1338", false, false},
+		{"JPY-fits", "1337.00", "JPY", "1337", true, false},
+		{"KWD", "1.2345", "KWD", "1.234", false, false},
+		{"KWD-fits", "1.234", "KWD", "1.234", true, false},
+		{"unknown", "1", "XX", "", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := MustParseMoney(tt.m)
+			got, err := m.RoundToCurrency(tt.currency, RoundHalfEven)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Money.RoundToCurrency() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.String() != tt.want {
+				t.Errorf("Money.RoundToCurrency() = %v, want %v", got, tt.want)
+			}
+			if fits := m.FitsCurrency(tt.currency); fits != tt.wantFits {
+				t.Errorf("Money.FitsCurrency() = %v, want %v", fits, tt.wantFits)
+			}
+		})
+	}
+}
+
+func TestMoney_MinorUnits(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        string
+		currency string
+		want     int64
+		wantErr  bool
+	}{
+		{"GBP", "13.37", "GBP", 1337, false},
+		{"JPY", "1337", "JPY", 1337, false},
+		{"KWD", "1.5", "KWD", 1500, false},
+		{"too-precise", "13.375", "GBP", 0, true},
+		{"too-large", "100000000000000000000", "GBP", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MustParseMoney(tt.m).MinorUnits(tt.currency)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Money.MinorUnits() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Money.MinorUnits() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		json        string
+		want        string
+		wantInvalid bool
+	}{
+		{"string", `"13.37"`, `"13.37"`, false},
+		{"trailing-zeroes", `"5.00"`, `"5.00"`, false},
+		{"number", `13.37`, `"13.37"`, false},
+		{"invalid", `"abc"`, `"abc"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Money
+			if err := json.Unmarshal([]byte(tt.json), &m); err != nil {
+				t.Errorf("json.Unmarshal() error = %v", err)
+				return
+			}
+			if (m.Err() != nil) != tt.wantInvalid {
+				t.Errorf("Money.Err() = %v, wantInvalid %v", m.Err(), tt.wantInvalid)
+			}
+
+			got, err := json.Marshal(m)
+			if err != nil {
+				t.Errorf("json.Marshal() error = %v", err)
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("json.Marshal() = %v, want %v", string(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestMoney_Scan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    string
+		wantErr bool
+	}{
+		{"bytes", []byte("13.37"), "13.37", false},
+		{"string", "5.00", "5.00", false},
+		{"int", int64(5), "5", false},
+		{"float", 13.37, "13.37", false},
+		{"invalid", "abc", "", true},
+		{"unsupported", true, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Money
+			err := m.Scan(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Money.Scan() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && m.String() != tt.want {
+				t.Errorf("Money.Scan() = %v, want %v", m, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package model
 
 import (
 	"github.com/manyminds/api2go/jsonapi"
+	"github.com/satori/go.uuid"
 )
 
 // Organisation model that represents an organisation. Can be marshaled to a json resource according to the json:api
@@ -9,6 +10,9 @@ import (
 type Organisation struct {
 	Model `json:"-"`
 	Name  string `json:"name"`
+
+	// IDs of the payments of the organisation, only loaded when the payments relationship itself is requested.
+	PaymentIDs []uuid.UUID `json:"-" gorm:"-"`
 }
 
 // GetReferences method required to implement `jsonapi.MarshalReferences`.
@@ -17,7 +21,7 @@ func (org *Organisation) GetReferences() []jsonapi.Reference {
 		{
 			Name:         "payments",
 			Type:         "payments",
-			IsNotLoaded:  true,
+			IsNotLoaded:  org.PaymentIDs == nil,
 			Relationship: jsonapi.ToManyRelationship,
 		},
 	}
@@ -25,7 +29,16 @@ func (org *Organisation) GetReferences() []jsonapi.Reference {
 
 // GetReferencedIDs method required to implement `jsonapi.MarshalLinkedRelations`.
 func (org *Organisation) GetReferencedIDs() []jsonapi.ReferenceID {
-	// Always return an empty slice. We don't want to retrieve all payments for an organisation, as they can be quite
-	// numerous.
-	return []jsonapi.ReferenceID{}
+	// Payments are only loaded on request, as they can be quite numerous.
+	ids := make([]jsonapi.ReferenceID, len(org.PaymentIDs))
+	for i, id := range org.PaymentIDs {
+		ids[i] = jsonapi.ReferenceID{
+			ID:           id.String(),
+			Name:         "payments",
+			Type:         "payments",
+			Relationship: jsonapi.ToManyRelationship,
+		}
+	}
+
+	return ids
 }
@@ -5,12 +5,14 @@ import (
 	"testing"
 
 	"github.com/manyminds/api2go/jsonapi"
+	"github.com/satori/go.uuid"
 )
 
 func TestOrganisation_GetReferences(t *testing.T) {
 	type fields struct {
-		Model Model
-		Name  string
+		Model      Model
+		Name       string
+		PaymentIDs []uuid.UUID
 	}
 	tests := []struct {
 		name   string
@@ -29,12 +31,25 @@ func TestOrganisation_GetReferences(t *testing.T) {
 				},
 			},
 		},
+		{
+			"loaded-payments",
+			fields{PaymentIDs: []uuid.UUID{}},
+			[]jsonapi.Reference{
+				{
+					Name:         "payments",
+					Type:         "payments",
+					IsNotLoaded:  false,
+					Relationship: jsonapi.ToManyRelationship,
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			org := &Organisation{
-				Model: tt.fields.Model,
-				Name:  tt.fields.Name,
+				Model:      tt.fields.Model,
+				Name:       tt.fields.Name,
+				PaymentIDs: tt.fields.PaymentIDs,
 			}
 			if got := org.GetReferences(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Organisation.GetReferences() = %v, want %v", got, tt.want)
@@ -44,9 +59,12 @@ func TestOrganisation_GetReferences(t *testing.T) {
 }
 
 func TestOrganisation_GetReferencedIDs(t *testing.T) {
+	paymentID := uuid.NewV4()
+
 	type fields struct {
-		Model Model
-		Name  string
+		Model      Model
+		Name       string
+		PaymentIDs []uuid.UUID
 	}
 	tests := []struct {
 		name   string
@@ -54,12 +72,25 @@ func TestOrganisation_GetReferencedIDs(t *testing.T) {
 		want   []jsonapi.ReferenceID
 	}{
 		{"base-case", fields{}, []jsonapi.ReferenceID{}},
+		{
+			"loaded-payments",
+			fields{PaymentIDs: []uuid.UUID{paymentID}},
+			[]jsonapi.ReferenceID{
+				{
+					ID:           paymentID.String(),
+					Name:         "payments",
+					Type:         "payments",
+					Relationship: jsonapi.ToManyRelationship,
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			org := &Organisation{
-				Model: tt.fields.Model,
-				Name:  tt.fields.Name,
+				Model:      tt.fields.Model,
+				Name:       tt.fields.Name,
+				PaymentIDs: tt.fields.PaymentIDs,
 			}
 			if got := org.GetReferencedIDs(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Organisation.GetReferencedIDs() = %v, want %v", got, tt.want)
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+// EventType is the kind of change a domain event describes, e.g. `payment.created`.
+type EventType string
+
+// Domain events of payments and organisations.
+const (
+	EventPaymentCreated       EventType = "payment.created"
+	EventPaymentUpdated       EventType = "payment.updated"
+	EventPaymentStatusChanged EventType = "payment.status_changed"
+	EventPaymentDeleted       EventType = "payment.deleted"
+
+	EventOrganisationCreated EventType = "organisation.created"
+	EventOrganisationUpdated EventType = "organisation.updated"
+	EventOrganisationDeleted EventType = "organisation.deleted"
+)
+
+// OutboxEvent model that represents a domain event, stored in the outbox in the same transaction as the change it
+// describes, until it's dispatched to downstream systems. Marshals to the JSON that is delivered to them.
+type OutboxEvent struct {
+	// Increases with every event, so events are dispatched in the order they happened. Events may be delivered more
+	// than once, downstream systems can recognise them by their id.
+	ID             uint      `json:"id" gorm:"primary_key"`
+	Type           EventType `json:"type" gorm:"type:varchar(64)"`
+	CreatedAt      time.Time `json:"created_at"`
+	OrganisationID uuid.UUID `json:"organisation_id" gorm:"type:uuid"`
+	ResourceType   string    `json:"resource_type" gorm:"type:varchar(32)"`
+	ResourceID     uuid.UUID `json:"resource_id" gorm:"type:uuid"`
+	// The attributes of the resource after the change, or before it when the resource was deleted.
+	Data EventData `json:"data" gorm:"type:text"`
+	// The attributes that changed, only for updates of resources.
+	Changes AuditChanges `json:"changes,omitempty" gorm:"type:text"`
+
+	DispatchedAt *time.Time `json:"-"`
+	// Number of failed attempts to dispatch the event, and the error of the last one.
+	Attempts  int    `json:"-"`
+	LastError string `json:"-"`
+}
+
+// EventData is a JSON object with the attributes of a resource. Stored as text.
+type EventData json.RawMessage
+
+// MarshalJSON method required to implement `json.Marshaler`.
+func (data EventData) MarshalJSON() ([]byte, error) {
+	if data == nil {
+		return []byte("null"), nil
+	}
+
+	return data, nil
+}
+
+// UnmarshalJSON method required to implement `json.Unmarshaler`.
+func (data *EventData) UnmarshalJSON(src []byte) error {
+	*data = append((*data)[:0], src...)
+	return nil
+}
+
+// Value method required to implement `driver.Valuer`.
+func (data EventData) Value() (driver.Value, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	return string(data), nil
+}
+
+// Scan method required to implement `sql.Scanner`.
+func (data *EventData) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case nil:
+		*data = nil
+		return nil
+	case []byte:
+		*data = append(EventData(nil), value...)
+		return nil
+	case string:
+		*data = EventData(value)
+		return nil
+	}
+
+	return errors.New("cannot scan event data")
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEventData_Scan(t *testing.T) {
+	data := EventData(`{"currency":"GBP"}`)
+	value, err := data.Value()
+	if err != nil {
+		t.Fatalf("EventData.Value() error = %v", err)
+	}
+
+	for _, src := range []interface{}{value, []byte(value.(string))} {
+		var got EventData
+		if err := got.Scan(src); err != nil || string(got) != string(data) {
+			t.Errorf("EventData.Scan() = %s, %v, want %s", got, err, data)
+		}
+	}
+
+	var got EventData
+	if err := got.Scan(nil); err != nil || got != nil {
+		t.Errorf("EventData.Scan() = %s, %v, want %v", got, err, nil)
+	}
+	if value, err := got.Value(); err != nil || value != nil {
+		t.Errorf("EventData.Value() = %v, %v, want %v", value, err, nil)
+	}
+	if err := got.Scan(42); err == nil {
+		t.Errorf("EventData.Scan() error = %v, wantErr %v", err, true)
+	}
+}
+
+func TestOutboxEvent_MarshalJSON(t *testing.T) {
+	event := &OutboxEvent{ID: 1, Type: EventPaymentCreated, Data: EventData(`{"currency":"GBP"}`), Attempts: 2}
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	var got OutboxEvent
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got.ID != event.ID || got.Type != event.Type || string(got.Data) != string(event.Data) || got.Attempts != 0 {
+		t.Errorf("json.Unmarshal() = %+v, want %+v without the dispatch state", got, event)
+	}
+
+	if data, err := json.Marshal(&OutboxEvent{}); err != nil || !json.Valid(data) {
+		t.Errorf("json.Marshal() = %s, %v, want null data", data, err)
+	}
+}
@@ -3,8 +3,10 @@ package model
 import (
 	"database/sql"
 	"fmt"
+	"github.com/Shodske/payment-api/pkg/validation"
 	"github.com/manyminds/api2go/jsonapi"
 	"github.com/satori/go.uuid"
+	"regexp"
 )
 
 // AccountType type and constants.
@@ -16,15 +18,34 @@ const (
 	PremiumAccount
 )
 
+// IsValid checks whether the account type is one of the known account types.
+func (accountType AccountType) IsValid() bool {
+	return accountType == BasicAccount || accountType == PremiumAccount
+}
+
+// Precision and scale of the decimal column used for exchange rates.
+const (
+	exchangeRatePrecision = 10
+	exchangeRateScale     = 5
+)
+
+var (
+	numericRegex      = regexp.MustCompile(`^[0-9]+$`)
+	alphanumericRegex = regexp.MustCompile(`^[0-9A-Za-z]+$`)
+	codeRegex         = regexp.MustCompile(`^[A-Z]+$`)
+)
+
 // Payment struct represents a payment. Instances of this struct can be marshaled to a json resource according to the
 // json:api specification.
 type Payment struct {
 	Model `json:"-"`
 
 	OrganisationID uuid.UUID    `json:"-" gorm:"type:uuid REFERENCES organisations(id)"`
-	Organisation   Organisation `json:"-" gorm:"association_autoupdate:false"`
+	Organisation   Organisation `json:"-" gorm:"association_autoupdate:false;preload:false"`
+
+	Status PaymentStatus `json:"status,omitempty" gorm:"type:varchar(16);not null;default:'pending'"`
 
-	Amount               string `json:"amount,omitempty" gorm:"type:decimal(1000,2)"`
+	Amount               *Money `json:"amount,omitempty" gorm:"type:numeric"`
 	Currency             string `json:"currency,omitempty"`
 	EndToEndReference    string `json:"end_to_end_reference,omitempty"`
 	NumericReference     string `json:"numeric_reference,omitempty"`
@@ -51,6 +72,9 @@ type Payment struct {
 
 	FXID sql.NullInt64 `json:"-" sql:"type:integer REFERENCES fxes(id)"`
 	FX   *FX           `json:"fx,omitempty"`
+
+	// Attributes requested with a sparse fieldset, nil when all attributes are requested.
+	fields []string
 }
 
 // Party struct used in Payment struct.
@@ -70,7 +94,7 @@ type Party struct {
 type Charge struct {
 	ID                      uint              `json:"-" gorm:"primary_key"`
 	BearerCode              string            `json:"bearer_code,omitempty"`
-	ReceiverChargesAmount   string            `json:"receiver_charges_amount,omitempty" gorm:"type:decimal(1000,2)"`
+	ReceiverChargesAmount   *Money            `json:"receiver_charges_amount,omitempty" gorm:"type:numeric"`
 	ReceiverChargesCurrency string            `json:"receiver_charges_currency,omitempty"`
 	SenderCharges           []*CurrencyAmount `json:"sender_charges,omitempty" gorm:"foreignkey:ChargeID"`
 }
@@ -79,7 +103,7 @@ type Charge struct {
 type CurrencyAmount struct {
 	ID       uint   `json:"-" gorm:"primary_key"`
 	ChargeID uint   `json:"-" gorm:"type:integer REFERENCES charges(id)"`
-	Amount   string `json:"amount,omitempty" gorm:"type:decimal(1000,2)"`
+	Amount   *Money `json:"amount,omitempty" gorm:"type:numeric"`
 	Currency string `json:"currency,omitempty"`
 }
 
@@ -88,10 +112,23 @@ type FX struct {
 	ID                uint   `json:"-" gorm:"primary_key"`
 	ContractReference string `json:"contract_reference,omitempty"`
 	ExchangeRate      string `json:"exchange_rate,omitempty" gorm:"type:decimal(10,5)"`
-	OriginalAmount    string `json:"original_amount,omitempty" gorm:"type:decimal(1000,2)"`
+	OriginalAmount    *Money `json:"original_amount,omitempty" gorm:"type:numeric"`
 	OriginalCurrency  string `json:"original_currency,omitempty"`
 }
 
+// SetFields limits the attributes of the Payment that are marshaled to the given sparse fieldset. Nil fields marshal
+// all attributes.
+func (payment *Payment) SetFields(fields []string) {
+	payment.fields = fields
+}
+
+// MarshalJSON method required to implement `json.Marshaler`. Only marshals the attributes of the sparse fieldset, see
+// `SetFields`.
+func (payment *Payment) MarshalJSON() ([]byte, error) {
+	type attributes Payment
+	return marshalFields((*attributes)(payment), payment.fields)
+}
+
 // SetToOneReferenceID method required to implement `jsonapi.UnmarshalToOneRelations`, which we need to set the
 // organisation relationship.
 func (payment *Payment) SetToOneReferenceID(name, ID string) error {
@@ -122,6 +159,16 @@ func (payment *Payment) GetReferences() []jsonapi.Reference {
 	}
 }
 
+// GetReferencedStructs method required to implement `jsonapi.MarshalIncludedRelations`. The organisation is only
+// included when it has been loaded, i.e. when it's requested with `include=organisation`.
+func (payment *Payment) GetReferencedStructs() []jsonapi.MarshalIdentifier {
+	if payment.Organisation.GetID() == "" {
+		return []jsonapi.MarshalIdentifier{}
+	}
+
+	return []jsonapi.MarshalIdentifier{&payment.Organisation}
+}
+
 // GetReferencedIDs method required to implement `jsonapi.MarshalLinkedRelations`
 func (payment *Payment) GetReferencedIDs() []jsonapi.ReferenceID {
 	orgId := payment.OrganisationID.String()
@@ -138,3 +185,141 @@ func (payment *Payment) GetReferencedIDs() []jsonapi.ReferenceID {
 		},
 	}
 }
+
+// Validate the attributes of the Payment and its nested objects, reporting all violations to the Validator.
+func (payment *Payment) Validate(v *validation.Validator) {
+	if payment.Status != "" && !payment.Status.IsValid() {
+		v.Add("status", "must be a valid payment status")
+	}
+
+	validateAmount(v, "amount", payment.Amount, payment.Currency, true)
+	if v.Required("currency", payment.Currency) {
+		validateCurrency(v, "currency", payment.Currency)
+	}
+
+	v.Pattern("numeric_reference", payment.NumericReference, numericRegex, "must only contain digits")
+	v.OneOf("payment_type", payment.PaymentType, "Credit", "Debit")
+	v.Date("processing_date", payment.ProcessingDate)
+
+	v.MaxLength("end_to_end_reference", payment.EndToEndReference, 255)
+	v.MaxLength("payment_id", payment.PaymentID, 255)
+	v.MaxLength("payment_purpose", payment.PaymentPurpose, 255)
+	v.MaxLength("payment_scheme", payment.PaymentScheme, 255)
+	v.MaxLength("reference", payment.Reference, 255)
+	v.MaxLength("scheme_payment_sub_type", payment.SchemePaymentSubType, 255)
+	v.MaxLength("scheme_payment_type", payment.SchemePaymentType, 255)
+
+	if payment.BeneficiaryParty != nil {
+		payment.BeneficiaryParty.Validate(v.Field("beneficiary_party"))
+	}
+	if payment.DebtorParty != nil {
+		payment.DebtorParty.Validate(v.Field("debtor_party"))
+	}
+	if payment.SponsorParty != nil {
+		payment.SponsorParty.Validate(v.Field("sponsor_party"))
+	}
+	if payment.ChargesInformation != nil {
+		payment.ChargesInformation.Validate(v.Field("charges_information"))
+	}
+	if payment.FX != nil {
+		payment.FX.Validate(v.Field("fx"))
+	}
+}
+
+// Validate the attributes of the Party, reporting all violations to the Validator.
+func (party *Party) Validate(v *validation.Validator) {
+	// Account numbers are either a BBAN or IBAN, of which the latter is at most 34 characters long.
+	if v.Required("account_number", party.AccountNumber) {
+		v.Pattern("account_number", party.AccountNumber, alphanumericRegex, "must only contain letters and digits")
+		v.MaxLength("account_number", party.AccountNumber, 34)
+	}
+	v.OneOf("account_number_code", party.AccountNumberCode, "BBAN", "IBAN")
+
+	if !party.AccountType.IsValid() {
+		v.Add("account_type", "must be a valid account type")
+	}
+
+	v.Pattern("bank_id", party.BankID, alphanumericRegex, "must only contain letters and digits")
+	v.Pattern("bank_id_code", party.BankIDCode, codeRegex, "must only contain capital letters")
+
+	v.MaxLength("account_name", party.AccountName, 255)
+	v.MaxLength("address", party.Address, 255)
+	v.MaxLength("name", party.Name, 255)
+}
+
+// Validate the attributes of the Charge and its sender charges, reporting all violations to the Validator.
+func (charge *Charge) Validate(v *validation.Validator) {
+	v.MaxLength("bearer_code", charge.BearerCode, 255)
+
+	validateAmount(v, "receiver_charges_amount", charge.ReceiverChargesAmount, charge.ReceiverChargesCurrency, false)
+	validateCurrency(v, "receiver_charges_currency", charge.ReceiverChargesCurrency)
+	if charge.ReceiverChargesAmount != nil {
+		v.Required("receiver_charges_currency", charge.ReceiverChargesCurrency)
+	}
+
+	senderCharges := v.Field("sender_charges")
+	for i, senderCharge := range charge.SenderCharges {
+		if senderCharge != nil {
+			senderCharge.Validate(senderCharges.Index(i))
+		}
+	}
+}
+
+// Validate the attributes of the CurrencyAmount, reporting all violations to the Validator.
+func (amount *CurrencyAmount) Validate(v *validation.Validator) {
+	validateAmount(v, "amount", amount.Amount, amount.Currency, true)
+	if v.Required("currency", amount.Currency) {
+		validateCurrency(v, "currency", amount.Currency)
+	}
+}
+
+// Validate the attributes of the FX, reporting all violations to the Validator.
+func (fx *FX) Validate(v *validation.Validator) {
+	v.MaxLength("contract_reference", fx.ContractReference, 255)
+	v.Decimal("exchange_rate", fx.ExchangeRate, exchangeRatePrecision, exchangeRateScale)
+
+	validateAmount(v, "original_amount", fx.OriginalAmount, fx.OriginalCurrency, false)
+	validateCurrency(v, "original_currency", fx.OriginalCurrency)
+	if fx.OriginalAmount != nil {
+		v.Required("original_currency", fx.OriginalCurrency)
+	}
+}
+
+// Validate an amount of money in the given currency. The amount must not be negative and has to fit the minor units of the
+// currency, e.g. 0.5 JPY is not a valid amount.
+func validateAmount(v *validation.Validator, field string, amount *Money, currency string, required bool) {
+	if amount == nil {
+		if required {
+			v.Missing(field)
+		}
+		return
+	}
+
+	if amount.Err() != nil {
+		v.Add(field, "must be a decimal number, e.g. `12.34`")
+		return
+	}
+	if amount.Sign() < 0 {
+		v.Add(field, "must not be negative")
+	}
+	if units, ok := MinorUnits(currency); ok && !amount.FitsCurrency(currency) {
+		v.Add(field, fmt.Sprintf("must not have more than %d decimals for `%s`", units, currency))
+	}
+}
+
+// Validate a currency code against the ISO 4217 currency table. Inactive currencies are rejected, as no new amounts
+// should be created in them.
+func validateCurrency(v *validation.Validator, field, code string) {
+	if code == "" {
+		return
+	}
+
+	currency, ok := LookupCurrency(code)
+	if !ok {
+		v.Add(field, "must be an ISO 4217 currency code, e.g. `GBP`")
+		return
+	}
+	if !currency.Active {
+		v.Add(field, fmt.Sprintf("`%s` is no longer an active ISO 4217 currency", code))
+	}
+}
@@ -2,6 +2,8 @@ package model
 
 import (
 	"database/sql"
+	"encoding/json"
+	"github.com/Shodske/payment-api/pkg/validation"
 	"github.com/manyminds/api2go/jsonapi"
 	"github.com/satori/go.uuid"
 	"reflect"
@@ -13,7 +15,7 @@ func TestPayment_SetToOneReferenceID(t *testing.T) {
 		Model                Model
 		OrganisationID       uuid.UUID
 		Organisation         Organisation
-		Amount               string
+		Amount               *Money
 		Currency             string
 		EndToEndReference    string
 		NumericReference     string
@@ -92,10 +94,10 @@ func TestPayment_GetReferences(t *testing.T) {
 	baseOrgID := uuid.NewV4()
 	baseRef := []jsonapi.Reference{
 		{
-			"organisations",
-			"organisation",
-			false,
-			jsonapi.ToOneRelationship,
+			Type:         "organisations",
+			Name:         "organisation",
+			IsNotLoaded:  false,
+			Relationship: jsonapi.ToOneRelationship,
 		},
 	}
 
@@ -103,7 +105,7 @@ func TestPayment_GetReferences(t *testing.T) {
 		Model                Model
 		OrganisationID       uuid.UUID
 		Organisation         Organisation
-		Amount               string
+		Amount               *Money
 		Currency             string
 		EndToEndReference    string
 		NumericReference     string
@@ -175,10 +177,10 @@ func TestPayment_GetReferencedIDs(t *testing.T) {
 	baseOrgID := uuid.NewV4()
 	baseRef := []jsonapi.ReferenceID{
 		{
-			baseOrgID.String(),
-			"organisations",
-			"organisation",
-			jsonapi.ToOneRelationship,
+			ID:           baseOrgID.String(),
+			Type:         "organisations",
+			Name:         "organisation",
+			Relationship: jsonapi.ToOneRelationship,
 		},
 	}
 	emptyRef := []jsonapi.ReferenceID{}
@@ -187,7 +189,7 @@ func TestPayment_GetReferencedIDs(t *testing.T) {
 		Model                Model
 		OrganisationID       uuid.UUID
 		Organisation         Organisation
-		Amount               string
+		Amount               *Money
 		Currency             string
 		EndToEndReference    string
 		NumericReference     string
@@ -253,3 +255,120 @@ func TestPayment_GetReferencedIDs(t *testing.T) {
 		})
 	}
 }
+
+func TestPayment_GetReferencedStructs(t *testing.T) {
+	org := Organisation{Model: Model{ID: uuid.NewV4()}, Name: "Organisation"}
+
+	tests := []struct {
+		name    string
+		payment *Payment
+		want    []jsonapi.MarshalIdentifier
+	}{
+		{"not-loaded", &Payment{OrganisationID: org.ID}, []jsonapi.MarshalIdentifier{}},
+		{"loaded", &Payment{OrganisationID: org.ID, Organisation: org}, []jsonapi.MarshalIdentifier{&org}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.payment.GetReferencedStructs(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Payment.GetReferencedStructs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayment_MarshalJSON(t *testing.T) {
+	payment := &Payment{
+		Amount:           money("10.00"),
+		Currency:         "GBP",
+		Reference:        "Payment for Em's piano lessons",
+		BeneficiaryParty: &Party{AccountNumber: "31926819"},
+	}
+
+	tests := []struct {
+		name   string
+		fields []string
+		want   string
+	}{
+		{
+			"all",
+			nil,
+			`{"amount":"10.00","currency":"GBP","reference":"Payment for Em's piano lessons","beneficiary_party":{"account_number":"31926819"}}`,
+		},
+		{"sparse", []string{"currency", "beneficiary_party"}, `{"beneficiary_party":{"account_number":"31926819"},"currency":"GBP"}`},
+		{"empty-value", []string{"amount", "fx"}, `{"amount":"10.00","fx":null}`},
+		{"none", []string{}, `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment.SetFields(tt.fields)
+			got, err := json.Marshal(payment)
+			if err != nil {
+				t.Fatalf("Payment.MarshalJSON() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Payment.MarshalJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayment_Validate(t *testing.T) {
+	validParty := &Party{AccountNumber: "31926819", AccountNumberCode: "BBAN", BankID: "403000", BankIDCode: "GBDSC"}
+
+	tests := []struct {
+		name         string
+		payment      *Payment
+		partial      bool
+		wantPointers []string
+	}{
+		{"valid", &Payment{Amount: money("79.99"), Currency: "GBP", ProcessingDate: "2017-01-18", BeneficiaryParty: validParty}, false, nil},
+		{"missing", &Payment{}, false, []string{"/amount", "/currency"}},
+		{"partial-missing", &Payment{}, true, nil},
+		{"invalid-attributes", &Payment{Amount: &Money{invalid: "abc"}, Currency: "XX", ProcessingDate: "tomorrow"}, false, []string{"/amount", "/currency", "/processing_date"}},
+		{"negative-amount", &Payment{Amount: money("-1.00"), Currency: "GBP"}, false, []string{"/amount"}},
+		{"too-precise-for-currency", &Payment{Amount: money("10.5"), Currency: "JPY"}, false, []string{"/amount"}},
+		{"fits-currency", &Payment{Amount: money("10.505"), Currency: "KWD"}, false, nil},
+		{"unknown-currency", &Payment{Amount: money("1.00"), Currency: "XYZ"}, false, []string{"/currency"}},
+		{"inactive-currency", &Payment{Amount: money("1.00"), Currency: "HRK"}, false, []string{"/currency"}},
+		{"invalid-status", &Payment{Amount: money("1"), Currency: "GBP", Status: "not-a-status"}, false, []string{"/status"}},
+		{
+			"invalid-party",
+			&Payment{Amount: money("1"), Currency: "GBP", BeneficiaryParty: &Party{AccountNumber: "12-34", AccountType: 5}},
+			false,
+			[]string{"/beneficiary_party/account_number", "/beneficiary_party/account_type"},
+		},
+		{"missing-party-account-number", &Payment{Amount: money("1"), Currency: "GBP", DebtorParty: &Party{}}, false, []string{"/debtor_party/account_number"}},
+		{
+			"invalid-charges",
+			&Payment{Amount: money("1"), Currency: "GBP", ChargesInformation: &Charge{
+				ReceiverChargesAmount: money("1.00"),
+				SenderCharges:         []*CurrencyAmount{{Amount: money("5.00"), Currency: "GBP"}, {Amount: money("5.001"), Currency: "GBP"}},
+			}},
+			false,
+			[]string{"/charges_information/receiver_charges_currency", "/charges_information/sender_charges/1/amount"},
+		},
+		{
+			"invalid-fx",
+			&Payment{Amount: money("1"), Currency: "GBP", FX: &FX{ExchangeRate: "123456.1", OriginalAmount: money("200.42"), OriginalCurrency: "usd"}},
+			false,
+			[]string{"/fx/exchange_rate", "/fx/original_currency"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validation.New()
+			if tt.partial {
+				v = validation.NewPartial()
+			}
+			tt.payment.Validate(v)
+
+			var got []string
+			for _, err := range v.Errors() {
+				got = append(got, err.Pointer)
+			}
+			if !reflect.DeepEqual(got, tt.wantPointers) {
+				t.Errorf("Payment.Validate() pointers = %v, want %v", got, tt.wantPointers)
+			}
+		})
+	}
+}
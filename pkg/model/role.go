@@ -0,0 +1,37 @@
+package model
+
+// Role type and constants, representing what the caller of the API is allowed to do within its organisation.
+type Role string
+
+// All roles a caller can have. Every role includes the permissions of the roles before it.
+const (
+	// RoleViewer can only read resources.
+	RoleViewer Role = "viewer"
+	// RoleOperator can also create and update payments and move them through their lifecycle.
+	RoleOperator Role = "operator"
+	// RoleAdmin can do anything within its organisation, including deleting resources and managing API keys.
+	RoleAdmin Role = "admin"
+)
+
+// The rank of every role, higher ranks include the permissions of the lower ones.
+var roleRanks = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// Roles returns all roles, from least to most privileged.
+func Roles() []Role {
+	return []Role{RoleViewer, RoleOperator, RoleAdmin}
+}
+
+// IsValid checks whether the role is one of the known roles.
+func (role Role) IsValid() bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// Includes checks whether the role has all permissions of the other role. Unknown roles include no other role.
+func (role Role) Includes(other Role) bool {
+	return role.IsValid() && other.IsValid() && roleRanks[role] >= roleRanks[other]
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestRole_IsValid(t *testing.T) {
+	tests := []struct {
+		name string
+		role Role
+		want bool
+	}{
+		{"viewer", RoleViewer, true},
+		{"operator", RoleOperator, true},
+		{"admin", RoleAdmin, true},
+		{"empty", "", false},
+		{"unknown", "owner", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.role.IsValid(); got != tt.want {
+				t.Errorf("Role.IsValid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRole_Includes(t *testing.T) {
+	tests := []struct {
+		name  string
+		role  Role
+		other Role
+		want  bool
+	}{
+		{"same", RoleOperator, RoleOperator, true},
+		{"lower", RoleAdmin, RoleViewer, true},
+		{"higher", RoleViewer, RoleOperator, false},
+		{"unknown", "owner", RoleViewer, false},
+		{"unknown-other", RoleAdmin, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.role.Includes(tt.other); got != tt.want {
+				t.Errorf("Role.Includes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package model
+
+import (
+	"fmt"
+)
+
+// PaymentStatus type and constants, representing the different stages in the lifecycle of a Payment.
+type PaymentStatus string
+
+// All statuses a Payment can be in. A Payment always starts out as pending.
+const (
+	StatusPending   PaymentStatus = "pending"
+	StatusSubmitted PaymentStatus = "submitted"
+	StatusAccepted  PaymentStatus = "accepted"
+	StatusSettled   PaymentStatus = "settled"
+	StatusRejected  PaymentStatus = "rejected"
+	StatusFailed    PaymentStatus = "failed"
+	StatusCancelled PaymentStatus = "cancelled"
+)
+
+// The state machine of a Payment, maps every status to the statuses it can transition to. Statuses without any
+// transitions are final.
+var statusTransitions = map[PaymentStatus][]PaymentStatus{
+	StatusPending:   {StatusSubmitted, StatusCancelled},
+	StatusSubmitted: {StatusAccepted, StatusRejected, StatusFailed, StatusCancelled},
+	StatusAccepted:  {StatusSettled, StatusFailed},
+	StatusSettled:   {},
+	StatusRejected:  {},
+	StatusFailed:    {},
+	StatusCancelled: {},
+}
+
+// TransitionError is returned whenever a Payment is not allowed to transition from one status to another.
+type TransitionError struct {
+	From PaymentStatus
+	To   PaymentStatus
+}
+
+// Error method required to implement `error`.
+func (err *TransitionError) Error() string {
+	return fmt.Sprintf("cannot transition payment from status `%s` to `%s`", err.From, err.To)
+}
+
+// IsValid checks whether the status is one of the known statuses.
+func (status PaymentStatus) IsValid() bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// IsFinal checks whether the status is a final status, from which no transitions are possible.
+func (status PaymentStatus) IsFinal() bool {
+	return status.IsValid() && len(statusTransitions[status]) == 0
+}
+
+// CanTransitionTo checks whether the state machine allows a transition from this status to the given status.
+func (status PaymentStatus) CanTransitionTo(to PaymentStatus) bool {
+	for _, allowed := range statusTransitions[status] {
+		if allowed == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Transition moves the Payment to the given status. Returns a `*TransitionError` when the state machine doesn't allow
+// the transition, in which case the Payment is left untouched.
+func (payment *Payment) Transition(to PaymentStatus) error {
+	if !payment.Status.CanTransitionTo(to) {
+		return &TransitionError{From: payment.Status, To: to}
+	}
+
+	payment.Status = to
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestPaymentStatus_IsValid(t *testing.T) {
+	tests := []struct {
+		name   string
+		status PaymentStatus
+		want   bool
+	}{
+		{"pending", StatusPending, true},
+		{"settled", StatusSettled, true},
+		{"empty", "", false},
+		{"unknown", "not-a-status", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.status.IsValid(); got != tt.want {
+				t.Errorf("PaymentStatus.IsValid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentStatus_IsFinal(t *testing.T) {
+	tests := []struct {
+		name   string
+		status PaymentStatus
+		want   bool
+	}{
+		{"pending", StatusPending, false},
+		{"submitted", StatusSubmitted, false},
+		{"accepted", StatusAccepted, false},
+		{"settled", StatusSettled, true},
+		{"rejected", StatusRejected, true},
+		{"failed", StatusFailed, true},
+		{"cancelled", StatusCancelled, true},
+		{"unknown", "not-a-status", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.status.IsFinal(); got != tt.want {
+				t.Errorf("PaymentStatus.IsFinal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentStatus_CanTransitionTo(t *testing.T) {
+	tests := []struct {
+		name   string
+		status PaymentStatus
+		to     PaymentStatus
+		want   bool
+	}{
+		{"pending-submitted", StatusPending, StatusSubmitted, true},
+		{"pending-cancelled", StatusPending, StatusCancelled, true},
+		{"pending-accepted", StatusPending, StatusAccepted, false},
+		{"submitted-accepted", StatusSubmitted, StatusAccepted, true},
+		{"submitted-rejected", StatusSubmitted, StatusRejected, true},
+		{"submitted-failed", StatusSubmitted, StatusFailed, true},
+		{"submitted-cancelled", StatusSubmitted, StatusCancelled, true},
+		{"submitted-settled", StatusSubmitted, StatusSettled, false},
+		{"accepted-settled", StatusAccepted, StatusSettled, true},
+		{"accepted-failed", StatusAccepted, StatusFailed, true},
+		{"accepted-cancelled", StatusAccepted, StatusCancelled, false},
+		{"settled-pending", StatusSettled, StatusPending, false},
+		{"cancelled-submitted", StatusCancelled, StatusSubmitted, false},
+		{"same-status", StatusPending, StatusPending, false},
+		{"unknown", StatusPending, "not-a-status", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.status.CanTransitionTo(tt.to); got != tt.want {
+				t.Errorf("PaymentStatus.CanTransitionTo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPayment_Transition(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  PaymentStatus
+		to      PaymentStatus
+		want    PaymentStatus
+		wantErr bool
+	}{
+		{"submit", StatusPending, StatusSubmitted, StatusSubmitted, false},
+		{"settle", StatusAccepted, StatusSettled, StatusSettled, false},
+		{"illegal", StatusPending, StatusSettled, StatusPending, true},
+		{"final", StatusCancelled, StatusSubmitted, StatusCancelled, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := &Payment{Status: tt.status}
+			err := payment.Transition(tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Payment.Transition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, ok := err.(*TransitionError); err != nil && !ok {
+				t.Errorf("Payment.Transition() error = %T, want *TransitionError", err)
+			}
+			if payment.Status != tt.want {
+				t.Errorf("Payment.Status = %v, want %v", payment.Status, tt.want)
+			}
+		})
+	}
+}
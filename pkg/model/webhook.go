@@ -0,0 +1,187 @@
+package model
+
+import (
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/Shodske/payment-api/pkg/validation"
+	"github.com/satori/go.uuid"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Every generated webhook secret starts with this prefix, so secrets are easily recognised.
+const webhookSecretPrefix = "whsec_"
+
+// Number of random bytes in a generated webhook secret.
+const webhookSecretBytes = 32
+
+// Minimum length of secrets chosen by clients, so signatures can't be forged by guessing the secret.
+const minWebhookSecretLength = 16
+
+// All event types webhooks can subscribe to.
+var eventTypes = []EventType{
+	EventPaymentCreated,
+	EventPaymentUpdated,
+	EventPaymentStatusChanged,
+	EventPaymentDeleted,
+	EventOrganisationCreated,
+	EventOrganisationUpdated,
+	EventOrganisationDeleted,
+}
+
+// IsValid checks whether the event type is one of the domain events.
+func (typ EventType) IsValid() bool {
+	for _, t := range eventTypes {
+		if typ == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Webhook model that represents an endpoint of an organisation, to which the domain events it subscribes to are
+// delivered. Can be marshaled to a json resource according to the json:api specification.
+type Webhook struct {
+	Model          `json:"-"`
+	OrganisationID uuid.UUID  `json:"-" gorm:"type:uuid REFERENCES organisations(id);index"`
+	URL            string     `json:"url"`
+	EventTypes     EventTypes `json:"event_types" gorm:"type:text"`
+	// Secret the deliveries are signed with. It's only returned when it has been generated, it can't be retrieved
+	// afterwards.
+	Secret string `json:"secret,omitempty"`
+	// Disabled webhooks don't receive any deliveries. Webhooks are disabled automatically when too many deliveries in a
+	// row have failed.
+	Enabled bool `json:"enabled"`
+	// Number of failed attempts to deliver events since the last successful one.
+	Failures int `json:"failures"`
+}
+
+// EventTypes is a list of event types. Stored as a JSON document.
+type EventTypes []EventType
+
+// NewWebhookSecret generates a random secret to sign the deliveries of a webhook with.
+func NewWebhookSecret() (string, error) {
+	random := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	return webhookSecretPrefix + hex.EncodeToString(random), nil
+}
+
+// GetName method required to implement `jsonapi.EntityNamer`.
+func (webhook *Webhook) GetName() string {
+	return "webhooks"
+}
+
+// Validate the attributes of a webhook that can be set by clients. The URL must use https, unless http is allowed for
+// local use.
+func (webhook *Webhook) Validate(v *validation.Validator, allowHTTP bool) {
+	if v.Required("url", webhook.URL) {
+		v.MaxLength("url", webhook.URL, 2048)
+		u, err := url.Parse(webhook.URL)
+		switch {
+		case err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http"):
+			v.Add("url", "must be an absolute https URL")
+		case u.Scheme == "http" && !allowHTTP:
+			v.Add("url", "must use https")
+		}
+	}
+
+	if len(webhook.EventTypes) == 0 {
+		v.Missing("event_types")
+	}
+	for i, typ := range webhook.EventTypes {
+		if !typ.IsValid() {
+			v.Field("event_types").Add(strconv.Itoa(i), "must be a valid event type")
+		}
+	}
+
+	if webhook.Secret != "" && len(webhook.Secret) < minWebhookSecretLength {
+		v.Add("secret", "must be at least "+strconv.Itoa(minWebhookSecretLength)+" characters long")
+	}
+	v.MaxLength("secret", webhook.Secret, 255)
+}
+
+// Subscribes reports whether the webhook receives events of the type.
+func (webhook *Webhook) Subscribes(typ EventType) bool {
+	for _, t := range webhook.EventTypes {
+		if t == typ {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Value method required to implement `driver.Valuer`.
+func (types EventTypes) Value() (driver.Value, error) {
+	data, err := json.Marshal(types)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+// Scan method required to implement `sql.Scanner`.
+func (types *EventTypes) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case nil:
+		*types = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(data, types)
+	case string:
+		return json.Unmarshal([]byte(data), types)
+	}
+
+	return errors.New("cannot scan event types")
+}
+
+// DeliveryStatus is the state of a WebhookDelivery.
+type DeliveryStatus string
+
+// Statuses of deliveries. Pending deliveries are attempted until they succeed, or fail permanently.
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// WebhookDelivery model that represents the delivery of a single event to a webhook, with the outcome of the last
+// attempt. Can be marshaled to a json resource according to the json:api specification.
+type WebhookDelivery struct {
+	ID        uint      `json:"-" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Every event is delivered to a webhook only once.
+	WebhookID uuid.UUID `json:"-" gorm:"type:uuid;unique_index:uix_webhook_deliveries_event"`
+	EventID   uint      `json:"event_id" gorm:"unique_index:uix_webhook_deliveries_event"`
+	EventType EventType `json:"event_type" gorm:"type:varchar(64)"`
+	// The JSON body that's posted to the webhook.
+	Payload string         `json:"-" gorm:"type:text"`
+	Status  DeliveryStatus `json:"status" gorm:"type:varchar(16)"`
+	// Number of attempts so far, and when the next attempt is due while the delivery is pending.
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	// Status code of the response to the last attempt, if there was one, or why the last attempt failed.
+	ResponseCode int    `json:"response_code,omitempty"`
+	LastError    string `json:"last_error,omitempty"`
+}
+
+// GetID method required to implement `jsonapi.MarshalIdentifier`.
+func (delivery *WebhookDelivery) GetID() string {
+	return strconv.FormatUint(uint64(delivery.ID), 10)
+}
+
+// GetName method required to implement `jsonapi.EntityNamer`.
+func (delivery *WebhookDelivery) GetName() string {
+	return "webhook-deliveries"
+}
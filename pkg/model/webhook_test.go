@@ -0,0 +1,76 @@
+package model
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Shodske/payment-api/pkg/validation"
+)
+
+func TestNewWebhookSecret(t *testing.T) {
+	secret, err := NewWebhookSecret()
+	if err != nil {
+		t.Fatalf("NewWebhookSecret() error = %v", err)
+	}
+
+	if !strings.HasPrefix(secret, "whsec_") || len(secret) != 70 {
+		t.Errorf("NewWebhookSecret() = %v, want whsec_ and 64 hex characters", secret)
+	}
+	if other, _ := NewWebhookSecret(); other == secret {
+		t.Errorf("NewWebhookSecret() = %v, want a random secret", other)
+	}
+}
+
+func TestWebhook_Validate(t *testing.T) {
+	types := EventTypes{EventPaymentCreated}
+	tests := []struct {
+		name      string
+		webhook   *Webhook
+		allowHTTP bool
+		wantErr   bool
+	}{
+		{"base", &Webhook{URL: "https://example.com/webhooks", EventTypes: types}, false, false},
+		{"http", &Webhook{URL: "http://example.com/webhooks", EventTypes: types}, false, true},
+		{"allowed-http", &Webhook{URL: "http://localhost:8080", EventTypes: types}, true, false},
+		{"secret", &Webhook{URL: "https://example.com", EventTypes: types, Secret: "0123456789abcdef"}, false, false},
+		{"missing-url", &Webhook{EventTypes: types}, false, true},
+		{"relative-url", &Webhook{URL: "example.com/webhooks", EventTypes: types}, false, true},
+		{"invalid-scheme", &Webhook{URL: "mailto:ops@example.com", EventTypes: types}, true, true},
+		{"missing-event-types", &Webhook{URL: "https://example.com"}, false, true},
+		{"unknown-event-type", &Webhook{URL: "https://example.com", EventTypes: EventTypes{"payment.paid"}}, false, true},
+		{"short-secret", &Webhook{URL: "https://example.com", EventTypes: types, Secret: "secret"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validation.New()
+			tt.webhook.Validate(v, tt.allowHTTP)
+			if errs := v.Errors(); (errs != nil) != tt.wantErr {
+				t.Errorf("Webhook.Validate() errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEventTypes_Scan(t *testing.T) {
+	types := EventTypes{EventPaymentCreated, EventOrganisationDeleted}
+	value, err := types.Value()
+	if err != nil {
+		t.Fatalf("EventTypes.Value() error = %v", err)
+	}
+
+	for _, src := range []interface{}{value, []byte(value.(string))} {
+		var got EventTypes
+		if err := got.Scan(src); err != nil || !reflect.DeepEqual(got, types) {
+			t.Errorf("EventTypes.Scan() = %v, %v, want %v", got, err, types)
+		}
+	}
+
+	var got EventTypes
+	if err := got.Scan(nil); err != nil || got != nil {
+		t.Errorf("EventTypes.Scan() = %v, %v, want %v", got, err, nil)
+	}
+	if err := got.Scan(42); err == nil {
+		t.Errorf("EventTypes.Scan() error = %v, wantErr %v", err, true)
+	}
+}
@@ -0,0 +1,107 @@
+// Package outbox dispatches the domain events in the outbox to downstream systems, like ledgers, notifications and
+// analytics, so they don't have to poll the API for changes. The sources add the events in the same transaction as the
+// changes they describe, and a Dispatcher delivers them to the configured sinks afterwards.
+//
+// Events are delivered at least once, in the order they were added. An event that can't be delivered is retried, and
+// holds back the events after it until it has been delivered. Downstream systems recognise events that are delivered
+// more than once by their id.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+// DispatcherConfig configures how often a Dispatcher looks for events, and how many it delivers at a time.
+type DispatcherConfig struct {
+	// Duration between looking for pending events, when there weren't any left the last time.
+	Interval time.Duration
+	// Maximum number of events delivered in a single transaction.
+	BatchSize int
+}
+
+// Dispatcher delivers the pending events of the outbox to all its sinks, and marks them as dispatched once they are.
+type Dispatcher struct {
+	repos  repository.Repositories
+	config DispatcherConfig
+	sinks  []Sink
+}
+
+// NewDispatcher creates a Dispatcher of the events in the outbox of the repositories.
+func NewDispatcher(repos repository.Repositories, config DispatcherConfig, sinks ...Sink) *Dispatcher {
+	return &Dispatcher{repos: repos, config: config, sinks: sinks}
+}
+
+// Run dispatches the pending events every interval, until the context is done. Failures are logged and retried.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := d.Dispatch(ctx)
+		if err != nil {
+			logrus.WithError(err).Error("cannot dispatch events")
+		}
+
+		// A full batch may have left events behind, which are dispatched right away.
+		if err != nil || n < d.config.BatchSize {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		} else if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Dispatch a single batch of pending events, returning the number of events that were delivered. Stops at the first
+// event that can't be delivered, which is recorded as a failed attempt and retried the next time.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	var dispatched int
+	var failed error
+
+	// The pending events are locked until the transaction ends, so they aren't dispatched concurrently.
+	err := d.repos.Transaction(func(tx repository.Repositories) error {
+		events, err := tx.Outbox.Pending(d.config.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			if err := d.deliver(ctx, tx, event); err != nil {
+				// The failure is committed, so the event is dispatched again after the next interval, together with
+				// the events after it.
+				failed = fmt.Errorf("event %d: %v", event.ID, err)
+				return tx.Outbox.MarkFailed(event, err.Error())
+			}
+			if err := tx.Outbox.MarkDispatched(event); err != nil {
+				return err
+			}
+			dispatched++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return dispatched, failed
+}
+
+// Deliver the event to every sink, in the transaction of the repositories.
+func (d *Dispatcher) deliver(ctx context.Context, tx repository.Repositories, event *model.OutboxEvent) error {
+	for _, sink := range d.sinks {
+		if err := sink.Deliver(ctx, tx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
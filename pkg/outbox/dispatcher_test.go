@@ -0,0 +1,141 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/satori/go.uuid"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Sink that records the ids of the events it delivered, and fails while failures are left.
+type recordingSink struct {
+	delivered []uint
+	failures  int
+}
+
+func (sink *recordingSink) Deliver(_ context.Context, _ repository.Repositories, event *model.OutboxEvent) error {
+	if sink.failures > 0 {
+		sink.failures--
+		return errors.New("unavailable")
+	}
+	sink.delivered = append(sink.delivered, event.ID)
+
+	return nil
+}
+
+// Add n events to the outbox of the repositories.
+func addEvents(t *testing.T, repos repository.Repositories, n int) {
+	for i := 0; i < n; i++ {
+		event := &model.OutboxEvent{Type: model.EventPaymentCreated, ResourceType: "payments", ResourceID: uuid.NewV4()}
+		if err := repos.Outbox.Add(event); err != nil {
+			t.Fatalf("OutboxRepository.Add() error = %v", err)
+		}
+	}
+}
+
+func TestDispatcher_Dispatch(t *testing.T) {
+	repos := repository.NewMemory()
+	addEvents(t, repos, 5)
+	sinks := []*recordingSink{{}, {}}
+	dispatcher := NewDispatcher(repos, DispatcherConfig{Interval: time.Second, BatchSize: 2}, sinks[0], sinks[1])
+
+	steps := []struct {
+		name     string
+		failures int
+		want     int
+		wantErr  bool
+		// Ids of the events the second sink has delivered after the step.
+		delivered []uint
+	}{
+		{"first-batch", 0, 2, false, []uint{1, 2}},
+		{"failed", 1, 0, true, []uint{1, 2}},
+		{"retried", 0, 2, false, []uint{1, 2, 3, 4}},
+		{"last-batch", 0, 1, false, []uint{1, 2, 3, 4, 5}},
+		{"none-pending", 0, 0, false, []uint{1, 2, 3, 4, 5}},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			sinks[1].failures = step.failures
+
+			got, err := dispatcher.Dispatch(context.Background())
+			if (err != nil) != step.wantErr {
+				t.Fatalf("Dispatcher.Dispatch() error = %v, wantErr %v", err, step.wantErr)
+			}
+			if got != step.want {
+				t.Errorf("Dispatcher.Dispatch() = %v, want %v", got, step.want)
+			}
+			if !reflect.DeepEqual(sinks[1].delivered, step.delivered) {
+				t.Errorf("Dispatcher.Dispatch() delivered %v, want %v", sinks[1].delivered, step.delivered)
+			}
+		})
+	}
+
+	// The first sink received the failed event twice, as delivery is at least once.
+	if want := []uint{1, 2, 3, 3, 4, 5}; !reflect.DeepEqual(sinks[0].delivered, want) {
+		t.Errorf("Dispatcher.Dispatch() delivered %v, want %v", sinks[0].delivered, want)
+	}
+}
+
+// Failed attempts are recorded with the event.
+func TestDispatcher_DispatchFailed(t *testing.T) {
+	repos := repository.NewMemory()
+	addEvents(t, repos, 2)
+	dispatcher := NewDispatcher(repos, DispatcherConfig{Interval: time.Second, BatchSize: 10}, &recordingSink{failures: 2})
+
+	for i := 0; i < 2; i++ {
+		if _, err := dispatcher.Dispatch(context.Background()); err == nil {
+			t.Fatalf("Dispatcher.Dispatch() error = %v, wantErr %v", err, true)
+		}
+	}
+
+	pending, err := repos.Outbox.Pending(10)
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("OutboxRepository.Pending() = %v, %v, want 2 events", pending, err)
+	}
+	if pending[0].Attempts != 2 || pending[0].LastError != "unavailable" || pending[1].Attempts != 0 {
+		t.Errorf("OutboxRepository.Pending() = %+v, %+v, want the failed attempts of the first", pending[0], pending[1])
+	}
+}
+
+// Running dispatches pending events right away, and again every interval, until the context is done.
+func TestDispatcher_Run(t *testing.T) {
+	repos := repository.NewMemory()
+	addEvents(t, repos, 3)
+	sink := &recordingSink{}
+	dispatcher := NewDispatcher(repos, DispatcherConfig{Interval: 10 * time.Millisecond, BatchSize: 2}, sink)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	waitDispatched := func() {
+		for {
+			pending, _ := repos.Outbox.Pending(10)
+			if len(pending) == 0 {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Dispatcher.Run() left %d events pending", len(pending))
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitDispatched()
+	addEvents(t, repos, 1)
+	waitDispatched()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Dispatcher.Run() didn't return after the context was done")
+	}
+}
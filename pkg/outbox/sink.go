@@ -0,0 +1,64 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"io"
+	"os"
+	"sync"
+)
+
+// Sink delivers events to a downstream system.
+type Sink interface {
+	// Deliver the event. When it fails, the event is delivered again later, so sinks must be able to deliver the same
+	// event more than once. Sinks that store the event in the repositories use tx, the repositories of the transaction
+	// of the dispatcher, so what they store is committed together with the event being dispatched.
+	Deliver(ctx context.Context, tx repository.Repositories, event *model.OutboxEvent) error
+}
+
+// WriterSink writes every event as a single line of JSON, for local use and for tools that process JSON lines.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink creates a WriterSink that writes the events to w, e.g. `os.Stdout`.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// OpenFileSink creates a WriterSink that appends the events to the file at the path, which is created when it doesn't
+// exist yet. The file must be closed with `Close`.
+func OpenFileSink(path string) (*WriterSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWriterSink(file), nil
+}
+
+// Deliver method required to implement `Sink`.
+func (sink *WriterSink) Deliver(_ context.Context, _ repository.Repositories, event *model.OutboxEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	_, err = sink.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close the writer of the WriterSink, when it can be closed.
+func (sink *WriterSink) Close() error {
+	if closer, ok := sink.w.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/satori/go.uuid"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriterSink_Deliver(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+	resourceID := uuid.NewV4()
+
+	events := []*model.OutboxEvent{
+		{ID: 1, Type: model.EventPaymentCreated, ResourceType: "payments", ResourceID: resourceID,
+			Data: model.EventData(`{"currency":"GBP"}`)},
+		{ID: 2, Type: model.EventPaymentUpdated, ResourceType: "payments", ResourceID: resourceID,
+			Data: model.EventData(`{"currency":"EUR"}`), Changes: model.AuditChanges{
+				"currency": {Before: json.RawMessage(`"GBP"`), After: json.RawMessage(`"EUR"`)},
+			}},
+	}
+	for _, event := range events {
+		if err := sink.Deliver(context.Background(), repository.Repositories{}, event); err != nil {
+			t.Fatalf("WriterSink.Deliver() error = %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(events) {
+		t.Fatalf("WriterSink.Deliver() wrote %d lines, want %d", len(lines), len(events))
+	}
+	for i, line := range lines {
+		var got map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("WriterSink.Deliver() wrote %s, error = %v", line, err)
+		}
+		if string(got["type"]) != `"`+string(events[i].Type)+`"` || string(got["data"]) != string(events[i].Data) {
+			t.Errorf("WriterSink.Deliver() wrote %s, want %+v", line, events[i])
+		}
+		if _, ok := got["attempts"]; ok {
+			t.Errorf("WriterSink.Deliver() wrote %s, want no dispatch state", line)
+		}
+	}
+	if !strings.Contains(lines[0], `"id":1`) || strings.Contains(lines[0], `"changes"`) {
+		t.Errorf("WriterSink.Deliver() wrote %s, want the id without changes", lines[0])
+	}
+	if !strings.Contains(lines[1], `"changes":{"currency":{"before":"GBP","after":"EUR"}}`) {
+		t.Errorf("WriterSink.Deliver() wrote %s, want the changes", lines[1])
+	}
+}
+
+func TestOpenFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.jsonl")
+
+	// Events are appended to the file, also when it's opened again.
+	for id := uint(1); id <= 2; id++ {
+		sink, err := OpenFileSink(path)
+		if err != nil {
+			t.Fatalf("OpenFileSink() error = %v", err)
+		}
+		if err := sink.Deliver(context.Background(), repository.Repositories{}, &model.OutboxEvent{ID: id}); err != nil {
+			t.Errorf("WriterSink.Deliver() error = %v", err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Errorf("WriterSink.Close() error = %v", err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 {
+		t.Errorf("OpenFileSink() wrote %q, want 2 lines", data)
+	}
+
+	if _, err := OpenFileSink(filepath.Join(dir, "missing", "events.jsonl")); err == nil {
+		t.Errorf("OpenFileSink() error = %v, wantErr %v", err, true)
+	}
+}
@@ -0,0 +1,672 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/logging"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/tracing"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/satori/go.uuid"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Code of the Postgres error for the violation of a unique index.
+const uniqueViolation = "23505"
+
+// Column an attribute is stored in.
+type column struct {
+	name string
+	// Format of a condition on a related table, in which the condition on the column is embedded. Used to filter on
+	// nested objects without joining their tables.
+	related string
+}
+
+// SQL conditions of the filter operators, the placeholder is replaced with the values of the filter.
+var operatorConditions = map[string]string{
+	OperatorEq:  "%s IN (?)",
+	OperatorGte: "%s >= ?",
+	OperatorLte: "%s <= ?",
+}
+
+// Columns of the attributes of payments, see `newPaymentColumns`.
+var paymentColumns = newPaymentColumns()
+
+// Maps the attributes of payments to the associations that have to be loaded for them. Nested objects are stored in
+// their own tables, attributes stored in the table of payments itself don't need any associations.
+var paymentAssociations = map[string][]string{
+	"beneficiary_party":   {"BeneficiaryParty"},
+	"debtor_party":        {"DebtorParty"},
+	"sponsor_party":       {"SponsorParty"},
+	"charges_information": {"ChargesInformation", "ChargesInformation.SenderCharges"},
+	"fx":                  {"FX"},
+}
+
+// Maps the relationships of payments to their associations.
+var paymentIncludes = map[string]string{
+	"organisation": "Organisation",
+}
+
+// Columns of the attributes of organisations.
+var organisationColumns = map[string]column{
+	"id":         {name: "organisations.id"},
+	"created_at": {name: "organisations.created_at"},
+	"updated_at": {name: "organisations.updated_at"},
+	"name":       {name: "organisations.name"},
+}
+
+// NewGorm creates the Repositories that store all resources in the database, using the same connections for all of
+// them.
+func NewGorm(db *gorm.DB) Repositories {
+	repos := Repositories{
+		Payments:      &gormPayments{db: db},
+		Organisations: &gormOrganisations{db: db},
+		APIKeys:       &gormAPIKeys{db: db},
+		AuditEvents:   &gormAuditEvents{db: db},
+		Outbox:        &gormOutbox{db: db},
+		Webhooks:      &gormWebhooks{db: db},
+		Deliveries:    &gormDeliveries{db: db},
+	}
+	repos.transact = func(fn func(tx Repositories) error) error {
+		return transaction(db, func(tx *gorm.DB) error {
+			return fn(NewGorm(tx))
+		})
+	}
+	repos.scope = func(ctx context.Context) Repositories {
+		scoped := db.New()
+		scoped.SetLogger(logging.NewGormLogger(logging.FromContext(ctx)))
+		return NewGorm(tracing.WithContext(scoped, ctx))
+	}
+
+	return repos
+}
+
+// PaymentRepository that stores payments in the database.
+type gormPayments struct {
+	db *gorm.DB
+}
+
+// Find method required to implement `PaymentRepository`.
+func (repo *gormPayments) Find(id uuid.UUID, load Load) (*model.Payment, error) {
+	db, err := loadPayments(repo.db, load)
+	if err != nil {
+		return nil, err
+	}
+
+	payment := &model.Payment{Model: model.Model{ID: id}}
+	if err := db.Where(payment).First(payment).Error; err != nil {
+		return nil, gormError(err)
+	}
+
+	return payment, nil
+}
+
+// List method required to implement `PaymentRepository`.
+func (repo *gormPayments) List(query Query) ([]*model.Payment, error) {
+	db, err := loadPayments(repo.db, query.Load)
+	if err != nil {
+		return nil, err
+	}
+	db, err = list(db, "payments", paymentColumns, query)
+	if err != nil {
+		return nil, err
+	}
+
+	payments := make([]*model.Payment, 0)
+	if err := db.Find(&payments).Error; err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// Count method required to implement `PaymentRepository`.
+func (repo *gormPayments) Count(query Query) (uint, error) {
+	db, err := where(repo.db, paymentColumns, query.Filters)
+	if err != nil {
+		return 0, err
+	}
+
+	var count uint
+	err = db.Model(&model.Payment{}).Count(&count).Error
+
+	return count, err
+}
+
+// Create method required to implement `PaymentRepository`.
+func (repo *gormPayments) Create(payment *model.Payment) error {
+	return repo.db.Create(payment).Error
+}
+
+// CreateIdempotent method required to implement `PaymentRepository`. The key is stored first, so a concurrent request
+// with the same key fails on its unique index instead of creating a second payment.
+func (repo *gormPayments) CreateIdempotent(payment *model.Payment, key *model.IdempotencyKey, respond func() error) error {
+	return transaction(repo.db, func(tx *gorm.DB) error {
+		if err := tx.Create(key).Error; isUniqueViolation(err) {
+			return ErrConflict
+		} else if err != nil {
+			return err
+		}
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		if err := respond(); err != nil {
+			return err
+		}
+
+		return tx.Save(key).Error
+	})
+}
+
+// FindIdempotencyKey method required to implement `PaymentRepository`.
+func (repo *gormPayments) FindIdempotencyKey(orgID uuid.UUID, key string) (*model.IdempotencyKey, error) {
+	stored := &model.IdempotencyKey{}
+	if err := repo.db.Where(&model.IdempotencyKey{OrganisationID: orgID, Key: key}).First(stored).Error; err != nil {
+		return nil, gormError(err)
+	}
+
+	return stored, nil
+}
+
+// Update method required to implement `PaymentRepository`.
+func (repo *gormPayments) Update(payment *model.Payment, data *model.Payment) error {
+	return repo.db.Model(payment).Update(data).Error
+}
+
+// UpdateStatus method required to implement `PaymentRepository`. The update is conditional on the stored status, so a
+// concurrent transition can't be overwritten.
+func (repo *gormPayments) UpdateStatus(payment *model.Payment, from model.PaymentStatus) error {
+	query := repo.db.Model(payment).Where("status = ?", from).Update("status", payment.Status)
+	if err := query.Error; err != nil {
+		return err
+	}
+	if query.RowsAffected == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// Delete method required to implement `PaymentRepository`.
+func (repo *gormPayments) Delete(payment *model.Payment) error {
+	return repo.db.Delete(payment).Error
+}
+
+// OrganisationRepository that stores organisations in the database.
+type gormOrganisations struct {
+	db *gorm.DB
+}
+
+// Find method required to implement `OrganisationRepository`.
+func (repo *gormOrganisations) Find(id uuid.UUID) (*model.Organisation, error) {
+	org := &model.Organisation{Model: model.Model{ID: id}}
+	if err := repo.db.Set("gorm:auto_preload", false).Where(org).First(org).Error; err != nil {
+		return nil, gormError(err)
+	}
+
+	return org, nil
+}
+
+// List method required to implement `OrganisationRepository`.
+func (repo *gormOrganisations) List(query Query) ([]*model.Organisation, error) {
+	db, err := list(repo.db.Set("gorm:auto_preload", false), "organisations", organisationColumns, query)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs := make([]*model.Organisation, 0)
+	if err := db.Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// Count method required to implement `OrganisationRepository`.
+func (repo *gormOrganisations) Count(query Query) (uint, error) {
+	db, err := where(repo.db, organisationColumns, query.Filters)
+	if err != nil {
+		return 0, err
+	}
+
+	var count uint
+	err = db.Model(&model.Organisation{}).Count(&count).Error
+
+	return count, err
+}
+
+// Create method required to implement `OrganisationRepository`.
+func (repo *gormOrganisations) Create(org *model.Organisation) error {
+	return repo.db.Create(org).Error
+}
+
+// Update method required to implement `OrganisationRepository`.
+func (repo *gormOrganisations) Update(org *model.Organisation, data *model.Organisation) error {
+	return repo.db.Model(org).Update(data).Error
+}
+
+// Delete method required to implement `OrganisationRepository`.
+func (repo *gormOrganisations) Delete(org *model.Organisation) error {
+	return repo.db.Delete(org).Error
+}
+
+// APIKeyRepository that stores API keys in the database.
+type gormAPIKeys struct {
+	db *gorm.DB
+}
+
+// Find method required to implement `APIKeyRepository`.
+func (repo *gormAPIKeys) Find(id uuid.UUID) (*model.APIKey, error) {
+	key := &model.APIKey{Model: model.Model{ID: id}}
+	if err := repo.db.Where(key).First(key).Error; err != nil {
+		return nil, gormError(err)
+	}
+
+	return key, nil
+}
+
+// FindByHash method required to implement `APIKeyRepository`.
+func (repo *gormAPIKeys) FindByHash(hash string) (*model.APIKey, error) {
+	key := &model.APIKey{}
+	if err := repo.db.Where(&model.APIKey{Hash: hash}).First(key).Error; err != nil {
+		return nil, gormError(err)
+	}
+
+	return key, nil
+}
+
+// List method required to implement `APIKeyRepository`.
+func (repo *gormAPIKeys) List(orgID uuid.UUID) ([]*model.APIKey, error) {
+	keys := make([]*model.APIKey, 0)
+	err := repo.db.Where(&model.APIKey{OrganisationID: orgID}).Order("created_at ASC").Order("id ASC").Find(&keys).Error
+
+	return keys, err
+}
+
+// Create method required to implement `APIKeyRepository`.
+func (repo *gormAPIKeys) Create(key *model.APIKey) error {
+	return repo.db.Create(key).Error
+}
+
+// Revoke method required to implement `APIKeyRepository`. The key is only updated when it isn't revoked yet, so the
+// time it was first revoked is kept.
+func (repo *gormAPIKeys) Revoke(key *model.APIKey) error {
+	if key.Revoked() {
+		return nil
+	}
+
+	now := time.Now()
+	err := repo.db.Model(key).Where("revoked_at IS NULL").Update("revoked_at", &now).Error
+	if err != nil {
+		return err
+	}
+
+	return repo.db.Where(&model.APIKey{Model: model.Model{ID: key.ID}}).First(key).Error
+}
+
+// AuditEventRepository that stores the audit log in the database.
+type gormAuditEvents struct {
+	db *gorm.DB
+}
+
+// Append method required to implement `AuditEventRepository`.
+func (repo *gormAuditEvents) Append(event *model.AuditEvent) error {
+	return repo.db.Create(event).Error
+}
+
+// List method required to implement `AuditEventRepository`.
+func (repo *gormAuditEvents) List(resourceType string, resourceID uuid.UUID) ([]*model.AuditEvent, error) {
+	events := make([]*model.AuditEvent, 0)
+	err := repo.db.Where(&model.AuditEvent{ResourceType: resourceType, ResourceID: resourceID}).Order("id ASC").Find(&events).Error
+
+	return events, err
+}
+
+// OutboxRepository that stores the outbox in the database.
+type gormOutbox struct {
+	db *gorm.DB
+}
+
+// Add method required to implement `OutboxRepository`.
+func (repo *gormOutbox) Add(event *model.OutboxEvent) error {
+	return repo.db.Create(event).Error
+}
+
+// Pending method required to implement `OutboxRepository`.
+func (repo *gormOutbox) Pending(limit int) ([]*model.OutboxEvent, error) {
+	db := repo.db.Where("dispatched_at IS NULL").Order("id ASC").Limit(limit)
+	// Sqlite locks the whole database in a transaction, and doesn't support locking rows.
+	if db.Dialect().GetName() == "postgres" {
+		db = db.Set("gorm:query_option", "FOR UPDATE")
+	}
+
+	events := make([]*model.OutboxEvent, 0)
+	err := db.Find(&events).Error
+
+	return events, err
+}
+
+// MarkDispatched method required to implement `OutboxRepository`.
+func (repo *gormOutbox) MarkDispatched(event *model.OutboxEvent) error {
+	now := time.Now()
+	if err := repo.db.Model(event).UpdateColumn("dispatched_at", now).Error; err != nil {
+		return err
+	}
+	event.DispatchedAt = &now
+
+	return nil
+}
+
+// MarkFailed method required to implement `OutboxRepository`.
+func (repo *gormOutbox) MarkFailed(event *model.OutboxEvent, reason string) error {
+	err := repo.db.Model(event).UpdateColumns(map[string]interface{}{
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": reason,
+	}).Error
+	if err != nil {
+		return err
+	}
+	event.Attempts++
+	event.LastError = reason
+
+	return nil
+}
+
+// WebhookRepository that stores webhooks in the database.
+type gormWebhooks struct {
+	db *gorm.DB
+}
+
+// Find method required to implement `WebhookRepository`.
+func (repo *gormWebhooks) Find(id uuid.UUID) (*model.Webhook, error) {
+	webhook := &model.Webhook{Model: model.Model{ID: id}}
+	if err := repo.db.Where(webhook).First(webhook).Error; err != nil {
+		return nil, gormError(err)
+	}
+
+	return webhook, nil
+}
+
+// List method required to implement `WebhookRepository`.
+func (repo *gormWebhooks) List(orgID uuid.UUID) ([]*model.Webhook, error) {
+	webhooks := make([]*model.Webhook, 0)
+	err := repo.db.Where(&model.Webhook{OrganisationID: orgID}).Order("created_at ASC, id ASC").Find(&webhooks).Error
+
+	return webhooks, err
+}
+
+// Create method required to implement `WebhookRepository`.
+func (repo *gormWebhooks) Create(webhook *model.Webhook) error {
+	return repo.db.Create(webhook).Error
+}
+
+// Update method required to implement `WebhookRepository`. The attributes are updated explicitly, as updating with a
+// struct skips the ones that are false or empty.
+func (repo *gormWebhooks) Update(webhook *model.Webhook) error {
+	return repo.db.Model(webhook).Updates(map[string]interface{}{
+		"url":         webhook.URL,
+		"event_types": webhook.EventTypes,
+		"secret":      webhook.Secret,
+		"enabled":     webhook.Enabled,
+		"failures":    webhook.Failures,
+	}).Error
+}
+
+// Delete method required to implement `WebhookRepository`.
+func (repo *gormWebhooks) Delete(webhook *model.Webhook) error {
+	return repo.db.Delete(webhook).Error
+}
+
+// RecordSuccess method required to implement `WebhookRepository`.
+func (repo *gormWebhooks) RecordSuccess(webhook *model.Webhook) error {
+	if err := repo.db.Model(webhook).UpdateColumn("failures", 0).Error; err != nil {
+		return err
+	}
+	webhook.Failures = 0
+
+	return nil
+}
+
+// RecordFailure method required to implement `WebhookRepository`. The failures are counted by the database, so
+// concurrent deliveries to the same webhook are all counted.
+func (repo *gormWebhooks) RecordFailure(webhook *model.Webhook, disableAfter int) error {
+	err := repo.db.Model(webhook).UpdateColumn("failures", gorm.Expr("failures + 1")).Error
+	if err != nil {
+		return err
+	}
+	err = repo.db.Model(webhook).Where("failures >= ?", disableAfter).UpdateColumn("enabled", false).Error
+	if err != nil {
+		return err
+	}
+
+	return repo.db.Select("enabled, failures").Where("id = ?", webhook.ID).First(webhook).Error
+}
+
+// WebhookDeliveryRepository that stores deliveries in the database.
+type gormDeliveries struct {
+	db *gorm.DB
+}
+
+// Create method required to implement `WebhookDeliveryRepository`.
+func (repo *gormDeliveries) Create(delivery *model.WebhookDelivery) error {
+	return repo.db.Create(delivery).Error
+}
+
+// List method required to implement `WebhookDeliveryRepository`.
+func (repo *gormDeliveries) List(webhookID uuid.UUID, limit int) ([]*model.WebhookDelivery, error) {
+	deliveries := make([]*model.WebhookDelivery, 0)
+	err := repo.db.Where(&model.WebhookDelivery{WebhookID: webhookID}).Order("id DESC").Limit(limit).Find(&deliveries).Error
+
+	return deliveries, err
+}
+
+// ListByEvent method required to implement `WebhookDeliveryRepository`.
+func (repo *gormDeliveries) ListByEvent(eventID uint) ([]*model.WebhookDelivery, error) {
+	deliveries := make([]*model.WebhookDelivery, 0)
+	err := repo.db.Where(&model.WebhookDelivery{EventID: eventID}).Order("id ASC").Find(&deliveries).Error
+
+	return deliveries, err
+}
+
+// Due method required to implement `WebhookDeliveryRepository`.
+func (repo *gormDeliveries) Due(at time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	db := repo.db.Where("status = ? AND next_attempt_at <= ?", model.DeliveryPending, at).
+		Order("next_attempt_at ASC, id ASC").
+		Limit(limit)
+	// Sqlite locks the whole database in a transaction, and doesn't support locking rows.
+	if db.Dialect().GetName() == "postgres" {
+		db = db.Set("gorm:query_option", "FOR UPDATE SKIP LOCKED")
+	}
+
+	deliveries := make([]*model.WebhookDelivery, 0)
+	err := db.Find(&deliveries).Error
+
+	return deliveries, err
+}
+
+// Update method required to implement `WebhookDeliveryRepository`.
+func (repo *gormDeliveries) Update(delivery *model.WebhookDelivery) error {
+	return repo.db.Model(delivery).Updates(map[string]interface{}{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"last_attempt_at": delivery.LastAttemptAt,
+		"response_code":   delivery.ResponseCode,
+		"last_error":      delivery.LastError,
+	}).Error
+}
+
+// Run fn in a new transaction of the database, which is committed when fn succeeds and rolled back otherwise. When db
+// is already part of a transaction, fn runs in that transaction instead, as gorm can't nest them.
+func transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if _, ok := db.CommonDB().(*sql.Tx); ok {
+		return fn(db)
+	}
+
+	tx := db.Begin()
+	if err := tx.Error; err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Preload the associations needed for the attributes and relationships of payments that are requested. Automatic
+// preloading is disabled, so associations of attributes that aren't requested are never loaded.
+func loadPayments(db *gorm.DB, load Load) (*gorm.DB, error) {
+	fields := load.Fields
+	if fields == nil {
+		fields = make([]string, 0, len(paymentAssociations))
+		for field := range paymentAssociations {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+	}
+
+	// Preloading an association twice would load it twice, e.g. for attributes sharing an association.
+	preloaded := make(map[string]bool)
+	db = db.Set("gorm:auto_preload", false)
+	for _, field := range fields {
+		for _, association := range paymentAssociations[field] {
+			if !preloaded[association] {
+				db = db.Preload(association)
+				preloaded[association] = true
+			}
+		}
+	}
+
+	// Relationships are loaded in a single query for all payments, instead of a query per payment.
+	for _, name := range load.Include {
+		association, ok := paymentIncludes[name]
+		if !ok {
+			return nil, fmt.Errorf("cannot include `%s` with payments", name)
+		}
+		db = db.Preload(association)
+	}
+
+	return db, nil
+}
+
+// Apply the filters, order, position and limits of the query to a query of the table.
+func list(db *gorm.DB, table string, columns map[string]column, query Query) (*gorm.DB, error) {
+	db, err := where(db, columns, query.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	if position := query.Seek; position != nil {
+		comparison := ">"
+		if position.Backward {
+			comparison = "<"
+		}
+		condition := fmt.Sprintf("%[1]s.created_at %[2]s ? OR (%[1]s.created_at = ? AND %[1]s.id %[2]s ?)", table, comparison)
+		db = db.Where(condition, position.CreatedAt, position.CreatedAt, position.ID)
+	}
+
+	ordered := false
+	for _, order := range query.Order {
+		c, ok := columns[order.Field]
+		if !ok {
+			return nil, fmt.Errorf("cannot order %s on `%s`", table, order.Field)
+		}
+
+		direction := "ASC"
+		if order.Descending {
+			direction = "DESC"
+		}
+		db = db.Order(c.name + " " + direction)
+		ordered = ordered || order.Field == "id"
+	}
+	if !ordered {
+		db = db.Order(table + ".id ASC")
+	}
+
+	if query.Limit > 0 {
+		db = db.Limit(query.Limit)
+	}
+	if query.Offset > 0 {
+		db = db.Offset(query.Offset)
+	}
+
+	return db, nil
+}
+
+// Apply the filters to the query.
+func where(db *gorm.DB, columns map[string]column, filters []Filter) (*gorm.DB, error) {
+	for _, f := range filters {
+		c, ok := columns[f.Field]
+		format, known := operatorConditions[f.Operator]
+		if !ok || !known {
+			return nil, fmt.Errorf("cannot filter on `%s` with operator `%s`", f.Field, f.Operator)
+		}
+
+		condition := fmt.Sprintf(format, c.name)
+		if c.related != "" {
+			condition = fmt.Sprintf(c.related, condition)
+		}
+
+		if f.Operator == OperatorEq {
+			db = db.Where(condition, f.Values)
+		} else {
+			db = db.Where(condition, f.Values[0])
+		}
+	}
+
+	return db, nil
+}
+
+// Whether the error is the violation of a unique index, e.g. by a concurrent insert of the same key.
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	if pqErr, ok := err.(*pq.Error); ok {
+		return pqErr.Code == uniqueViolation
+	}
+
+	// The sqlite driver of the tests isn't a dependency of the API, so its errors are recognised by their message.
+	return strings.HasPrefix(err.Error(), "UNIQUE constraint failed")
+}
+
+// Convert the errors of gorm to the errors of this package.
+func gormError(err error) error {
+	if gorm.IsRecordNotFoundError(err) {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// Create the columns of the attributes of payments. Besides the attributes of the payment itself, this includes the
+// attributes of their parties, e.g. `beneficiary_party.account_number`.
+func newPaymentColumns() map[string]column {
+	columns := map[string]column{
+		"id":              {name: "payments.id"},
+		"created_at":      {name: "payments.created_at"},
+		"updated_at":      {name: "payments.updated_at"},
+		"amount":          {name: "payments.amount"},
+		"currency":        {name: "payments.currency"},
+		"payment_scheme":  {name: "payments.payment_scheme"},
+		"payment_type":    {name: "payments.payment_type"},
+		"processing_date": {name: "payments.processing_date"},
+		"status":          {name: "payments.status"},
+		"organisation":    {name: "payments.organisation_id"},
+	}
+
+	for _, party := range partyAttributes {
+		related := "payments." + party + "_id IN (SELECT id FROM parties WHERE %s)"
+		for _, attribute := range partyColumns {
+			columns[party+"."+attribute] = column{name: "parties." + attribute, related: related}
+		}
+	}
+
+	return columns
+}
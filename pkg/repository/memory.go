@@ -0,0 +1,1272 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/satori/go.uuid"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Accessors of the attributes of payments that can be queried, see `newPaymentValues`.
+var paymentValues = newPaymentValues()
+
+// Accessors of the attributes of organisations that can be queried.
+var organisationValues = map[string]func(org *model.Organisation) interface{}{
+	"id":         func(org *model.Organisation) interface{} { return org.ID },
+	"created_at": func(org *model.Organisation) interface{} { return org.CreatedAt },
+	"updated_at": func(org *model.Organisation) interface{} { return org.UpdatedAt },
+	"name":       func(org *model.Organisation) interface{} { return org.Name },
+}
+
+// Storage of all resources in memory, safe for concurrent use. Resources are copied when they are stored and when they
+// are returned, so callers can never change stored resources without going through a repository.
+type memoryStore struct {
+	mu            sync.RWMutex
+	organisations map[uuid.UUID]*model.Organisation
+	payments      map[uuid.UUID]*model.Payment
+	keys          map[string]*model.IdempotencyKey
+	lastKeyID     uint
+	apiKeys       map[uuid.UUID]*model.APIKey
+	auditEvents   []*model.AuditEvent
+	outbox        []*model.OutboxEvent
+	webhooks      map[uuid.UUID]*model.Webhook
+	deliveries    []*model.WebhookDelivery
+
+	// Held for the duration of a transaction, so transactions don't roll back each other's changes.
+	tx sync.Mutex
+}
+
+// Copy of all resources of a memoryStore, to roll back a transaction.
+type memorySnapshot struct {
+	organisations map[uuid.UUID]*model.Organisation
+	payments      map[uuid.UUID]*model.Payment
+	keys          map[string]*model.IdempotencyKey
+	lastKeyID     uint
+	apiKeys       map[uuid.UUID]*model.APIKey
+	auditEvents   int
+	outbox        []*model.OutboxEvent
+	webhooks      map[uuid.UUID]*model.Webhook
+	deliveries    []*model.WebhookDelivery
+}
+
+// NewMemory creates Repositories that store all resources in memory, for tests and local demos that run without a
+// database. Everything stored is lost when the process exits.
+func NewMemory() Repositories {
+	store := &memoryStore{
+		organisations: make(map[uuid.UUID]*model.Organisation),
+		payments:      make(map[uuid.UUID]*model.Payment),
+		keys:          make(map[string]*model.IdempotencyKey),
+		apiKeys:       make(map[uuid.UUID]*model.APIKey),
+		webhooks:      make(map[uuid.UUID]*model.Webhook),
+	}
+
+	repos := Repositories{
+		Payments:      &memoryPayments{store: store},
+		Organisations: &memoryOrganisations{store: store},
+		APIKeys:       &memoryAPIKeys{store: store},
+		AuditEvents:   &memoryAuditEvents{store: store},
+		Outbox:        &memoryOutbox{store: store},
+		Webhooks:      &memoryWebhooks{store: store},
+		Deliveries:    &memoryDeliveries{store: store},
+	}
+	// Nothing is logged in memory, so the repositories are the same for every request.
+	repos.scope = func(context.Context) Repositories {
+		return repos
+	}
+	repos.transact = store.transaction(repos)
+
+	return repos
+}
+
+// Create the function that runs functions in a transaction of the store, with the repositories of the store.
+// Transactions are run one at a time, and rolled back by restoring a snapshot of the store. Changes made outside of
+// transactions while one is running are lost when it's rolled back, which is good enough for tests and local demos.
+func (store *memoryStore) transaction(repos Repositories) func(fn func(tx Repositories) error) error {
+	return func(fn func(tx Repositories) error) error {
+		store.tx.Lock()
+		defer store.tx.Unlock()
+
+		// Transactions started within the transaction are part of it.
+		tx := repos
+		tx.transact = func(fn func(tx Repositories) error) error {
+			return fn(tx)
+		}
+
+		snapshot := store.snapshot()
+		if err := fn(tx); err != nil {
+			store.restore(snapshot)
+			return err
+		}
+
+		return nil
+	}
+}
+
+// PaymentRepository that stores payments in memory.
+type memoryPayments struct {
+	store *memoryStore
+}
+
+// Find method required to implement `PaymentRepository`.
+func (repo *memoryPayments) Find(id uuid.UUID, load Load) (*model.Payment, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	payment, ok := repo.store.payments[id]
+	if !ok || payment.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+
+	return repo.store.loadPayment(payment, load)
+}
+
+// List method required to implement `PaymentRepository`.
+func (repo *memoryPayments) List(query Query) ([]*model.Payment, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	selected, err := repo.selectPayments(query)
+	if err != nil {
+		return nil, err
+	}
+
+	payments := make([]*model.Payment, 0, len(selected))
+	for _, payment := range paginate(selected, query).([]*model.Payment) {
+		loaded, err := repo.store.loadPayment(payment, query.Load)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, loaded)
+	}
+
+	return payments, nil
+}
+
+// Count method required to implement `PaymentRepository`.
+func (repo *memoryPayments) Count(query Query) (uint, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	selected, err := repo.selectPayments(Query{Filters: query.Filters})
+
+	return uint(len(selected)), err
+}
+
+// Create method required to implement `PaymentRepository`.
+func (repo *memoryPayments) Create(payment *model.Payment) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	return repo.store.createPayment(payment)
+}
+
+// CreateIdempotent method required to implement `PaymentRepository`.
+func (repo *memoryPayments) CreateIdempotent(payment *model.Payment, key *model.IdempotencyKey, respond func() error) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	index := idempotencyIndex(key.OrganisationID, key.Key)
+	if _, ok := repo.store.keys[index]; ok {
+		return ErrConflict
+	}
+
+	if err := repo.store.createPayment(payment); err != nil {
+		return err
+	}
+	if err := respond(); err != nil {
+		delete(repo.store.payments, payment.ID)
+		return err
+	}
+
+	repo.store.lastKeyID++
+	key.ID = repo.store.lastKeyID
+	key.CreatedAt = time.Now()
+	stored := *key
+	repo.store.keys[index] = &stored
+
+	return nil
+}
+
+// FindIdempotencyKey method required to implement `PaymentRepository`.
+func (repo *memoryPayments) FindIdempotencyKey(orgID uuid.UUID, key string) (*model.IdempotencyKey, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	stored, ok := repo.store.keys[idempotencyIndex(orgID, key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *stored
+
+	return &found, nil
+}
+
+// Update method required to implement `PaymentRepository`.
+func (repo *memoryPayments) Update(payment *model.Payment, data *model.Payment) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	stored, ok := repo.store.payments[payment.ID]
+	if !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+
+	merge(payment, data)
+	payment.UpdatedAt = time.Now()
+	merge(stored, data)
+	stored.UpdatedAt = payment.UpdatedAt
+	repo.store.payments[payment.ID] = clonePayment(stored)
+
+	return nil
+}
+
+// UpdateStatus method required to implement `PaymentRepository`.
+func (repo *memoryPayments) UpdateStatus(payment *model.Payment, from model.PaymentStatus) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	stored, ok := repo.store.payments[payment.ID]
+	if !ok || stored.DeletedAt != nil || stored.Status != from {
+		return ErrConflict
+	}
+
+	payment.UpdatedAt = time.Now()
+	stored.Status = payment.Status
+	stored.UpdatedAt = payment.UpdatedAt
+
+	return nil
+}
+
+// Delete method required to implement `PaymentRepository`. Payments are only marked as deleted, like they are in the
+// database.
+func (repo *memoryPayments) Delete(payment *model.Payment) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	if stored, ok := repo.store.payments[payment.ID]; ok && stored.DeletedAt == nil {
+		now := time.Now()
+		stored.DeletedAt = &now
+	}
+
+	return nil
+}
+
+// Select the payments matching the filters and position of the query, in the order of the query. The store must be
+// locked.
+func (repo *memoryPayments) selectPayments(query Query) ([]*model.Payment, error) {
+	payments := make([]*model.Payment, 0, len(repo.store.payments))
+	for _, payment := range repo.store.payments {
+		if payment.DeletedAt == nil {
+			payments = append(payments, payment)
+		}
+	}
+
+	values := make(map[string]func(i int) interface{}, len(paymentValues))
+	for field, get := range paymentValues {
+		get := get
+		values[field] = func(i int) interface{} { return get(payments[i]) }
+	}
+	indices, err := selectIndices(len(payments), "payments", query, values)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]*model.Payment, len(indices))
+	for i, index := range indices {
+		selected[i] = payments[index]
+	}
+
+	return selected, nil
+}
+
+// OrganisationRepository that stores organisations in memory.
+type memoryOrganisations struct {
+	store *memoryStore
+}
+
+// Find method required to implement `OrganisationRepository`.
+func (repo *memoryOrganisations) Find(id uuid.UUID) (*model.Organisation, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	org, ok := repo.store.organisations[id]
+	if !ok || org.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	found := *org
+
+	return &found, nil
+}
+
+// List method required to implement `OrganisationRepository`.
+func (repo *memoryOrganisations) List(query Query) ([]*model.Organisation, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	selected, err := repo.selectOrganisations(query)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs := make([]*model.Organisation, 0, len(selected))
+	for _, org := range paginate(selected, query).([]*model.Organisation) {
+		found := *org
+		orgs = append(orgs, &found)
+	}
+
+	return orgs, nil
+}
+
+// Count method required to implement `OrganisationRepository`.
+func (repo *memoryOrganisations) Count(query Query) (uint, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	selected, err := repo.selectOrganisations(Query{Filters: query.Filters})
+
+	return uint(len(selected)), err
+}
+
+// Create method required to implement `OrganisationRepository`.
+func (repo *memoryOrganisations) Create(org *model.Organisation) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	if err := org.BeforeCreate(); err != nil {
+		return err
+	}
+	if _, ok := repo.store.organisations[org.ID]; ok {
+		return fmt.Errorf("organisation %s already exists", org.ID)
+	}
+
+	touch(&org.Model)
+	stored := *org
+	stored.PaymentIDs = nil
+	repo.store.organisations[org.ID] = &stored
+
+	return nil
+}
+
+// Update method required to implement `OrganisationRepository`.
+func (repo *memoryOrganisations) Update(org *model.Organisation, data *model.Organisation) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	stored, ok := repo.store.organisations[org.ID]
+	if !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+
+	merge(org, data)
+	org.UpdatedAt = time.Now()
+	merge(stored, data)
+	stored.UpdatedAt = org.UpdatedAt
+	stored.PaymentIDs = nil
+
+	return nil
+}
+
+// Delete method required to implement `OrganisationRepository`. Organisations are only marked as deleted, like they
+// are in the database.
+func (repo *memoryOrganisations) Delete(org *model.Organisation) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	if stored, ok := repo.store.organisations[org.ID]; ok && stored.DeletedAt == nil {
+		now := time.Now()
+		stored.DeletedAt = &now
+	}
+
+	return nil
+}
+
+// Select the organisations matching the filters and position of the query, in the order of the query. The store must
+// be locked.
+func (repo *memoryOrganisations) selectOrganisations(query Query) ([]*model.Organisation, error) {
+	orgs := make([]*model.Organisation, 0, len(repo.store.organisations))
+	for _, org := range repo.store.organisations {
+		if org.DeletedAt == nil {
+			orgs = append(orgs, org)
+		}
+	}
+
+	values := make(map[string]func(i int) interface{}, len(organisationValues))
+	for field, get := range organisationValues {
+		get := get
+		values[field] = func(i int) interface{} { return get(orgs[i]) }
+	}
+	indices, err := selectIndices(len(orgs), "organisations", query, values)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]*model.Organisation, len(indices))
+	for i, index := range indices {
+		selected[i] = orgs[index]
+	}
+
+	return selected, nil
+}
+
+// APIKeyRepository that stores API keys in memory.
+type memoryAPIKeys struct {
+	store *memoryStore
+}
+
+// Find method required to implement `APIKeyRepository`.
+func (repo *memoryAPIKeys) Find(id uuid.UUID) (*model.APIKey, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	key, ok := repo.store.apiKeys[id]
+	if !ok || key.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	found := *key
+
+	return &found, nil
+}
+
+// FindByHash method required to implement `APIKeyRepository`.
+func (repo *memoryAPIKeys) FindByHash(hash string) (*model.APIKey, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	for _, key := range repo.store.apiKeys {
+		if key.Hash == hash && key.DeletedAt == nil {
+			found := *key
+			return &found, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// List method required to implement `APIKeyRepository`.
+func (repo *memoryAPIKeys) List(orgID uuid.UUID) ([]*model.APIKey, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	keys := make([]*model.APIKey, 0)
+	for _, key := range repo.store.apiKeys {
+		if key.OrganisationID == orgID && key.DeletedAt == nil {
+			found := *key
+			keys = append(keys, &found)
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return compareValues(keys[i].ID, keys[j].ID) < 0
+	})
+
+	return keys, nil
+}
+
+// Create method required to implement `APIKeyRepository`. The organisation of the key must exist, like the foreign key
+// in the database requires. The key itself is never stored, only its hash.
+func (repo *memoryAPIKeys) Create(key *model.APIKey) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	if err := key.BeforeCreate(); err != nil {
+		return err
+	}
+	if _, ok := repo.store.apiKeys[key.ID]; ok {
+		return fmt.Errorf("api key %s already exists", key.ID)
+	}
+	if org, ok := repo.store.organisations[key.OrganisationID]; !ok || org.DeletedAt != nil {
+		return fmt.Errorf("organisation %s does not exist", key.OrganisationID)
+	}
+	for _, stored := range repo.store.apiKeys {
+		if stored.Hash == key.Hash {
+			return fmt.Errorf("api key with hash %s already exists", key.Hash)
+		}
+	}
+
+	touch(&key.Model)
+	stored := *key
+	stored.Key = ""
+	repo.store.apiKeys[key.ID] = &stored
+
+	return nil
+}
+
+// Revoke method required to implement `APIKeyRepository`.
+func (repo *memoryAPIKeys) Revoke(key *model.APIKey) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	stored, ok := repo.store.apiKeys[key.ID]
+	if !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if stored.RevokedAt == nil {
+		now := time.Now()
+		stored.RevokedAt = &now
+		stored.UpdatedAt = now
+	}
+	key.RevokedAt = stored.RevokedAt
+	key.UpdatedAt = stored.UpdatedAt
+
+	return nil
+}
+
+// AuditEventRepository that stores the audit log in memory.
+type memoryAuditEvents struct {
+	store *memoryStore
+}
+
+// Append method required to implement `AuditEventRepository`.
+func (repo *memoryAuditEvents) Append(event *model.AuditEvent) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	event.ID = uint(len(repo.store.auditEvents) + 1)
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	stored := *event
+	repo.store.auditEvents = append(repo.store.auditEvents, &stored)
+
+	return nil
+}
+
+// List method required to implement `AuditEventRepository`.
+func (repo *memoryAuditEvents) List(resourceType string, resourceID uuid.UUID) ([]*model.AuditEvent, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	events := make([]*model.AuditEvent, 0)
+	for _, event := range repo.store.auditEvents {
+		if event.ResourceType == resourceType && uuid.Equal(event.ResourceID, resourceID) {
+			found := *event
+			events = append(events, &found)
+		}
+	}
+
+	return events, nil
+}
+
+// OutboxRepository that stores the outbox in memory. Transactions run one at a time, so pending events don't need to be
+// locked.
+type memoryOutbox struct {
+	store *memoryStore
+}
+
+// Add method required to implement `OutboxRepository`.
+func (repo *memoryOutbox) Add(event *model.OutboxEvent) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	event.ID = uint(len(repo.store.outbox) + 1)
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	stored := *event
+	repo.store.outbox = append(repo.store.outbox, &stored)
+
+	return nil
+}
+
+// Pending method required to implement `OutboxRepository`.
+func (repo *memoryOutbox) Pending(limit int) ([]*model.OutboxEvent, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	events := make([]*model.OutboxEvent, 0)
+	for _, event := range repo.store.outbox {
+		if len(events) == limit {
+			break
+		}
+		if event.DispatchedAt == nil {
+			found := *event
+			events = append(events, &found)
+		}
+	}
+
+	return events, nil
+}
+
+// MarkDispatched method required to implement `OutboxRepository`.
+func (repo *memoryOutbox) MarkDispatched(event *model.OutboxEvent) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	stored, err := repo.find(event.ID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	stored.DispatchedAt = &now
+	event.DispatchedAt = &now
+
+	return nil
+}
+
+// MarkFailed method required to implement `OutboxRepository`.
+func (repo *memoryOutbox) MarkFailed(event *model.OutboxEvent, reason string) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	stored, err := repo.find(event.ID)
+	if err != nil {
+		return err
+	}
+	stored.Attempts++
+	stored.LastError = reason
+	event.Attempts, event.LastError = stored.Attempts, stored.LastError
+
+	return nil
+}
+
+// Find the stored event with the id. The store must be locked.
+func (repo *memoryOutbox) find(id uint) (*model.OutboxEvent, error) {
+	if id == 0 || int(id) > len(repo.store.outbox) {
+		return nil, ErrNotFound
+	}
+
+	return repo.store.outbox[id-1], nil
+}
+
+// WebhookRepository that stores webhooks in memory.
+type memoryWebhooks struct {
+	store *memoryStore
+}
+
+// Find method required to implement `WebhookRepository`.
+func (repo *memoryWebhooks) Find(id uuid.UUID) (*model.Webhook, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	webhook, ok := repo.store.webhooks[id]
+	if !ok || webhook.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+
+	return cloneWebhook(webhook), nil
+}
+
+// List method required to implement `WebhookRepository`.
+func (repo *memoryWebhooks) List(orgID uuid.UUID) ([]*model.Webhook, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	webhooks := make([]*model.Webhook, 0)
+	for _, webhook := range repo.store.webhooks {
+		if webhook.OrganisationID == orgID && webhook.DeletedAt == nil {
+			webhooks = append(webhooks, cloneWebhook(webhook))
+		}
+	}
+	sort.SliceStable(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+		return compareValues(webhooks[i].ID, webhooks[j].ID) < 0
+	})
+
+	return webhooks, nil
+}
+
+// Create method required to implement `WebhookRepository`. The organisation of the webhook must exist, like the
+// foreign key in the database requires.
+func (repo *memoryWebhooks) Create(webhook *model.Webhook) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	if err := webhook.BeforeCreate(); err != nil {
+		return err
+	}
+	if _, ok := repo.store.webhooks[webhook.ID]; ok {
+		return fmt.Errorf("webhook %s already exists", webhook.ID)
+	}
+	if org, ok := repo.store.organisations[webhook.OrganisationID]; !ok || org.DeletedAt != nil {
+		return fmt.Errorf("organisation %s does not exist", webhook.OrganisationID)
+	}
+
+	touch(&webhook.Model)
+	repo.store.webhooks[webhook.ID] = cloneWebhook(webhook)
+
+	return nil
+}
+
+// Update method required to implement `WebhookRepository`.
+func (repo *memoryWebhooks) Update(webhook *model.Webhook) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	stored, ok := repo.store.webhooks[webhook.ID]
+	if !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+	webhook.UpdatedAt = time.Now()
+	webhook.CreatedAt, webhook.OrganisationID = stored.CreatedAt, stored.OrganisationID
+	repo.store.webhooks[webhook.ID] = cloneWebhook(webhook)
+
+	return nil
+}
+
+// Delete method required to implement `WebhookRepository`.
+func (repo *memoryWebhooks) Delete(webhook *model.Webhook) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	if stored, ok := repo.store.webhooks[webhook.ID]; ok && stored.DeletedAt == nil {
+		now := time.Now()
+		stored.DeletedAt = &now
+	}
+
+	return nil
+}
+
+// RecordSuccess method required to implement `WebhookRepository`.
+func (repo *memoryWebhooks) RecordSuccess(webhook *model.Webhook) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	if stored, ok := repo.store.webhooks[webhook.ID]; ok {
+		stored.Failures = 0
+	}
+	webhook.Failures = 0
+
+	return nil
+}
+
+// RecordFailure method required to implement `WebhookRepository`.
+func (repo *memoryWebhooks) RecordFailure(webhook *model.Webhook, disableAfter int) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	stored, ok := repo.store.webhooks[webhook.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.Failures++
+	if stored.Failures >= disableAfter {
+		stored.Enabled = false
+	}
+	webhook.Failures, webhook.Enabled = stored.Failures, stored.Enabled
+
+	return nil
+}
+
+// WebhookDeliveryRepository that stores deliveries in memory. Transactions run one at a time, so due deliveries don't
+// need to be locked.
+type memoryDeliveries struct {
+	store *memoryStore
+}
+
+// Create method required to implement `WebhookDeliveryRepository`.
+func (repo *memoryDeliveries) Create(delivery *model.WebhookDelivery) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	for _, stored := range repo.store.deliveries {
+		if stored.WebhookID == delivery.WebhookID && stored.EventID == delivery.EventID {
+			return fmt.Errorf("event %d already has a delivery to webhook %s", delivery.EventID, delivery.WebhookID)
+		}
+	}
+
+	delivery.ID = uint(len(repo.store.deliveries) + 1)
+	now := time.Now()
+	delivery.CreatedAt, delivery.UpdatedAt = now, now
+	repo.store.deliveries = append(repo.store.deliveries, cloneDelivery(delivery))
+
+	return nil
+}
+
+// List method required to implement `WebhookDeliveryRepository`.
+func (repo *memoryDeliveries) List(webhookID uuid.UUID, limit int) ([]*model.WebhookDelivery, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	deliveries := make([]*model.WebhookDelivery, 0)
+	for i := len(repo.store.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if delivery := repo.store.deliveries[i]; delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, cloneDelivery(delivery))
+		}
+	}
+
+	return deliveries, nil
+}
+
+// ListByEvent method required to implement `WebhookDeliveryRepository`.
+func (repo *memoryDeliveries) ListByEvent(eventID uint) ([]*model.WebhookDelivery, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	deliveries := make([]*model.WebhookDelivery, 0)
+	for _, delivery := range repo.store.deliveries {
+		if delivery.EventID == eventID {
+			deliveries = append(deliveries, cloneDelivery(delivery))
+		}
+	}
+
+	return deliveries, nil
+}
+
+// Due method required to implement `WebhookDeliveryRepository`.
+func (repo *memoryDeliveries) Due(at time.Time, limit int) ([]*model.WebhookDelivery, error) {
+	repo.store.mu.RLock()
+	defer repo.store.mu.RUnlock()
+
+	deliveries := make([]*model.WebhookDelivery, 0)
+	for _, delivery := range repo.store.deliveries {
+		if delivery.Status == model.DeliveryPending && delivery.NextAttemptAt != nil && !delivery.NextAttemptAt.After(at) {
+			deliveries = append(deliveries, cloneDelivery(delivery))
+		}
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].NextAttemptAt.Before(*deliveries[j].NextAttemptAt)
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+// Update method required to implement `WebhookDeliveryRepository`.
+func (repo *memoryDeliveries) Update(delivery *model.WebhookDelivery) error {
+	repo.store.mu.Lock()
+	defer repo.store.mu.Unlock()
+
+	if delivery.ID == 0 || int(delivery.ID) > len(repo.store.deliveries) {
+		return ErrNotFound
+	}
+	stored := repo.store.deliveries[delivery.ID-1]
+	delivery.UpdatedAt = time.Now()
+	updated := cloneDelivery(delivery)
+	updated.CreatedAt, updated.WebhookID, updated.EventID = stored.CreatedAt, stored.WebhookID, stored.EventID
+	updated.EventType, updated.Payload = stored.EventType, stored.Payload
+	repo.store.deliveries[delivery.ID-1] = updated
+
+	return nil
+}
+
+// Copy all resources of the store. Audit events are never changed, so only their number is needed.
+func (store *memoryStore) snapshot() memorySnapshot {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	snapshot := memorySnapshot{
+		organisations: make(map[uuid.UUID]*model.Organisation, len(store.organisations)),
+		payments:      make(map[uuid.UUID]*model.Payment, len(store.payments)),
+		keys:          make(map[string]*model.IdempotencyKey, len(store.keys)),
+		lastKeyID:     store.lastKeyID,
+		apiKeys:       make(map[uuid.UUID]*model.APIKey, len(store.apiKeys)),
+		auditEvents:   len(store.auditEvents),
+		outbox:        make([]*model.OutboxEvent, len(store.outbox)),
+		webhooks:      make(map[uuid.UUID]*model.Webhook, len(store.webhooks)),
+		deliveries:    make([]*model.WebhookDelivery, len(store.deliveries)),
+	}
+	for id, org := range store.organisations {
+		clone := *org
+		snapshot.organisations[id] = &clone
+	}
+	for id, payment := range store.payments {
+		snapshot.payments[id] = clonePayment(payment)
+	}
+	for index, key := range store.keys {
+		clone := *key
+		snapshot.keys[index] = &clone
+	}
+	for id, key := range store.apiKeys {
+		clone := *key
+		snapshot.apiKeys[id] = &clone
+	}
+	for index, event := range store.outbox {
+		clone := *event
+		snapshot.outbox[index] = &clone
+	}
+	for id, webhook := range store.webhooks {
+		snapshot.webhooks[id] = cloneWebhook(webhook)
+	}
+	for index, delivery := range store.deliveries {
+		snapshot.deliveries[index] = cloneDelivery(delivery)
+	}
+
+	return snapshot
+}
+
+// Restore the resources of the store to a snapshot.
+func (store *memoryStore) restore(snapshot memorySnapshot) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.organisations = snapshot.organisations
+	store.payments = snapshot.payments
+	store.keys = snapshot.keys
+	store.lastKeyID = snapshot.lastKeyID
+	store.apiKeys = snapshot.apiKeys
+	store.auditEvents = store.auditEvents[:snapshot.auditEvents]
+	store.outbox = snapshot.outbox
+	store.webhooks = snapshot.webhooks
+	store.deliveries = snapshot.deliveries
+}
+
+// Store a copy of a new payment. The organisation of the payment must exist, like the foreign key in the database
+// requires. The store must be locked.
+func (store *memoryStore) createPayment(payment *model.Payment) error {
+	if err := payment.BeforeCreate(); err != nil {
+		return err
+	}
+	if _, ok := store.payments[payment.ID]; ok {
+		return fmt.Errorf("payment %s already exists", payment.ID)
+	}
+	if _, ok := store.organisations[payment.OrganisationID]; !ok {
+		return fmt.Errorf("organisation %s of payment %s doesn't exist", payment.OrganisationID, payment.ID)
+	}
+
+	if payment.Status == "" {
+		payment.Status = model.StatusPending
+	}
+	touch(&payment.Model)
+	store.payments[payment.ID] = clonePayment(payment)
+
+	return nil
+}
+
+// Copy a stored payment, with only the nested objects and relationships that are requested. The store must be locked.
+func (store *memoryStore) loadPayment(stored *model.Payment, load Load) (*model.Payment, error) {
+	payment := clonePayment(stored)
+
+	if load.Fields != nil {
+		requested := make(map[string]bool, len(load.Fields))
+		for _, field := range load.Fields {
+			requested[field] = true
+		}
+		if !requested["beneficiary_party"] {
+			payment.BeneficiaryParty = nil
+		}
+		if !requested["debtor_party"] {
+			payment.DebtorParty = nil
+		}
+		if !requested["sponsor_party"] {
+			payment.SponsorParty = nil
+		}
+		if !requested["charges_information"] {
+			payment.ChargesInformation = nil
+		}
+		if !requested["fx"] {
+			payment.FX = nil
+		}
+	}
+
+	for _, name := range load.Include {
+		if name != "organisation" {
+			return nil, fmt.Errorf("cannot include `%s` with payments", name)
+		}
+		// Deleted organisations aren't loaded, like they aren't by gorm.
+		if org, ok := store.organisations[payment.OrganisationID]; ok && org.DeletedAt == nil {
+			payment.Organisation = *org
+		}
+	}
+
+	return payment, nil
+}
+
+// Set the timestamps of a Model that's created, the same way gorm does.
+func touch(m *model.Model) {
+	now := time.Now()
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = now
+	}
+	if m.UpdatedAt.IsZero() {
+		m.UpdatedAt = now
+	}
+}
+
+// Copy a webhook, including its event types.
+func cloneWebhook(webhook *model.Webhook) *model.Webhook {
+	clone := *webhook
+	clone.EventTypes = append(model.EventTypes(nil), webhook.EventTypes...)
+
+	return &clone
+}
+
+// Copy a delivery, including its times.
+func cloneDelivery(delivery *model.WebhookDelivery) *model.WebhookDelivery {
+	clone := *delivery
+	if delivery.NextAttemptAt != nil {
+		next := *delivery.NextAttemptAt
+		clone.NextAttemptAt = &next
+	}
+	if delivery.LastAttemptAt != nil {
+		last := *delivery.LastAttemptAt
+		clone.LastAttemptAt = &last
+	}
+
+	return &clone
+}
+
+// Index of an idempotency key, which is unique per organisation.
+func idempotencyIndex(orgID uuid.UUID, key string) string {
+	return orgID.String() + "/" + key
+}
+
+// Copy a payment, including its nested objects, but without its loaded relationships.
+func clonePayment(payment *model.Payment) *model.Payment {
+	clone := *payment
+	clone.Organisation = model.Organisation{}
+	clone.SetFields(nil)
+
+	if payment.Amount != nil {
+		amount := *payment.Amount
+		clone.Amount = &amount
+	}
+	clone.BeneficiaryParty = cloneParty(payment.BeneficiaryParty)
+	clone.DebtorParty = cloneParty(payment.DebtorParty)
+	clone.SponsorParty = cloneParty(payment.SponsorParty)
+	if payment.ChargesInformation != nil {
+		charges := *payment.ChargesInformation
+		charges.SenderCharges = make([]*model.CurrencyAmount, len(payment.ChargesInformation.SenderCharges))
+		for i, charge := range payment.ChargesInformation.SenderCharges {
+			sender := *charge
+			charges.SenderCharges[i] = &sender
+		}
+		if payment.ChargesInformation.SenderCharges == nil {
+			charges.SenderCharges = nil
+		}
+		clone.ChargesInformation = &charges
+	}
+	if payment.FX != nil {
+		fx := *payment.FX
+		clone.FX = &fx
+	}
+
+	return &clone
+}
+
+// Copy a party of a payment.
+func cloneParty(party *model.Party) *model.Party {
+	if party == nil {
+		return nil
+	}
+	clone := *party
+
+	return &clone
+}
+
+// Copy the exported attributes of data that are set onto target, which must be pointers to the same type of struct.
+// Embedded structs, like the Model, are never copied. This is the same way gorm updates a model with a struct.
+func merge(target, data interface{}) {
+	targetValue := reflect.ValueOf(target).Elem()
+	dataValue := reflect.ValueOf(data).Elem()
+
+	for i := 0; i < dataValue.NumField(); i++ {
+		field := dataValue.Type().Field(i)
+		value := dataValue.Field(i)
+		if field.PkgPath != "" || field.Anonymous {
+			continue
+		}
+		if reflect.DeepEqual(value.Interface(), reflect.Zero(field.Type).Interface()) {
+			continue
+		}
+
+		targetValue.Field(i).Set(value)
+	}
+}
+
+// Select the indices of the n resources that match the filters and position of the query, in the order of the query.
+// The values map the attributes that can be queried to a function returning the value of the resource with an index.
+func selectIndices(n int, typ string, query Query, values map[string]func(i int) interface{}) ([]int, error) {
+	orders := append(append([]Order{}, query.Order...), Order{Field: "id"})
+	for _, order := range orders {
+		if _, ok := values[order.Field]; !ok {
+			return nil, fmt.Errorf("cannot order %s on `%s`", typ, order.Field)
+		}
+	}
+	for _, f := range query.Filters {
+		if _, ok := values[f.Field]; !ok {
+			return nil, fmt.Errorf("cannot filter %s on `%s`", typ, f.Field)
+		}
+	}
+
+	indices := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		if matches(i, query, values) {
+			indices = append(indices, i)
+		}
+	}
+
+	sort.SliceStable(indices, func(a, b int) bool {
+		for _, order := range orders {
+			c := compareValues(values[order.Field](indices[a]), values[order.Field](indices[b]))
+			if order.Descending {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	return indices, nil
+}
+
+// Check whether the resource with the index matches all filters and the position of the query.
+func matches(i int, query Query, values map[string]func(i int) interface{}) bool {
+	for _, f := range query.Filters {
+		if !matchesFilter(values[f.Field](i), f) {
+			return false
+		}
+	}
+
+	if position := query.Seek; position != nil {
+		c := compareValues(values["created_at"](i), position.CreatedAt)
+		if c == 0 {
+			c = compareValues(values["id"](i), position.ID)
+		}
+		if (position.Backward && c >= 0) || (!position.Backward && c <= 0) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Check whether a value matches a filter. Missing values never match, like NULL doesn't in the database.
+func matchesFilter(v interface{}, f Filter) bool {
+	if v == nil {
+		return false
+	}
+
+	switch f.Operator {
+	case OperatorEq:
+		for _, filterValue := range f.Values {
+			if compareValues(v, filterValue) == 0 {
+				return true
+			}
+		}
+		return false
+	case OperatorGte:
+		return compareValues(v, f.Values[0]) >= 0
+	case OperatorLte:
+		return compareValues(v, f.Values[0]) <= 0
+	}
+
+	return false
+}
+
+// Compare two values of the same attribute, returning -1, 0 or 1. Missing values are greater than all other values,
+// so they are sorted last in ascending order, like NULL is by Postgres.
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	switch a := a.(type) {
+	case string:
+		return compareStrings(a, b.(string))
+	case uuid.UUID:
+		return bytes.Compare(a.Bytes(), b.(uuid.UUID).Bytes())
+	case time.Time:
+		t := b.(time.Time)
+		switch {
+		case a.Before(t):
+			return -1
+		case a.After(t):
+			return 1
+		}
+		return 0
+	case model.Money:
+		return a.Cmp(b.(model.Money))
+	}
+
+	panic(fmt.Sprintf("cannot compare values of type %T", a))
+}
+
+// Compare two strings, returning -1, 0 or 1.
+func compareStrings(a, b string) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Limit the selected resources, a slice, to the offset and limit of the query.
+func paginate(selected interface{}, query Query) interface{} {
+	value := reflect.ValueOf(selected)
+
+	start := query.Offset
+	if start < 0 {
+		start = 0
+	}
+	if start > value.Len() {
+		start = value.Len()
+	}
+	end := value.Len()
+	if query.Limit > 0 && start+query.Limit < end {
+		end = start + query.Limit
+	}
+
+	return value.Slice(start, end).Interface()
+}
+
+// Create the accessors of the attributes of payments. Besides the attributes of the payment itself, this includes the
+// attributes of their parties, e.g. `beneficiary_party.account_number`. Missing amounts and parties have no value.
+func newPaymentValues() map[string]func(payment *model.Payment) interface{} {
+	values := map[string]func(payment *model.Payment) interface{}{
+		"id":              func(payment *model.Payment) interface{} { return payment.ID },
+		"created_at":      func(payment *model.Payment) interface{} { return payment.CreatedAt },
+		"updated_at":      func(payment *model.Payment) interface{} { return payment.UpdatedAt },
+		"currency":        func(payment *model.Payment) interface{} { return payment.Currency },
+		"payment_scheme":  func(payment *model.Payment) interface{} { return payment.PaymentScheme },
+		"payment_type":    func(payment *model.Payment) interface{} { return payment.PaymentType },
+		"processing_date": func(payment *model.Payment) interface{} { return payment.ProcessingDate },
+		"status":          func(payment *model.Payment) interface{} { return string(payment.Status) },
+		"organisation":    func(payment *model.Payment) interface{} { return payment.OrganisationID },
+		"amount": func(payment *model.Payment) interface{} {
+			if payment.Amount == nil {
+				return nil
+			}
+			return *payment.Amount
+		},
+	}
+
+	parties := map[string]func(payment *model.Payment) *model.Party{
+		"beneficiary_party": func(payment *model.Payment) *model.Party { return payment.BeneficiaryParty },
+		"debtor_party":      func(payment *model.Payment) *model.Party { return payment.DebtorParty },
+		"sponsor_party":     func(payment *model.Payment) *model.Party { return payment.SponsorParty },
+	}
+	for _, name := range partyAttributes {
+		party := parties[name]
+		for _, attribute := range partyColumns {
+			get := partyValues[attribute]
+			values[name+"."+attribute] = func(payment *model.Payment) interface{} {
+				if p := party(payment); p != nil {
+					return get(p)
+				}
+				return nil
+			}
+		}
+	}
+
+	return values
+}
+
+// Accessors of the attributes of parties that can be queried.
+var partyValues = map[string]func(party *model.Party) string{
+	"account_name":        func(party *model.Party) string { return party.AccountName },
+	"account_number":      func(party *model.Party) string { return party.AccountNumber },
+	"account_number_code": func(party *model.Party) string { return party.AccountNumberCode },
+	"bank_id":             func(party *model.Party) string { return party.BankID },
+	"bank_id_code":        func(party *model.Party) string { return party.BankIDCode },
+	"name":                func(party *model.Party) string { return party.Name },
+}
@@ -0,0 +1,228 @@
+// Package repository stores the resources of the API. The sources only depend on the interfaces of this package, which
+// are implemented on top of gorm for Postgres, see `NewGorm`, and in memory for tests and local demos, see `NewMemory`.
+//
+// Queries are described in terms of the attributes of the resources, e.g. `currency` or `beneficiary_party.name`,
+// which every implementation maps to its own storage. Query parameters are validated by the sources, so
+// implementations may return an error for anything they don't know.
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/satori/go.uuid"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when a resource doesn't exist, or has been deleted.
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict is returned when a change conflicts with the stored state, e.g. when a payment changed status
+	// concurrently or an idempotency key is used twice.
+	ErrConflict = errors.New("conflicting change")
+)
+
+// Operators of a Filter.
+const (
+	// OperatorEq matches any of the values of the filter.
+	OperatorEq = "eq"
+	// OperatorGte matches values greater than or equal to the single value of the filter.
+	OperatorGte = "gte"
+	// OperatorLte matches values less than or equal to the single value of the filter.
+	OperatorLte = "lte"
+)
+
+// Attributes of payments that are parties, and the attributes of parties that can be queried, e.g.
+// `beneficiary_party.account_number`.
+var (
+	partyAttributes = []string{"beneficiary_party", "debtor_party", "sponsor_party"}
+	partyColumns    = []string{"account_name", "account_number", "account_number_code", "bank_id", "bank_id_code", "name"}
+)
+
+// Filter limits a list to the resources of which an attribute matches the values, using the operator.
+type Filter struct {
+	Field    string
+	Operator string
+	Values   []interface{}
+}
+
+// Order of a list on an attribute.
+type Order struct {
+	Field      string
+	Descending bool
+}
+
+// Position of a resource in a list ordered by (created_at, id), used for keyset pagination.
+type Position struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+	// Whether the resources before the position are selected instead of the ones after it.
+	Backward bool
+}
+
+// Load describes the data that's loaded together with resources.
+type Load struct {
+	// Attributes that are loaded, nil loads all attributes. Nested objects are only loaded when requested.
+	Fields []string
+	// Relationships that are loaded, e.g. `organisation` for payments.
+	Include []string
+}
+
+// Query selects a list of resources.
+type Query struct {
+	Load
+	Filters []Filter
+	// Order of the list. The `id` is always used last, so the order is stable.
+	Order []Order
+	// Limits the list to the resources after the position in the order of (created_at, id), see `Position`.
+	Seek *Position
+	// Maximum number of resources, 0 selects all of them.
+	Limit  int
+	Offset int
+}
+
+// PaymentRepository stores payments, together with the idempotency keys used to create them.
+type PaymentRepository interface {
+	// Find the payment with the id. Returns ErrNotFound when it doesn't exist.
+	Find(id uuid.UUID, load Load) (*model.Payment, error)
+	// List the payments selected by the query.
+	List(query Query) ([]*model.Payment, error)
+	// Count the payments selected by the filters of the query, ignoring its order and limits.
+	Count(query Query) (uint, error)
+	// Create the payment, setting its id when it doesn't have one yet.
+	Create(payment *model.Payment) error
+	// Create the payment and store the idempotency key atomically. The response of the key is set by respond once the
+	// payment has been created, when respond fails neither is stored. Returns ErrConflict when the key already exists.
+	CreateIdempotent(payment *model.Payment, key *model.IdempotencyKey, respond func() error) error
+	// Find the idempotency key of an organisation. Returns ErrNotFound when it doesn't exist.
+	FindIdempotencyKey(orgID uuid.UUID, key string) (*model.IdempotencyKey, error)
+	// Update the payment with the attributes of data that are set, and apply them to the payment as well.
+	Update(payment *model.Payment, data *model.Payment) error
+	// Store the status of the payment, as long as the stored status is still from. Returns ErrConflict otherwise.
+	UpdateStatus(payment *model.Payment, from model.PaymentStatus) error
+	// Delete the payment.
+	Delete(payment *model.Payment) error
+}
+
+// OrganisationRepository stores organisations.
+type OrganisationRepository interface {
+	// Find the organisation with the id. Returns ErrNotFound when it doesn't exist.
+	Find(id uuid.UUID) (*model.Organisation, error)
+	// List the organisations selected by the query.
+	List(query Query) ([]*model.Organisation, error)
+	// Count the organisations selected by the filters of the query, ignoring its order and limits.
+	Count(query Query) (uint, error)
+	// Create the organisation, setting its id when it doesn't have one yet.
+	Create(org *model.Organisation) error
+	// Update the organisation with the attributes of data that are set, and apply them to the organisation as well.
+	Update(org *model.Organisation, data *model.Organisation) error
+	// Delete the organisation.
+	Delete(org *model.Organisation) error
+}
+
+// APIKeyRepository stores the API keys of organisations.
+type APIKeyRepository interface {
+	// Find the API key with the id, revoked or not. Returns ErrNotFound when it doesn't exist.
+	Find(id uuid.UUID) (*model.APIKey, error)
+	// Find the API key with the hash, revoked or not. Returns ErrNotFound when it doesn't exist.
+	FindByHash(hash string) (*model.APIKey, error)
+	// List the API keys of an organisation, in the order they were created.
+	List(orgID uuid.UUID) ([]*model.APIKey, error)
+	// Create the API key, setting its id when it doesn't have one yet.
+	Create(key *model.APIKey) error
+	// Revoke the API key, so it can no longer be used. Revoking a key that's already revoked has no effect.
+	Revoke(key *model.APIKey) error
+}
+
+// AuditEventRepository stores the audit log of the changes to resources. Events can only be appended, never changed or
+// deleted.
+type AuditEventRepository interface {
+	// Append the event to the log, setting its id and creation time.
+	Append(event *model.AuditEvent) error
+	// List the events of the resource of the type with the id, in the order they were appended.
+	List(resourceType string, resourceID uuid.UUID) ([]*model.AuditEvent, error)
+}
+
+// OutboxRepository stores the domain events that are yet to be dispatched to downstream systems. Events are added in
+// the same transaction as the change they describe, so no change is ever stored without its event, and dispatched
+// afterwards.
+type OutboxRepository interface {
+	// Add the event to the outbox, setting its id and creation time.
+	Add(event *model.OutboxEvent) error
+	// List at most limit events that haven't been dispatched yet, in the order they were added. In a transaction, the
+	// events are locked until it ends, so concurrent dispatchers wait for each other instead of dispatching the same
+	// events.
+	Pending(limit int) ([]*model.OutboxEvent, error)
+	// Mark the event as dispatched, so it's no longer pending.
+	MarkDispatched(event *model.OutboxEvent) error
+	// Record a failed attempt to dispatch the event, which stays pending.
+	MarkFailed(event *model.OutboxEvent, reason string) error
+}
+
+// WebhookRepository stores the webhooks of organisations.
+type WebhookRepository interface {
+	// Find the webhook with the id. Returns ErrNotFound when it doesn't exist.
+	Find(id uuid.UUID) (*model.Webhook, error)
+	// List the webhooks of an organisation, in the order they were created.
+	List(orgID uuid.UUID) ([]*model.Webhook, error)
+	// Create the webhook, setting its id when it doesn't have one yet.
+	Create(webhook *model.Webhook) error
+	// Store the url, event types, secret, whether the webhook is enabled and its number of failures.
+	Update(webhook *model.Webhook) error
+	// Delete the webhook.
+	Delete(webhook *model.Webhook) error
+	// Reset the number of failures of the webhook after a successful delivery.
+	RecordSuccess(webhook *model.Webhook) error
+	// Count a failed delivery of the webhook, and disable it once it has failed at least disableAfter times in a row.
+	RecordFailure(webhook *model.Webhook, disableAfter int) error
+}
+
+// WebhookDeliveryRepository stores the deliveries of events to webhooks.
+type WebhookDeliveryRepository interface {
+	// Create the delivery, setting its id. Fails when the event already has a delivery to the webhook, see
+	// `ListByEvent`.
+	Create(delivery *model.WebhookDelivery) error
+	// List at most limit deliveries to the webhook, the most recent first.
+	List(webhookID uuid.UUID, limit int) ([]*model.WebhookDelivery, error)
+	// List the deliveries of the event to all webhooks.
+	ListByEvent(eventID uint) ([]*model.WebhookDelivery, error)
+	// List at most limit pending deliveries of which the next attempt is due at the time, the longest overdue first.
+	// In a transaction, the deliveries are locked until it ends, and deliveries locked by other transactions are
+	// skipped.
+	Due(at time.Time, limit int) ([]*model.WebhookDelivery, error)
+	// Store the status and attempts of the delivery.
+	Update(delivery *model.WebhookDelivery) error
+}
+
+// Repositories of all resources, sharing the same storage.
+type Repositories struct {
+	Payments      PaymentRepository
+	Organisations OrganisationRepository
+	APIKeys       APIKeyRepository
+	AuditEvents   AuditEventRepository
+	Outbox        OutboxRepository
+	Webhooks      WebhookRepository
+	Deliveries    WebhookDeliveryRepository
+
+	// Runs a function in a transaction of the storage, see `Transaction`.
+	transact func(fn func(tx Repositories) error) error
+	// Creates the repositories of a request, see `WithContext`.
+	scope func(ctx context.Context) Repositories
+}
+
+// WithContext returns repositories that log their queries with the logger of the context, which is the logger of the
+// request with its id for requests, see `logging.FromContext`, and trace them as children of the span of the context,
+// see `tracing.WithContext`.
+func (repos Repositories) WithContext(ctx context.Context) Repositories {
+	if repos.scope == nil {
+		return repos
+	}
+	return repos.scope(ctx)
+}
+
+// Transaction runs fn with repositories of which all changes are committed together when fn succeeds, or rolled back
+// when it fails. The error of fn is returned as is. Transactions started with the repositories of fn are part of the
+// same transaction.
+func (repos Repositories) Transaction(fn func(tx Repositories) error) error {
+	return repos.transact(fn)
+}
@@ -0,0 +1,860 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/Shodske/payment-api/pkg/logging"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Run the test against every implementation of the repositories, each with its own empty storage.
+func forEachImplementation(t *testing.T, test func(t *testing.T, repos Repositories)) {
+	t.Run("gorm", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "repository")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		db, err := gorm.Open("sqlite3", filepath.Join(dir, "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		err = db.AutoMigrate(
+			&model.Organisation{},
+			&model.Party{},
+			&model.Charge{},
+			&model.CurrencyAmount{},
+			&model.FX{},
+			&model.Payment{},
+			&model.IdempotencyKey{},
+			&model.APIKey{},
+			&model.AuditEvent{},
+			&model.OutboxEvent{},
+			&model.Webhook{},
+			&model.WebhookDelivery{},
+		).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test(t, NewGorm(db))
+	})
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemory())
+	})
+}
+
+// Store two organisations and three payments, created a minute apart in the order they are returned.
+func seed(t *testing.T, repos Repositories) ([]*model.Organisation, []*model.Payment) {
+	start := time.Date(2019, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) model.Model {
+		return model.Model{CreatedAt: start.Add(time.Duration(minutes) * time.Minute)}
+	}
+	amount := func(s string) *model.Money {
+		m := model.MustParseMoney(s)
+		return &m
+	}
+
+	orgs := []*model.Organisation{
+		{Model: at(0), Name: "Organisation B"},
+		{Model: at(1), Name: "Organisation A"},
+	}
+	for _, org := range orgs {
+		if err := repos.Organisations.Create(org); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	payments := []*model.Payment{
+		{
+			Model:            at(0),
+			OrganisationID:   orgs[0].ID,
+			Amount:           amount("13.37"),
+			Currency:         "GBP",
+			ProcessingDate:   "2019-01-18",
+			BeneficiaryParty: &model.Party{AccountNumber: "31926819", Name: "Wilfred Jeremiah Owens"},
+		},
+		{
+			Model:          at(1),
+			OrganisationID: orgs[0].ID,
+			Amount:         amount("5.00"),
+			Currency:       "GBP",
+			ProcessingDate: "2019-01-19",
+			FX:             &model.FX{ExchangeRate: "2.00000", OriginalAmount: amount("2.50"), OriginalCurrency: "EUR"},
+		},
+		{
+			Model:          at(2),
+			OrganisationID: orgs[1].ID,
+			Amount:         amount("100.00"),
+			Currency:       "USD",
+			ProcessingDate: "2019-01-20",
+		},
+	}
+	for _, payment := range payments {
+		if err := repos.Payments.Create(payment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return orgs, payments
+}
+
+// Get the IDs of the payments.
+func paymentIDs(payments []*model.Payment) []uuid.UUID {
+	ids := make([]uuid.UUID, len(payments))
+	for i, payment := range payments {
+		ids[i] = payment.ID
+	}
+	return ids
+}
+
+func TestPaymentRepository_Find(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, repos Repositories) {
+		orgs, payments := seed(t, repos)
+
+		got, err := repos.Payments.Find(payments[0].ID, Load{})
+		if err != nil {
+			t.Fatalf("PaymentRepository.Find() error = %v", err)
+		}
+		if got.Status != model.StatusPending || got.Amount.String() != "13.37" ||
+			!reflect.DeepEqual(got.BeneficiaryParty.Name, payments[0].BeneficiaryParty.Name) {
+			t.Errorf("PaymentRepository.Find() = %+v, want %+v", got, payments[0])
+		}
+		if got.Organisation.GetID() != "" {
+			t.Errorf("PaymentRepository.Find() organisation = %+v, want none", got.Organisation)
+		}
+
+		sparse, err := repos.Payments.Find(payments[0].ID, Load{Fields: []string{"amount"}, Include: []string{"organisation"}})
+		if err != nil {
+			t.Fatalf("PaymentRepository.Find() error = %v", err)
+		}
+		if sparse.BeneficiaryParty != nil {
+			t.Errorf("PaymentRepository.Find() beneficiary_party = %+v, want none", sparse.BeneficiaryParty)
+		}
+		if sparse.Organisation.Name != orgs[0].Name {
+			t.Errorf("PaymentRepository.Find() organisation = %v, want %v", sparse.Organisation.Name, orgs[0].Name)
+		}
+
+		if _, err := repos.Payments.Find(uuid.NewV4(), Load{}); err != ErrNotFound {
+			t.Errorf("PaymentRepository.Find() error = %v, want %v", err, ErrNotFound)
+		}
+
+		if err := repos.Payments.Delete(payments[1]); err != nil {
+			t.Fatalf("PaymentRepository.Delete() error = %v", err)
+		}
+		if _, err := repos.Payments.Find(payments[1].ID, Load{}); err != ErrNotFound {
+			t.Errorf("PaymentRepository.Find() error = %v, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+// Amounts keep all decimals of their currency, e.g. the 3 decimals of KWD, instead of being rounded to 2 decimals.
+func TestPaymentRepository_AmountDecimals(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, repos Repositories) {
+		orgs, _ := seed(t, repos)
+		amount := func(s string) *model.Money {
+			m := model.MustParseMoney(s)
+			return &m
+		}
+
+		payment := &model.Payment{
+			OrganisationID: orgs[0].ID,
+			Amount:         amount("1.234"),
+			Currency:       "KWD",
+			ProcessingDate: "2019-01-21",
+			ChargesInformation: &model.Charge{
+				ReceiverChargesAmount:   amount("0.005"),
+				ReceiverChargesCurrency: "KWD",
+				SenderCharges:           []*model.CurrencyAmount{{Amount: amount("0.015"), Currency: "KWD"}},
+			},
+			FX: &model.FX{ExchangeRate: "0.30000", OriginalAmount: amount("4.113"), OriginalCurrency: "BHD"},
+		}
+		if err := repos.Payments.Create(payment); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := repos.Payments.Find(payment.ID, Load{})
+		if err != nil {
+			t.Fatalf("PaymentRepository.Find() error = %v", err)
+		}
+		amounts := []string{got.Amount.String(), got.ChargesInformation.ReceiverChargesAmount.String(),
+			got.ChargesInformation.SenderCharges[0].Amount.String(), got.FX.OriginalAmount.String()}
+		if want := []string{"1.234", "0.005", "0.015", "4.113"}; !reflect.DeepEqual(amounts, want) {
+			t.Errorf("PaymentRepository.Find() amounts = %v, want %v", amounts, want)
+		}
+	})
+}
+
+func TestPaymentRepository_List(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, repos Repositories) {
+		orgs, payments := seed(t, repos)
+		p := payments
+		created := []Order{{Field: "created_at"}}
+
+		tests := []struct {
+			name  string
+			query Query
+			want  []*model.Payment
+		}{
+			{"all", Query{}, sortedByID(p[0], p[1], p[2])},
+			{"created", Query{Order: created}, []*model.Payment{p[0], p[1], p[2]}},
+			{"currency", Query{Filters: []Filter{{"currency", OperatorEq, []interface{}{"GBP"}}}, Order: created}, []*model.Payment{p[0], p[1]}},
+			{"currency-any", Query{Filters: []Filter{{"currency", OperatorEq, []interface{}{"USD", "EUR"}}}, Order: created}, []*model.Payment{p[2]}},
+			{"organisation", Query{Filters: []Filter{{"organisation", OperatorEq, []interface{}{orgs[1].ID}}}, Order: created}, []*model.Payment{p[2]}},
+			{"amount-gte", Query{Filters: []Filter{{"amount", OperatorGte, []interface{}{model.MustParseMoney("13.37")}}}, Order: created}, []*model.Payment{p[0], p[2]}},
+			{"date-lte", Query{Filters: []Filter{{"processing_date", OperatorLte, []interface{}{"2019-01-19"}}}, Order: created}, []*model.Payment{p[0], p[1]}},
+			{"party", Query{Filters: []Filter{{"beneficiary_party.name", OperatorEq, []interface{}{"Wilfred Jeremiah Owens"}}}, Order: created}, []*model.Payment{p[0]}},
+			{"other-party", Query{Filters: []Filter{{"debtor_party.name", OperatorEq, []interface{}{"Wilfred Jeremiah Owens"}}}}, []*model.Payment{}},
+			{"order", Query{Order: []Order{{Field: "amount", Descending: true}}}, []*model.Payment{p[2], p[0], p[1]}},
+			{
+				"order-equal",
+				Query{Filters: []Filter{{"currency", OperatorEq, []interface{}{"GBP"}}}, Order: []Order{{Field: "currency"}}},
+				sortedByID(p[0], p[1]),
+			},
+			{"limit", Query{Order: created, Limit: 2}, []*model.Payment{p[0], p[1]}},
+			{"offset", Query{Order: created, Limit: 2, Offset: 2}, []*model.Payment{p[2]}},
+			{
+				"seek",
+				Query{Order: created, Seek: &Position{CreatedAt: p[0].CreatedAt, ID: p[0].ID}},
+				[]*model.Payment{p[1], p[2]},
+			},
+			{
+				"seek-backward",
+				Query{
+					Order: []Order{{Field: "created_at", Descending: true}},
+					Seek:  &Position{CreatedAt: p[2].CreatedAt, ID: p[2].ID, Backward: true},
+				},
+				[]*model.Payment{p[1], p[0]},
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				got, err := repos.Payments.List(tt.query)
+				if err != nil {
+					t.Fatalf("PaymentRepository.List() error = %v", err)
+				}
+				if !reflect.DeepEqual(paymentIDs(got), paymentIDs(tt.want)) {
+					t.Errorf("PaymentRepository.List() = %v, want %v", paymentIDs(got), paymentIDs(tt.want))
+				}
+			})
+		}
+
+		count, err := repos.Payments.Count(Query{Filters: []Filter{{"currency", OperatorEq, []interface{}{"GBP"}}}, Limit: 1})
+		if err != nil || count != 2 {
+			t.Errorf("PaymentRepository.Count() = %v, %v, want %v", count, err, 2)
+		}
+
+		// Only the requested nested objects are loaded.
+		got, err := repos.Payments.List(Query{Load: Load{Fields: []string{"fx"}}, Order: created})
+		if err != nil {
+			t.Fatalf("PaymentRepository.List() error = %v", err)
+		}
+		if got[0].BeneficiaryParty != nil || got[1].FX == nil || got[1].FX.OriginalCurrency != "EUR" {
+			t.Errorf("PaymentRepository.List() = %+v, want only the fx", got)
+		}
+
+		if _, err := repos.Payments.List(Query{Order: []Order{{Field: "unknown"}}}); err == nil {
+			t.Errorf("PaymentRepository.List() error = %v, wantErr %v", err, true)
+		}
+	})
+}
+
+// Sort payments by their ID, the order of payments that are equal in all attributes they are ordered on.
+func sortedByID(payments ...*model.Payment) []*model.Payment {
+	sorted := append([]*model.Payment{}, payments...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return compareValues(sorted[i].ID, sorted[j].ID) < 0
+	})
+	return sorted
+}
+
+func TestPaymentRepository_Update(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, repos Repositories) {
+		_, payments := seed(t, repos)
+
+		payment, _ := repos.Payments.Find(payments[0].ID, Load{})
+		if err := repos.Payments.Update(payment, &model.Payment{Reference: "Updated"}); err != nil {
+			t.Fatalf("PaymentRepository.Update() error = %v", err)
+		}
+		if payment.Reference != "Updated" || payment.Currency != "GBP" {
+			t.Errorf("PaymentRepository.Update() = %+v, want the updated reference", payment)
+		}
+
+		got, _ := repos.Payments.Find(payments[0].ID, Load{})
+		if got.Reference != "Updated" || got.Currency != "GBP" {
+			t.Errorf("PaymentRepository.Update() stored = %+v, want the updated reference", got)
+		}
+	})
+}
+
+func TestPaymentRepository_UpdateStatus(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, repos Repositories) {
+		_, payments := seed(t, repos)
+
+		payment, _ := repos.Payments.Find(payments[0].ID, Load{})
+		payment.Status = model.StatusSubmitted
+		if err := repos.Payments.UpdateStatus(payment, model.StatusPending); err != nil {
+			t.Fatalf("PaymentRepository.UpdateStatus() error = %v", err)
+		}
+
+		// The status has changed in the meantime, so the transition must not be stored.
+		payment.Status = model.StatusCancelled
+		if err := repos.Payments.UpdateStatus(payment, model.StatusPending); err != ErrConflict {
+			t.Errorf("PaymentRepository.UpdateStatus() error = %v, want %v", err, ErrConflict)
+		}
+
+		got, _ := repos.Payments.Find(payments[0].ID, Load{})
+		if got.Status != model.StatusSubmitted {
+			t.Errorf("PaymentRepository.UpdateStatus() status = %v, want %v", got.Status, model.StatusSubmitted)
+		}
+	})
+}
+
+func TestPaymentRepository_CreateIdempotent(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, repos Repositories) {
+		orgs, _ := seed(t, repos)
+		newPayment := func() *model.Payment {
+			return &model.Payment{OrganisationID: orgs[0].ID, Currency: "GBP"}
+		}
+
+		payment := newPayment()
+		key := &model.IdempotencyKey{OrganisationID: orgs[0].ID, Key: "key-a"}
+		err := repos.Payments.CreateIdempotent(payment, key, func() error {
+			key.ResponseCode = 201
+			key.Response = payment.GetID()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("PaymentRepository.CreateIdempotent() error = %v", err)
+		}
+
+		stored, err := repos.Payments.FindIdempotencyKey(orgs[0].ID, "key-a")
+		if err != nil || stored.ResponseCode != 201 || stored.Response != payment.GetID() {
+			t.Errorf("PaymentRepository.FindIdempotencyKey() = %+v, %v, want the response", stored, err)
+		}
+		if _, err := repos.Payments.Find(payment.ID, Load{}); err != nil {
+			t.Errorf("PaymentRepository.Find() error = %v", err)
+		}
+
+		key = &model.IdempotencyKey{OrganisationID: orgs[0].ID, Key: "key-a"}
+		err = repos.Payments.CreateIdempotent(newPayment(), key, func() error { return nil })
+		if err != ErrConflict {
+			t.Errorf("PaymentRepository.CreateIdempotent() error = %v, want %v", err, ErrConflict)
+		}
+
+		// Neither the payment nor the key is stored when responding fails.
+		failing := newPayment()
+		key = &model.IdempotencyKey{OrganisationID: orgs[0].ID, Key: "key-b"}
+		err = repos.Payments.CreateIdempotent(failing, key, func() error { return errors.New("failed") })
+		if err == nil {
+			t.Errorf("PaymentRepository.CreateIdempotent() error = %v, wantErr %v", err, true)
+		}
+		if _, err := repos.Payments.FindIdempotencyKey(orgs[0].ID, "key-b"); err != ErrNotFound {
+			t.Errorf("PaymentRepository.FindIdempotencyKey() error = %v, want %v", err, ErrNotFound)
+		}
+		if _, err := repos.Payments.Find(failing.ID, Load{}); err != ErrNotFound {
+			t.Errorf("PaymentRepository.Find() error = %v, want %v", err, ErrNotFound)
+		}
+	})
+
+	// Only a duplicate key is a conflict, any other error of the database is returned as is.
+	t.Run("failing", func(t *testing.T) {
+		db, err := gorm.Open("sqlite3", ":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if err := db.AutoMigrate(&model.Organisation{}, &model.Payment{}).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		key := &model.IdempotencyKey{OrganisationID: uuid.NewV4(), Key: "key-a"}
+		err = NewGorm(db).Payments.CreateIdempotent(&model.Payment{}, key, func() error { return nil })
+		if err == nil || err == ErrConflict {
+			t.Errorf("PaymentRepository.CreateIdempotent() error = %v, want the error of the missing table", err)
+		}
+	})
+}
+
+func TestOrganisationRepository(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, repos Repositories) {
+		orgs, _ := seed(t, repos)
+
+		got, err := repos.Organisations.List(Query{Order: []Order{{Field: "name"}}})
+		if err != nil || len(got) != 2 || got[0].ID != orgs[1].ID {
+			t.Errorf("OrganisationRepository.List() = %v, %v, want sorted on name", got, err)
+		}
+
+		org, err := repos.Organisations.Find(orgs[0].ID)
+		if err != nil {
+			t.Fatalf("OrganisationRepository.Find() error = %v", err)
+		}
+		if err := repos.Organisations.Update(org, &model.Organisation{Name: "Renamed"}); err != nil {
+			t.Fatalf("OrganisationRepository.Update() error = %v", err)
+		}
+		if org, _ = repos.Organisations.Find(orgs[0].ID); org.Name != "Renamed" {
+			t.Errorf("OrganisationRepository.Update() name = %v, want %v", org.Name, "Renamed")
+		}
+
+		if err := repos.Organisations.Delete(org); err != nil {
+			t.Fatalf("OrganisationRepository.Delete() error = %v", err)
+		}
+		if _, err := repos.Organisations.Find(orgs[0].ID); err != ErrNotFound {
+			t.Errorf("OrganisationRepository.Find() error = %v, want %v", err, ErrNotFound)
+		}
+		if count, err := repos.Organisations.Count(Query{}); err != nil || count != 1 {
+			t.Errorf("OrganisationRepository.Count() = %v, %v, want %v", count, err, 1)
+		}
+	})
+}
+
+func TestMemory_Copies(t *testing.T) {
+	repos := NewMemory()
+	_, payments := seed(t, repos)
+
+	// Changing a payment that was stored or returned must not change the stored payment.
+	payments[0].BeneficiaryParty.Name = "Changed"
+	got, _ := repos.Payments.Find(payments[0].ID, Load{})
+	got.Currency = "EUR"
+
+	got, _ = repos.Payments.Find(payments[0].ID, Load{})
+	if got.Currency != "GBP" || got.BeneficiaryParty.Name != "Wilfred Jeremiah Owens" {
+		t.Errorf("PaymentRepository.Find() = %+v, want the stored payment", got)
+	}
+}
+
+func TestMemory_Concurrent(t *testing.T) {
+	repos := NewMemory()
+	orgs, _ := seed(t, repos)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			repos.Payments.Create(&model.Payment{OrganisationID: orgs[0].ID, Currency: "GBP"})
+			repos.Payments.List(Query{})
+		}()
+	}
+	wg.Wait()
+
+	if count, err := repos.Payments.Count(Query{}); err != nil || count != 53 {
+		t.Errorf("PaymentRepository.Count() = %v, %v, want %v", count, err, 53)
+	}
+}
+
+func TestAPIKeyRepository(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, repos Repositories) {
+		orgs, _ := seed(t, repos)
+
+		keys := make([]*model.APIKey, 3)
+		for i, orgID := range []uuid.UUID{orgs[0].ID, orgs[0].ID, orgs[1].ID} {
+			key, err := model.NewAPIKey(orgID, "key", model.RoleViewer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key.CreatedAt = time.Date(2019, 1, 1, 12, i, 0, 0, time.UTC)
+			if err := repos.APIKeys.Create(key); err != nil {
+				t.Fatalf("APIKeyRepository.Create() error = %v", err)
+			}
+			keys[i] = key
+		}
+
+		found, err := repos.APIKeys.FindByHash(model.HashAPIKey(keys[1].Key))
+		if err != nil || found.ID != keys[1].ID || found.OrganisationID != orgs[0].ID {
+			t.Errorf("APIKeyRepository.FindByHash() = %+v, %v, want %v", found, err, keys[1].ID)
+		}
+		if found.Key != "" {
+			t.Errorf("APIKeyRepository.FindByHash() key = %v, want it not to be stored", found.Key)
+		}
+		if _, err := repos.APIKeys.FindByHash(model.HashAPIKey("pk_unknown")); err != ErrNotFound {
+			t.Errorf("APIKeyRepository.FindByHash() error = %v, want %v", err, ErrNotFound)
+		}
+
+		list, err := repos.APIKeys.List(orgs[0].ID)
+		if err != nil || len(list) != 2 || list[0].ID != keys[0].ID || list[1].ID != keys[1].ID {
+			t.Errorf("APIKeyRepository.List() = %v, %v, want the keys of the organisation", list, err)
+		}
+
+		key, err := repos.APIKeys.Find(keys[0].ID)
+		if err != nil {
+			t.Fatalf("APIKeyRepository.Find() error = %v", err)
+		}
+		if err := repos.APIKeys.Revoke(key); err != nil || !key.Revoked() {
+			t.Fatalf("APIKeyRepository.Revoke() = %+v, %v, want a revoked key", key, err)
+		}
+		revokedAt := *key.RevokedAt
+		if err := repos.APIKeys.Revoke(key); err != nil || !key.RevokedAt.Equal(revokedAt) {
+			t.Errorf("APIKeyRepository.Revoke() revoked_at = %v, %v, want %v", key.RevokedAt, err, revokedAt)
+		}
+		if found, _ := repos.APIKeys.Find(keys[0].ID); !found.Revoked() {
+			t.Errorf("APIKeyRepository.Revoke() stored = %+v, want a revoked key", found)
+		}
+
+		if _, err := repos.APIKeys.Find(uuid.NewV4()); err != ErrNotFound {
+			t.Errorf("APIKeyRepository.Find() error = %v, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+func TestAuditEventRepository(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, repos Repositories) {
+		orgs, payments := seed(t, repos)
+
+		events := []*model.AuditEvent{
+			{ResourceType: "payments", ResourceID: payments[0].ID, Operation: model.AuditCreate},
+			{ResourceType: "organisations", ResourceID: payments[0].ID, Operation: model.AuditCreate},
+			{ResourceType: "payments", ResourceID: payments[1].ID, Operation: model.AuditCreate},
+			{ResourceType: "payments", ResourceID: payments[0].ID, Operation: model.AuditUpdate, Actor: "api-key:1",
+				RequestID: "request", Changes: model.AuditChanges{
+					"currency": {Before: []byte(`"GBP"`), After: []byte(`"EUR"`)},
+				}},
+		}
+		for _, event := range events {
+			event.OrganisationID = orgs[0].ID
+			if err := repos.AuditEvents.Append(event); err != nil {
+				t.Fatalf("AuditEventRepository.Append() error = %v", err)
+			}
+			if event.ID == 0 || event.CreatedAt.IsZero() {
+				t.Errorf("AuditEventRepository.Append() = %+v, want an id and creation time", event)
+			}
+		}
+
+		got, err := repos.AuditEvents.List("payments", payments[0].ID)
+		if err != nil || len(got) != 2 || got[0].ID != events[0].ID || got[1].ID != events[3].ID {
+			t.Fatalf("AuditEventRepository.List() = %v, %v, want the events of the payment in order", got, err)
+		}
+		want := events[3]
+		if got[1].Actor != want.Actor || got[1].RequestID != want.RequestID || !reflect.DeepEqual(got[1].Changes, want.Changes) {
+			t.Errorf("AuditEventRepository.List() = %+v, want %+v", got[1], want)
+		}
+
+		if got, err := repos.AuditEvents.List("payments", payments[2].ID); err != nil || len(got) != 0 {
+			t.Errorf("AuditEventRepository.List() = %v, %v, want no events", got, err)
+		}
+	})
+}
+
+func TestOutboxRepository(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, repos Repositories) {
+		orgs, payments := seed(t, repos)
+
+		events := make([]*model.OutboxEvent, 3)
+		for i := range events {
+			events[i] = &model.OutboxEvent{
+				Type:           model.EventPaymentCreated,
+				OrganisationID: orgs[0].ID,
+				ResourceType:   "payments",
+				ResourceID:     payments[i].ID,
+				Data:           model.EventData(`{"currency":"GBP"}`),
+			}
+			if err := repos.Outbox.Add(events[i]); err != nil {
+				t.Fatalf("OutboxRepository.Add() error = %v", err)
+			}
+			if events[i].ID == 0 || events[i].CreatedAt.IsZero() {
+				t.Errorf("OutboxRepository.Add() = %+v, want an id and creation time", events[i])
+			}
+		}
+
+		got, err := repos.Outbox.Pending(2)
+		if err != nil || len(got) != 2 || got[0].ID != events[0].ID || got[1].ID != events[1].ID {
+			t.Fatalf("OutboxRepository.Pending() = %v, %v, want the first 2 events in order", got, err)
+		}
+		if string(got[0].Data) != `{"currency":"GBP"}` || got[0].Changes != nil || !uuid.Equal(got[0].ResourceID, payments[0].ID) {
+			t.Errorf("OutboxRepository.Pending() = %+v, want %+v", got[0], events[0])
+		}
+
+		if err := repos.Outbox.MarkDispatched(got[0]); err != nil || got[0].DispatchedAt == nil {
+			t.Errorf("OutboxRepository.MarkDispatched() = %v, %v, want the dispatch time", got[0].DispatchedAt, err)
+		}
+		for i := 1; i <= 2; i++ {
+			if err := repos.Outbox.MarkFailed(got[1], "unavailable"); err != nil || got[1].Attempts != i {
+				t.Errorf("OutboxRepository.MarkFailed() = %v, %v, want %v attempts", got[1].Attempts, err, i)
+			}
+		}
+
+		got, err = repos.Outbox.Pending(10)
+		if err != nil || len(got) != 2 || got[0].ID != events[1].ID || got[1].ID != events[2].ID {
+			t.Fatalf("OutboxRepository.Pending() = %v, %v, want the events that haven't been dispatched", got, err)
+		}
+		if got[0].Attempts != 2 || got[0].LastError != "unavailable" {
+			t.Errorf("OutboxRepository.Pending() = %+v, want the failed attempts", got[0])
+		}
+	})
+}
+
+func TestWebhookRepository(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, repos Repositories) {
+		orgs, _ := seed(t, repos)
+
+		webhooks := make([]*model.Webhook, 3)
+		for i, orgID := range []uuid.UUID{orgs[0].ID, orgs[0].ID, orgs[1].ID} {
+			webhooks[i] = &model.Webhook{
+				Model:          model.Model{CreatedAt: time.Date(2019, 1, 1, 12, i, 0, 0, time.UTC)},
+				OrganisationID: orgID,
+				URL:            "https://example.com/webhooks",
+				EventTypes:     model.EventTypes{model.EventPaymentCreated, model.EventPaymentDeleted},
+				Secret:         "secret",
+				Enabled:        true,
+			}
+			if err := repos.Webhooks.Create(webhooks[i]); err != nil {
+				t.Fatalf("WebhookRepository.Create() error = %v", err)
+			}
+		}
+
+		list, err := repos.Webhooks.List(orgs[0].ID)
+		if err != nil || len(list) != 2 || list[0].ID != webhooks[0].ID || list[1].ID != webhooks[1].ID {
+			t.Fatalf("WebhookRepository.List() = %v, %v, want the webhooks of the organisation", list, err)
+		}
+		if !reflect.DeepEqual(list[0].EventTypes, webhooks[0].EventTypes) || list[0].Secret != "secret" {
+			t.Errorf("WebhookRepository.List() = %+v, want %+v", list[0], webhooks[0])
+		}
+
+		// False and empty attributes are updated as well.
+		webhook := list[0]
+		webhook.URL = "https://example.com/changed"
+		webhook.EventTypes = model.EventTypes{model.EventPaymentUpdated}
+		webhook.Enabled = false
+		if err := repos.Webhooks.Update(webhook); err != nil {
+			t.Fatalf("WebhookRepository.Update() error = %v", err)
+		}
+		found, err := repos.Webhooks.Find(webhook.ID)
+		if err != nil || found.URL != webhook.URL || found.Enabled || !reflect.DeepEqual(found.EventTypes, webhook.EventTypes) {
+			t.Errorf("WebhookRepository.Find() = %+v, %v, want %+v", found, err, webhook)
+		}
+
+		// Webhooks are disabled once they failed too often in a row, failures are reset by a success.
+		webhook = webhooks[1]
+		if err := repos.Webhooks.RecordFailure(webhook, 3); err != nil || webhook.Failures != 1 {
+			t.Errorf("WebhookRepository.RecordFailure() = %v failures, %v, want 1", webhook.Failures, err)
+		}
+		if err := repos.Webhooks.RecordSuccess(webhook); err != nil || webhook.Failures != 0 {
+			t.Errorf("WebhookRepository.RecordSuccess() = %v failures, %v, want 0", webhook.Failures, err)
+		}
+		for i := 1; i <= 3; i++ {
+			if err := repos.Webhooks.RecordFailure(webhook, 3); err != nil || webhook.Failures != i || webhook.Enabled != (i < 3) {
+				t.Errorf("WebhookRepository.RecordFailure() = %v failures, enabled %v, %v", webhook.Failures, webhook.Enabled, err)
+			}
+		}
+		found, err = repos.Webhooks.Find(webhook.ID)
+		if err != nil || found.Failures != 3 || found.Enabled {
+			t.Errorf("WebhookRepository.Find() = %+v, %v, want a disabled webhook", found, err)
+		}
+
+		if err := repos.Webhooks.Delete(webhooks[2]); err != nil {
+			t.Fatalf("WebhookRepository.Delete() error = %v", err)
+		}
+		if _, err := repos.Webhooks.Find(webhooks[2].ID); err != ErrNotFound {
+			t.Errorf("WebhookRepository.Find() error = %v, want %v", err, ErrNotFound)
+		}
+	})
+}
+
+func TestWebhookDeliveryRepository(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, repos Repositories) {
+		now := time.Now()
+		at := func(minutes int) *time.Time {
+			t := now.Add(time.Duration(minutes) * time.Minute)
+			return &t
+		}
+		webhookIDs := []uuid.UUID{uuid.NewV4(), uuid.NewV4()}
+
+		deliveries := []*model.WebhookDelivery{
+			{WebhookID: webhookIDs[0], EventID: 1, NextAttemptAt: at(-1)},
+			{WebhookID: webhookIDs[1], EventID: 1, NextAttemptAt: at(-2)},
+			{WebhookID: webhookIDs[0], EventID: 2, NextAttemptAt: at(1)},
+			{WebhookID: webhookIDs[0], EventID: 3, NextAttemptAt: at(-3)},
+		}
+		for _, delivery := range deliveries {
+			delivery.EventType = model.EventPaymentCreated
+			delivery.Payload = `{"id":1}`
+			delivery.Status = model.DeliveryPending
+			if err := repos.Deliveries.Create(delivery); err != nil {
+				t.Fatalf("WebhookDeliveryRepository.Create() error = %v", err)
+			}
+			if delivery.ID == 0 {
+				t.Errorf("WebhookDeliveryRepository.Create() = %+v, want an id", delivery)
+			}
+		}
+		if err := repos.Deliveries.Create(&model.WebhookDelivery{WebhookID: webhookIDs[0], EventID: 1}); err == nil {
+			t.Errorf("WebhookDeliveryRepository.Create() error = %v, want an error for a second delivery", err)
+		}
+
+		list, err := repos.Deliveries.List(webhookIDs[0], 2)
+		if err != nil || len(list) != 2 || list[0].ID != deliveries[3].ID || list[1].ID != deliveries[2].ID {
+			t.Errorf("WebhookDeliveryRepository.List() = %v, %v, want the latest deliveries of the webhook", list, err)
+		}
+		list, err = repos.Deliveries.ListByEvent(1)
+		if err != nil || len(list) != 2 || list[0].ID != deliveries[0].ID || list[1].ID != deliveries[1].ID {
+			t.Errorf("WebhookDeliveryRepository.ListByEvent() = %v, %v, want the deliveries of the event", list, err)
+		}
+
+		due, err := repos.Deliveries.Due(now, 2)
+		if err != nil || len(due) != 2 || due[0].ID != deliveries[3].ID || due[1].ID != deliveries[1].ID {
+			t.Fatalf("WebhookDeliveryRepository.Due() = %v, %v, want the most overdue deliveries", due, err)
+		}
+		if due[0].Payload != `{"id":1}` || due[0].EventType != model.EventPaymentCreated {
+			t.Errorf("WebhookDeliveryRepository.Due() = %+v, want %+v", due[0], deliveries[3])
+		}
+
+		due[0].Status = model.DeliverySucceeded
+		due[0].Attempts = 1
+		due[0].NextAttemptAt = nil
+		due[0].LastAttemptAt = at(0)
+		due[0].ResponseCode = 204
+		if err := repos.Deliveries.Update(due[0]); err != nil {
+			t.Fatalf("WebhookDeliveryRepository.Update() error = %v", err)
+		}
+		due[1].Attempts = 1
+		due[1].NextAttemptAt = at(5)
+		due[1].LastError = "connection refused"
+		if err := repos.Deliveries.Update(due[1]); err != nil {
+			t.Fatalf("WebhookDeliveryRepository.Update() error = %v", err)
+		}
+
+		due, err = repos.Deliveries.Due(now, 10)
+		if err != nil || len(due) != 1 || due[0].ID != deliveries[0].ID {
+			t.Errorf("WebhookDeliveryRepository.Due() = %v, %v, want the deliveries that are still due", due, err)
+		}
+		list, _ = repos.Deliveries.List(webhookIDs[0], 10)
+		if got := list[0]; got.Status != model.DeliverySucceeded || got.Attempts != 1 || got.NextAttemptAt != nil ||
+			got.LastAttemptAt == nil || got.ResponseCode != 204 || got.Payload != `{"id":1}` {
+			t.Errorf("WebhookDeliveryRepository.List() = %+v, want the outcome of the attempt", got)
+		}
+	})
+}
+
+func TestRepositories_Transaction(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, repos Repositories) {
+		orgs, payments := seed(t, repos)
+		failed := errors.New("failed")
+
+		// Changes of a failed transaction are all rolled back, including those of nested transactions.
+		created := &model.Payment{OrganisationID: orgs[0].ID, Currency: "GBP"}
+		err := repos.Transaction(func(tx Repositories) error {
+			if err := tx.Payments.Create(created); err != nil {
+				return err
+			}
+			err := tx.Transaction(func(tx Repositories) error {
+				if err := tx.AuditEvents.Append(&model.AuditEvent{ResourceType: "payments", ResourceID: created.ID}); err != nil {
+					return err
+				}
+				return tx.Outbox.Add(&model.OutboxEvent{Type: model.EventPaymentCreated, ResourceID: created.ID})
+			})
+			if err != nil {
+				return err
+			}
+			if err := tx.Organisations.Update(orgs[0], &model.Organisation{Name: "Renamed"}); err != nil {
+				return err
+			}
+			if err := tx.Payments.Delete(payments[0]); err != nil {
+				return err
+			}
+			return failed
+		})
+		if err != failed {
+			t.Errorf("Repositories.Transaction() error = %v, want %v", err, failed)
+		}
+		if _, err := repos.Payments.Find(created.ID, Load{}); err != ErrNotFound {
+			t.Errorf("PaymentRepository.Find() error = %v, want %v", err, ErrNotFound)
+		}
+		if events, _ := repos.AuditEvents.List("payments", created.ID); len(events) != 0 {
+			t.Errorf("AuditEventRepository.List() = %v, want no events", events)
+		}
+		if events, _ := repos.Outbox.Pending(10); len(events) != 0 {
+			t.Errorf("OutboxRepository.Pending() = %v, want no events", events)
+		}
+		if org, _ := repos.Organisations.Find(orgs[0].ID); org.Name != "Organisation B" {
+			t.Errorf("OrganisationRepository.Find() name = %v, want %v", org.Name, "Organisation B")
+		}
+		if _, err := repos.Payments.Find(payments[0].ID, Load{}); err != nil {
+			t.Errorf("PaymentRepository.Find() error = %v, want the payment", err)
+		}
+
+		// Changes of a successful transaction are all committed.
+		err = repos.Transaction(func(tx Repositories) error {
+			if err := tx.Payments.Create(created); err != nil {
+				return err
+			}
+			return tx.AuditEvents.Append(&model.AuditEvent{ResourceType: "payments", ResourceID: created.ID})
+		})
+		if err != nil {
+			t.Fatalf("Repositories.Transaction() error = %v", err)
+		}
+		if _, err := repos.Payments.Find(created.ID, Load{}); err != nil {
+			t.Errorf("PaymentRepository.Find() error = %v, want the payment", err)
+		}
+		if events, _ := repos.AuditEvents.List("payments", created.ID); len(events) != 1 {
+			t.Errorf("AuditEventRepository.List() = %v, want the event", events)
+		}
+	})
+}
+
+func TestRepositories_WithContext(t *testing.T) {
+	forEachImplementation(t, func(t *testing.T, repos Repositories) {
+		orgs, _ := seed(t, repos)
+
+		// The repositories of a request use the same storage.
+		scoped := repos.WithContext(context.Background())
+		if _, err := scoped.Organisations.Find(orgs[0].ID); err != nil {
+			t.Errorf("OrganisationRepository.Find() error = %v, want the organisation", err)
+		}
+		created := &model.Organisation{Name: "Organisation C"}
+		err := scoped.Transaction(func(tx Repositories) error {
+			return tx.Organisations.Create(created)
+		})
+		if err != nil {
+			t.Fatalf("Repositories.Transaction() error = %v", err)
+		}
+		if _, err := repos.Organisations.Find(created.ID); err != nil {
+			t.Errorf("OrganisationRepository.Find() error = %v, want the organisation", err)
+		}
+	})
+
+	t.Run("logged", func(t *testing.T) {
+		db, err := gorm.Open("sqlite3", ":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		if err := db.AutoMigrate(&model.Organisation{}).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		buf := &bytes.Buffer{}
+		logger := logrus.New()
+		logger.SetOutput(buf)
+		logger.SetLevel(logrus.DebugLevel)
+		ctx := logging.NewContext(context.Background(), logger.WithField("request_id", "req-123"))
+
+		repos := NewGorm(db.LogMode(true)).WithContext(ctx)
+		if err := repos.Organisations.Create(&model.Organisation{Name: "Organisation A"}); err != nil {
+			t.Fatalf("OrganisationRepository.Create() error = %v", err)
+		}
+		if line := buf.String(); !strings.Contains(line, "request_id=req-123") || !strings.Contains(line, "INSERT") {
+			t.Errorf("Repositories.WithContext() logged %v, want the query with the id of the request", line)
+		}
+
+		// The repositories of the zero value can't be scoped, but are still returned.
+		if got := (Repositories{}).WithContext(ctx); got.Payments != nil {
+			t.Errorf("Repositories.WithContext() = %v, want the zero value", got)
+		}
+	})
+}
@@ -0,0 +1,16 @@
+package source
+
+import (
+	"github.com/manyminds/api2go"
+)
+
+// Action is a custom operation on a single resource, for operations that don't fit any of the CRUD interfaces of
+// api2go.
+type Action func(id string, req api2go.Request) (api2go.Responder, error)
+
+// ActionSource interface can be implemented by sources that provide custom actions. Every returned Action will enable
+// the URI:
+// POST /<resource>/:id/<action>
+type ActionSource interface {
+	Actions() map[string]Action
+}
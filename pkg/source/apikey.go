@@ -0,0 +1,118 @@
+package source
+
+import (
+	"errors"
+	"github.com/Shodske/payment-api/pkg/auth"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/Shodske/payment-api/pkg/validation"
+	"github.com/manyminds/api2go"
+	"github.com/satori/go.uuid"
+	"net/http"
+)
+
+// APIKeySource manages the API keys of organisations, which are nested under their organisation:
+// GET /organisations/:id/api-keys
+// POST /organisations/:id/api-keys
+// DELETE /organisations/:id/api-keys/:keyID
+//
+// Callers can only manage the keys of their own organisation, other organisations are reported as not found. Managing
+// keys requires the admin role.
+type APIKeySource struct {
+	repos repository.Repositories
+}
+
+// NewAPIKeySource creates an APIKeySource using the given repositories, which are shared by all requests.
+func NewAPIKeySource(repos repository.Repositories) *APIKeySource {
+	return &APIKeySource{repos: repos}
+}
+
+// FindAll lists the API keys of the organisation, including the ones that are revoked.
+func (src *APIKeySource) FindAll(orgID string, req api2go.Request) (api2go.Responder, error) {
+	if _, err := authorize(req, "api-keys", auth.OperationRead); err != nil {
+		return nil, err
+	}
+
+	org, err := callerOrganisation(orgID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := scoped(src.repos, req).APIKeys.List(org.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &api2go.Response{Res: keys, Code: http.StatusOK}, nil
+}
+
+// Create a new API key for the organisation. The key itself is only part of this response, it can't be retrieved
+// afterwards.
+func (src *APIKeySource) Create(orgID string, obj interface{}, req api2go.Request) (api2go.Responder, error) {
+	if _, err := authorize(req, "api-keys", auth.OperationCreate); err != nil {
+		return nil, err
+	}
+
+	org, err := callerOrganisation(orgID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := obj.(*model.APIKey)
+	if !ok {
+		return nil, NewHTTPError(errors.New("invalid type"), "invalid type", http.StatusConflict)
+	}
+
+	v := validation.New()
+	data.Validate(v)
+	if errs := v.Errors(); errs != nil {
+		return nil, newValidationError(errs, "api-keys")
+	}
+
+	// Only the name and role are taken from the request, everything else is generated. Keys only get more than read
+	// access when a role is asked for explicitly.
+	role := data.Role
+	if role == "" {
+		role = model.RoleViewer
+	}
+	key, err := model.NewAPIKey(org.ID, data.Name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := scoped(src.repos, req).APIKeys.Create(key); err != nil {
+		return nil, err
+	}
+
+	return &api2go.Response{Res: key, Code: http.StatusCreated}, nil
+}
+
+// Revoke the API key of the organisation, after which it can no longer be used.
+func (src *APIKeySource) Revoke(orgID, id string, req api2go.Request) (api2go.Responder, error) {
+	if _, err := authorize(req, "api-keys", auth.OperationDelete); err != nil {
+		return nil, err
+	}
+
+	org, err := callerOrganisation(orgID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, NewHTTPError(err, "invalid id", http.StatusBadRequest)
+	}
+
+	key, err := scoped(src.repos, req).APIKeys.Find(keyID)
+	if err == nil && !uuid.Equal(key.OrganisationID, org.ID) {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, newNotFoundError(req, err, "api-keys")
+	}
+
+	if err := scoped(src.repos, req).APIKeys.Revoke(key); err != nil {
+		return nil, err
+	}
+
+	return &api2go.Response{Code: http.StatusNoContent}, nil
+}
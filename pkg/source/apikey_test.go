@@ -0,0 +1,119 @@
+package source
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+	"net/http"
+	"testing"
+)
+
+func TestAPIKeySource(t *testing.T) {
+	orgs := GetOrganisationFixtures(false)
+	req := NewMockedRequest()
+	*req = WithMockedCaller(*req, orgs[0])
+	db := NewMockedDatabase(*req)
+	defer db.Unscoped().Delete(&model.APIKey{})
+	src := NewAPIKeySource(NewMockedRepositories(*req))
+
+	// A key of another organisation, which must not be visible to the caller.
+	other, _ := model.NewAPIKey(orgs[1].ID, "Other", model.RoleAdmin)
+	if err := db.Create(other).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	createTests := []struct {
+		name     string
+		orgID    string
+		obj      interface{}
+		wantRole model.Role
+		wantErr  bool
+	}{
+		{"create", orgs[0].GetID(), &model.APIKey{Name: "CI"}, model.RoleViewer, false},
+		{"missing-name", orgs[0].GetID(), &model.APIKey{}, "", true},
+		{"invalid-role", orgs[0].GetID(), &model.APIKey{Name: "CI", Role: "owner"}, "", true},
+		{"other-organisation", orgs[1].GetID(), &model.APIKey{Name: "CI"}, "", true},
+		{"invalid-type", orgs[0].GetID(), &model.Organisation{}, "", true},
+	}
+	var created *model.APIKey
+	for _, tt := range createTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := src.Create(tt.orgID, tt.obj, *req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("APIKeySource.Create() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if got.StatusCode() != http.StatusCreated {
+				t.Errorf("APIKeySource.Create() status = %v, want %v", got.StatusCode(), http.StatusCreated)
+			}
+
+			created = got.Result().(*model.APIKey)
+			if created.Key == "" || created.Hash != model.HashAPIKey(created.Key) || created.OrganisationID != orgs[0].ID {
+				t.Errorf("APIKeySource.Create() = %+v, want a new key of the organisation", created)
+			}
+			if created.Role != tt.wantRole {
+				t.Errorf("APIKeySource.Create() role = %v, want %v", created.Role, tt.wantRole)
+			}
+		})
+	}
+
+	got, err := src.FindAll(orgs[0].GetID(), *req)
+	if err != nil {
+		t.Fatalf("APIKeySource.FindAll() error = %v", err)
+	}
+	keys := got.Result().([]*model.APIKey)
+	if len(keys) != 1 || keys[0].ID != created.ID || keys[0].Key != "" {
+		t.Errorf("APIKeySource.FindAll() = %v, want only the created key, without the key itself", keys)
+	}
+	if _, err := src.FindAll(orgs[1].GetID(), *req); err == nil {
+		t.Errorf("APIKeySource.FindAll() error = %v, wantErr %v", err, true)
+	}
+
+	revokeTests := []struct {
+		name    string
+		orgID   string
+		id      string
+		wantErr bool
+	}{
+		{"revoke", orgs[0].GetID(), created.GetID(), false},
+		{"revoke-again", orgs[0].GetID(), created.GetID(), false},
+		{"key-of-other-organisation", orgs[0].GetID(), other.GetID(), true},
+		{"other-organisation", orgs[1].GetID(), other.GetID(), true},
+		{"unknown", orgs[0].GetID(), "00000000-0000-0000-0000-000000000001", true},
+		{"invalid-id", orgs[0].GetID(), "abc", true},
+	}
+	for _, tt := range revokeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := src.Revoke(tt.orgID, tt.id, *req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("APIKeySource.Revoke() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.StatusCode() != http.StatusNoContent {
+				t.Errorf("APIKeySource.Revoke() status = %v, want %v", got.StatusCode(), http.StatusNoContent)
+			}
+		})
+	}
+
+	revoked := &model.APIKey{}
+	db.Where(&model.APIKey{Model: model.Model{ID: created.ID}}).First(revoked)
+	if !revoked.Revoked() {
+		t.Errorf("APIKeySource.Revoke() stored = %+v, want a revoked key", revoked)
+	}
+	db.Where(&model.APIKey{Model: model.Model{ID: other.ID}}).First(other)
+	if other.Revoked() {
+		t.Errorf("APIKeySource.Revoke() revoked the key of another organisation")
+	}
+
+	// Requests without a caller can't manage any keys, and neither can callers that aren't admins.
+	if _, err := src.FindAll(orgs[0].GetID(), *NewMockedRequest()); err == nil {
+		t.Errorf("APIKeySource.FindAll() error = %v, wantErr %v", err, true)
+	}
+	operator := WithMockedRole(*req, orgs[0], model.RoleOperator)
+	if _, err := src.FindAll(orgs[0].GetID(), operator); httpStatus(err) != http.StatusForbidden {
+		t.Errorf("APIKeySource.FindAll() error = %v, want status %v", err, http.StatusForbidden)
+	}
+	if _, err := src.Create(orgs[0].GetID(), &model.APIKey{Name: "CI", Role: model.RoleAdmin}, operator); httpStatus(err) != http.StatusForbidden {
+		t.Errorf("APIKeySource.Create() error = %v, want status %v", err, http.StatusForbidden)
+	}
+}
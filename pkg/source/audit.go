@@ -0,0 +1,61 @@
+package source
+
+import (
+	"encoding/json"
+	"github.com/Shodske/payment-api/pkg/auth"
+	"github.com/Shodske/payment-api/pkg/logging"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/manyminds/api2go"
+	"github.com/satori/go.uuid"
+)
+
+// Header with the id of a request, which is recorded with the changes it makes.
+const requestIDHeader = logging.RequestIDHeader
+
+// Maximum length of a request id that's recorded, longer ids are truncated.
+const maxRequestIDLength = 128
+
+// Snapshot a resource as JSON, to record how it changed in the audit log. Resources that don't exist, before they are
+// created or after they are deleted, have a nil snapshot.
+func snapshot(resource interface{}) ([]byte, error) {
+	if resource == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(resource)
+}
+
+// Append an event to the audit log for the change of the resource of the type with the id, which belongs to the
+// organisation. The event records the caller and request that made the change, and the attributes that changed between
+// the snapshots before and after the change. Must be called in the same transaction as the change itself, so a change
+// is never stored without its event.
+func appendAuditEvent(
+	events repository.AuditEventRepository,
+	req api2go.Request,
+	op model.AuditOperation,
+	typ string,
+	id, orgID uuid.UUID,
+	before, after []byte,
+) error {
+	changes, err := model.DiffJSON(before, after)
+	if err != nil {
+		return err
+	}
+
+	actor, _ := auth.Actor(req.Context)
+	requestID := req.Header.Get(requestIDHeader)
+	if len(requestID) > maxRequestIDLength {
+		requestID = requestID[:maxRequestIDLength]
+	}
+
+	return events.Append(&model.AuditEvent{
+		OrganisationID: orgID,
+		ResourceType:   typ,
+		ResourceID:     id,
+		Operation:      op,
+		Actor:          actor,
+		RequestID:      requestID,
+		Changes:        changes,
+	})
+}
@@ -0,0 +1,177 @@
+package source
+
+import (
+	"encoding/json"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/manyminds/api2go"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Every change to a payment appends an event to its audit log, which records who made the change, in which request and
+// how the attributes changed.
+func TestPaymentSource_AuditEvents(t *testing.T) {
+	req := NewMockedRequest()
+	payments := GetPaymentFixtures(false)
+	payment := payments[0]
+	callerReq := withPaymentCaller(*req, payment)
+	callerReq.Header = http.Header{}
+	callerReq.Header.Set(requestIDHeader, "request-"+strings.Repeat("x", maxRequestIDLength))
+	src := NewPaymentSource(NewMockedRepositories(*req))
+
+	if _, err := src.Update(&model.Payment{Model: model.Model{ID: payment.ID}, Reference: "Changed"}, callerReq); err != nil {
+		t.Fatalf("PaymentSource.Update() error = %v", err)
+	}
+	if _, err := src.Transition(payment.GetID(), model.StatusSubmitted, callerReq); err != nil {
+		t.Fatalf("PaymentSource.Transition() error = %v", err)
+	}
+	if _, err := src.Delete(payment.GetID(), callerReq); err != nil {
+		t.Fatalf("PaymentSource.Delete() error = %v", err)
+	}
+	created := &model.Payment{Amount: money("1.00"), Currency: "EUR"}
+	if _, err := src.Create(created, callerReq); err != nil {
+		t.Fatalf("PaymentSource.Create() error = %v", err)
+	}
+
+	res, err := src.AuditEvents(payment.GetID(), callerReq)
+	if err != nil {
+		t.Fatalf("PaymentSource.AuditEvents() error = %v", err)
+	}
+	events := res.Result().([]*model.AuditEvent)
+
+	want := []struct {
+		op      model.AuditOperation
+		changes map[string][2]string
+	}{
+		{model.AuditUpdate, map[string][2]string{"reference": {`"Another reference"`, `"Changed"`}}},
+		{model.AuditTransition, map[string][2]string{"status": {`"pending"`, `"submitted"`}}},
+		{model.AuditDelete, map[string][2]string{"currency": {`"GBP"`, `null`}, "status": {`"submitted"`, `null`}}},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("PaymentSource.AuditEvents() = %d events, want %d", len(events), len(want))
+	}
+	for i, event := range events {
+		if event.Operation != want[i].op || event.ResourceType != "payments" || event.ResourceID != payment.ID {
+			t.Errorf("PaymentSource.AuditEvents()[%d] = %+v, want %v of the payment", i, event, want[i].op)
+		}
+		if event.Actor != MockedActor || event.RequestID != callerReq.Header.Get(requestIDHeader)[:maxRequestIDLength] {
+			t.Errorf("PaymentSource.AuditEvents()[%d] = %v %v, want the caller and request", i, event.Actor, event.RequestID)
+		}
+		if want[i].op != model.AuditDelete && len(event.Changes) != len(want[i].changes) {
+			t.Errorf("PaymentSource.AuditEvents()[%d] = %d changes, want %d", i, len(event.Changes), len(want[i].changes))
+		}
+		for attribute, values := range want[i].changes {
+			change := event.Changes[attribute]
+			if string(change.Before) != values[0] || string(change.After) != values[1] {
+				t.Errorf("PaymentSource.AuditEvents()[%d] %s = %s -> %s, want %s -> %s",
+					i, attribute, change.Before, change.After, values[0], values[1])
+			}
+		}
+	}
+
+	// Created payments have all their attributes recorded.
+	res, err = src.AuditEvents(created.GetID(), callerReq)
+	if err != nil {
+		t.Fatalf("PaymentSource.AuditEvents() error = %v", err)
+	}
+	events = res.Result().([]*model.AuditEvent)
+	if len(events) != 1 || events[0].Operation != model.AuditCreate {
+		t.Fatalf("PaymentSource.AuditEvents() = %v, want the creation", events)
+	}
+	if amount := events[0].Changes["amount"]; string(amount.Before) != "null" || string(amount.After) != `"1.00"` {
+		t.Errorf("PaymentSource.AuditEvents() amount = %s -> %s, want null -> \"1.00\"", amount.Before, amount.After)
+	}
+	if _, err := json.Marshal(events); err != nil {
+		t.Errorf("json.Marshal() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		id         string
+		req        api2go.Request
+		wantEvents int
+		wantStatus int
+	}{
+		{"without-events", payments[1].GetID(), callerReq, 0, http.StatusOK},
+		{"viewer", payment.GetID(), WithMockedRole(*req, GetPaymentOrganisationFixture(payment), model.RoleViewer), 3, http.StatusOK},
+		{"other-organisation", payment.GetID(), withPaymentCaller(*req, payments[2]), 0, http.StatusNotFound},
+		{"other-organisation-without-events", payments[1].GetID(), withPaymentCaller(*req, payments[2]), 0, http.StatusNotFound},
+		{"unknown", "00000000-0000-0000-0000-000000000001", callerReq, 0, http.StatusNotFound},
+		{"invalid", "not-a-uuid", callerReq, 0, http.StatusBadRequest},
+		{"no-role", payment.GetID(), WithMockedRole(*req, GetPaymentOrganisationFixture(payment), ""), 0, http.StatusForbidden},
+		{"no-caller", payment.GetID(), *req, 0, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := src.AuditEvents(tt.id, tt.req)
+			if tt.wantStatus != http.StatusOK {
+				if got := httpStatus(err); got != tt.wantStatus {
+					t.Errorf("PaymentSource.AuditEvents() error = %v, want status %v", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PaymentSource.AuditEvents() error = %v", err)
+			}
+			if got := res.Result().([]*model.AuditEvent); len(got) != tt.wantEvents {
+				t.Errorf("PaymentSource.AuditEvents() = %d events, want %d", len(got), tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestOrganisationSource_AuditEvents(t *testing.T) {
+	req := NewMockedRequest()
+	org := GetOrganisationFixtures(false)[0]
+	callerReq := WithMockedCaller(*req, org)
+	repos := NewMockedRepositories(*req)
+	src := NewOrganisationSource(repos)
+
+	if _, err := src.Update(&model.Organisation{Model: model.Model{ID: org.ID}, Name: "Renamed"}, callerReq); err != nil {
+		t.Fatalf("OrganisationSource.Update() error = %v", err)
+	}
+	if _, err := src.Delete(org.GetID(), callerReq); err != nil {
+		t.Fatalf("OrganisationSource.Delete() error = %v", err)
+	}
+	created := &model.Organisation{Name: "Created"}
+	if _, err := src.Create(created, callerReq); err != nil {
+		t.Fatalf("OrganisationSource.Create() error = %v", err)
+	}
+
+	events, err := repos.AuditEvents.List("organisations", org.ID)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("AuditEventRepository.List() = %v, %v, want 2 events", events, err)
+	}
+	if name := events[0].Changes["name"]; events[0].Operation != model.AuditUpdate ||
+		string(name.Before) != `"Test Organisation A"` || string(name.After) != `"Renamed"` {
+		t.Errorf("AuditEventRepository.List()[0] = %+v, want the update of the name", events[0])
+	}
+	if name := events[1].Changes["name"]; events[1].Operation != model.AuditDelete || string(name.After) != "null" {
+		t.Errorf("AuditEventRepository.List()[1] = %+v, want the deletion", events[1])
+	}
+
+	events, err = repos.AuditEvents.List("organisations", created.ID)
+	if err != nil || len(events) != 1 || events[0].Operation != model.AuditCreate || events[0].OrganisationID != created.ID {
+		t.Errorf("AuditEventRepository.List() = %v, %v, want the creation", events, err)
+	}
+}
+
+// Failed changes don't append any events.
+func TestPaymentSource_AuditEventsFailed(t *testing.T) {
+	req := NewMockedRequest()
+	payment := GetPaymentFixtures(false)[0]
+	callerReq := withPaymentCaller(*req, payment)
+	repos := NewMockedRepositories(*req)
+	src := NewPaymentSource(repos)
+
+	if _, err := src.Transition(payment.GetID(), model.StatusSettled, callerReq); err == nil {
+		t.Fatalf("PaymentSource.Transition() error = %v, wantErr %v", err, true)
+	}
+	if _, err := src.Update(&model.Payment{Model: model.Model{ID: payment.ID}, Currency: "XXX"}, callerReq); err == nil {
+		t.Fatalf("PaymentSource.Update() error = %v, wantErr %v", err, true)
+	}
+	if events, err := repos.AuditEvents.List("payments", payment.ID); err != nil || len(events) != 0 {
+		t.Errorf("AuditEventRepository.List() = %v, %v, want no events", events, err)
+	}
+}
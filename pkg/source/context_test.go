@@ -8,7 +8,8 @@ import (
 )
 
 type mockedContext struct {
-	db *gorm.DB
+	db     *gorm.DB
+	values map[string]interface{}
 }
 
 // NewMockedContext mocks an `api2go.APIContexter` to be used in tests.
@@ -32,7 +33,11 @@ func (*mockedContext) Value(key interface{}) interface{} {
 	return nil
 }
 
-func (*mockedContext) Set(key string, value interface{}) {
+func (ctx *mockedContext) Set(key string, value interface{}) {
+	if ctx.values == nil {
+		ctx.values = make(map[string]interface{})
+	}
+	ctx.values[key] = value
 }
 
 func (ctx *mockedContext) Get(key string) (interface{}, bool) {
@@ -52,7 +57,9 @@ func (ctx *mockedContext) Get(key string) (interface{}, bool) {
 		return db, true
 	}
 
-	return nil, false
+	value, ok := ctx.values[key]
+
+	return value, ok
 }
 
 func (*mockedContext) Reset() {
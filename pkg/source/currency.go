@@ -0,0 +1,30 @@
+package source
+
+import (
+	"errors"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/manyminds/api2go"
+	"net/http"
+)
+
+// CurrencySource struct that implements the read-only interfaces for the embedded ISO 4217 currency table. Currencies
+// aren't stored in the database, so the source doesn't need a database connection.
+type CurrencySource struct {
+}
+
+// FindAll method required to implement `api2go.FindAll`. Implementing this interface will enable the URI:
+// GET /currencies
+func (src *CurrencySource) FindAll(req api2go.Request) (api2go.Responder, error) {
+	return &api2go.Response{Res: model.Currencies(), Code: http.StatusOK}, nil
+}
+
+// FindOne method required to implement `api2go.ResourceGetter`. Implementing this interface will enable the URI:
+// GET /currencies/:currencyCode
+func (src *CurrencySource) FindOne(id string, req api2go.Request) (api2go.Responder, error) {
+	currency, ok := model.LookupCurrency(id)
+	if !ok {
+		return nil, NewHTTPError(errors.New("unknown currency"), "could not find currencies resource", http.StatusNotFound)
+	}
+
+	return &api2go.Response{Res: currency, Code: http.StatusOK}, nil
+}
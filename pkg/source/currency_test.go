@@ -0,0 +1,51 @@
+package source
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/manyminds/api2go"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCurrencySource_FindAll(t *testing.T) {
+	src := &CurrencySource{}
+	got, err := src.FindAll(*NewMockedRequest())
+	if err != nil {
+		t.Errorf("CurrencySource.FindAll() error = %v", err)
+		return
+	}
+
+	want := &api2go.Response{Res: model.Currencies(), Code: http.StatusOK}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CurrencySource.FindAll() = %v, want %v", got, want)
+	}
+}
+
+func TestCurrencySource_FindOne(t *testing.T) {
+	gbp, _ := model.LookupCurrency("GBP")
+
+	tests := []struct {
+		name    string
+		id      string
+		want    api2go.Responder
+		wantErr bool
+	}{
+		{"GBP", "GBP", &api2go.Response{Res: gbp, Code: http.StatusOK}, false},
+		{"unknown", "XYZ", nil, true},
+		{"empty", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &CurrencySource{}
+			got, err := src.FindOne(tt.id, *NewMockedRequest())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CurrencySource.FindOne() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CurrencySource.FindOne() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
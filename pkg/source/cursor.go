@@ -0,0 +1,208 @@
+package source
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/manyminds/api2go"
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Query parameters of cursor pagination, e.g. `page[size]=50&page[cursor]=<cursor>`. A page can also be requested
+// right after a known resource using `page[after]=<id>`, e.g. to resume processing from the last seen payment.
+const (
+	cursorParameter = "page[cursor]"
+	afterParameter  = "page[after]"
+	sizeParameter   = "page[size]"
+	numberParameter = "page[number]"
+)
+
+// Size of cursor paginated pages, when no `page[size]` is given, and the largest size that can be requested.
+const (
+	defaultCursorPageSize = 100
+	maxCursorPageSize     = 1000
+)
+
+// Position in a list of resources ordered by (created_at, id), encoded into an opaque string for use in links.
+type cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"i"`
+	// Whether the page is the one before the position instead of after it.
+	Backward bool `json:"b,omitempty"`
+}
+
+// Create a cursor pointing at the position of the Model.
+func newCursor(m model.Model, backward bool) cursor {
+	return cursor{CreatedAt: m.CreatedAt, ID: m.ID, Backward: backward}
+}
+
+// Encode the cursor into an opaque string. Clients must not depend on its contents.
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode an opaque string created by `cursor.encode`.
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, err
+	}
+	if uuid.Equal(c.ID, uuid.Nil) {
+		return c, errors.New("missing id")
+	}
+
+	return c, nil
+}
+
+// A page of resources using keyset pagination on (created_at, id). Unlike pages selected by number, these pages
+// neither skip nor repeat resources when resources are inserted concurrently, and don't require counting all
+// resources.
+type cursorPage struct {
+	size int
+	// Position the page starts after, or before when it is backward. Nil for the first page.
+	position *cursor
+}
+
+// Extract the cursor pagination from the request. Returns nil when the request isn't cursor paginated, i.e. when it
+// has none of the cursor parameters or uses `page[number]`. The position of `page[after]` is resolved using `find`,
+// which must return the Model of the resource with the given id.
+func extractCursorQuery(req api2go.Request, find func(id string) (*model.Model, error)) (*cursorPage, error) {
+	if _, ok := req.QueryParams[numberParameter]; ok {
+		return nil, nil
+	}
+
+	sizeQuery, hasSize := req.QueryParams[sizeParameter]
+	cursorQuery, hasCursor := req.QueryParams[cursorParameter]
+	afterQuery, hasAfter := req.QueryParams[afterParameter]
+	if !hasSize && !hasCursor && !hasAfter {
+		return nil, nil
+	}
+
+	page := &cursorPage{size: defaultCursorPageSize}
+	if hasSize {
+		size, err := strconv.Atoi(sizeQuery[0])
+		if err != nil || size < 1 || size > maxCursorPageSize {
+			detail := fmt.Sprintf("must be a number from 1 to %d", maxCursorPageSize)
+			return nil, newQueryError(errors.New("invalid page size"), sizeParameter, detail)
+		}
+		page.size = size
+	}
+
+	switch {
+	case hasCursor && hasAfter:
+		err := errors.New("conflicting pagination")
+		return nil, newQueryError(err, afterParameter, fmt.Sprintf("cannot be combined with `%s`", cursorParameter))
+	case hasCursor:
+		position, err := decodeCursor(cursorQuery[0])
+		if err != nil {
+			return nil, newQueryError(err, cursorParameter, "is not a valid cursor")
+		}
+		page.position = &position
+	case hasAfter:
+		m, err := find(afterQuery[0])
+		if err != nil {
+			return nil, newQueryError(err, afterParameter, "must be the id of an existing resource")
+		}
+		position := newCursor(*m, false)
+		page.position = &position
+	}
+
+	return page, nil
+}
+
+// Select the page with the query. One more resource than the size of the page is selected, to know whether there is
+// a next page. Backward pages are selected in reverse order.
+func (page *cursorPage) apply(query repository.Query) repository.Query {
+	backward := page.position != nil && page.position.Backward
+	query.Order = []repository.Order{{Field: "created_at", Descending: backward}, {Field: "id", Descending: backward}}
+	query.Limit = page.size + 1
+
+	if page.position != nil {
+		query.Seek = &repository.Position{
+			CreatedAt: page.position.CreatedAt,
+			ID:        page.position.ID,
+			Backward:  backward,
+		}
+	}
+
+	return query
+}
+
+// Create the response for the selected resources, a slice of the results selected with `apply` and their Models.
+// Trims the results to the size of the page, restores the order of backward pages and adds the cursors of the pages
+// before and after it.
+func (page *cursorPage) respond(results interface{}, models []model.Model) *cursorResponse {
+	backward := page.position != nil && page.position.Backward
+	more := len(models) > page.size
+
+	value := reflect.ValueOf(results)
+	if more {
+		value = value.Slice(0, page.size)
+		models = models[:page.size]
+	}
+	if backward {
+		swap := reflect.Swapper(value.Interface())
+		for i, j := 0, len(models)-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+			models[i], models[j] = models[j], models[i]
+		}
+	}
+
+	res := &cursorResponse{Response: api2go.Response{Res: value.Interface(), Code: http.StatusOK}}
+	if len(models) == 0 {
+		return res
+	}
+
+	// Going forward there is a previous page whenever we didn't start at the beginning, going backward there always is
+	// a next page, as that's where we came from.
+	first, last := models[0], models[len(models)-1]
+	if backward || more {
+		res.next = newCursor(last, false).encode()
+	}
+	if (backward && more) || (!backward && page.position != nil) {
+		res.prev = newCursor(first, true).encode()
+	}
+
+	return res
+}
+
+// Response of a cursor paginated request, which links to the pages before and after it.
+type cursorResponse struct {
+	api2go.Response
+	next string
+	prev string
+}
+
+// Links method required to implement `api2go.LinksResponder`. The links keep all query parameters of the request,
+// except for the position of the page.
+func (res *cursorResponse) Links(req *http.Request, baseURL string) jsonapi.Links {
+	links := jsonapi.Links{}
+	for name, c := range map[string]string{"next": res.next, "prev": res.prev} {
+		if c == "" {
+			continue
+		}
+
+		params := req.URL.Query()
+		params.Del(afterParameter)
+		params.Set(cursorParameter, c)
+		query, _ := url.QueryUnescape(params.Encode())
+		links[name] = jsonapi.Link{Href: baseURL + "?" + query}
+	}
+
+	return links
+}
@@ -0,0 +1,124 @@
+package source
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/manyminds/api2go"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestPaymentSource_FindAllCursor(t *testing.T) {
+	orgs := GetOrganisationFixtures(false)
+	req := NewMockedRequest()
+	*req = WithMockedCaller(*req, orgs[0])
+
+	// Only two of the fixtures belong to the organisation of the caller, so create a third one to page through.
+	db := NewMockedDatabase(*req)
+	extra := &model.Payment{OrganisationID: orgs[0].ID, Amount: money("1.00"), Currency: "EUR"}
+	if err := db.Create(extra).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer db.Unscoped().Delete(extra)
+	extra = &model.Payment{Model: model.Model{ID: extra.ID}}
+	db.Where(extra).First(extra)
+	payments := append(GetPaymentFixtures(false)[0:2], extra)
+
+	paged := func(params map[string][]string) api2go.Request {
+		pagedReq := *req
+		pagedReq.QueryParams = params
+		return pagedReq
+	}
+	find := func(params map[string][]string) *cursorResponse {
+		src := NewPaymentSource(NewMockedRepositories(*req))
+		got, err := src.FindAll(paged(params))
+		if err != nil {
+			t.Fatalf("PaymentSource.FindAll() error = %v", err)
+		}
+		return got.(*cursorResponse)
+	}
+
+	type want struct {
+		payments []*model.Payment
+		next     bool
+		prev     bool
+	}
+	check := func(name string, got *cursorResponse, want want) {
+		if !reflect.DeepEqual(got.Res, want.payments) {
+			t.Errorf("%s: PaymentSource.FindAll() = %v, want %v", name, got.Res, want.payments)
+		}
+		if (got.next != "") != want.next {
+			t.Errorf("%s: PaymentSource.FindAll() next = %q, want %v", name, got.next, want.next)
+		}
+		if (got.prev != "") != want.prev {
+			t.Errorf("%s: PaymentSource.FindAll() prev = %q, want %v", name, got.prev, want.prev)
+		}
+	}
+
+	// Walk forward through all payments, then back again.
+	first := find(map[string][]string{"page[size]": {"1"}})
+	check("first", first, want{payments[0:1], true, false})
+	second := find(map[string][]string{"page[size]": {"1"}, "page[cursor]": {first.next}})
+	check("second", second, want{payments[1:2], true, true})
+	last := find(map[string][]string{"page[size]": {"1"}, "page[cursor]": {second.next}})
+	check("last", last, want{payments[2:3], false, true})
+	back := find(map[string][]string{"page[size]": {"1"}, "page[cursor]": {last.prev}})
+	check("back", back, want{payments[1:2], true, true})
+	backFirst := find(map[string][]string{"page[size]": {"1"}, "page[cursor]": {back.prev}})
+	check("back-first", backFirst, want{payments[0:1], true, false})
+
+	// Backward pages keep the regular order.
+	backTwo := find(map[string][]string{"page[size]": {"2"}, "page[cursor]": {last.prev}})
+	check("back-two", backTwo, want{payments[0:2], true, false})
+
+	after := find(map[string][]string{"page[size]": {"2"}, "page[after]": {payments[0].GetID()}})
+	check("after", after, want{payments[1:3], false, true})
+	all := find(map[string][]string{"page[cursor]": {newCursor(model.Model{ID: payments[0].ID}, false).encode()}})
+	check("default-size", all, want{payments, false, true})
+
+	filtered := find(map[string][]string{"page[size]": {"1"}, "filter[currency]": {"GBP"}})
+	check("filtered", filtered, want{payments[0:1], true, false})
+	filteredLast := find(map[string][]string{"page[size]": {"1"}, "filter[currency]": {"GBP"}, "page[cursor]": {filtered.next}})
+	check("filtered-last", filteredLast, want{payments[1:2], false, true})
+
+	tests := []struct {
+		name   string
+		params map[string][]string
+	}{
+		{"invalid-cursor", map[string][]string{"page[cursor]": {"abc"}}},
+		{"zero-size", map[string][]string{"page[size]": {"0"}}},
+		{"too-large-size", map[string][]string{"page[size]": {"1001"}}},
+		{"invalid-size", map[string][]string{"page[size]": {"abc"}}},
+		{"cursor-and-after", map[string][]string{"page[cursor]": {first.next}, "page[after]": {payments[0].GetID()}}},
+		{"unknown-after", map[string][]string{"page[after]": {"d290f1ee-6c54-4b01-90e6-d701748f0851"}}},
+		{"sorted", map[string][]string{"page[size]": {"1"}, "sort": {"-amount"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := NewPaymentSource(NewMockedRepositories(*req))
+			if _, err := src.FindAll(paged(tt.params)); err == nil {
+				t.Errorf("PaymentSource.FindAll() error = %v, wantErr %v", err, true)
+			}
+		})
+	}
+}
+
+func TestCursorResponse_Links(t *testing.T) {
+	res := &cursorResponse{next: "next-cursor"}
+	req := httptest.NewRequest("GET", "/v0/payments?filter[currency]=GBP&page[size]=1&page[after]=abc", nil)
+
+	links := res.Links(req, "/v0/payments")
+	if _, ok := links["prev"]; ok {
+		t.Errorf("cursorResponse.Links() prev = %v, want none", links["prev"])
+	}
+
+	next, err := url.Parse(links["next"].Href)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{"filter[currency]": {"GBP"}, "page[size]": {"1"}, "page[cursor]": {"next-cursor"}}
+	if next.Path != "/v0/payments" || !reflect.DeepEqual(next.Query(), want) {
+		t.Errorf("cursorResponse.Links() next = %v, want %v", links["next"].Href, want)
+	}
+}
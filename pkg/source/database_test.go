@@ -1,11 +1,13 @@
 package source
 
 import (
+	"encoding/json"
 	"github.com/Shodske/payment-api/pkg/model"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/satori/go.uuid"
 	"log"
+	"strconv"
 	"time"
 )
 
@@ -25,14 +27,17 @@ var organisationFixtures = []*model.Organisation{
 }
 
 // TODO Find out why the nested structs cause errors while setting up the test database. This may have something to do
-//      with sqlite as these errors don't seem to appear with postgres.
+//
+//	with sqlite as these errors don't seem to appear with postgres.
 var paymentFixtures = []*model.Payment{
 	{
 		Model: model.Model{ID: uuid.NewV4()},
 
 		OrganisationID: organisationFixtures[0].ID,
 
-		Amount:               "13.37",
+		Status: model.StatusPending,
+
+		Amount:               money("13.37"),
 		Currency:             "GBP",
 		EndToEndReference:    "Some reference A",
 		NumericReference:     "90011337420",
@@ -75,15 +80,15 @@ var paymentFixtures = []*model.Payment{
 		//
 		//ChargesInformation: &model.Charge{
 		//	BearerCode:              "4532452",
-		//	ReceiverChargesAmount:   "1.12",
+		//	ReceiverChargesAmount:   money("1.12"),
 		//	ReceiverChargesCurrency: "USD",
 		//	SenderCharges: []*model.CurrencyAmount{
 		//		{
-		//			Amount:   "987.32",
+		//			Amount:   money("987.32"),
 		//			Currency: "USD",
 		//		},
 		//		{
-		//			Amount:   "9.32",
+		//			Amount:   money("9.32"),
 		//			Currency: "USD",
 		//		},
 		//	},
@@ -92,7 +97,7 @@ var paymentFixtures = []*model.Payment{
 		//FX: &model.FX{
 		//	ContractReference: "FX123",
 		//	ExchangeRate:      "2.00000",
-		//	OriginalAmount:    "200000.01",
+		//	OriginalAmount:    money("200000.01"),
 		//	OriginalCurrency:  "USD",
 		//},
 	},
@@ -100,7 +105,9 @@ var paymentFixtures = []*model.Payment{
 		Model:          model.Model{ID: uuid.NewV4()},
 		OrganisationID: organisationFixtures[0].ID,
 
-		Amount:               "5.55",
+		Status: model.StatusSubmitted,
+
+		Amount:               money("5.55"),
 		Currency:             "GBP",
 		EndToEndReference:    "Some reference B",
 		NumericReference:     "987984654",
@@ -108,7 +115,7 @@ var paymentFixtures = []*model.Payment{
 		PaymentPurpose:       "Some purpose",
 		PaymentScheme:        "FPS",
 		PaymentType:          "Debit",
-		ProcessingDate:       "2017-01-18",
+		ProcessingDate:       "2017-01-19",
 		Reference:            "Another reference",
 		SchemePaymentSubType: "InternetBanking",
 		SchemePaymentType:    "ImmediatePayment",
@@ -143,19 +150,19 @@ var paymentFixtures = []*model.Payment{
 		//
 		//ChargesInformation: &model.Charge{
 		//	BearerCode:              "987987",
-		//	ReceiverChargesAmount:   "11.99",
+		//	ReceiverChargesAmount:   money("11.99"),
 		//	ReceiverChargesCurrency: "USD",
 		//	SenderCharges: []*model.CurrencyAmount{
 		//		{
-		//			Amount:   "900000000.12",
+		//			Amount:   money("900000000.12"),
 		//			Currency: "USD",
 		//		},
 		//		{
-		//			Amount:   "2.01",
+		//			Amount:   money("2.01"),
 		//			Currency: "USD",
 		//		},
 		//		{
-		//			Amount:   "7.77",
+		//			Amount:   money("7.77"),
 		//			Currency: "USD",
 		//		},
 		//	},
@@ -164,7 +171,7 @@ var paymentFixtures = []*model.Payment{
 		//FX: &model.FX{
 		//	ContractReference: "FX321",
 		//	ExchangeRate:      "1.77700",
-		//	OriginalAmount:    "90.01",
+		//	OriginalAmount:    money("90.01"),
 		//	OriginalCurrency:  "USD",
 		//},
 	},
@@ -172,15 +179,17 @@ var paymentFixtures = []*model.Payment{
 		Model:          model.Model{ID: uuid.NewV4()},
 		OrganisationID: organisationFixtures[1].ID,
 
-		Amount:               "987.54",
+		Status: model.StatusAccepted,
+
+		Amount:               money("987.54"),
 		Currency:             "USD",
 		EndToEndReference:    "Some reference C",
 		NumericReference:     "90011337420",
 		PaymentID:            "01234659876",
 		PaymentPurpose:       "Just paying",
-		PaymentScheme:        "FPS",
+		PaymentScheme:        "BACS",
 		PaymentType:          "Credit",
-		ProcessingDate:       "2017-01-18",
+		ProcessingDate:       "2017-01-20",
 		Reference:            "Another reference",
 		SchemePaymentSubType: "InternetBanking",
 		SchemePaymentType:    "ImmediatePayment",
@@ -215,11 +224,11 @@ var paymentFixtures = []*model.Payment{
 		//
 		//ChargesInformation: &model.Charge{
 		//	BearerCode:              "46876987",
-		//	ReceiverChargesAmount:   "4.20",
+		//	ReceiverChargesAmount:   money("4.20"),
 		//	ReceiverChargesCurrency: "USD",
 		//	SenderCharges: []*model.CurrencyAmount{
 		//		{
-		//			Amount:   "8.20",
+		//			Amount:   money("8.20"),
 		//			Currency: "USD",
 		//		},
 		//	},
@@ -228,7 +237,7 @@ var paymentFixtures = []*model.Payment{
 		//FX: &model.FX{
 		//	ContractReference: "FX123",
 		//	ExchangeRate:      "7.01010",
-		//	OriginalAmount:    "20.87",
+		//	OriginalAmount:    money("20.87"),
 		//	OriginalCurrency:  "USD",
 		//},
 	},
@@ -236,7 +245,9 @@ var paymentFixtures = []*model.Payment{
 		Model:          model.Model{ID: uuid.NewV4(), DeletedAt: &time.Time{}},
 		OrganisationID: organisationFixtures[2].ID,
 
-		Amount:               "13.37",
+		Status: model.StatusPending,
+
+		Amount:               money("13.37"),
 		Currency:             "GBP",
 		EndToEndReference:    "Some reference D",
 		NumericReference:     "4242",
@@ -279,15 +290,15 @@ var paymentFixtures = []*model.Payment{
 		//
 		//ChargesInformation: &model.Charge{
 		//	BearerCode:              "9877698354",
-		//	ReceiverChargesAmount:   "1.12",
+		//	ReceiverChargesAmount:   money("1.12"),
 		//	ReceiverChargesCurrency: "USD",
 		//	SenderCharges: []*model.CurrencyAmount{
 		//		{
-		//			Amount:   "987.32",
+		//			Amount:   money("987.32"),
 		//			Currency: "USD",
 		//		},
 		//		{
-		//			Amount:   "9.32",
+		//			Amount:   money("9.32"),
 		//			Currency: "USD",
 		//		},
 		//	},
@@ -296,7 +307,7 @@ var paymentFixtures = []*model.Payment{
 		//FX: &model.FX{
 		//	ContractReference: "FX123",
 		//	ExchangeRate:      "0.00001",
-		//	OriginalAmount:    "200000000000.01",
+		//	OriginalAmount:    money("200000000000.01"),
 		//	OriginalCurrency:  "USD",
 		//},
 	},
@@ -330,6 +341,18 @@ func GetPaymentFixtures(deleted bool) []*model.Payment {
 	return payments
 }
 
+// GetPaymentOrganisationFixture method returns the Organisation fixture a Payment fixture belongs to, to be used as the
+// caller of requests on the Payment.
+func GetPaymentOrganisationFixture(payment *model.Payment) *model.Organisation {
+	for _, org := range organisationFixtures {
+		if uuid.Equal(org.ID, payment.OrganisationID) {
+			return org
+		}
+	}
+
+	return nil
+}
+
 // NewTestDatabase method creates a database connection for testing purposes, using sqlite.
 func NewTestDatabase() (*gorm.DB, error) {
 	db, err := gorm.Open("sqlite3", "/tmp/api.db")
@@ -352,6 +375,12 @@ func NewTestDatabase() (*gorm.DB, error) {
 func migrate(db *gorm.DB) error {
 	// First drop all tables, so we don't have residual data that can cause errors.
 	db.DropTableIfExists(
+		&model.WebhookDelivery{},
+		&model.Webhook{},
+		&model.OutboxEvent{},
+		&model.AuditEvent{},
+		&model.APIKey{},
+		&model.IdempotencyKey{},
 		&model.Payment{},
 		&model.FX{},
 		&model.Charge{},
@@ -367,6 +396,12 @@ func migrate(db *gorm.DB) error {
 		&model.CurrencyAmount{},
 		&model.FX{},
 		&model.Payment{},
+		&model.IdempotencyKey{},
+		&model.APIKey{},
+		&model.AuditEvent{},
+		&model.OutboxEvent{},
+		&model.Webhook{},
+		&model.WebhookDelivery{},
 	).Error
 }
 
@@ -414,3 +449,18 @@ func populate(db *gorm.DB) error {
 
 	return nil
 }
+
+// Parse a constant amount of money, for use in fixtures.
+func money(s string) *model.Money {
+	m := model.MustParseMoney(s)
+	return &m
+}
+
+// Decode an invalid amount of money, like it would be decoded from a request document.
+func invalidMoney(s string) *model.Money {
+	m := &model.Money{}
+	if err := json.Unmarshal([]byte(strconv.Quote(s)), m); err != nil {
+		panic(err)
+	}
+	return m
+}
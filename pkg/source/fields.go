@@ -0,0 +1,55 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"github.com/manyminds/api2go"
+)
+
+// Fieldset describes the attributes of a resource type that can be requested with the json:api sparse fieldset query
+// parameter, e.g. `fields[payments]=amount,currency`.
+type fieldset struct {
+	// Type of the resource, as used in the name of the query parameter.
+	typ string
+	// Attributes of the resource.
+	attributes []string
+}
+
+// Name of the sparse fieldset query parameter of the resource type.
+func (fs fieldset) parameter() string {
+	return "fields[" + fs.typ + "]"
+}
+
+// Extract the attributes requested by the sparse fieldset query parameter of the request. Returns nil when the request
+// has no sparse fieldset, i.e. when all attributes are requested, and a 400 error for unknown attributes.
+func (fs fieldset) extract(req api2go.Request) ([]string, error) {
+	fields, ok := req.QueryParams[fs.parameter()]
+	if !ok {
+		return nil, nil
+	}
+
+	requested := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field == "" {
+			continue
+		}
+		if !fs.has(field) {
+			err := errors.New("unknown field")
+			return nil, newQueryError(err, fs.parameter(), fmt.Sprintf("`%s` is not an attribute of %s", field, fs.typ))
+		}
+		requested = append(requested, field)
+	}
+
+	return requested, nil
+}
+
+// Check whether the resource type has the attribute.
+func (fs fieldset) has(attribute string) bool {
+	for _, a := range fs.attributes {
+		if a == attribute {
+			return true
+		}
+	}
+
+	return false
+}
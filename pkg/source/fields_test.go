@@ -0,0 +1,155 @@
+package source
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/jinzhu/gorm"
+	"github.com/manyminds/api2go"
+	"testing"
+)
+
+func TestPaymentSource_FindAllFields(t *testing.T) {
+	req := NewMockedRequest()
+	orgs := GetOrganisationFixtures(false)
+	*req = WithMockedCaller(*req, orgs[1])
+	db := NewMockedDatabase(*req)
+
+	// Nested objects aren't part of the fixtures, so create a payment that has all of them.
+	nestedPayment := &model.Payment{
+		OrganisationID:     orgs[1].ID,
+		Amount:             money("1.00"),
+		Currency:           "EUR",
+		BeneficiaryParty:   &model.Party{AccountNumber: "31926819", Name: "Wilfred Jeremiah Owens"},
+		DebtorParty:        &model.Party{AccountNumber: "GB29XABC10161234567801", Name: "Emelia Jane Brown"},
+		ChargesInformation: &model.Charge{SenderCharges: []*model.CurrencyAmount{{Amount: money("5.00"), Currency: "GBP"}}},
+		FX:                 &model.FX{ExchangeRate: "2.00000", OriginalAmount: money("0.50"), OriginalCurrency: "GBP"},
+	}
+	if err := db.Create(nestedPayment).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer db.Unscoped().Delete(nestedPayment)
+
+	// Count the queries on the tables of the nested objects, to make sure they're only loaded when requested.
+	queries := map[string]int{}
+	db.Callback().Query().After("gorm:query").Register("test:count_nested", func(scope *gorm.Scope) {
+		queries[scope.TableName()]++
+	})
+	defer db.Callback().Query().Remove("test:count_nested")
+
+	sparse := func(params map[string][]string) api2go.Request {
+		sparseReq := *req
+		sparseReq.QueryParams = params
+		return sparseReq
+	}
+	find := func(params map[string][]string) *model.Payment {
+		queries = map[string]int{}
+		src := NewPaymentSource(repository.NewGorm(db))
+		got, err := src.FindOne(nestedPayment.GetID(), sparse(params))
+		if err != nil {
+			t.Fatalf("PaymentSource.FindOne() error = %v", err)
+		}
+		return got.Result().(*model.Payment)
+	}
+
+	all := find(map[string][]string{})
+	if all.BeneficiaryParty == nil || all.DebtorParty == nil || all.FX == nil ||
+		all.ChargesInformation == nil || len(all.ChargesInformation.SenderCharges) != 1 {
+		t.Errorf("PaymentSource.FindOne() = %+v, want all nested objects", all)
+	}
+
+	attributes := find(map[string][]string{"fields[payments]": {"amount", "currency"}})
+	if attributes.BeneficiaryParty != nil || attributes.DebtorParty != nil || attributes.ChargesInformation != nil ||
+		attributes.FX != nil {
+		t.Errorf("PaymentSource.FindOne() = %+v, want no nested objects", attributes)
+	}
+	for _, table := range []string{"parties", "charges", "currency_amounts", "fxes"} {
+		if queries[table] != 0 {
+			t.Errorf("PaymentSource.FindOne() %s queries = %v, want %v", table, queries[table], 0)
+		}
+	}
+
+	party := find(map[string][]string{"fields[payments]": {"amount", "beneficiary_party"}})
+	if party.BeneficiaryParty == nil || party.BeneficiaryParty.Name != "Wilfred Jeremiah Owens" {
+		t.Errorf("PaymentSource.FindOne() beneficiary_party = %+v, want %+v", party.BeneficiaryParty, nestedPayment.BeneficiaryParty)
+	}
+	if party.DebtorParty != nil || party.FX != nil {
+		t.Errorf("PaymentSource.FindOne() = %+v, want only the beneficiary_party", party)
+	}
+	if queries["parties"] != 1 || queries["fxes"] != 0 || queries["charges"] != 0 {
+		t.Errorf("PaymentSource.FindOne() queries = %v, want only a single query on parties", queries)
+	}
+
+	charges := find(map[string][]string{"fields[payments]": {"charges_information"}})
+	if charges.ChargesInformation == nil || len(charges.ChargesInformation.SenderCharges) != 1 {
+		t.Errorf("PaymentSource.FindOne() charges_information = %+v, want sender charges", charges.ChargesInformation)
+	}
+
+	// List endpoints only load the requested nested objects as well, in a single query for all payments.
+	queries = map[string]int{}
+	src := NewPaymentSource(repository.NewGorm(db))
+	got, err := src.FindAll(sparse(map[string][]string{"fields[payments]": {"fx"}}))
+	if err != nil {
+		t.Fatalf("PaymentSource.FindAll() error = %v", err)
+	}
+	if queries["fxes"] != 1 || queries["parties"] != 0 {
+		t.Errorf("PaymentSource.FindAll() queries = %v, want only a single query on fxes", queries)
+	}
+	for _, payment := range got.Result().([]*model.Payment) {
+		if payment.ID == nestedPayment.ID && payment.FX == nil {
+			t.Errorf("PaymentSource.FindAll() fx = %v, want %+v", payment.FX, nestedPayment.FX)
+		}
+	}
+
+	queries = map[string]int{}
+	_, _, err = src.PaginatedFindAll(sparse(map[string][]string{
+		"page[number]":     {"1"},
+		"page[size]":       {"10"},
+		"fields[payments]": {"status"},
+	}))
+	if err != nil {
+		t.Fatalf("PaymentSource.PaginatedFindAll() error = %v", err)
+	}
+	if queries["parties"] != 0 || queries["fxes"] != 0 || queries["charges"] != 0 {
+		t.Errorf("PaymentSource.PaginatedFindAll() queries = %v, want no queries on nested objects", queries)
+	}
+
+	tests := []struct {
+		name   string
+		params map[string][]string
+	}{
+		{"unknown-field", map[string][]string{"fields[payments]": {"amount", "unknown"}}},
+		{"nested-field", map[string][]string{"fields[payments]": {"beneficiary_party.name"}}},
+		{"relationship", map[string][]string{"fields[payments]": {"organisation"}}},
+		{"unknown-organisation-field", map[string][]string{"fields[organisations]": {"amount"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := src.FindAll(sparse(tt.params))
+			if err == nil {
+				t.Errorf("PaymentSource.FindAll() error = %v, wantErr %v", err, true)
+				return
+			}
+			if code := err.(api2go.HTTPError).Errors[0].Status; code != "400" {
+				t.Errorf("PaymentSource.FindAll() status = %v, want %v", code, "400")
+			}
+		})
+	}
+}
+
+func TestOrganisationSource_FindAllFields(t *testing.T) {
+	req := NewMockedRequest()
+	*req = WithMockedCaller(*req, GetOrganisationFixtures(false)[0])
+
+	sparseReq := *req
+	sparseReq.QueryParams = map[string][]string{"fields[organisations]": {"name"}}
+
+	src := NewOrganisationSource(NewMockedRepositories(*req))
+	if _, err := src.FindAll(sparseReq); err != nil {
+		t.Errorf("OrganisationSource.FindAll() error = %v", err)
+	}
+
+	sparseReq.QueryParams = map[string][]string{"fields[organisations]": {"amount"}}
+	if _, err := src.FindAll(sparseReq); err == nil {
+		t.Errorf("OrganisationSource.FindAll() error = %v, wantErr %v", err, true)
+	}
+}
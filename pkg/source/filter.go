@@ -0,0 +1,133 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/Shodske/payment-api/pkg/validation"
+	"github.com/manyminds/api2go"
+	"github.com/satori/go.uuid"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Operators that can be used in filter query parameters, e.g. `filter[amount][gte]=10.00`. Filters without an operator
+// use `eq`, which matches any of the comma separated values.
+const (
+	operatorEq  = repository.OperatorEq
+	operatorGte = repository.OperatorGte
+	operatorLte = repository.OperatorLte
+)
+
+var filterRegex = regexp.MustCompile(`^filter\[([a-z_.]+)\](?:\[([a-z]+)\])?$`)
+
+// Filter on a single attribute of a resource.
+type filter struct {
+	operators []string
+	// Parse and validate a value of the query parameter, before it's used in the query.
+	parse func(value string) (interface{}, error)
+}
+
+// Filters maps the names of the filters of a resource, e.g. `currency` for `filter[currency]`, to the filter.
+type filters map[string]filter
+
+// Extract all filter query parameters of the request. Returns a 400 error for unknown filters, unsupported operators
+// and invalid values.
+func (filters filters) extract(req api2go.Request) ([]repository.Filter, error) {
+	// Extract the parameters in a fixed order, so the same request always results in the same query.
+	keys := make([]string, 0, len(req.QueryParams))
+	for key := range req.QueryParams {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	extracted := make([]repository.Filter, 0, len(keys))
+	for _, key := range keys {
+		matches := filterRegex.FindStringSubmatch(key)
+		if matches == nil {
+			return nil, newQueryError(errors.New("invalid filter"), key, "is not a valid filter")
+		}
+
+		name, operator := matches[1], matches[2]
+		if operator == "" {
+			operator = operatorEq
+		}
+
+		f, ok := filters[name]
+		if !ok {
+			return nil, newQueryError(errors.New("unknown filter"), key, fmt.Sprintf("`%s` is not a known filter", name))
+		}
+		if !f.supports(operator) {
+			detail := fmt.Sprintf("operator `%s` is not supported, use one of `%s`", operator, strings.Join(f.operators, "`, `"))
+			return nil, newQueryError(errors.New("unsupported operator"), key, detail)
+		}
+
+		values := req.QueryParams[key]
+		if operator != operatorEq && len(values) != 1 {
+			return nil, newQueryError(errors.New("too many values"), key, "must have a single value")
+		}
+
+		parsed := make([]interface{}, len(values))
+		for i, value := range values {
+			var err error
+			if parsed[i], err = f.parse(value); err != nil {
+				return nil, newQueryError(err, key, err.Error())
+			}
+		}
+
+		extracted = append(extracted, repository.Filter{Field: name, Operator: operator, Values: parsed})
+	}
+
+	return extracted, nil
+}
+
+// Check whether the filter supports the operator.
+func (f filter) supports(operator string) bool {
+	for _, o := range f.operators {
+		if o == operator {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Filter values used as is.
+func parseString(value string) (interface{}, error) {
+	return value, nil
+}
+
+// Filter values that must be a UUID, e.g. the ID of a related resource.
+func parseUUID(value string) (interface{}, error) {
+	id, err := uuid.FromString(value)
+	if err != nil {
+		return nil, errors.New("must be a valid UUID")
+	}
+
+	return id, nil
+}
+
+// Filter values that must be a date in the format `YYYY-MM-DD`. Dates are stored in the same format, so they can be
+// compared as strings.
+func parseDate(value string) (interface{}, error) {
+	if _, err := time.Parse(validation.DateFormat, value); err != nil {
+		return nil, errors.New("must be a valid date in the format `YYYY-MM-DD`")
+	}
+
+	return value, nil
+}
+
+// Filter values that must be an amount of money.
+func parseMoney(value string) (interface{}, error) {
+	amount, err := model.ParseMoney(value)
+	if err != nil {
+		return nil, errors.New("must be a decimal number, e.g. `12.34`")
+	}
+
+	return amount, nil
+}
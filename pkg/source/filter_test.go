@@ -0,0 +1,115 @@
+package source
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/manyminds/api2go"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestPaymentSource_FindAllFiltered(t *testing.T) {
+	payments := GetPaymentFixtures(false)
+	orgs := GetOrganisationFixtures(false)
+
+	// Parties aren't part of the fixtures, so create a payment with a beneficiary to filter on.
+	req := NewMockedRequest()
+	db := NewMockedDatabase(*req)
+	partyPayment := &model.Payment{
+		OrganisationID:   orgs[1].ID,
+		Amount:           money("1.00"),
+		Currency:         "EUR",
+		BeneficiaryParty: &model.Party{AccountNumber: "31926819", Name: "Wilfred Jeremiah Owens"},
+	}
+	if err := db.Create(partyPayment).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer db.Unscoped().Delete(partyPayment)
+	partyPayment = &model.Payment{Model: model.Model{ID: partyPayment.ID}}
+	db.Preload("BeneficiaryParty").Where(partyPayment).First(partyPayment)
+
+	filtered := func(org *model.Organisation, params map[string][]string) api2go.Request {
+		filteredReq := WithMockedCaller(*req, org)
+		filteredReq.QueryParams = params
+		return filteredReq
+	}
+	list := func(payments ...*model.Payment) []*model.Payment {
+		return payments
+	}
+	// Callers only ever get the payments of their own organisation.
+	res := func(org *model.Organisation, payments []*model.Payment) api2go.Responder {
+		owned := make([]*model.Payment, 0)
+		for _, payment := range payments {
+			if payment.OrganisationID == org.ID {
+				owned = append(owned, payment)
+			}
+		}
+		return &api2go.Response{Code: http.StatusOK, Res: owned}
+	}
+
+	tests := []struct {
+		name    string
+		params  map[string][]string
+		want    []*model.Payment
+		wantErr bool
+	}{
+		{"currency", map[string][]string{"filter[currency]": {"GBP"}}, list(payments[0], payments[1]), false},
+		{"currency-any", map[string][]string{"filter[currency]": {"USD", "EUR"}}, list(payments[2], partyPayment), false},
+		{"payment-scheme", map[string][]string{"filter[payment_scheme]": {"BACS"}}, list(payments[2]), false},
+		{"organisation", map[string][]string{"filter[organisation]": {orgs[0].ID.String()}}, list(payments[0], payments[1]), false},
+		{"processing-date-gte", map[string][]string{"filter[processing_date][gte]": {"2017-01-19"}}, list(payments[1], payments[2]), false},
+		{
+			"processing-date-range",
+			map[string][]string{"filter[processing_date][gte]": {"2017-01-19"}, "filter[processing_date][lte]": {"2017-01-19"}},
+			list(payments[1]),
+			false,
+		},
+		{"amount-gte", map[string][]string{"filter[amount][gte]": {"9"}}, list(payments[0], payments[2]), false},
+		{"combined", map[string][]string{"filter[currency]": {"GBP"}, "filter[amount][gte]": {"9"}}, list(payments[0]), false},
+		{"party", map[string][]string{"filter[beneficiary_party.account_number]": {"31926819"}}, list(partyPayment), false},
+		{"other-party", map[string][]string{"filter[debtor_party.account_number]": {"31926819"}}, list(), false},
+		{"no-match", map[string][]string{"filter[currency]": {"JPY"}}, list(), false},
+		{"unknown-filter", map[string][]string{"filter[unknown]": {"value"}}, nil, true},
+		{"unknown-party-field", map[string][]string{"filter[beneficiary_party.account_type]": {"0"}}, nil, true},
+		{"invalid-filter", map[string][]string{"filter[currency]]": {"GBP"}}, nil, true},
+		{"unsupported-operator", map[string][]string{"filter[currency][gte]": {"GBP"}}, nil, true},
+		{"unknown-operator", map[string][]string{"filter[amount][gt]": {"10"}}, nil, true},
+		{"multiple-values", map[string][]string{"filter[amount][gte]": {"1", "2"}}, nil, true},
+		{"invalid-organisation", map[string][]string{"filter[organisation]": {"abc"}}, nil, true},
+		{"invalid-date", map[string][]string{"filter[processing_date][lte]": {"tomorrow"}}, nil, true},
+		{"invalid-amount", map[string][]string{"filter[amount][gte]": {"abc"}}, nil, true},
+	}
+	for _, tt := range tests {
+		for _, org := range orgs {
+			t.Run(tt.name+"/"+org.Name, func(t *testing.T) {
+				src := NewPaymentSource(repository.NewGorm(db))
+				got, err := src.FindAll(filtered(org, tt.params))
+				if (err != nil) != tt.wantErr {
+					t.Errorf("PaymentSource.FindAll() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+				if err != nil {
+					if code := err.(api2go.HTTPError).Errors[0].Status; code != "400" {
+						t.Errorf("PaymentSource.FindAll() status = %v, want %v", code, "400")
+					}
+					return
+				}
+				if want := res(org, tt.want); !reflect.DeepEqual(got, want) {
+					t.Errorf("PaymentSource.FindAll() = %v, want %v", got, want)
+				}
+			})
+		}
+	}
+
+	// The count of paginated results must take the filters into account.
+	src := NewPaymentSource(repository.NewGorm(db))
+	count, _, err := src.PaginatedFindAll(filtered(orgs[0], map[string][]string{
+		"page[number]":     {"1"},
+		"page[size]":       {"1"},
+		"filter[currency]": {"GBP"},
+	}))
+	if err != nil || count != 2 {
+		t.Errorf("PaymentSource.PaginatedFindAll() count = %v, error = %v, want %v", count, err, 2)
+	}
+}
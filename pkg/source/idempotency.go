@@ -0,0 +1,125 @@
+package source
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/Shodske/payment-api/pkg/metrics"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/manyminds/api2go"
+	"github.com/manyminds/api2go/jsonapi"
+	"net/http"
+	"strconv"
+)
+
+// Name of the header clients can use to safely retry requests.
+const idempotencyHeader = "Idempotency-Key"
+
+// Maximum length of an idempotency key, equal to the size of its column.
+const maxIdempotencyKeyLength = 255
+
+// Create the payment at most once for every idempotency key of its organisation. The response of the first request is
+// stored together with a fingerprint of the payment that was sent. Retries with the same payment get the stored
+// response replayed, while reusing the key for a different payment is refused.
+//
+// The payment is created atomically with storing the key and appending its event to the audit log, so a failed request
+// doesn't use up the key.
+func createIdempotent(repos repository.Repositories, key string, payment *model.Payment, req api2go.Request) (api2go.Responder, error) {
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, newIdempotencyError(
+			errors.New("idempotency key too long"),
+			http.StatusBadRequest,
+			"`Idempotency-Key` cannot be longer than "+strconv.Itoa(maxIdempotencyKeyLength)+" characters",
+		)
+	}
+
+	fingerprint, err := fingerprint(payment)
+	if err != nil {
+		return nil, newInternalError(req, err)
+	}
+
+	stored, err := repos.Payments.FindIdempotencyKey(payment.OrganisationID, key)
+	if err == nil {
+		return replay(req, stored, fingerprint, payment)
+	}
+	if err != repository.ErrNotFound {
+		return nil, newInternalError(req, err)
+	}
+
+	res := &api2go.Response{Res: payment, Code: http.StatusCreated}
+	stored = &model.IdempotencyKey{OrganisationID: payment.OrganisationID, Key: key, Fingerprint: fingerprint}
+	err = repos.Transaction(func(tx repository.Repositories) error {
+		err := tx.Payments.CreateIdempotent(payment, stored, func() error {
+			document, err := jsonapi.Marshal(res.Result())
+			if err != nil {
+				return err
+			}
+
+			stored.ResponseCode = res.StatusCode()
+			stored.Response = string(document)
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return recordPayment(tx, req, model.AuditCreate, payment, nil)
+	})
+	if err == repository.ErrConflict {
+		// The key has been stored in the meantime, by a concurrent request with the same key.
+		return nil, newIdempotencyError(err, http.StatusConflict, "a request with this `Idempotency-Key` is already being processed")
+	}
+	if err != nil {
+		return nil, newInternalError(req, err)
+	}
+	metrics.PaymentCreated(payment.Currency, payment.PaymentScheme)
+
+	return res, nil
+}
+
+// Replay the stored response of an idempotency key into obj, as long as the fingerprint matches the one of the original
+// request.
+func replay(req api2go.Request, stored *model.IdempotencyKey, fingerprint string, obj jsonapi.MarshalIdentifier) (api2go.Responder, error) {
+	if stored.Fingerprint != fingerprint {
+		return nil, newIdempotencyError(
+			errors.New("idempotency key reused"),
+			http.StatusUnprocessableEntity,
+			"`Idempotency-Key` has already been used for a request with a different body",
+		)
+	}
+
+	if err := jsonapi.Unmarshal([]byte(stored.Response), obj); err != nil {
+		return nil, newInternalError(req, err)
+	}
+
+	return &api2go.Response{Res: obj, Code: stored.ResponseCode}, nil
+}
+
+// Create a fingerprint of an object, which is the sha256 hash of its json representation.
+func fingerprint(obj interface{}) (string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(data)
+
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Create a json:api error for the misuse of an idempotency key.
+func newIdempotencyError(err error, status int, detail string) api2go.HTTPError {
+	httpErr := api2go.NewHTTPError(err, "invalid idempotency key", status)
+	httpErr.Errors = []api2go.Error{
+		{
+			Status: strconv.Itoa(status),
+			Code:   "invalid_idempotency_key",
+			Title:  "invalid idempotency key",
+			Detail: detail,
+		},
+	}
+
+	return httpErr
+}
@@ -0,0 +1,106 @@
+package source
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/manyminds/api2go"
+	"github.com/satori/go.uuid"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPaymentSource_CreateIdempotent(t *testing.T) {
+	req := NewMockedRequest()
+	orgs := GetOrganisationFixtures(false)
+
+	newPayment := func(orgID uuid.UUID, reference string) *model.Payment {
+		return &model.Payment{
+			OrganisationID: orgID,
+			Amount:         money("10.00"),
+			Currency:       "GBP",
+			Reference:      reference,
+		}
+	}
+	withKey := func(org *model.Organisation, key string) api2go.Request {
+		keyReq := WithMockedCaller(*req, org)
+		keyReq.Header = http.Header{}
+		keyReq.Header.Set("Idempotency-Key", key)
+		return keyReq
+	}
+
+	type args struct {
+		obj interface{}
+		req api2go.Request
+	}
+	tests := []struct {
+		name     string
+		args     args
+		wantCode int
+		sameAs   string
+		wantErr  bool
+	}{
+		{"first", args{newPayment(orgs[0].ID, "A"), withKey(orgs[0], "key-a")}, http.StatusCreated, "", false},
+		{"retry", args{newPayment(orgs[0].ID, "A"), withKey(orgs[0], "key-a")}, http.StatusCreated, "first", false},
+		{"different-body", args{newPayment(orgs[0].ID, "B"), withKey(orgs[0], "key-a")}, 0, "", true},
+		{"other-organisation", args{newPayment(orgs[1].ID, "A"), withKey(orgs[1], "key-a")}, http.StatusCreated, "", false},
+		{"too-long", args{newPayment(orgs[0].ID, "A"), withKey(orgs[0], strings.Repeat("a", 256))}, 0, "", true},
+	}
+
+	ids := map[string]string{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := NewPaymentSource(NewMockedRepositories(tt.args.req))
+			got, err := src.Create(tt.args.obj, tt.args.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PaymentSource.Create() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got.StatusCode() != tt.wantCode {
+				t.Errorf("PaymentSource.Create() code = %v, want %v", got.StatusCode(), tt.wantCode)
+			}
+
+			id := got.Result().(*model.Payment).GetID()
+			ids[tt.name] = id
+			if tt.sameAs != "" && id != ids[tt.sameAs] {
+				t.Errorf("PaymentSource.Create() id = %v, want %v", id, ids[tt.sameAs])
+			}
+			for name, other := range ids {
+				if tt.sameAs == "" && name != tt.name && other == id {
+					t.Errorf("PaymentSource.Create() id = %v, want a new payment", id)
+				}
+			}
+		})
+	}
+
+	// Retries must not have created duplicate payments.
+	db := NewMockedDatabase(*req)
+	var count int
+	db.Model(&model.Payment{}).Where(&model.Payment{Reference: "A"}).Count(&count)
+	if count != 2 {
+		t.Errorf("payments created = %v, want %v", count, 2)
+	}
+}
+
+func TestCreateIdempotent_Rollback(t *testing.T) {
+	req := NewMockedRequest()
+	db := NewMockedDatabase(*req)
+
+	// Creating a payment with the id of an existing payment fails.
+	existing := GetPaymentFixtures(false)[0]
+	failing := &model.Payment{Model: model.Model{ID: existing.ID}, OrganisationID: existing.OrganisationID}
+	if _, err := createIdempotent(repository.NewGorm(db), "key-b", failing, *req); err == nil {
+		t.Errorf("createIdempotent() error = %v, wantErr %v", err, true)
+	}
+
+	// A failed request must not use up the key.
+	var count int
+	db.Model(&model.IdempotencyKey{}).Where(&model.IdempotencyKey{Key: "key-b"}).Count(&count)
+	if count != 0 {
+		t.Errorf("idempotency keys stored = %v, want %v", count, 0)
+	}
+}
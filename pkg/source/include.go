@@ -0,0 +1,39 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"github.com/manyminds/api2go"
+)
+
+// Name of the json:api include query parameter, e.g. `include=organisation`.
+const includeParameter = "include"
+
+// Includes lists the relationships of a resource that can be included in a compound document.
+type includes []string
+
+// Extract the relationships in the include query parameter of the request, which are loaded together with the
+// resources. Returns a 400 error for relationships that cannot be included.
+func (includes includes) extract(req api2go.Request) ([]string, error) {
+	requested := make([]string, 0, len(req.QueryParams[includeParameter]))
+	for _, name := range req.QueryParams[includeParameter] {
+		if !includes.has(name) {
+			err := errors.New("unknown include")
+			return nil, newQueryError(err, includeParameter, fmt.Sprintf("cannot include `%s`", name))
+		}
+		requested = append(requested, name)
+	}
+
+	return requested, nil
+}
+
+// Check whether the relationship can be included.
+func (includes includes) has(name string) bool {
+	for _, include := range includes {
+		if include == name {
+			return true
+		}
+	}
+
+	return false
+}
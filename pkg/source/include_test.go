@@ -0,0 +1,88 @@
+package source
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/jinzhu/gorm"
+	"github.com/manyminds/api2go"
+	"testing"
+)
+
+func TestPaymentSource_FindAllInclude(t *testing.T) {
+	req := NewMockedRequest()
+	orgs := GetOrganisationFixtures(false)
+	*req = WithMockedCaller(*req, orgs[0])
+	db := NewMockedDatabase(*req)
+
+	// Count the queries on organisations, to make sure they're loaded in a single query for all payments.
+	queries := 0
+	db.Callback().Query().After("gorm:query").Register("test:count_organisations", func(scope *gorm.Scope) {
+		if scope.TableName() == "organisations" {
+			queries++
+		}
+	})
+	defer db.Callback().Query().Remove("test:count_organisations")
+
+	included := func(params map[string][]string) api2go.Request {
+		includedReq := *req
+		includedReq.QueryParams = params
+		return includedReq
+	}
+
+	src := NewPaymentSource(repository.NewGorm(db))
+	got, err := src.FindAll(included(map[string][]string{"include": {"organisation"}}))
+	if err != nil {
+		t.Fatalf("PaymentSource.FindAll() error = %v", err)
+	}
+
+	want := map[string]string{}
+	for _, payment := range GetPaymentFixtures(false) {
+		for _, org := range orgs {
+			if payment.OrganisationID == org.ID {
+				want[payment.GetID()] = org.Name
+			}
+		}
+	}
+	if len(got.Result().([]*model.Payment)) != 2 {
+		t.Errorf("PaymentSource.FindAll() = %v, want the payments of the caller", got.Result())
+	}
+	for _, payment := range got.Result().([]*model.Payment) {
+		if payment.Organisation.Name != want[payment.GetID()] {
+			t.Errorf("PaymentSource.FindAll() organisation = %v, want %v", payment.Organisation.Name, want[payment.GetID()])
+		}
+	}
+	if queries != 1 {
+		t.Errorf("PaymentSource.FindAll() organisation queries = %v, want %v", queries, 1)
+	}
+
+	// Without include the organisations aren't loaded at all.
+	queries = 0
+	got, err = src.FindAll(included(map[string][]string{}))
+	if err != nil {
+		t.Fatalf("PaymentSource.FindAll() error = %v", err)
+	}
+	for _, payment := range got.Result().([]*model.Payment) {
+		if len(payment.GetReferencedStructs()) != 0 {
+			t.Errorf("PaymentSource.FindAll() included = %v, want none", payment.GetReferencedStructs())
+		}
+	}
+	if queries != 0 {
+		t.Errorf("PaymentSource.FindAll() organisation queries = %v, want %v", queries, 0)
+	}
+
+	payment := GetPaymentFixtures(false)[1]
+	one, err := src.FindOne(payment.GetID(), included(map[string][]string{"include": {"organisation"}}))
+	if err != nil {
+		t.Fatalf("PaymentSource.FindOne() error = %v", err)
+	}
+	if name := one.Result().(*model.Payment).Organisation.Name; name != orgs[0].Name {
+		t.Errorf("PaymentSource.FindOne() organisation = %v, want %v", name, orgs[0].Name)
+	}
+
+	if _, err := src.FindAll(included(map[string][]string{"include": {"beneficiary_party"}})); err == nil {
+		t.Errorf("PaymentSource.FindAll() error = %v, wantErr %v", err, true)
+	}
+	if _, err := src.FindOne(payment.GetID(), included(map[string][]string{"include": {"payments"}})); err == nil {
+		t.Errorf("PaymentSource.FindOne() error = %v, wantErr %v", err, true)
+	}
+}
@@ -2,45 +2,98 @@ package source
 
 import (
 	"errors"
+	"github.com/Shodske/payment-api/pkg/auth"
 	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
 	"github.com/manyminds/api2go"
+	"github.com/satori/go.uuid"
 	"net/http"
+	"strings"
 )
 
+// The attributes of organisations that can be requested with a sparse fieldset.
+var organisationFields = fieldset{
+	typ:        "organisations",
+	attributes: []string{"name"},
+}
+
+// The domain events of the changes to organisations.
+var organisationEvents = map[model.AuditOperation]model.EventType{
+	model.AuditCreate: model.EventOrganisationCreated,
+	model.AuditUpdate: model.EventOrganisationUpdated,
+	model.AuditDelete: model.EventOrganisationDeleted,
+}
+
+// The attributes organisations can be sorted on.
+var organisationSorts = sorts{
+	attributes: []string{"id", "created_at", "updated_at", "name"},
+	defaults:   []string{"created_at"},
+}
+
+// Query parameter api2go sets to the id of the organisation, when a relationship of an organisation is requested, e.g.
+// GET /organisations/:organisationID/payments.
+const organisationIDParameter = "organisationsID"
+
+// Path of the payments relationship of an organisation.
+const paymentsRelationshipPath = "/relationships/payments"
+
 // OrganisationSource struct that implements the different interfaces for handling CRUD actions on Organisation Models.
 type OrganisationSource struct {
+	repos repository.Repositories
+}
+
+// NewOrganisationSource creates an OrganisationSource using the given repositories, which are shared by all requests.
+func NewOrganisationSource(repos repository.Repositories) *OrganisationSource {
+	return &OrganisationSource{repos: repos}
 }
 
 // Create method required to implement `api2go.ResourceCreator`. Implementing this interface will enable the URI:
 // POST /organisations
 func (src *OrganisationSource) Create(obj interface{}, req api2go.Request) (api2go.Responder, error) {
-	org, ok := obj.(*model.Organisation)
-	if !ok {
-		return nil, api2go.NewHTTPError(errors.New("invalid type"), "invalid type", http.StatusConflict)
+	if _, err := authorize(req, "organisations", auth.OperationCreate); err != nil {
+		return nil, err
 	}
 
-	db, err := getDatabase(req)
-	if err != nil {
-		return nil, err
+	org, ok := obj.(*model.Organisation)
+	if !ok {
+		return nil, NewHTTPError(errors.New("invalid type"), "invalid type", http.StatusConflict)
 	}
 
-	if err := db.Create(org).Error; err != nil {
-		return nil, err
+	if err := CreateOrganisation(scoped(src.repos, req), req, org); err != nil {
+		return nil, newInternalError(req, err)
 	}
 
 	return &api2go.Response{Res: org, Code: http.StatusCreated}, nil
 }
 
+// CreateOrganisation creates the organisation, appending its creation to the audit log and adding its domain event to
+// the outbox in the same transaction. The actor of the request is recorded as the creator, also when the organisation
+// isn't created through the API.
+func CreateOrganisation(repos repository.Repositories, req api2go.Request, org *model.Organisation) error {
+	return repos.Transaction(func(tx repository.Repositories) error {
+		if err := tx.Organisations.Create(org); err != nil {
+			return err
+		}
+		return recordOrganisation(tx, req, model.AuditCreate, org, nil)
+	})
+}
+
 // FindAll method required to implement `api2go.FindAll`. Implementing this interface will enable the URI:
-// GET /organisations
+// GET /organisations?sort=<attributes>&fields[organisations]=<attributes>
 func (src *OrganisationSource) FindAll(req api2go.Request) (api2go.Responder, error) {
-	db, err := getDatabase(req)
+	if _, err := authorize(req, "organisations", auth.OperationRead); err != nil {
+		return nil, err
+	}
+
+	query, err := src.query(req)
 	if err != nil {
 		return nil, err
 	}
 
-	orgs := make([]*model.Organisation, 0)
-	db.Find(&orgs)
+	orgs, err := scoped(src.repos, req).Organisations.List(query)
+	if err != nil {
+		return nil, newInternalError(req, err)
+	}
 
 	return &api2go.Response{Res: orgs, Code: http.StatusOK}, nil
 }
@@ -48,68 +101,135 @@ func (src *OrganisationSource) FindAll(req api2go.Request) (api2go.Responder, er
 // PaginatedFindAll method required to implement `api2go.PaginatedFindAll`. Implementing this interface will enable the URI:
 // GET /organisations?page[number]=<number>&page[size]=<size>
 func (src *OrganisationSource) PaginatedFindAll(req api2go.Request) (uint, api2go.Responder, error) {
+	if _, err := authorize(req, "organisations", auth.OperationRead); err != nil {
+		return 0, nil, err
+	}
+
 	number, size, err := extractPaginationQuery(req)
 	if err != nil {
 		return 0, nil, err
 	}
 
-	db, err := getDatabase(req)
+	query, err := src.query(req)
 	if err != nil {
 		return 0, nil, err
 	}
 
-	var count uint
-	db.Model(&model.Organisation{}).Count(&count)
+	count, err := scoped(src.repos, req).Organisations.Count(query)
+	if err != nil {
+		return 0, nil, newInternalError(req, err)
+	}
 
-	orgs := make([]*model.Organisation, 0)
-	db.Limit(size).Offset((number - 1) * size).Find(&orgs)
+	query.Limit, query.Offset = int(size), int((number-1)*size)
+	orgs, err := scoped(src.repos, req).Organisations.List(query)
+	if err != nil {
+		return 0, nil, newInternalError(req, err)
+	}
 
 	return count, &api2go.Response{Res: orgs, Code: http.StatusOK}, nil
 }
 
 // FindOne method required to implement `api2go.ResourceGetter`. Implementing this interface will enable the URI:
 // GET /organisations/:organisationID
+// GET /organisations/:organisationID/relationships/payments
 func (src *OrganisationSource) FindOne(id string, req api2go.Request) (api2go.Responder, error) {
-	db, err := getDatabase(req)
+	if _, err := authorize(req, "organisations", auth.OperationRead); err != nil {
+		return nil, err
+	}
+
+	if _, err := organisationFields.extract(req); err != nil {
+		return nil, err
+	}
+
+	org, err := src.find(id, req)
 	if err != nil {
 		return nil, err
 	}
 
-	org := &model.Organisation{}
-	if err := org.SetID(id); err != nil {
-		return nil, api2go.NewHTTPError(err, "invalid id", http.StatusBadRequest)
+	res := &api2go.Response{Res: org, Code: http.StatusOK}
+	if req.PlainRequest != nil && strings.HasSuffix(req.PlainRequest.URL.Path, paymentsRelationshipPath) {
+		if res.Meta, err = src.loadPayments(org, req); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := db.Where(org).First(org).Error; err != nil {
-		return nil, api2go.NewHTTPError(err, "could not find organisations resource", http.StatusNotFound)
+	return res, nil
+}
+
+// Load the IDs of the payments of the organisation, using the same filters, sorting and pagination as the payments
+// themselves. Returns the meta of the relationship, which links to the other pages of the relationship when paginated.
+func (src *OrganisationSource) loadPayments(org *model.Organisation, req api2go.Request) (map[string]interface{}, error) {
+	paymentReq := req
+	paymentReq.QueryParams = map[string][]string{organisationIDParameter: {org.GetID()}}
+	for key, values := range req.QueryParams {
+		paymentReq.QueryParams[key] = values
 	}
+	// Only the IDs of the payments are needed, so none of their nested objects have to be loaded.
+	paymentReq.QueryParams[paymentFields.parameter()] = []string{}
 
-	return &api2go.Response{Res: org, Code: http.StatusOK}, nil
+	payments := NewPaymentSource(src.repos)
+	meta := map[string]interface{}{}
+
+	var res api2go.Responder
+	var err error
+	if _, ok := req.QueryParams[numberParameter]; ok {
+		var count uint
+		count, res, err = payments.PaginatedFindAll(paymentReq)
+		meta["total"] = count
+	} else {
+		res, err = payments.FindAll(paymentReq)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if linksRes, ok := res.(*cursorResponse); ok {
+		if links := linksRes.Links(req.PlainRequest, req.PlainRequest.URL.Path); len(links) > 0 {
+			meta["links"] = links
+		}
+	}
+
+	org.PaymentIDs = []uuid.UUID{}
+	for _, payment := range res.Result().([]*model.Payment) {
+		org.PaymentIDs = append(org.PaymentIDs, payment.ID)
+	}
+
+	return meta, nil
 }
 
 // Update method required to implement `api2go.ResourceUpdater`. Implementing this interface will enable the URI:
 // PATCH /organisations/:organisationID
 func (src *OrganisationSource) Update(obj interface{}, req api2go.Request) (api2go.Responder, error) {
+	if _, err := authorize(req, "organisations", auth.OperationUpdate); err != nil {
+		return nil, err
+	}
+
 	orgData, ok := obj.(*model.Organisation)
 	if !ok {
-		return nil, api2go.NewHTTPError(errors.New("invalid type"), "invalid type", http.StatusConflict)
+		return nil, NewHTTPError(errors.New("invalid type"), "invalid type", http.StatusConflict)
 	}
 
 	if orgData.GetID() == "" {
-		return nil, api2go.NewHTTPError(errors.New("missing id"), "missing id", http.StatusConflict)
+		return nil, NewHTTPError(errors.New("missing id"), "missing id", http.StatusConflict)
 	}
 
-	db, err := getDatabase(req)
+	org, err := src.find(orgData.GetID(), req)
 	if err != nil {
 		return nil, err
 	}
 
-	org := &model.Organisation{Model: model.Model{ID: orgData.ID}}
-	if err := db.Where(org).First(org).Error; err != nil {
-		return nil, err
+	before, err := snapshot(org)
+	if err != nil {
+		return nil, newInternalError(req, err)
 	}
-	if err := db.Model(org).Update(orgData).Error; err != nil {
-		return nil, err
+	err = scoped(src.repos, req).Transaction(func(tx repository.Repositories) error {
+		if err := tx.Organisations.Update(org, orgData); err != nil {
+			return err
+		}
+		return recordOrganisation(tx, req, model.AuditUpdate, org, before)
+	})
+	if err != nil {
+		return nil, newInternalError(req, err)
 	}
 
 	return &api2go.Response{Res: org, Code: http.StatusOK}, nil
@@ -118,27 +238,89 @@ func (src *OrganisationSource) Update(obj interface{}, req api2go.Request) (api2
 // Delete method required to implement `api2go.ResourceDeleter`. Implementing this interface will enable the URI:
 // DELETE /organisations/:organisationID
 func (src *OrganisationSource) Delete(id string, req api2go.Request) (api2go.Responder, error) {
+	if _, err := authorize(req, "organisations", auth.OperationDelete); err != nil {
+		return nil, err
+	}
+
 	if id == "" {
-		return nil, api2go.NewHTTPError(errors.New("invalid id"), "invalid id", http.StatusBadRequest)
+		return nil, NewHTTPError(errors.New("invalid id"), "invalid id", http.StatusBadRequest)
 	}
 
-	db, err := getDatabase(req)
+	org, err := src.find(id, req)
 	if err != nil {
 		return nil, err
 	}
 
-	org := &model.Organisation{}
-	if err := org.SetID(id); err != nil {
-		return nil, api2go.NewHTTPError(err, "invalid id", http.StatusBadRequest)
+	before, err := snapshot(org)
+	if err != nil {
+		return nil, newInternalError(req, err)
+	}
+	err = scoped(src.repos, req).Transaction(func(tx repository.Repositories) error {
+		if err := tx.Organisations.Delete(org); err != nil {
+			return err
+		}
+		return recordOrganisation(tx, req, model.AuditDelete, org, before)
+	})
+	if err != nil {
+		return nil, newInternalError(req, err)
 	}
 
-	if err := db.Where(org).First(org).Error; err != nil {
-		return nil, api2go.NewHTTPError(err, "could not find organisations resource", http.StatusNotFound)
+	return &api2go.Response{Code: http.StatusNoContent}, nil
+}
+
+// Record the change of the organisation, see `recordPayment`.
+func recordOrganisation(tx repository.Repositories, req api2go.Request, op model.AuditOperation, org *model.Organisation, before []byte) error {
+	var after []byte
+	if op != model.AuditDelete {
+		var err error
+		if after, err = snapshot(org); err != nil {
+			return err
+		}
+	}
+
+	if err := appendAuditEvent(tx.AuditEvents, req, op, "organisations", org.ID, org.ID, before, after); err != nil {
+		return err
 	}
 
-	if err := db.Delete(org).Error; err != nil {
+	return addOutboxEvent(tx.Outbox, organisationEvents[op], "organisations", org.ID, org.ID, before, after)
+}
+
+// Find the organisation with the id. Returns a 404 error when it doesn't exist, or when it isn't the organisation of
+// the caller.
+func (src *OrganisationSource) find(id string, req api2go.Request) (*model.Organisation, error) {
+	orgID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, NewHTTPError(err, "invalid id", http.StatusBadRequest)
+	}
+	if _, err := callerOrganisation(id, req); err != nil {
 		return nil, err
 	}
 
-	return &api2go.Response{Code: http.StatusNoContent}, nil
+	org, err := scoped(src.repos, req).Organisations.Find(orgID)
+	if err != nil {
+		return nil, newNotFoundError(req, err, "organisations")
+	}
+
+	return org, nil
+}
+
+// Build the query of the organisations requested, with the sort order and sparse fieldset of the request. Callers can
+// only see their own organisation.
+func (src *OrganisationSource) query(req api2go.Request) (repository.Query, error) {
+	query := repository.Query{}
+
+	org, err := caller(req)
+	if err != nil {
+		return query, err
+	}
+	query.Filters = []repository.Filter{{Field: "id", Operator: operatorEq, Values: []interface{}{org.ID}}}
+
+	if query.Fields, err = organisationFields.extract(req); err != nil {
+		return query, err
+	}
+	if query.Order, err = organisationSorts.extract(req); err != nil {
+		return query, err
+	}
+
+	return query, nil
 }
@@ -5,13 +5,16 @@ import (
 	"github.com/manyminds/api2go"
 	"github.com/satori/go.uuid"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"testing"
 	"time"
 )
 
 func TestOrganisationSource_Create(t *testing.T) {
 	req := NewMockedRequest()
+	*req = WithMockedCaller(*req, GetOrganisationFixtures(false)[0])
 
 	baseOrg := &model.Organisation{
 		Name: "Base Organisation",
@@ -49,7 +52,7 @@ func TestOrganisationSource_Create(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			src := &OrganisationSource{}
+			src := NewOrganisationSource(NewMockedRepositories(tt.args.req))
 			got, err := src.Create(tt.args.obj, tt.args.req)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("OrganisationSource.Create() error = %v, wantErr %v", err, tt.wantErr)
@@ -64,10 +67,13 @@ func TestOrganisationSource_Create(t *testing.T) {
 
 func TestOrganisationSource_FindAll(t *testing.T) {
 	req := NewMockedRequest()
+	orgs := GetOrganisationFixtures(false)
+	*req = WithMockedCaller(*req, orgs[0])
 
+	// Callers only find their own organisation.
 	baseRes := &api2go.Response{
 		Code: http.StatusOK,
-		Res:  GetOrganisationFixtures(false),
+		Res:  orgs[0:1],
 	}
 
 	type args struct {
@@ -84,7 +90,7 @@ func TestOrganisationSource_FindAll(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			src := &OrganisationSource{}
+			src := NewOrganisationSource(NewMockedRepositories(tt.args.req))
 			got, err := src.FindAll(tt.args.req)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("OrganisationSource.FindAll() error = %v, wantErr %v", err, tt.wantErr)
@@ -98,16 +104,18 @@ func TestOrganisationSource_FindAll(t *testing.T) {
 }
 
 func TestOrganisationSource_PaginatedFindAll(t *testing.T) {
+	orgs := GetOrganisationFixtures(false)
 	req := NewMockedRequest()
-	firstReq := NewMockedRequest()
+	*req = WithMockedCaller(*req, orgs[0])
+	firstReq := *req
 	firstReq.QueryParams = map[string][]string{"page[number]": {"1"}, "page[size]": {"1"}}
-	secondReq := NewMockedRequest()
+	secondReq := *req
 	secondReq.QueryParams = map[string][]string{"page[number]": {"2"}, "page[size]": {"1"}}
-	oorReq := NewMockedRequest()
+	oorReq := *req
 	oorReq.QueryParams = map[string][]string{"page[number]": {"100"}, "page[size]": {"100"}}
 
-	orgs := GetOrganisationFixtures(false)
-	count := len(orgs)
+	// Callers only find their own organisation.
+	count := 1
 
 	firstRes := &api2go.Response{
 		Code: http.StatusOK,
@@ -115,7 +123,7 @@ func TestOrganisationSource_PaginatedFindAll(t *testing.T) {
 	}
 	secondRes := &api2go.Response{
 		Code: http.StatusOK,
-		Res:  orgs[1:2],
+		Res:  make([]*model.Organisation, 0),
 	}
 	emptyRes := &api2go.Response{
 		Code: http.StatusOK,
@@ -133,14 +141,14 @@ func TestOrganisationSource_PaginatedFindAll(t *testing.T) {
 		wantResponse   api2go.Responder
 		wantErr        bool
 	}{
-		{"first-page", &OrganisationSource{}, args{*firstReq}, uint(count), firstRes, false},
-		{"second-page", &OrganisationSource{}, args{*secondReq}, uint(count), secondRes, false},
-		{"out-of-range", &OrganisationSource{}, args{*oorReq}, uint(count), emptyRes, false},
+		{"first-page", &OrganisationSource{}, args{firstReq}, uint(count), firstRes, false},
+		{"second-page", &OrganisationSource{}, args{secondReq}, uint(count), secondRes, false},
+		{"out-of-range", &OrganisationSource{}, args{oorReq}, uint(count), emptyRes, false},
 		{"not-paginated", &OrganisationSource{}, args{*req}, 0, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			src := &OrganisationSource{}
+			src := NewOrganisationSource(NewMockedRepositories(tt.args.req))
 			gotTotalCount, gotResponse, err := src.PaginatedFindAll(tt.args.req)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("OrganisationSource.PaginatedFindAll() error = %v, wantErr %v", err, tt.wantErr)
@@ -174,7 +182,9 @@ func TestOrganisationSource_FindOne(t *testing.T) {
 		wantErr bool
 	}
 	tests := []testData{
-		{"deleted", &OrganisationSource{}, args{deletedOrgs[0].GetID(), *req}, nil, true},
+		{"deleted", &OrganisationSource{}, args{deletedOrgs[0].GetID(), WithMockedCaller(*req, deletedOrgs[0])}, nil, true},
+		{"other-organisation", &OrganisationSource{}, args{orgs[1].GetID(), WithMockedCaller(*req, orgs[0])}, nil, true},
+		{"no-caller", &OrganisationSource{}, args{orgs[0].GetID(), *req}, nil, true},
 	}
 
 	for i, org := range orgs {
@@ -184,13 +194,13 @@ func TestOrganisationSource_FindOne(t *testing.T) {
 		}
 		tests = append(
 			tests,
-			testData{"organisation-" + string(i), &OrganisationSource{}, args{org.GetID(), *req}, res, false},
+			testData{"organisation-" + strconv.Itoa(i), &OrganisationSource{}, args{org.GetID(), WithMockedCaller(*req, org)}, res, false},
 		)
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			src := &OrganisationSource{}
+			src := NewOrganisationSource(NewMockedRepositories(tt.args.req))
 			got, err := src.FindOne(tt.args.ID, tt.args.req)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("OrganisationSource.FindOne() error = %v, wantErr %v", err, tt.wantErr)
@@ -206,7 +216,9 @@ func TestOrganisationSource_FindOne(t *testing.T) {
 func TestOrganisationSource_Update(t *testing.T) {
 	req := NewMockedRequest()
 	org := GetOrganisationFixtures(false)[0]
+	otherOrg := GetOrganisationFixtures(false)[1]
 	deletedOrg := GetOrganisationFixtures(true)[0]
+	*req = WithMockedCaller(*req, org)
 
 	updateData := &model.Organisation{
 		Model: model.Model{ID: org.ID},
@@ -229,6 +241,11 @@ func TestOrganisationSource_Update(t *testing.T) {
 		Name:  "Updated Organisation",
 	}
 
+	otherUpdateData := &model.Organisation{
+		Model: model.Model{ID: otherOrg.ID},
+		Name:  "Updated Organisation",
+	}
+
 	type args struct {
 		obj interface{}
 		req api2go.Request
@@ -243,10 +260,11 @@ func TestOrganisationSource_Update(t *testing.T) {
 		{"base", &OrganisationSource{}, args{updateData, *req}, res, false},
 		{"no-id", &OrganisationSource{}, args{noIDData, *req}, nil, true},
 		{"deleted", &OrganisationSource{}, args{delUpdateData, *req}, nil, true},
+		{"other-organisation", &OrganisationSource{}, args{otherUpdateData, *req}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			src := &OrganisationSource{}
+			src := NewOrganisationSource(NewMockedRepositories(tt.args.req))
 			got, err := src.Update(tt.args.obj, tt.args.req)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("OrganisationSource.Update() error = %v, wantErr %v", err, tt.wantErr)
@@ -293,8 +311,9 @@ func TestOrganisationSource_Delete(t *testing.T) {
 	}
 
 	tests := []testData{
-		{"invalid", &OrganisationSource{}, args{"not-a-uuid", *req}, nil, true},
-		{"deleted", &OrganisationSource{}, args{deletedOrgs[0].GetID(), *req}, nil, true},
+		{"invalid", &OrganisationSource{}, args{"not-a-uuid", WithMockedCaller(*req, orgs[0])}, nil, true},
+		{"deleted", &OrganisationSource{}, args{deletedOrgs[0].GetID(), WithMockedCaller(*req, deletedOrgs[0])}, nil, true},
+		{"other-organisation", &OrganisationSource{}, args{orgs[1].GetID(), WithMockedCaller(*req, orgs[0])}, nil, true},
 	}
 
 	for i, org := range orgs {
@@ -303,13 +322,13 @@ func TestOrganisationSource_Delete(t *testing.T) {
 		}
 		tests = append(
 			tests,
-			testData{"organisation-" + string(i), &OrganisationSource{}, args{org.GetID(), *req}, res, false},
+			testData{"organisation-" + strconv.Itoa(i), &OrganisationSource{}, args{org.GetID(), WithMockedCaller(*req, org)}, res, false},
 		)
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			src := &OrganisationSource{}
+			src := NewOrganisationSource(NewMockedRepositories(tt.args.req))
 			got, err := src.Delete(tt.args.id, tt.args.req)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("OrganisationSource.Delete() error = %v, wantErr %v", err, tt.wantErr)
@@ -321,3 +340,57 @@ func TestOrganisationSource_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestOrganisationSource_FindOnePayments(t *testing.T) {
+	req := NewMockedRequest()
+	org := GetOrganisationFixtures(false)[0]
+	*req = WithMockedCaller(*req, org)
+	payments := GetPaymentFixtures(false)
+
+	relationship := func(query string) api2go.Request {
+		relationshipReq := *req
+		relationshipReq.PlainRequest = httptest.NewRequest("GET", "/v0/organisations/"+org.GetID()+"/relationships/payments?"+query, nil)
+		relationshipReq.QueryParams = map[string][]string{}
+		for key, values := range relationshipReq.PlainRequest.URL.Query() {
+			relationshipReq.QueryParams[key] = values
+		}
+		return relationshipReq
+	}
+
+	tests := []struct {
+		name     string
+		req      api2go.Request
+		wantIDs  []uuid.UUID
+		wantMeta []string
+		wantErr  bool
+	}{
+		{"organisation", *req, nil, nil, false},
+		{"relationship", relationship(""), []uuid.UUID{payments[0].ID, payments[1].ID}, nil, false},
+		{"filtered", relationship("filter[currency]=USD"), []uuid.UUID{}, nil, false},
+		{"cursor", relationship("page[size]=1"), []uuid.UUID{payments[0].ID}, []string{"links"}, false},
+		{"number", relationship("page[number]=2&page[size]=1"), []uuid.UUID{payments[1].ID}, []string{"total"}, false},
+		{"invalid-filter", relationship("filter[unknown]=1"), nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := NewOrganisationSource(NewMockedRepositories(tt.req))
+			got, err := src.FindOne(org.GetID(), tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OrganisationSource.FindOne() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if ids := got.Result().(*model.Organisation).PaymentIDs; !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("OrganisationSource.FindOne() payment ids = %v, want %v", ids, tt.wantIDs)
+			}
+			for _, key := range tt.wantMeta {
+				if _, ok := got.Metadata()[key]; !ok {
+					t.Errorf("OrganisationSource.FindOne() meta = %v, want %v", got.Metadata(), key)
+				}
+			}
+		})
+	}
+}
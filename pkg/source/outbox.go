@@ -0,0 +1,39 @@
+package source
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/satori/go.uuid"
+)
+
+// Add a domain event of the type to the outbox, for the change of the resource of the type with the id, which belongs
+// to the organisation. The event has the snapshot of the resource after the change, or before it when it was deleted,
+// and the attributes that changed when it was updated. Must be called in the same transaction as the change itself, so
+// a change is never stored without its event.
+func addOutboxEvent(
+	outbox repository.OutboxRepository,
+	eventType model.EventType,
+	typ string,
+	id, orgID uuid.UUID,
+	before, after []byte,
+) error {
+	event := &model.OutboxEvent{
+		Type:           eventType,
+		OrganisationID: orgID,
+		ResourceType:   typ,
+		ResourceID:     id,
+		Data:           model.EventData(after),
+	}
+	switch {
+	case after == nil:
+		event.Data = model.EventData(before)
+	case before != nil:
+		changes, err := model.DiffJSON(before, after)
+		if err != nil {
+			return err
+		}
+		event.Changes = changes
+	}
+
+	return outbox.Add(event)
+}
@@ -0,0 +1,82 @@
+package source
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+	"strings"
+	"testing"
+)
+
+// Every change to a payment or organisation adds its domain event to the outbox, in the order of the changes.
+func TestSources_OutboxEvents(t *testing.T) {
+	req := NewMockedRequest()
+	payment := GetPaymentFixtures(false)[0]
+	callerReq := withPaymentCaller(*req, payment)
+	repos := NewMockedRepositories(*req)
+	payments := NewPaymentSource(repos)
+	orgs := NewOrganisationSource(repos)
+	org := GetPaymentOrganisationFixture(payment)
+
+	if _, err := payments.Update(&model.Payment{Model: model.Model{ID: payment.ID}, Reference: "Changed"}, callerReq); err != nil {
+		t.Fatalf("PaymentSource.Update() error = %v", err)
+	}
+	if _, err := payments.Transition(payment.GetID(), model.StatusSubmitted, callerReq); err != nil {
+		t.Fatalf("PaymentSource.Transition() error = %v", err)
+	}
+	// A status change with PATCH is a transition too.
+	if _, err := payments.Update(&model.Payment{Model: model.Model{ID: payment.ID}, Status: model.StatusAccepted}, callerReq); err != nil {
+		t.Fatalf("PaymentSource.Update() error = %v", err)
+	}
+	if _, err := payments.Delete(payment.GetID(), callerReq); err != nil {
+		t.Fatalf("PaymentSource.Delete() error = %v", err)
+	}
+	created := &model.Payment{Amount: money("1.00"), Currency: "EUR"}
+	if _, err := payments.Create(created, callerReq); err != nil {
+		t.Fatalf("PaymentSource.Create() error = %v", err)
+	}
+	// Failed changes don't add any events.
+	if _, err := payments.Transition(created.GetID(), model.StatusSettled, callerReq); err == nil {
+		t.Fatalf("PaymentSource.Transition() error = %v, wantErr %v", err, true)
+	}
+	if _, err := orgs.Update(&model.Organisation{Model: model.Model{ID: org.ID}, Name: "Renamed"}, callerReq); err != nil {
+		t.Fatalf("OrganisationSource.Update() error = %v", err)
+	}
+
+	events, err := repos.Outbox.Pending(100)
+	if err != nil {
+		t.Fatalf("OutboxRepository.Pending() error = %v", err)
+	}
+
+	want := []struct {
+		typ     model.EventType
+		id      string
+		data    string
+		changes []string
+	}{
+		{model.EventPaymentUpdated, payment.GetID(), `"reference":"Changed"`, []string{"reference"}},
+		{model.EventPaymentStatusChanged, payment.GetID(), `"status":"submitted"`, []string{"status"}},
+		{model.EventPaymentStatusChanged, payment.GetID(), `"status":"accepted"`, []string{"status"}},
+		{model.EventPaymentDeleted, payment.GetID(), `"status":"accepted"`, nil},
+		{model.EventPaymentCreated, created.GetID(), `"currency":"EUR"`, nil},
+		{model.EventOrganisationUpdated, org.GetID(), `"name":"Renamed"`, []string{"name"}},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("OutboxRepository.Pending() = %d events, want %d", len(events), len(want))
+	}
+	for i, event := range events {
+		if event.Type != want[i].typ || event.ResourceID.String() != want[i].id ||
+			event.OrganisationID.String() != org.GetID() {
+			t.Errorf("OutboxRepository.Pending()[%d] = %+v, want %v of %v", i, event, want[i].typ, want[i].id)
+		}
+		if !strings.Contains(string(event.Data), want[i].data) {
+			t.Errorf("OutboxRepository.Pending()[%d] data = %s, want %s", i, event.Data, want[i].data)
+		}
+		if len(event.Changes) != len(want[i].changes) {
+			t.Errorf("OutboxRepository.Pending()[%d] = %d changes, want %v", i, len(event.Changes), want[i].changes)
+		}
+		for _, attribute := range want[i].changes {
+			if _, ok := event.Changes[attribute]; !ok {
+				t.Errorf("OutboxRepository.Pending()[%d] changes = %v, want %s", i, event.Changes, attribute)
+			}
+		}
+	}
+}
@@ -2,89 +2,258 @@ package source
 
 import (
 	"errors"
+	"github.com/Shodske/payment-api/pkg/auth"
+	"github.com/Shodske/payment-api/pkg/metrics"
 	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/Shodske/payment-api/pkg/validation"
 	"github.com/manyminds/api2go"
+	"github.com/satori/go.uuid"
 	"net/http"
+	"strconv"
 )
 
+// The custom actions available on payments, mapped to the status the payment transitions to.
+var paymentActions = map[string]model.PaymentStatus{
+	"submit": model.StatusSubmitted,
+	"accept": model.StatusAccepted,
+	"settle": model.StatusSettled,
+	"reject": model.StatusRejected,
+	"fail":   model.StatusFailed,
+	"cancel": model.StatusCancelled,
+}
+
+// The domain events of the changes to payments.
+var paymentEvents = map[model.AuditOperation]model.EventType{
+	model.AuditCreate:     model.EventPaymentCreated,
+	model.AuditUpdate:     model.EventPaymentUpdated,
+	model.AuditTransition: model.EventPaymentStatusChanged,
+	model.AuditDelete:     model.EventPaymentDeleted,
+}
+
+// The filters available on payments, see `newPaymentFilters`.
+var paymentFilters = newPaymentFilters()
+
+// The relationships that can be included with payments.
+var paymentIncludes = includes{"organisation"}
+
+// The attributes of payments that can be requested with a sparse fieldset. Nested objects are only loaded when
+// requested.
+var paymentFields = fieldset{
+	typ: "payments",
+	attributes: []string{
+		"status",
+		"amount",
+		"currency",
+		"end_to_end_reference",
+		"numeric_reference",
+		"payment_id",
+		"payment_purpose",
+		"payment_scheme",
+		"payment_type",
+		"processing_date",
+		"reference",
+		"scheme_payment_sub_type",
+		"scheme_payment_type",
+		"beneficiary_party",
+		"debtor_party",
+		"sponsor_party",
+		"charges_information",
+		"fx",
+	},
+}
+
+// The attributes payments can be sorted on.
+var paymentSorts = sorts{
+	attributes: []string{"id", "created_at", "updated_at", "amount", "currency", "processing_date", "status"},
+	defaults:   []string{"created_at"},
+}
+
 // PaymentSource struct that implements the different interfaces for handling CRUD actions on Payment Models.
 type PaymentSource struct {
+	repos repository.Repositories
+}
+
+// NewPaymentSource creates a PaymentSource using the given repositories, which are shared by all requests.
+func NewPaymentSource(repos repository.Repositories) *PaymentSource {
+	return &PaymentSource{repos: repos}
 }
 
 // Create method required to implement `api2go.ResourceCreator`. Implementing this interface will enable the URI:
 // POST /payments
 func (src *PaymentSource) Create(obj interface{}, req api2go.Request) (api2go.Responder, error) {
+	org, err := authorize(req, "payments", auth.OperationCreate)
+	if err != nil {
+		return nil, err
+	}
+
 	payment, ok := obj.(*model.Payment)
 	if !ok {
-		return nil, api2go.NewHTTPError(errors.New("invalid type"), "invalid type", http.StatusConflict)
+		return nil, NewHTTPError(errors.New("invalid type"), "invalid type", http.StatusConflict)
 	}
 
-	db, err := getDatabase(req)
-	if err != nil {
-		return nil, err
+	// Every payment starts out as pending, other statuses can only be reached through transitions.
+	if payment.Status == "" {
+		payment.Status = model.StatusPending
+	}
+	if payment.Status != model.StatusPending {
+		err := errors.New("payments can only be created with status `pending`")
+		return nil, newStatusError(err, http.StatusUnprocessableEntity)
 	}
 
-	if err := db.Create(payment).Error; err != nil {
-		return nil, err
+	v := validation.New()
+	payment.Validate(v)
+	if errs := v.Errors(); errs != nil {
+		return nil, newValidationError(errs, "payments")
+	}
+
+	// Payments belong to the organisation of the caller, which doesn't have to be sent along.
+	if uuid.Equal(payment.OrganisationID, uuid.Nil) {
+		payment.OrganisationID = org.ID
 	}
+	if !uuid.Equal(payment.OrganisationID, org.ID) {
+		return nil, newNotFoundError(req, repository.ErrNotFound, "organisations")
+	}
+
+	// Retries of requests with an idempotency key must not create duplicate payments.
+	if key := req.Header.Get(idempotencyHeader); key != "" {
+		return createIdempotent(scoped(src.repos, req), key, payment, req)
+	}
+
+	err = scoped(src.repos, req).Transaction(func(tx repository.Repositories) error {
+		if err := tx.Payments.Create(payment); err != nil {
+			return err
+		}
+		return recordPayment(tx, req, model.AuditCreate, payment, nil)
+	})
+	if err != nil {
+		return nil, newInternalError(req, err)
+	}
+	metrics.PaymentCreated(payment.Currency, payment.PaymentScheme)
 
 	return &api2go.Response{Res: payment, Code: http.StatusCreated}, nil
 }
 
 // FindAll method required to implement `api2go.FindAll`. Implementing this interface will enable the URI:
-// GET /payments
+// GET /payments?filter[<name>][<operator>]=<value>&sort=<attributes>&fields[payments]=<attributes>
+// GET /payments?page[size]=<size>&page[cursor]=<cursor>
+// GET /organisations/:organisationID/payments
 func (src *PaymentSource) FindAll(req api2go.Request) (api2go.Responder, error) {
-	db, err := getDatabase(req)
+	if _, err := authorize(req, "payments", auth.OperationRead); err != nil {
+		return nil, err
+	}
+
+	page, err := extractCursorQuery(req, func(id string) (*model.Model, error) {
+		payment, err := src.find(id, repository.Load{Fields: []string{}}, req)
+		if err != nil {
+			return nil, err
+		}
+		return &payment.Model, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := src.query(req)
 	if err != nil {
 		return nil, err
 	}
 
-	payments := make([]*model.Payment, 0)
-	if err := db.Find(&payments).Error; err != nil {
+	if page != nil {
+		return src.findPage(query, page, req)
+	}
+
+	if query.Order, err = paymentSorts.extract(req); err != nil {
 		return nil, err
 	}
 
+	payments, err := scoped(src.repos, req).Payments.List(query)
+	if err != nil {
+		return nil, newInternalError(req, err)
+	}
+	setPaymentFields(payments, query.Fields)
+
 	return &api2go.Response{Res: payments, Code: http.StatusOK}, nil
 }
 
+// Find a cursor paginated page of payments. Cursors are positions in the default order, so other orders are rejected.
+func (src *PaymentSource) findPage(query repository.Query, page *cursorPage, req api2go.Request) (api2go.Responder, error) {
+	if _, ok := req.QueryParams[sortParameter]; ok {
+		err := errors.New("sorted cursor pagination")
+		return nil, newQueryError(err, sortParameter, "cannot be combined with cursor pagination")
+	}
+
+	payments, err := scoped(src.repos, req).Payments.List(page.apply(query))
+	if err != nil {
+		return nil, newInternalError(req, err)
+	}
+	setPaymentFields(payments, query.Fields)
+
+	models := make([]model.Model, len(payments))
+	for i, payment := range payments {
+		models[i] = payment.Model
+	}
+
+	return page.respond(payments, models), nil
+}
+
 // PaginatedFindAll method required to implement `api2go.PaginatedFindAll`. Implementing this interface will enable the URI:
 // GET /payments?page[number]=<number>&page[size]=<size>
+// GET /organisations/:organisationID/payments?page[number]=<number>&page[size]=<size>
 func (src *PaymentSource) PaginatedFindAll(req api2go.Request) (uint, api2go.Responder, error) {
+	if _, err := authorize(req, "payments", auth.OperationRead); err != nil {
+		return 0, nil, err
+	}
+
 	number, size, err := extractPaginationQuery(req)
 	if err != nil {
 		return 0, nil, err
 	}
 
-	db, err := getDatabase(req)
+	query, err := src.query(req)
 	if err != nil {
 		return 0, nil, err
 	}
+	if query.Order, err = paymentSorts.extract(req); err != nil {
+		return 0, nil, err
+	}
 
-	var count uint
-	db.Model(&model.Payment{}).Count(&count)
+	count, err := scoped(src.repos, req).Payments.Count(query)
+	if err != nil {
+		return 0, nil, newInternalError(req, err)
+	}
 
-	payments := make([]*model.Payment, 0)
-	db.Limit(size).Offset((number - 1) * size).Find(&payments)
+	query.Limit, query.Offset = int(size), int((number-1)*size)
+	payments, err := scoped(src.repos, req).Payments.List(query)
+	if err != nil {
+		return 0, nil, newInternalError(req, err)
+	}
+	setPaymentFields(payments, query.Fields)
 
 	return count, &api2go.Response{Res: payments, Code: http.StatusOK}, nil
 }
 
 // FindOne method required to implement `api2go.ResourceGetter`. Implementing this interface will enable the URI:
-// GET /payments/:paymentID
+// GET /payments/:paymentID?include=organisation&fields[payments]=<attributes>
 func (src *PaymentSource) FindOne(id string, req api2go.Request) (api2go.Responder, error) {
-	db, err := getDatabase(req)
-	if err != nil {
+	if _, err := authorize(req, "payments", auth.OperationRead); err != nil {
 		return nil, err
 	}
 
-	payment := &model.Payment{}
-	if err := payment.SetID(id); err != nil {
-		return nil, api2go.NewHTTPError(err, "invalid id", http.StatusBadRequest)
+	include, err := paymentIncludes.extract(req)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := extractPaymentFields(req)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := db.Where(payment).First(payment).Error; err != nil {
-		return nil, api2go.NewHTTPError(err, "could not find payments resource", http.StatusNotFound)
+	payment, err := src.find(id, repository.Load{Fields: fields, Include: include}, req)
+	if err != nil {
+		return nil, err
 	}
+	payment.SetFields(fields)
 
 	return &api2go.Response{Res: payment, Code: http.StatusOK}, nil
 }
@@ -92,26 +261,68 @@ func (src *PaymentSource) FindOne(id string, req api2go.Request) (api2go.Respond
 // Update method required to implement `api2go.ResourceUpdater`. Implementing this interface will enable the URI:
 // PATCH /payments/:paymentID
 func (src *PaymentSource) Update(obj interface{}, req api2go.Request) (api2go.Responder, error) {
+	if _, err := authorize(req, "payments", auth.OperationUpdate); err != nil {
+		return nil, err
+	}
+
 	paymentData, ok := obj.(*model.Payment)
 	if !ok {
-		return nil, api2go.NewHTTPError(errors.New("invalid type"), "invalid type", http.StatusConflict)
+		return nil, NewHTTPError(errors.New("invalid type"), "invalid type", http.StatusConflict)
 	}
 
 	if paymentData.GetID() == "" {
-		return nil, api2go.NewHTTPError(errors.New("missing id"), "missing id", http.StatusConflict)
+		return nil, NewHTTPError(errors.New("missing id"), "missing id", http.StatusConflict)
 	}
 
-	db, err := getDatabase(req)
+	v := validation.NewPartial()
+	paymentData.Validate(v)
+	if errs := v.Errors(); errs != nil {
+		return nil, newValidationError(errs, "payments")
+	}
+
+	payment, err := src.find(paymentData.GetID(), repository.Load{}, req)
 	if err != nil {
 		return nil, err
 	}
+	// Payments can't be moved to another organisation.
+	if !uuid.Equal(paymentData.OrganisationID, uuid.Nil) && !uuid.Equal(paymentData.OrganisationID, payment.OrganisationID) {
+		return nil, newNotFoundError(req, repository.ErrNotFound, "organisations")
+	}
 
-	payment := &model.Payment{Model: model.Model{ID: paymentData.ID}}
-	if err := db.Where(payment).First(payment).Error; err != nil {
-		return nil, err
+	// Status changes must abide by the state machine of the payment, like the actions of the payment. The status is
+	// only updated when it hasn't been changed concurrently, and the change is recorded as a transition.
+	from := payment.Status
+	status := paymentData.Status
+	paymentData.Status = ""
+	op := model.AuditUpdate
+	if status != "" && status != from {
+		if !from.CanTransitionTo(status) {
+			return nil, newStatusError(&model.TransitionError{From: from, To: status}, http.StatusConflict)
+		}
+		op = model.AuditTransition
 	}
-	if err := db.Model(payment).Update(paymentData).Error; err != nil {
-		return nil, err
+
+	before, err := snapshot(payment)
+	if err != nil {
+		return nil, newInternalError(req, err)
+	}
+	err = scoped(src.repos, req).Transaction(func(tx repository.Repositories) error {
+		if err := tx.Payments.Update(payment, paymentData); err != nil {
+			return err
+		}
+		if op == model.AuditTransition {
+			payment.Status = status
+			if err := tx.Payments.UpdateStatus(payment, from); err != nil {
+				return err
+			}
+		}
+		return recordPayment(tx, req, op, payment, before)
+	})
+	if err == repository.ErrConflict {
+		return nil, newStatusError(&model.TransitionError{From: from, To: status}, http.StatusConflict)
+	}
+	if err != nil {
+		return nil, newInternalError(req, err)
 	}
 
 	return &api2go.Response{Res: payment, Code: http.StatusOK}, nil
@@ -120,27 +331,270 @@ func (src *PaymentSource) Update(obj interface{}, req api2go.Request) (api2go.Re
 // Delete method required to implement `api2go.ResourceDeleter`. Implementing this interface will enable the URI:
 // DELETE /payments/:paymentID
 func (src *PaymentSource) Delete(id string, req api2go.Request) (api2go.Responder, error) {
+	if _, err := authorize(req, "payments", auth.OperationDelete); err != nil {
+		return nil, err
+	}
+
 	if id == "" {
-		return nil, api2go.NewHTTPError(errors.New("invalid id"), "invalid id", http.StatusBadRequest)
+		return nil, NewHTTPError(errors.New("invalid id"), "invalid id", http.StatusBadRequest)
 	}
 
-	db, err := getDatabase(req)
+	// The whole payment is loaded, so the audit log records everything that's deleted.
+	payment, err := src.find(id, repository.Load{}, req)
 	if err != nil {
 		return nil, err
 	}
 
-	payment := &model.Payment{}
-	if err := payment.SetID(id); err != nil {
-		return nil, api2go.NewHTTPError(err, "invalid id", http.StatusBadRequest)
+	before, err := snapshot(payment)
+	if err != nil {
+		return nil, newInternalError(req, err)
+	}
+	err = scoped(src.repos, req).Transaction(func(tx repository.Repositories) error {
+		if err := tx.Payments.Delete(payment); err != nil {
+			return err
+		}
+		return recordPayment(tx, req, model.AuditDelete, payment, before)
+	})
+	if err != nil {
+		return nil, newInternalError(req, err)
 	}
 
-	if err := db.Where(payment).First(payment).Error; err != nil {
-		return nil, api2go.NewHTTPError(err, "could not find payments resource", http.StatusNotFound)
+	return &api2go.Response{Code: http.StatusNoContent}, nil
+}
+
+// Actions method required to implement `ActionSource`. Implementing this interface will enable the URIs:
+// POST /payments/:paymentID/submit
+// POST /payments/:paymentID/accept
+// POST /payments/:paymentID/settle
+// POST /payments/:paymentID/reject
+// POST /payments/:paymentID/fail
+// POST /payments/:paymentID/cancel
+func (src *PaymentSource) Actions() map[string]Action {
+	actions := make(map[string]Action, len(paymentActions))
+	for name, status := range paymentActions {
+		status := status
+		actions[name] = func(id string, req api2go.Request) (api2go.Responder, error) {
+			return src.Transition(id, status, req)
+		}
 	}
 
-	if err := db.Delete(payment).Error; err != nil {
+	return actions
+}
+
+// Transition moves the payment with the given id to the given status, as long as the state machine of the payment
+// allows it.
+func (src *PaymentSource) Transition(id string, status model.PaymentStatus, req api2go.Request) (api2go.Responder, error) {
+	if _, err := authorize(req, "payments", auth.OperationTransition); err != nil {
 		return nil, err
 	}
 
-	return &api2go.Response{Code: http.StatusNoContent}, nil
+	payment, err := src.find(id, repository.Load{}, req)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := snapshot(payment)
+	if err != nil {
+		return nil, newInternalError(req, err)
+	}
+	from := payment.Status
+	if err := payment.Transition(status); err != nil {
+		return nil, newStatusError(err, http.StatusConflict)
+	}
+
+	// Only update the payment when its status hasn't been changed concurrently, otherwise we could skip a step in the
+	// state machine.
+	err = scoped(src.repos, req).Transaction(func(tx repository.Repositories) error {
+		if err := tx.Payments.UpdateStatus(payment, from); err != nil {
+			return err
+		}
+		return recordPayment(tx, req, model.AuditTransition, payment, before)
+	})
+	if err == repository.ErrConflict {
+		return nil, newStatusError(&model.TransitionError{From: from, To: status}, http.StatusConflict)
+	}
+	if err != nil {
+		return nil, newInternalError(req, err)
+	}
+
+	return &api2go.Response{Res: payment, Code: http.StatusOK}, nil
+}
+
+// AuditEvents lists the audit log of the payment with the given id, the oldest event first. Enables the URI:
+// GET /payments/:paymentID/audit-events
+//
+// Deleted payments can't be found, but their audit log still can.
+func (src *PaymentSource) AuditEvents(id string, req api2go.Request) (api2go.Responder, error) {
+	org, err := authorize(req, "audit-events", auth.OperationRead)
+	if err != nil {
+		return nil, err
+	}
+	paymentID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, NewHTTPError(err, "invalid id", http.StatusBadRequest)
+	}
+
+	events, err := scoped(src.repos, req).AuditEvents.List("payments", paymentID)
+	if err != nil {
+		return nil, newInternalError(req, err)
+	}
+	// Payments can't move between organisations, so all events of a payment belong to the same organisation.
+	if len(events) > 0 && !uuid.Equal(events[0].OrganisationID, org.ID) {
+		return nil, newNotFoundError(req, repository.ErrNotFound, "payments")
+	}
+	// Payments created before the audit log existed may not have any events yet.
+	if len(events) == 0 {
+		if _, err := src.find(id, repository.Load{Fields: []string{}}, req); err != nil {
+			return nil, err
+		}
+	}
+
+	return &api2go.Response{Res: events, Code: http.StatusOK}, nil
+}
+
+// Record the change of the payment, by appending an event to the audit log and adding a domain event to the outbox, see
+// `appendAuditEvent` and `addOutboxEvent`. The payment is snapshotted after the change, unless it was deleted, before is
+// the snapshot from before the change.
+func recordPayment(tx repository.Repositories, req api2go.Request, op model.AuditOperation, payment *model.Payment, before []byte) error {
+	var after []byte
+	if op != model.AuditDelete {
+		var err error
+		if after, err = snapshot(payment); err != nil {
+			return err
+		}
+	}
+
+	err := appendAuditEvent(tx.AuditEvents, req, op, "payments", payment.ID, payment.OrganisationID, before, after)
+	if err != nil {
+		return err
+	}
+
+	return addOutboxEvent(tx.Outbox, paymentEvents[op], "payments", payment.ID, payment.OrganisationID, before, after)
+}
+
+// Create a json:api error for an illegal status of a payment.
+func newStatusError(err error, status int) api2go.HTTPError {
+	httpErr := api2go.NewHTTPError(err, "invalid payment status", status)
+	httpErr.Errors = []api2go.Error{
+		{
+			Status: strconv.Itoa(status),
+			Code:   "invalid_status",
+			Title:  "invalid payment status",
+			Detail: err.Error(),
+			Source: &api2go.ErrorSource{Pointer: attributesPointer + "/status"},
+		},
+	}
+
+	return httpErr
+}
+
+// Find the payment with the id, loading the data of load. Returns a 404 error when it doesn't exist, or when it belongs
+// to another organisation than the caller's.
+func (src *PaymentSource) find(id string, load repository.Load, req api2go.Request) (*model.Payment, error) {
+	org, err := caller(req)
+	if err != nil {
+		return nil, err
+	}
+	paymentID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, NewHTTPError(err, "invalid id", http.StatusBadRequest)
+	}
+
+	payment, err := scoped(src.repos, req).Payments.Find(paymentID, load)
+	if err == nil && !uuid.Equal(payment.OrganisationID, org.ID) {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, newNotFoundError(req, err, "payments")
+	}
+
+	return payment, nil
+}
+
+// Build the query of the payments requested, with the filters, includes and sparse fieldsets of the request. Queries
+// are always limited to the payments of the organisation of the caller.
+func (src *PaymentSource) query(req api2go.Request) (repository.Query, error) {
+	query := repository.Query{}
+
+	scope, err := src.scopeOrganisation(req)
+	if err != nil {
+		return query, err
+	}
+	filters, err := paymentFilters.extract(req)
+	if err != nil {
+		return query, err
+	}
+	if query.Include, err = paymentIncludes.extract(req); err != nil {
+		return query, err
+	}
+	if query.Fields, err = extractPaymentFields(req); err != nil {
+		return query, err
+	}
+	query.Filters = append(scope, filters...)
+
+	return query, nil
+}
+
+// Create the filter that limits the query to the payments of the organisation of the caller. Payments requested through
+// the payments relationship of another organisation result in a 404 error, as if that organisation doesn't exist.
+func (src *PaymentSource) scopeOrganisation(req api2go.Request) ([]repository.Filter, error) {
+	org, err := caller(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if ids, ok := req.QueryParams[organisationIDParameter]; ok {
+		if _, err := uuid.FromString(ids[0]); err != nil {
+			return nil, NewHTTPError(err, "invalid id", http.StatusBadRequest)
+		}
+		if _, err := callerOrganisation(ids[0], req); err != nil {
+			return nil, err
+		}
+	}
+
+	return []repository.Filter{{Field: "organisation", Operator: operatorEq, Values: []interface{}{org.ID}}}, nil
+}
+
+// Create the filters available on payments. Besides the attributes of the payment itself, payments can be filtered on
+// the attributes of their parties, e.g. `filter[beneficiary_party.account_number]`.
+func newPaymentFilters() filters {
+	eq := []string{operatorEq}
+	ranged := []string{operatorEq, operatorGte, operatorLte}
+
+	paymentFilters := filters{
+		"currency":        {operators: eq, parse: parseString},
+		"payment_scheme":  {operators: eq, parse: parseString},
+		"payment_type":    {operators: eq, parse: parseString},
+		"status":          {operators: eq, parse: parseString},
+		"organisation":    {operators: eq, parse: parseUUID},
+		"processing_date": {operators: ranged, parse: parseDate},
+		"amount":          {operators: ranged, parse: parseMoney},
+	}
+
+	parties := []string{"beneficiary_party", "debtor_party", "sponsor_party"}
+	partyAttributes := []string{"account_name", "account_number", "account_number_code", "bank_id", "bank_id_code", "name"}
+	for _, party := range parties {
+		for _, attribute := range partyAttributes {
+			paymentFilters[party+"."+attribute] = filter{operators: eq, parse: parseString}
+		}
+	}
+
+	return paymentFilters
+}
+
+// Extract the sparse fieldset of payments from the request, see `fieldset.extract`. Organisations can be included with
+// payments, so their sparse fieldset is validated as well.
+func extractPaymentFields(req api2go.Request) ([]string, error) {
+	if _, err := organisationFields.extract(req); err != nil {
+		return nil, err
+	}
+
+	return paymentFields.extract(req)
+}
+
+// Limit the attributes of the payments to the requested sparse fieldset.
+func setPaymentFields(payments []*model.Payment, fields []string) {
+	for _, payment := range payments {
+		payment.SetFields(fields)
+	}
 }
@@ -2,10 +2,13 @@ package source
 
 import (
 	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
 	"github.com/manyminds/api2go"
 	"github.com/satori/go.uuid"
 	"net/http"
 	"reflect"
+	"sort"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -13,6 +16,8 @@ import (
 func TestPaymentSource_Create(t *testing.T) {
 	req := NewMockedRequest()
 	payments := GetPaymentFixtures(false)
+	orgs := GetOrganisationFixtures(false)
+	*req = WithMockedCaller(*req, orgs[0])
 
 	// For ease of use, we copy a payment from the fixtures and use that.
 	basePayment := *payments[0]
@@ -22,6 +27,12 @@ func TestPaymentSource_Create(t *testing.T) {
 	idPayment := basePayment
 	idPayment.ID = uuid.NewV4()
 
+	submittedPayment := basePayment
+	submittedPayment.Status = model.StatusSubmitted
+
+	otherOrgPayment := basePayment
+	otherOrgPayment.OrganisationID = orgs[1].ID
+
 	baseRes := &api2go.Response{
 		Code: http.StatusCreated,
 		Res:  &basePayment,
@@ -45,10 +56,13 @@ func TestPaymentSource_Create(t *testing.T) {
 		{"base", &PaymentSource{}, args{&basePayment, *req}, baseRes, false},
 		{"with-id", &PaymentSource{}, args{&idPayment, *req}, idRes, false},
 		{"duplicate-id", &PaymentSource{}, args{&idPayment, *req}, nil, true},
+		{"not-pending", &PaymentSource{}, args{&submittedPayment, *req}, nil, true},
+		{"other-organisation", &PaymentSource{}, args{&otherOrgPayment, *req}, nil, true},
+		{"no-caller", &PaymentSource{}, args{&basePayment, *NewMockedRequest()}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			src := &PaymentSource{}
+			src := NewPaymentSource(NewMockedRepositories(tt.args.req))
 			got, err := src.Create(tt.args.obj, tt.args.req)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("PaymentSource.Create() error = %v, wantErr %v", err, tt.wantErr)
@@ -63,10 +77,12 @@ func TestPaymentSource_Create(t *testing.T) {
 
 func TestPaymentSource_FindAll(t *testing.T) {
 	req := NewMockedRequest()
+	*req = WithMockedCaller(*req, GetOrganisationFixtures(false)[0])
 
+	// Only the payments of the caller's organisation are listed.
 	baseRes := &api2go.Response{
 		Code: http.StatusOK,
-		Res:  GetPaymentFixtures(false),
+		Res:  GetPaymentFixtures(false)[0:2],
 	}
 
 	type args struct {
@@ -80,10 +96,11 @@ func TestPaymentSource_FindAll(t *testing.T) {
 		wantErr bool
 	}{
 		{"base", &PaymentSource{}, args{*req}, baseRes, false},
+		{"no-caller", &PaymentSource{}, args{*NewMockedRequest()}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			src := &PaymentSource{}
+			src := NewPaymentSource(NewMockedRepositories(tt.args.req))
 			got, err := src.FindAll(tt.args.req)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("PaymentSource.FindAll() error = %v, wantErr %v", err, tt.wantErr)
@@ -98,23 +115,25 @@ func TestPaymentSource_FindAll(t *testing.T) {
 
 func TestPaymentSource_PaginatedFindAll(t *testing.T) {
 	req := NewMockedRequest()
-	firstReq := NewMockedRequest()
-	firstReq.QueryParams = map[string][]string{"page[number]": {"1"}, "page[size]": {"2"}}
-	secondReq := NewMockedRequest()
-	secondReq.QueryParams = map[string][]string{"page[number]": {"2"}, "page[size]": {"2"}}
-	oorReq := NewMockedRequest()
+	*req = WithMockedCaller(*req, GetOrganisationFixtures(false)[0])
+	firstReq := *req
+	firstReq.QueryParams = map[string][]string{"page[number]": {"1"}, "page[size]": {"1"}}
+	secondReq := *req
+	secondReq.QueryParams = map[string][]string{"page[number]": {"2"}, "page[size]": {"1"}}
+	oorReq := *req
 	oorReq.QueryParams = map[string][]string{"page[number]": {"100"}, "page[size]": {"100"}}
 
-	payments := GetPaymentFixtures(false)
+	// Only the payments of the caller's organisation are counted.
+	payments := GetPaymentFixtures(false)[0:2]
 	count := len(payments)
 
 	firstRes := &api2go.Response{
 		Code: http.StatusOK,
-		Res:  payments[0:2],
+		Res:  payments[0:1],
 	}
 	secondRes := &api2go.Response{
 		Code: http.StatusOK,
-		Res:  payments[2:3],
+		Res:  payments[1:2],
 	}
 	emptyRes := &api2go.Response{
 		Code: http.StatusOK,
@@ -132,14 +151,14 @@ func TestPaymentSource_PaginatedFindAll(t *testing.T) {
 		want1   api2go.Responder
 		wantErr bool
 	}{
-		{"first-page", &PaymentSource{}, args{*firstReq}, uint(count), firstRes, false},
-		{"second-page", &PaymentSource{}, args{*secondReq}, uint(count), secondRes, false},
-		{"out-of-range", &PaymentSource{}, args{*oorReq}, uint(count), emptyRes, false},
+		{"first-page", &PaymentSource{}, args{firstReq}, uint(count), firstRes, false},
+		{"second-page", &PaymentSource{}, args{secondReq}, uint(count), secondRes, false},
+		{"out-of-range", &PaymentSource{}, args{oorReq}, uint(count), emptyRes, false},
 		{"not-paginated", &PaymentSource{}, args{*req}, 0, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			src := &PaymentSource{}
+			src := NewPaymentSource(NewMockedRepositories(tt.args.req))
 			got, got1, err := src.PaginatedFindAll(tt.args.req)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("PaymentSource.PaginatedFindAll() error = %v, wantErr %v", err, tt.wantErr)
@@ -173,7 +192,9 @@ func TestPaymentSource_FindOne(t *testing.T) {
 		wantErr bool
 	}
 	tests := []testData{
-		{"deleted", &PaymentSource{}, args{deletedPayments[0].GetID(), *req}, nil, true},
+		{"deleted", &PaymentSource{}, args{deletedPayments[0].GetID(), withPaymentCaller(*req, deletedPayments[0])}, nil, true},
+		{"other-organisation", &PaymentSource{}, args{payments[2].GetID(), withPaymentCaller(*req, payments[0])}, nil, true},
+		{"no-caller", &PaymentSource{}, args{payments[0].GetID(), *req}, nil, true},
 	}
 
 	for i, payment := range payments {
@@ -183,13 +204,13 @@ func TestPaymentSource_FindOne(t *testing.T) {
 		}
 		tests = append(
 			tests,
-			testData{"payments-" + string(i), &PaymentSource{}, args{payment.GetID(), *req}, res, false},
+			testData{"payments-" + strconv.Itoa(i), &PaymentSource{}, args{payment.GetID(), withPaymentCaller(*req, payment)}, res, false},
 		)
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			src := &PaymentSource{}
+			src := NewPaymentSource(NewMockedRepositories(tt.args.req))
 			got, err := src.FindOne(tt.args.id, tt.args.req)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("PaymentSource.FindOne() error = %v, wantErr %v", err, tt.wantErr)
@@ -205,7 +226,9 @@ func TestPaymentSource_FindOne(t *testing.T) {
 func TestPaymentSource_Update(t *testing.T) {
 	req := NewMockedRequest()
 	payment := GetPaymentFixtures(false)[0]
+	otherPayment := GetPaymentFixtures(false)[2]
 	deletedOrg := GetPaymentFixtures(true)[0]
+	*req = withPaymentCaller(*req, payment)
 
 	updateData := &model.Payment{
 		Model:     model.Model{ID: payment.ID},
@@ -228,6 +251,16 @@ func TestPaymentSource_Update(t *testing.T) {
 		Reference: "Updated Payment",
 	}
 
+	otherUpdateData := &model.Payment{
+		Model:     model.Model{ID: otherPayment.ID},
+		Reference: "Updated Payment",
+	}
+
+	moveData := &model.Payment{
+		Model:          model.Model{ID: payment.ID},
+		OrganisationID: otherPayment.OrganisationID,
+	}
+
 	type args struct {
 		obj interface{}
 		req api2go.Request
@@ -242,10 +275,12 @@ func TestPaymentSource_Update(t *testing.T) {
 		{"base", &PaymentSource{}, args{updateData, *req}, res, false},
 		{"no-id", &PaymentSource{}, args{noIDData, *req}, nil, true},
 		{"deleted", &PaymentSource{}, args{delUpdateData, *req}, nil, true},
+		{"other-organisation", &PaymentSource{}, args{otherUpdateData, *req}, nil, true},
+		{"move-organisation", &PaymentSource{}, args{moveData, *req}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			src := &PaymentSource{}
+			src := NewPaymentSource(NewMockedRepositories(tt.args.req))
 			got, err := src.Update(tt.args.obj, tt.args.req)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("PaymentSource.Update() error = %v, wantErr %v", err, tt.wantErr)
@@ -292,8 +327,9 @@ func TestPaymentSource_Delete(t *testing.T) {
 	}
 
 	tests := []testData{
-		{"invalid", &PaymentSource{}, args{"not-a-uuid", *req}, nil, true},
-		{"deleted", &PaymentSource{}, args{deletedPayments[0].GetID(), *req}, nil, true},
+		{"invalid", &PaymentSource{}, args{"not-a-uuid", withPaymentCaller(*req, payments[0])}, nil, true},
+		{"deleted", &PaymentSource{}, args{deletedPayments[0].GetID(), withPaymentCaller(*req, deletedPayments[0])}, nil, true},
+		{"other-organisation", &PaymentSource{}, args{payments[2].GetID(), withPaymentCaller(*req, payments[0])}, nil, true},
 	}
 
 	for i, payment := range payments {
@@ -302,13 +338,13 @@ func TestPaymentSource_Delete(t *testing.T) {
 		}
 		tests = append(
 			tests,
-			testData{"payment-" + string(i), &PaymentSource{}, args{payment.GetID(), *req}, res, false},
+			testData{"payment-" + strconv.Itoa(i), &PaymentSource{}, args{payment.GetID(), withPaymentCaller(*req, payment)}, res, false},
 		)
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			src := &PaymentSource{}
+			src := NewPaymentSource(NewMockedRepositories(tt.args.req))
 			got, err := src.Delete(tt.args.id, tt.args.req)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("PaymentSource.Delete() error = %v, wantErr %v", err, tt.wantErr)
@@ -320,3 +356,224 @@ func TestPaymentSource_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestPaymentSource_Actions(t *testing.T) {
+	want := []string{"accept", "cancel", "fail", "reject", "settle", "submit"}
+
+	actions := NewPaymentSource(repository.Repositories{}).Actions()
+	got := make([]string, 0, len(actions))
+	for name := range actions {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PaymentSource.Actions() = %v, want %v", got, want)
+	}
+}
+
+func TestPaymentSource_Transition(t *testing.T) {
+	req := NewMockedRequest()
+	payments := GetPaymentFixtures(false)
+	deletedPayments := GetPaymentFixtures(true)
+	*req = withPaymentCaller(*req, payments[0])
+
+	type args struct {
+		id     string
+		status model.PaymentStatus
+		req    api2go.Request
+	}
+	tests := []struct {
+		name       string
+		src        *PaymentSource
+		args       args
+		wantStatus model.PaymentStatus
+		wantErr    bool
+	}{
+		{"submit", &PaymentSource{}, args{payments[0].GetID(), model.StatusSubmitted, *req}, model.StatusSubmitted, false},
+		{"submit-twice", &PaymentSource{}, args{payments[0].GetID(), model.StatusSubmitted, *req}, "", true},
+		{"accept", &PaymentSource{}, args{payments[1].GetID(), model.StatusAccepted, *req}, model.StatusAccepted, false},
+		{"settle", &PaymentSource{}, args{payments[1].GetID(), model.StatusSettled, *req}, model.StatusSettled, false},
+		{"cancel-settled", &PaymentSource{}, args{payments[1].GetID(), model.StatusCancelled, *req}, "", true},
+		{"skip-step", &PaymentSource{}, args{payments[0].GetID(), model.StatusSettled, *req}, "", true},
+		{"deleted", &PaymentSource{}, args{deletedPayments[0].GetID(), model.StatusSubmitted, *req}, "", true},
+		{"invalid-id", &PaymentSource{}, args{"not-a-uuid", model.StatusSubmitted, *req}, "", true},
+		{"other-organisation", &PaymentSource{}, args{payments[2].GetID(), model.StatusSubmitted, *req}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := NewPaymentSource(NewMockedRepositories(tt.args.req))
+			got, err := src.Transition(tt.args.id, tt.args.status, tt.args.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PaymentSource.Transition() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got.StatusCode() != http.StatusOK {
+				t.Errorf("PaymentSource.Transition() code = %v, want %v", got.StatusCode(), http.StatusOK)
+			}
+			if status := got.Result().(*model.Payment).Status; status != tt.wantStatus {
+				t.Errorf("PaymentSource.Transition() status = %v, want %v", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPaymentSource_UpdateStatus(t *testing.T) {
+	req := NewMockedRequest()
+	payment := GetPaymentFixtures(false)[1]
+	*req = withPaymentCaller(*req, payment)
+
+	type args struct {
+		obj interface{}
+		req api2go.Request
+	}
+	tests := []struct {
+		name    string
+		src     *PaymentSource
+		args    args
+		wantErr bool
+	}{
+		{"unchanged", &PaymentSource{}, args{&model.Payment{Model: model.Model{ID: payment.ID}, Status: model.StatusSubmitted}, *req}, false},
+		{"illegal", &PaymentSource{}, args{&model.Payment{Model: model.Model{ID: payment.ID}, Status: model.StatusSettled}, *req}, true},
+		{"legal", &PaymentSource{}, args{&model.Payment{Model: model.Model{ID: payment.ID}, Status: model.StatusAccepted}, *req}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := NewPaymentSource(NewMockedRepositories(tt.args.req))
+			if _, err := src.Update(tt.args.obj, tt.args.req); (err != nil) != tt.wantErr {
+				t.Errorf("PaymentSource.Update() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPaymentSource_Validation(t *testing.T) {
+	req := NewMockedRequest()
+	payment := GetPaymentFixtures(false)[0]
+	*req = withPaymentCaller(*req, payment)
+
+	invalidPayment := &model.Payment{
+		OrganisationID:   payment.OrganisationID,
+		Amount:           invalidMoney("abc"),
+		Currency:         "GBP",
+		BeneficiaryParty: &model.Party{AccountNumber: "not an account number"},
+	}
+	invalidUpdate := &model.Payment{Model: model.Model{ID: payment.ID}, ProcessingDate: "tomorrow"}
+
+	type args struct {
+		obj interface{}
+		req api2go.Request
+	}
+	tests := []struct {
+		name         string
+		create       bool
+		args         args
+		wantPointers []string
+	}{
+		{"create", true, args{invalidPayment, *req}, []string{"/data/attributes/amount", "/data/attributes/beneficiary_party/account_number"}},
+		{"update", false, args{invalidUpdate, *req}, []string{"/data/attributes/processing_date"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := NewPaymentSource(NewMockedRepositories(*req))
+
+			var err error
+			if tt.create {
+				_, err = src.Create(tt.args.obj, tt.args.req)
+			} else {
+				_, err = src.Update(tt.args.obj, tt.args.req)
+			}
+
+			httpErr, ok := err.(api2go.HTTPError)
+			if !ok {
+				t.Errorf("PaymentSource error = %v, want api2go.HTTPError", err)
+				return
+			}
+
+			var got []string
+			for _, e := range httpErr.Errors {
+				if e.Status != "422" {
+					t.Errorf("PaymentSource error status = %v, want %v", e.Status, "422")
+				}
+				got = append(got, e.Source.Pointer)
+			}
+			if !reflect.DeepEqual(got, tt.wantPointers) {
+				t.Errorf("PaymentSource error pointers = %v, want %v", got, tt.wantPointers)
+			}
+		})
+	}
+}
+
+func TestPaymentSource_FindAllOrganisation(t *testing.T) {
+	req := NewMockedRequest()
+	payments := GetPaymentFixtures(false)
+	orgs := GetOrganisationFixtures(false)
+	*req = WithMockedCaller(*req, orgs[0])
+
+	related := func(params map[string][]string) api2go.Request {
+		relatedReq := *req
+		relatedReq.QueryParams = params
+		return relatedReq
+	}
+
+	tests := []struct {
+		name    string
+		params  map[string][]string
+		want    api2go.Responder
+		wantErr bool
+	}{
+		{
+			"organisation",
+			map[string][]string{"organisationsID": {orgs[0].GetID()}},
+			&api2go.Response{Code: http.StatusOK, Res: payments[0:2]},
+			false,
+		},
+		{
+			"filtered",
+			map[string][]string{"organisationsID": {orgs[0].GetID()}, "filter[processing_date][gte]": {"2017-01-19"}},
+			&api2go.Response{Code: http.StatusOK, Res: payments[1:2]},
+			false,
+		},
+		{
+			"sorted",
+			map[string][]string{"organisationsID": {orgs[0].GetID()}, "sort": {"amount"}},
+			&api2go.Response{Code: http.StatusOK, Res: []*model.Payment{payments[1], payments[0]}},
+			false,
+		},
+		{"deleted-organisation", map[string][]string{"organisationsID": {GetOrganisationFixtures(true)[0].GetID()}}, nil, true},
+		{"invalid-organisation", map[string][]string{"organisationsID": {"abc"}}, nil, true},
+		{"other-organisation", map[string][]string{"organisationsID": {orgs[1].GetID()}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := NewPaymentSource(NewMockedRepositories(*req))
+			got, err := src.FindAll(related(tt.params))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PaymentSource.FindAll() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PaymentSource.FindAll() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	src := NewPaymentSource(NewMockedRepositories(*req))
+	count, _, err := src.PaginatedFindAll(related(map[string][]string{
+		"organisationsID": {orgs[0].GetID()},
+		"page[number]":    {"1"},
+		"page[size]":      {"1"},
+	}))
+	if err != nil || count != 2 {
+		t.Errorf("PaymentSource.PaginatedFindAll() count = %v, error = %v, want %v", count, err, 2)
+	}
+}
+
+// Authenticate a request mocked with `NewMockedRequest` as the organisation the payment belongs to.
+func withPaymentCaller(req api2go.Request, payment *model.Payment) api2go.Request {
+	return WithMockedCaller(req, GetPaymentOrganisationFixture(payment))
+}
@@ -0,0 +1,120 @@
+package source
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/manyminds/api2go"
+	"net/http"
+	"testing"
+)
+
+// Every operation of the sources is refused with a 403 error for roles that aren't allowed to perform it. Allowed
+// operations are called on resources that don't exist or aren't valid, so they fail after being authorized without
+// changing any of the fixtures.
+func TestRoles(t *testing.T) {
+	req := NewMockedRequest()
+	org := GetOrganisationFixtures(false)[0]
+	unknownID := "00000000-0000-0000-0000-000000000001"
+
+	repos := NewMockedRepositories(*req)
+	payments := NewPaymentSource(repos)
+	organisations := NewOrganisationSource(repos)
+	webhooks := NewWebhookSource(repos, false)
+
+	paginated := *req
+	paginated.QueryParams = map[string][]string{"page[number]": {"1"}, "page[size]": {"1"}}
+
+	operations := []struct {
+		name string
+		// Least privileged role allowed to perform the operation.
+		role model.Role
+		call func(req api2go.Request) error
+	}{
+		{"find-payments", model.RoleViewer, func(req api2go.Request) error {
+			_, err := payments.FindAll(req)
+			return err
+		}},
+		{"paginate-payments", model.RoleViewer, func(req api2go.Request) error {
+			req.QueryParams = paginated.QueryParams
+			_, _, err := payments.PaginatedFindAll(req)
+			return err
+		}},
+		{"find-payment", model.RoleViewer, func(req api2go.Request) error {
+			_, err := payments.FindOne(unknownID, req)
+			return err
+		}},
+		{"create-payment", model.RoleOperator, func(req api2go.Request) error {
+			_, err := payments.Create(&model.Payment{Currency: "XXX"}, req)
+			return err
+		}},
+		{"update-payment", model.RoleOperator, func(req api2go.Request) error {
+			_, err := payments.Update(&model.Payment{}, req)
+			return err
+		}},
+		{"cancel-payment", model.RoleOperator, func(req api2go.Request) error {
+			_, err := payments.Transition(unknownID, model.StatusCancelled, req)
+			return err
+		}},
+		{"delete-payment", model.RoleAdmin, func(req api2go.Request) error {
+			_, err := payments.Delete(unknownID, req)
+			return err
+		}},
+		{"find-audit-events", model.RoleViewer, func(req api2go.Request) error {
+			_, err := payments.AuditEvents(unknownID, req)
+			return err
+		}},
+		{"find-organisations", model.RoleViewer, func(req api2go.Request) error {
+			_, err := organisations.FindAll(req)
+			return err
+		}},
+		{"find-organisation", model.RoleViewer, func(req api2go.Request) error {
+			_, err := organisations.FindOne(unknownID, req)
+			return err
+		}},
+		{"create-organisation", model.RoleAdmin, func(req api2go.Request) error {
+			_, err := organisations.Create(&model.Payment{}, req)
+			return err
+		}},
+		{"update-organisation", model.RoleAdmin, func(req api2go.Request) error {
+			_, err := organisations.Update(&model.Organisation{}, req)
+			return err
+		}},
+		{"delete-organisation", model.RoleAdmin, func(req api2go.Request) error {
+			_, err := organisations.Delete(unknownID, req)
+			return err
+		}},
+		{"find-webhooks", model.RoleViewer, func(req api2go.Request) error {
+			_, err := webhooks.FindAll(req)
+			return err
+		}},
+		{"find-webhook", model.RoleViewer, func(req api2go.Request) error {
+			_, err := webhooks.FindOne(unknownID, req)
+			return err
+		}},
+		{"create-webhook", model.RoleAdmin, func(req api2go.Request) error {
+			_, err := webhooks.Create(&model.Webhook{}, req)
+			return err
+		}},
+		{"update-webhook", model.RoleAdmin, func(req api2go.Request) error {
+			_, err := webhooks.Update(&model.Webhook{}, req)
+			return err
+		}},
+		{"delete-webhook", model.RoleAdmin, func(req api2go.Request) error {
+			_, err := webhooks.Delete(unknownID, req)
+			return err
+		}},
+		{"find-webhook-deliveries", model.RoleViewer, func(req api2go.Request) error {
+			_, err := webhooks.Deliveries(unknownID, req)
+			return err
+		}},
+	}
+	for _, op := range operations {
+		for _, role := range append(model.Roles(), "", "owner") {
+			t.Run(op.name+"/"+string(role), func(t *testing.T) {
+				err := op.call(WithMockedRole(*req, org, role))
+				if forbidden := httpStatus(err) == http.StatusForbidden; forbidden == role.Includes(op.role) {
+					t.Errorf("error = %v, want forbidden %v", err, !role.Includes(op.role))
+				}
+			})
+		}
+	}
+}
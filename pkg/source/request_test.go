@@ -1,6 +1,15 @@
 package source
 
-import "github.com/manyminds/api2go"
+import (
+	"github.com/Shodske/payment-api/pkg/auth"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/jinzhu/gorm"
+	"github.com/manyminds/api2go"
+)
+
+// MockedActor is the actor of the callers of requests mocked with `WithMockedCaller` and `WithMockedRole`.
+const MockedActor = "api-key:mocked"
 
 // NewMockedRequest mocks an `api2go.Request` to be used in tests.
 func NewMockedRequest() *api2go.Request {
@@ -8,3 +17,34 @@ func NewMockedRequest() *api2go.Request {
 		Context: NewMockedContext(),
 	}
 }
+
+// NewMockedDatabase returns the test database of a request mocked with `NewMockedRequest`, to be injected into the
+// sources. Requests sharing a mocked context share the same database.
+func NewMockedDatabase(req api2go.Request) *gorm.DB {
+	db, _ := req.Context.Get("db")
+	return db.(*gorm.DB)
+}
+
+// NewMockedRepositories returns the repositories of the test database of a request mocked with `NewMockedRequest`, see
+// `NewMockedDatabase`.
+func NewMockedRepositories(req api2go.Request) repository.Repositories {
+	return repository.NewGorm(NewMockedDatabase(req))
+}
+
+// WithMockedCaller returns a copy of a request mocked with `NewMockedRequest`, of which the caller is authenticated as
+// an admin of the organisation. The copy shares the test database of the request.
+func WithMockedCaller(req api2go.Request, org *model.Organisation) api2go.Request {
+	return WithMockedRole(req, org, model.RoleAdmin)
+}
+
+// WithMockedRole returns a copy of a request mocked with `NewMockedRequest`, of which the caller is authenticated as
+// the organisation with the role, with `MockedActor` as actor. The copy shares the test database of the request.
+func WithMockedRole(req api2go.Request, org *model.Organisation, role model.Role) api2go.Request {
+	ctx := &mockedContext{db: NewMockedDatabase(req)}
+	ctx.Set(auth.ContextKey, org)
+	ctx.Set(auth.RoleContextKey, role)
+	ctx.Set(auth.ActorContextKey, MockedActor)
+	req.Context = ctx
+
+	return req
+}
@@ -0,0 +1,53 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/manyminds/api2go"
+	"strings"
+)
+
+// Name of the json:api sort query parameter, e.g. `sort=-created_at,amount`.
+const sortParameter = "sort"
+
+// Sorts describes the order in which the results of a resource can be sorted. Repositories always use the `id` as the
+// last sort attribute, so the order is stable even when the other attributes have equal values.
+type sorts struct {
+	// Attributes the resource can be sorted on.
+	attributes []string
+	// Attributes used when the request doesn't specify a sort order.
+	defaults []string
+}
+
+// Extract the order of the sort query parameter of the request, or the default order if there is none. Returns a 400
+// error for attributes that cannot be sorted on.
+func (sorts sorts) extract(req api2go.Request) ([]repository.Order, error) {
+	fields, ok := req.QueryParams[sortParameter]
+	if !ok {
+		fields = sorts.defaults
+	}
+
+	orders := make([]repository.Order, 0, len(fields))
+	for _, field := range fields {
+		order := repository.Order{Field: strings.TrimPrefix(field, "-"), Descending: strings.HasPrefix(field, "-")}
+		if !sorts.has(order.Field) {
+			return nil, newQueryError(errors.New("unknown sort attribute"), sortParameter, fmt.Sprintf("cannot sort on `%s`", order.Field))
+		}
+
+		orders = append(orders, order)
+	}
+
+	return orders, nil
+}
+
+// Check whether the resource can be sorted on the attribute.
+func (sorts sorts) has(attribute string) bool {
+	for _, a := range sorts.attributes {
+		if a == attribute {
+			return true
+		}
+	}
+
+	return false
+}
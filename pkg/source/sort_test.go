@@ -0,0 +1,79 @@
+package source
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/manyminds/api2go"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestPaymentSource_FindAllSorted(t *testing.T) {
+	req := NewMockedRequest()
+	*req = WithMockedCaller(*req, GetOrganisationFixtures(false)[0])
+	// Only the payments of the caller's organisation are listed.
+	payments := GetPaymentFixtures(false)[0:2]
+
+	sorted := func(fields ...string) api2go.Request {
+		sortedReq := *req
+		sortedReq.QueryParams = map[string][]string{"sort": fields}
+		return sortedReq
+	}
+	res := func(payments ...*model.Payment) api2go.Responder {
+		return &api2go.Response{Code: http.StatusOK, Res: payments}
+	}
+
+	tests := []struct {
+		name    string
+		req     api2go.Request
+		want    api2go.Responder
+		wantErr bool
+	}{
+		{"default", *req, res(payments...), false},
+		{"created-at-desc", sorted("-created_at"), res(payments[1], payments[0]), false},
+		{"amount", sorted("amount"), res(payments[1], payments[0]), false},
+		{"amount-desc", sorted("-amount"), res(payments[0], payments[1]), false},
+		{"multiple", sorted("currency", "-processing_date"), res(payments[1], payments[0]), false},
+		{"unknown", sorted("reference"), nil, true},
+		{"unknown-desc", sorted("-organisation_id"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := NewPaymentSource(NewMockedRepositories(tt.req))
+			got, err := src.FindAll(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PaymentSource.FindAll() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PaymentSource.FindAll() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrganisationSource_FindAllSorted(t *testing.T) {
+	req := NewMockedRequest()
+	orgs := GetOrganisationFixtures(false)
+	*req = WithMockedCaller(*req, orgs[0])
+
+	// Callers only find their own organisation, sorting still validates the fields.
+	sortedReq := *req
+	sortedReq.QueryParams = map[string][]string{"sort": {"-name"}}
+	want := &api2go.Response{Code: http.StatusOK, Res: []*model.Organisation{orgs[0]}}
+
+	src := NewOrganisationSource(NewMockedRepositories(*req))
+	got, err := src.FindAll(sortedReq)
+	if err != nil {
+		t.Errorf("OrganisationSource.FindAll() error = %v", err)
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("OrganisationSource.FindAll() = %v, want %v", got, want)
+	}
+
+	sortedReq.QueryParams = map[string][]string{"sort": {"amount"}}
+	if _, err := src.FindAll(sortedReq); err == nil {
+		t.Errorf("OrganisationSource.FindAll() error = %v, wantErr %v", err, true)
+	}
+}
@@ -1,18 +1,29 @@
 package source
 
 import (
+	"context"
 	"errors"
-	"github.com/jinzhu/gorm"
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/auth"
+	"github.com/Shodske/payment-api/pkg/logging"
+	"github.com/Shodske/payment-api/pkg/metrics"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/Shodske/payment-api/pkg/validation"
 	"github.com/manyminds/api2go"
+	"github.com/satori/go.uuid"
 	"net/http"
 	"strconv"
 )
 
+// JSON pointer to the attributes of the primary resource in a json:api request document.
+const attributesPointer = "/data/attributes"
+
 // Extract the page number and size from the request.
 func extractPaginationQuery(req api2go.Request) (number int64, size int64, err error) {
 	numberQuery, ok := req.QueryParams["page[number]"]
 	if !ok {
-		return 0, 0, api2go.NewHTTPError(
+		return 0, 0, NewHTTPError(
 			errors.New("could not find `page[number]` in query"),
 			"could not find `page[number]` in query",
 			http.StatusBadRequest,
@@ -21,7 +32,7 @@ func extractPaginationQuery(req api2go.Request) (number int64, size int64, err e
 
 	number, err = strconv.ParseInt(numberQuery[0], 10, 64)
 	if err != nil {
-		return 0, 0, api2go.NewHTTPError(
+		return 0, 0, NewHTTPError(
 			err,
 			"invalid value for `page[number]` in query",
 			http.StatusBadRequest,
@@ -30,7 +41,7 @@ func extractPaginationQuery(req api2go.Request) (number int64, size int64, err e
 
 	sizeQuery, ok := req.QueryParams["page[size]"]
 	if !ok {
-		return 0, 0, api2go.NewHTTPError(
+		return 0, 0, NewHTTPError(
 			errors.New("could not find `page[size]` in query"),
 			"could not find `page[size]` in query",
 			http.StatusBadRequest,
@@ -39,7 +50,7 @@ func extractPaginationQuery(req api2go.Request) (number int64, size int64, err e
 
 	size, err = strconv.ParseInt(sizeQuery[0], 10, 64)
 	if err != nil {
-		return 0, 0, api2go.NewHTTPError(
+		return 0, 0, NewHTTPError(
 			err,
 			"invalid value for `page[size]` in query",
 			http.StatusBadRequest,
@@ -49,17 +60,141 @@ func extractPaginationQuery(req api2go.Request) (number int64, size int64, err e
 	return
 }
 
-// Get the gorm database from the request's context.
-func getDatabase(req api2go.Request) (*gorm.DB, error) {
-	db, ok := req.Context.Get("db")
-	if !ok {
-		return nil, errors.New("no database connection")
+// NewHTTPError creates a json:api error with the status and title, of which the error object has the status too, so
+// it can be written without api2go, e.g. by the handlers of custom routes. The err is only logged.
+func NewHTTPError(err error, title string, status int) api2go.HTTPError {
+	httpErr := api2go.NewHTTPError(err, title, status)
+	httpErr.Errors = []api2go.Error{{Status: strconv.Itoa(status), Title: title}}
+
+	return httpErr
+}
+
+// Create a json:api error for the violations found while validating a resource of the type. The pointers of the
+// violations are relative to the attributes of the resource.
+func newValidationError(errs validation.Errors, typ string) api2go.HTTPError {
+	metrics.ValidationFailed(typ)
+
+	httpErr := api2go.NewHTTPError(errs, "invalid attributes", http.StatusUnprocessableEntity)
+	for _, err := range errs {
+		httpErr.Errors = append(httpErr.Errors, api2go.Error{
+			Status: strconv.Itoa(http.StatusUnprocessableEntity),
+			Code:   "invalid_attribute",
+			Title:  "invalid attribute",
+			Detail: err.Detail,
+			Source: &api2go.ErrorSource{Pointer: attributesPointer + err.Pointer},
+		})
+	}
+
+	return httpErr
+}
+
+// Create a json:api error for an invalid query parameter of a request.
+func newQueryError(err error, parameter, detail string) api2go.HTTPError {
+	httpErr := api2go.NewHTTPError(err, "invalid query parameter", http.StatusBadRequest)
+	httpErr.Errors = []api2go.Error{
+		{
+			Status: strconv.Itoa(http.StatusBadRequest),
+			Code:   "invalid_query_parameter",
+			Title:  "invalid query parameter",
+			Detail: detail,
+			Source: &api2go.ErrorSource{Parameter: parameter},
+		},
+	}
+
+	return httpErr
+}
+
+// Create a 404 error when a resource of the type couldn't be found in its repository. Any other error of a repository
+// is an internal error, see `newInternalError`.
+func newNotFoundError(req api2go.Request, err error, typ string) error {
+	if err != repository.ErrNotFound {
+		return newInternalError(req, err)
 	}
 
-	conn, ok := db.(*gorm.DB)
+	return NewHTTPError(err, "could not find "+typ+" resource", http.StatusNotFound)
+}
+
+// Create a generic 500 error for an unexpected error, e.g. of a repository or the database driver, so its message is
+// never part of a response. The error is logged with the id of the request instead, see `logging.FromContext`. json:api
+// errors are returned as is.
+func newInternalError(req api2go.Request, err error) error {
+	if _, ok := err.(api2go.HTTPError); ok {
+		return err
+	}
+
+	ctx := context.Background()
+	if req.PlainRequest != nil {
+		ctx = req.PlainRequest.Context()
+	}
+	logging.FromContext(ctx).WithError(err).Error("cannot handle request")
+
+	return NewHTTPError(err, "internal server error", http.StatusInternalServerError)
+}
+
+// Get the organisation of the caller, which every request is scoped to. Requests without an authenticated caller are
+// refused with a 401 error, so resources can never be accessed across organisations by accident.
+func caller(req api2go.Request) (*model.Organisation, error) {
+	org, ok := auth.Organisation(req.Context)
 	if !ok {
-		return nil, errors.New("error accessing database")
+		return nil, NewHTTPError(errors.New("missing caller"), "unauthorized", http.StatusUnauthorized)
+	}
+
+	return org, nil
+}
+
+// Authorize the caller to perform the operation on resources of the type, returning the organisation of the caller.
+// Callers whose role doesn't allow the operation are refused with a 403 error.
+func authorize(req api2go.Request, typ string, op auth.Operation) (*model.Organisation, error) {
+	org, err := caller(req)
+	if err != nil {
+		return nil, err
+	}
+
+	role, _ := auth.Role(req.Context)
+	if !auth.Allowed(role, typ, op) {
+		metrics.AuthFailed(metrics.ReasonForbidden)
+		return nil, newForbiddenError(role, typ, op)
+	}
+
+	return org, nil
+}
+
+// Create a json:api error for a caller whose role doesn't allow the operation on resources of the type.
+func newForbiddenError(role model.Role, typ string, op auth.Operation) api2go.HTTPError {
+	detail := fmt.Sprintf("role `%s` is not allowed to %s %s", role, op, typ)
+	httpErr := api2go.NewHTTPError(errors.New(detail), "forbidden", http.StatusForbidden)
+	httpErr.Errors = []api2go.Error{
+		{
+			Status: strconv.Itoa(http.StatusForbidden),
+			Code:   "forbidden",
+			Title:  "forbidden",
+			Detail: detail,
+		},
+	}
+
+	return httpErr
+}
+
+// Get the repositories of the request, which log their queries with the id of the request, see
+// `repository.Repositories.WithContext`. Requests that weren't made over HTTP use the repositories as they are.
+func scoped(repos repository.Repositories, req api2go.Request) repository.Repositories {
+	if req.PlainRequest == nil {
+		return repos
+	}
+
+	return repos.WithContext(req.PlainRequest.Context())
+}
+
+// Get the organisation of the caller, as long as it's the organisation with the id. Resources of other organisations
+// are reported as not found, so callers can't find out which resources exist.
+func callerOrganisation(id string, req api2go.Request) (*model.Organisation, error) {
+	org, err := caller(req)
+	if err != nil {
+		return nil, err
+	}
+	if orgID, err := uuid.FromString(id); err != nil || !uuid.Equal(orgID, org.ID) {
+		return nil, newNotFoundError(req, repository.ErrNotFound, "organisations")
 	}
 
-	return conn, nil
+	return org, nil
 }
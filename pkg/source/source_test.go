@@ -0,0 +1,73 @@
+package source
+
+import (
+	"bytes"
+	"github.com/Shodske/payment-api/pkg/auth"
+	"github.com/Shodske/payment-api/pkg/logging"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/jinzhu/gorm"
+	"github.com/manyminds/api2go"
+	"github.com/satori/go.uuid"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Unexpected errors of a repository are written as a generic 500 error, so their messages never reach the caller, and
+// are logged with the id of the request instead.
+func TestInternalErrors(t *testing.T) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every query of a closed database fails.
+	db.Close()
+	repos := repository.NewGorm(db)
+	org := GetOrganisationFixtures(false)[0]
+
+	api := api2go.NewAPI("v0")
+	api.UseMiddleware(func(ctx api2go.APIContexter, _ http.ResponseWriter, _ *http.Request) {
+		ctx.Set(auth.ContextKey, org)
+		ctx.Set(auth.RoleContextKey, model.RoleAdmin)
+	})
+	api.AddResource(&model.Organisation{}, NewOrganisationSource(repos))
+	api.AddResource(&model.Payment{}, NewPaymentSource(repos))
+	api.AddResource(&model.Webhook{}, NewWebhookSource(repos, false))
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"organisations", "/v0/organisations"},
+		{"organisation", "/v0/organisations/" + org.GetID()},
+		{"payments", "/v0/payments"},
+		{"payment", "/v0/payments/" + uuid.NewV4().String()},
+		{"webhooks", "/v0/webhooks"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			logger := logrus.New()
+			logger.SetOutput(buf)
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req = req.WithContext(logging.NewContext(req.Context(), logger.WithField("request_id", "abc")))
+
+			res := httptest.NewRecorder()
+			api.Handler().ServeHTTP(res, req)
+
+			body := res.Body.String()
+			if res.Code != http.StatusInternalServerError || !strings.Contains(body, `"title":"internal server error"`) {
+				t.Errorf("GET %s = %v %s, want %v and a generic error", tt.path, res.Code, body, http.StatusInternalServerError)
+			}
+			if strings.Contains(body, "closed") {
+				t.Errorf("GET %s = %s, want the error of the database hidden", tt.path, body)
+			}
+			if logged := buf.String(); !strings.Contains(logged, "request_id=abc") || !strings.Contains(logged, "closed") {
+				t.Errorf("GET %s logged %q, want the error of the database with the request id", tt.path, logged)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package source
+
+import (
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/manyminds/api2go"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// Callers must never be able to read or write the resources of another organisation. Every attempt is reported as not
+// found, exactly like resources that don't exist, and leaves the resources untouched.
+func TestTenantIsolation(t *testing.T) {
+	req := NewMockedRequest()
+	orgs := GetOrganisationFixtures(false)
+	payment := GetPaymentFixtures(false)[0]
+	if !reflect.DeepEqual(payment.OrganisationID, orgs[0].ID) {
+		t.Fatalf("payment fixture belongs to %v, want %v", payment.OrganisationID, orgs[0].ID)
+	}
+
+	// Organisation B tries to access the payment and organisation of organisation A.
+	other := WithMockedCaller(*req, orgs[1])
+	repos := NewMockedRepositories(*req)
+	payments := NewPaymentSource(repos)
+	organisations := NewOrganisationSource(repos)
+
+	related := other
+	related.QueryParams = map[string][]string{"organisationsID": {orgs[0].GetID()}}
+	paginated := other
+	paginated.QueryParams = map[string][]string{"organisationsID": {orgs[0].GetID()}, "page[number]": {"1"}, "page[size]": {"10"}}
+
+	newPayment := &model.Payment{OrganisationID: orgs[0].ID, Amount: money("1.00"), Currency: "GBP"}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"find-payment", func() error {
+			_, err := payments.FindOne(payment.GetID(), other)
+			return err
+		}},
+		{"update-payment", func() error {
+			_, err := payments.Update(&model.Payment{Model: model.Model{ID: payment.ID}, Reference: "Hijacked"}, other)
+			return err
+		}},
+		{"delete-payment", func() error {
+			_, err := payments.Delete(payment.GetID(), other)
+			return err
+		}},
+		{"transition-payment", func() error {
+			_, err := payments.Transition(payment.GetID(), model.StatusSubmitted, other)
+			return err
+		}},
+		{"list-organisation-payments", func() error {
+			_, err := payments.FindAll(related)
+			return err
+		}},
+		{"count-organisation-payments", func() error {
+			_, _, err := payments.PaginatedFindAll(paginated)
+			return err
+		}},
+		{"create-payment", func() error {
+			_, err := payments.Create(newPayment, other)
+			return err
+		}},
+		{"find-organisation", func() error {
+			_, err := organisations.FindOne(orgs[0].GetID(), other)
+			return err
+		}},
+		{"update-organisation", func() error {
+			_, err := organisations.Update(&model.Organisation{Model: model.Model{ID: orgs[0].ID}, Name: "Hijacked"}, other)
+			return err
+		}},
+		{"delete-organisation", func() error {
+			_, err := organisations.Delete(orgs[0].GetID(), other)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); httpStatus(err) != http.StatusNotFound {
+				t.Errorf("error = %v, want status %v", err, http.StatusNotFound)
+			}
+		})
+	}
+
+	// Listing without an organisation only includes the payments of the caller.
+	res, err := payments.FindAll(other)
+	if err != nil {
+		t.Fatalf("PaymentSource.FindAll() error = %v", err)
+	}
+	for _, p := range res.Result().([]*model.Payment) {
+		if !reflect.DeepEqual(p.OrganisationID, orgs[1].ID) {
+			t.Errorf("PaymentSource.FindAll() payment of organisation %v, want %v", p.OrganisationID, orgs[1].ID)
+		}
+	}
+
+	// None of the attempts may have changed the resources of organisation A.
+	got, err := repos.Payments.Find(payment.ID, repository.Load{Fields: []string{}})
+	if err != nil {
+		t.Fatalf("PaymentRepository.Find() error = %v", err)
+	}
+	if got.Reference != payment.Reference || got.Status != payment.Status {
+		t.Errorf("PaymentRepository.Find() = %+v, want %+v", got, payment)
+	}
+	org, err := repos.Organisations.Find(orgs[0].ID)
+	if err != nil {
+		t.Fatalf("OrganisationRepository.Find() error = %v", err)
+	}
+	if org.Name != orgs[0].Name {
+		t.Errorf("OrganisationRepository.Find() name = %v, want %v", org.Name, orgs[0].Name)
+	}
+	count, err := repos.Payments.Count(repository.Query{Filters: []repository.Filter{
+		{Field: "organisation", Operator: operatorEq, Values: []interface{}{orgs[0].ID}},
+	}})
+	if err != nil || count != 2 {
+		t.Errorf("PaymentRepository.Count() = %v, error = %v, want %v", count, err, 2)
+	}
+}
+
+// Requests without an authenticated caller are refused, instead of operating across all organisations.
+func TestTenantIsolation_NoCaller(t *testing.T) {
+	req := NewMockedRequest()
+	payment := GetPaymentFixtures(false)[0]
+	repos := NewMockedRepositories(*req)
+
+	if _, err := NewPaymentSource(repos).FindAll(*req); httpStatus(err) != http.StatusUnauthorized {
+		t.Errorf("PaymentSource.FindAll() error = %v, want status %v", err, http.StatusUnauthorized)
+	}
+	if _, err := NewPaymentSource(repos).FindOne(payment.GetID(), *req); httpStatus(err) != http.StatusUnauthorized {
+		t.Errorf("PaymentSource.FindOne() error = %v, want status %v", err, http.StatusUnauthorized)
+	}
+	if _, err := NewOrganisationSource(repos).FindAll(*req); httpStatus(err) != http.StatusUnauthorized {
+		t.Errorf("OrganisationSource.FindAll() error = %v, want status %v", err, http.StatusUnauthorized)
+	}
+}
+
+// Get the http status of an error returned by a source, which api2go only exposes through the error message.
+func httpStatus(err error) int {
+	var status int
+	if httpErr, ok := err.(api2go.HTTPError); ok {
+		fmt.Sscanf(httpErr.Error(), "http error (%d)", &status)
+	}
+
+	return status
+}
@@ -0,0 +1,214 @@
+package source
+
+import (
+	"errors"
+	"github.com/Shodske/payment-api/pkg/auth"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/Shodske/payment-api/pkg/validation"
+	"github.com/manyminds/api2go"
+	"github.com/satori/go.uuid"
+	"net/http"
+)
+
+// Maximum number of deliveries listed per webhook, the most recent ones first.
+const maxDeliveries = 100
+
+// WebhookSource struct that implements the different interfaces for handling CRUD actions on Webhook Models. Callers
+// can only see the webhooks of their own organisation, other webhooks are reported as not found.
+type WebhookSource struct {
+	repos repository.Repositories
+	// Whether webhooks may use http URLs, only for local use.
+	allowHTTP bool
+}
+
+// NewWebhookSource creates a WebhookSource using the given repositories, which are shared by all requests. Webhooks
+// must use https URLs, unless http is allowed for local use.
+func NewWebhookSource(repos repository.Repositories, allowHTTP bool) *WebhookSource {
+	return &WebhookSource{repos: repos, allowHTTP: allowHTTP}
+}
+
+// Create method required to implement `api2go.ResourceCreator`. Implementing this interface will enable the URI:
+// POST /webhooks
+//
+// A secret is generated when none is sent along, which is only part of this response, it can't be retrieved afterwards.
+func (src *WebhookSource) Create(obj interface{}, req api2go.Request) (api2go.Responder, error) {
+	org, err := authorize(req, "webhooks", auth.OperationCreate)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, ok := obj.(*model.Webhook)
+	if !ok {
+		return nil, NewHTTPError(errors.New("invalid type"), "invalid type", http.StatusConflict)
+	}
+
+	v := validation.New()
+	webhook.Validate(v, src.allowHTTP)
+	if errs := v.Errors(); errs != nil {
+		return nil, newValidationError(errs, "webhooks")
+	}
+
+	generated := webhook.Secret == ""
+	if generated {
+		if webhook.Secret, err = model.NewWebhookSecret(); err != nil {
+			return nil, newInternalError(req, err)
+		}
+	}
+	webhook.OrganisationID, webhook.Enabled, webhook.Failures = org.ID, true, 0
+	if err := scoped(src.repos, req).Webhooks.Create(webhook); err != nil {
+		return nil, newInternalError(req, err)
+	}
+
+	// Secrets chosen by the client aren't sent back.
+	if !generated {
+		webhook.Secret = ""
+	}
+
+	return &api2go.Response{Res: webhook, Code: http.StatusCreated}, nil
+}
+
+// FindAll method required to implement `api2go.FindAll`. Implementing this interface will enable the URI:
+// GET /webhooks
+func (src *WebhookSource) FindAll(req api2go.Request) (api2go.Responder, error) {
+	org, err := authorize(req, "webhooks", auth.OperationRead)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks, err := scoped(src.repos, req).Webhooks.List(org.ID)
+	if err != nil {
+		return nil, newInternalError(req, err)
+	}
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+
+	return &api2go.Response{Res: webhooks, Code: http.StatusOK}, nil
+}
+
+// FindOne method required to implement `api2go.ResourceGetter`. Implementing this interface will enable the URI:
+// GET /webhooks/:webhookID
+func (src *WebhookSource) FindOne(id string, req api2go.Request) (api2go.Responder, error) {
+	if _, err := authorize(req, "webhooks", auth.OperationRead); err != nil {
+		return nil, err
+	}
+
+	webhook, err := src.find(id, req)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = ""
+
+	return &api2go.Response{Res: webhook, Code: http.StatusOK}, nil
+}
+
+// Update method required to implement `api2go.ResourceUpdater`. Implementing this interface will enable the URI:
+// PATCH /webhooks/:webhookID
+//
+// The secret is only changed when a new one is sent along. Enabling a webhook again resets its failures.
+func (src *WebhookSource) Update(obj interface{}, req api2go.Request) (api2go.Responder, error) {
+	if _, err := authorize(req, "webhooks", auth.OperationUpdate); err != nil {
+		return nil, err
+	}
+
+	data, ok := obj.(*model.Webhook)
+	if !ok {
+		return nil, NewHTTPError(errors.New("invalid type"), "invalid type", http.StatusConflict)
+	}
+
+	if data.GetID() == "" {
+		return nil, NewHTTPError(errors.New("missing id"), "missing id", http.StatusConflict)
+	}
+
+	webhook, err := src.find(data.GetID(), req)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.Enabled && !webhook.Enabled {
+		webhook.Failures = 0
+	}
+	webhook.URL, webhook.EventTypes, webhook.Enabled = data.URL, data.EventTypes, data.Enabled
+	if data.Secret != "" {
+		webhook.Secret = data.Secret
+	}
+
+	v := validation.New()
+	webhook.Validate(v, src.allowHTTP)
+	if errs := v.Errors(); errs != nil {
+		return nil, newValidationError(errs, "webhooks")
+	}
+
+	if err := scoped(src.repos, req).Webhooks.Update(webhook); err != nil {
+		return nil, newInternalError(req, err)
+	}
+	webhook.Secret = ""
+
+	return &api2go.Response{Res: webhook, Code: http.StatusOK}, nil
+}
+
+// Delete method required to implement `api2go.ResourceDeleter`. Implementing this interface will enable the URI:
+// DELETE /webhooks/:webhookID
+//
+// Pending deliveries to the webhook fail, they are never attempted.
+func (src *WebhookSource) Delete(id string, req api2go.Request) (api2go.Responder, error) {
+	if _, err := authorize(req, "webhooks", auth.OperationDelete); err != nil {
+		return nil, err
+	}
+
+	webhook, err := src.find(id, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := scoped(src.repos, req).Webhooks.Delete(webhook); err != nil {
+		return nil, newInternalError(req, err)
+	}
+
+	return &api2go.Response{Code: http.StatusNoContent}, nil
+}
+
+// Deliveries lists the most recent deliveries to the webhook with the id, with the outcome of their last attempt:
+// GET /webhooks/:webhookID/deliveries
+func (src *WebhookSource) Deliveries(id string, req api2go.Request) (api2go.Responder, error) {
+	if _, err := authorize(req, "webhook-deliveries", auth.OperationRead); err != nil {
+		return nil, err
+	}
+
+	webhook, err := src.find(id, req)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := scoped(src.repos, req).Deliveries.List(webhook.ID, maxDeliveries)
+	if err != nil {
+		return nil, newInternalError(req, err)
+	}
+
+	return &api2go.Response{Res: deliveries, Code: http.StatusOK}, nil
+}
+
+// Find the webhook with the id. Returns a 404 error when it doesn't exist, or when it isn't a webhook of the
+// organisation of the caller.
+func (src *WebhookSource) find(id string, req api2go.Request) (*model.Webhook, error) {
+	org, err := caller(req)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookID, err := uuid.FromString(id)
+	if err != nil {
+		return nil, NewHTTPError(err, "invalid id", http.StatusBadRequest)
+	}
+
+	webhook, err := scoped(src.repos, req).Webhooks.Find(webhookID)
+	if err == nil && !uuid.Equal(webhook.OrganisationID, org.ID) {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, newNotFoundError(req, err, "webhooks")
+	}
+
+	return webhook, nil
+}
@@ -0,0 +1,188 @@
+package source
+
+import (
+	"github.com/Shodske/payment-api/pkg/model"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWebhookSource(t *testing.T) {
+	orgs := GetOrganisationFixtures(false)
+	req := NewMockedRequest()
+	*req = WithMockedCaller(*req, orgs[0])
+	db := NewMockedDatabase(*req)
+	defer db.Unscoped().Delete(&model.WebhookDelivery{})
+	defer db.Unscoped().Delete(&model.Webhook{})
+	repos := NewMockedRepositories(*req)
+	src := NewWebhookSource(repos, false)
+
+	// A webhook of another organisation, which must not be visible to the caller.
+	other := &model.Webhook{
+		OrganisationID: orgs[1].ID,
+		URL:            "https://example.com/other",
+		EventTypes:     model.EventTypes{model.EventPaymentCreated},
+		Secret:         "whsec_0123456789abcdef",
+		Enabled:        true,
+	}
+	if err := repos.Webhooks.Create(other); err != nil {
+		t.Fatal(err)
+	}
+
+	types := model.EventTypes{model.EventPaymentCreated, model.EventPaymentStatusChanged}
+	createTests := []struct {
+		name       string
+		obj        interface{}
+		wantSecret bool
+		wantErr    bool
+	}{
+		{"generated-secret", &model.Webhook{URL: "https://example.com/a", EventTypes: types}, true, false},
+		{"chosen-secret", &model.Webhook{URL: "https://example.com/b", EventTypes: types, Secret: "0123456789abcdef"}, false, false},
+		{"short-secret", &model.Webhook{URL: "https://example.com/c", EventTypes: types, Secret: "secret"}, false, true},
+		{"missing-url", &model.Webhook{EventTypes: types}, false, true},
+		{"relative-url", &model.Webhook{URL: "/webhooks", EventTypes: types}, false, true},
+		{"invalid-scheme", &model.Webhook{URL: "ftp://example.com", EventTypes: types}, false, true},
+		{"missing-event-types", &model.Webhook{URL: "https://example.com/d"}, false, true},
+		{"invalid-event-type", &model.Webhook{URL: "https://example.com/e", EventTypes: model.EventTypes{"payment.paid"}}, false, true},
+		{"invalid-type", &model.Organisation{}, false, true},
+	}
+	var created []*model.Webhook
+	for _, tt := range createTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := src.Create(tt.obj, *req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WebhookSource.Create() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if got.StatusCode() != http.StatusCreated {
+				t.Errorf("WebhookSource.Create() status = %v, want %v", got.StatusCode(), http.StatusCreated)
+			}
+
+			webhook := got.Result().(*model.Webhook)
+			if webhook.OrganisationID != orgs[0].ID || !webhook.Enabled {
+				t.Errorf("WebhookSource.Create() = %+v, want an enabled webhook of the organisation", webhook)
+			}
+			if gotSecret := strings.HasPrefix(webhook.Secret, "whsec_"); gotSecret != tt.wantSecret {
+				t.Errorf("WebhookSource.Create() secret = %v, want generated %v", webhook.Secret, tt.wantSecret)
+			}
+			created = append(created, webhook)
+		})
+	}
+
+	got, err := src.FindAll(*req)
+	if err != nil {
+		t.Fatalf("WebhookSource.FindAll() error = %v", err)
+	}
+	webhooks := got.Result().([]*model.Webhook)
+	if len(webhooks) != 2 || webhooks[0].ID != created[0].ID || webhooks[0].Secret != "" {
+		t.Errorf("WebhookSource.FindAll() = %v, want only the created webhooks, without their secrets", webhooks)
+	}
+
+	findTests := []struct {
+		name       string
+		id         string
+		wantStatus int
+	}{
+		{"find", created[0].GetID(), http.StatusOK},
+		{"other-organisation", other.GetID(), http.StatusNotFound},
+		{"unknown", "00000000-0000-0000-0000-000000000001", http.StatusNotFound},
+		{"invalid-id", "abc", http.StatusBadRequest},
+	}
+	for _, tt := range findTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := src.FindOne(tt.id, *req)
+			if err != nil {
+				if httpStatus(err) != tt.wantStatus {
+					t.Errorf("WebhookSource.FindOne() error = %v, want status %v", err, tt.wantStatus)
+				}
+				return
+			}
+			if got.Result().(*model.Webhook).Secret != "" {
+				t.Errorf("WebhookSource.FindOne() = %+v, want no secret", got.Result())
+			}
+		})
+	}
+
+	// Webhooks that were disabled after failing too often start counting failures again when they are enabled.
+	stored, _ := repos.Webhooks.Find(created[0].ID)
+	if err := repos.Webhooks.RecordFailure(stored, 1); err != nil {
+		t.Fatal(err)
+	}
+	updateTests := []struct {
+		name         string
+		obj          interface{}
+		wantFailures int
+		wantErr      bool
+	}{
+		{"invalid-url", &model.Webhook{Model: created[0].Model, URL: "example.com", EventTypes: types, Enabled: true}, 0, true},
+		{"other-organisation", &model.Webhook{Model: other.Model, URL: "https://example.com", EventTypes: types}, 0, true},
+		{"missing-id", &model.Webhook{URL: "https://example.com", EventTypes: types}, 0, true},
+		{"invalid-type", &model.Organisation{}, 0, true},
+		{"still-disabled", &model.Webhook{Model: created[0].Model, URL: "https://example.com/x", EventTypes: types}, 1, false},
+		{"enabled", &model.Webhook{Model: created[0].Model, URL: "https://example.com/y", EventTypes: types, Enabled: true}, 0, false},
+	}
+	for _, tt := range updateTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := src.Update(tt.obj, *req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WebhookSource.Update() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			data, webhook := tt.obj.(*model.Webhook), got.Result().(*model.Webhook)
+			if webhook.URL != data.URL || webhook.Enabled != data.Enabled || webhook.Failures != tt.wantFailures {
+				t.Errorf("WebhookSource.Update() = %+v, want %+v with %v failures", webhook, data, tt.wantFailures)
+			}
+		})
+	}
+	// The secret is kept, as no new one was sent along.
+	if stored, _ := repos.Webhooks.Find(created[0].ID); stored.Secret != created[0].Secret {
+		t.Errorf("WebhookSource.Update() secret = %v, want %v", stored.Secret, created[0].Secret)
+	}
+
+	delivery := &model.WebhookDelivery{
+		WebhookID: created[0].ID,
+		EventID:   1,
+		EventType: model.EventPaymentCreated,
+		Status:    model.DeliveryPending,
+	}
+	if err := repos.Deliveries.Create(delivery); err != nil {
+		t.Fatal(err)
+	}
+	got, err = src.Deliveries(created[0].GetID(), *req)
+	if err != nil {
+		t.Fatalf("WebhookSource.Deliveries() error = %v", err)
+	}
+	if deliveries := got.Result().([]*model.WebhookDelivery); len(deliveries) != 1 || deliveries[0].ID != delivery.ID {
+		t.Errorf("WebhookSource.Deliveries() = %v, want the delivery", deliveries)
+	}
+	if _, err := src.Deliveries(other.GetID(), *req); httpStatus(err) != http.StatusNotFound {
+		t.Errorf("WebhookSource.Deliveries() error = %v, want status %v", err, http.StatusNotFound)
+	}
+
+	deleteTests := []struct {
+		name    string
+		id      string
+		wantErr bool
+	}{
+		{"delete", created[1].GetID(), false},
+		{"deleted", created[1].GetID(), true},
+		{"other-organisation", other.GetID(), true},
+	}
+	for _, tt := range deleteTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := src.Delete(tt.id, *req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WebhookSource.Delete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.StatusCode() != http.StatusNoContent {
+				t.Errorf("WebhookSource.Delete() status = %v, want %v", got.StatusCode(), http.StatusNoContent)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Settings of a `gorm.DB` with the context of its queries, and of a query with its span.
+const (
+	contextSetting = "tracing:context"
+	spanSetting    = "tracing:span"
+)
+
+// RegisterCallbacks adds callbacks to the database connection that trace every query made with the context of a
+// request, see `WithContext`. Every create, query, update and delete gets a child span of the span of the request,
+// named by its operation and table, with the SQL statement. Values of the statement aren't recorded.
+func RegisterCallbacks(db *gorm.DB) {
+	callback := db.Callback()
+	callback.Create().Before("gorm:create").Register("tracing:before_create", startSpan("INSERT"))
+	callback.Create().After("gorm:create").Register("tracing:after_create", endSpan)
+	callback.Query().Before("gorm:query").Register("tracing:before_query", startSpan("SELECT"))
+	callback.Query().After("gorm:query").Register("tracing:after_query", endSpan)
+	callback.RowQuery().Before("gorm:row_query").Register("tracing:before_row_query", startSpan("SELECT"))
+	callback.RowQuery().After("gorm:row_query").Register("tracing:after_row_query", endSpan)
+	callback.Update().Before("gorm:update").Register("tracing:before_update", startSpan("UPDATE"))
+	callback.Update().After("gorm:update").Register("tracing:after_update", endSpan)
+	callback.Delete().Before("gorm:delete").Register("tracing:before_delete", startSpan("DELETE"))
+	callback.Delete().After("gorm:delete").Register("tracing:after_delete", endSpan)
+}
+
+// WithContext returns a database connection of which the queries are traced as children of the span of the context.
+// Queries of connections without a context, like the ones of the outbox dispatcher, aren't traced.
+func WithContext(db *gorm.DB, ctx context.Context) *gorm.DB {
+	return db.Set(contextSetting, ctx)
+}
+
+// Create a callback that starts the span of a query with the operation, before it's executed.
+func startSpan(operation string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		value, ok := scope.Get(contextSetting)
+		if !ok {
+			return
+		}
+		ctx, ok := value.(context.Context)
+		if !ok {
+			return
+		}
+
+		name := operation
+		table := scope.TableName()
+		if table != "" {
+			name += " " + table
+		}
+		_, span := Tracer().Start(
+			ctx,
+			name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(dbSystem(scope.Dialect().GetName()), semconv.DBOperation(operation), semconv.DBSQLTable(table)),
+		)
+		scope.InstanceSet(spanSetting, span)
+	}
+}
+
+// End the span of a query after it's executed, recording its statement and whether it failed. Records that aren't
+// found aren't a failure, as the repositories report these as `repository.ErrNotFound`.
+func endSpan(scope *gorm.Scope) {
+	value, ok := scope.InstanceGet(spanSetting)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	span.SetAttributes(semconv.DBStatement(scope.SQL), attribute.Int64("db.rows_affected", scope.DB().RowsAffected))
+	if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Attribute of the database system of the dialect of gorm.
+func dbSystem(dialect string) attribute.KeyValue {
+	switch dialect {
+	case "postgres":
+		return semconv.DBSystemPostgreSQL
+	case "sqlite3":
+		return semconv.DBSystemSqlite
+	}
+
+	return semconv.DBSystemKey.String(dialect)
+}
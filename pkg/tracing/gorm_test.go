@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"testing"
+)
+
+// Model stored in the tests.
+type record struct {
+	ID   int
+	Name string
+}
+
+func TestRegisterCallbacks(t *testing.T) {
+	recorder, restore := newRecorder(t)
+	defer restore()
+
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.AutoMigrate(&record{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	RegisterCallbacks(db)
+
+	// Queries without the context of a request aren't traced.
+	if err := db.Create(&record{Name: "untraced"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Fatalf("RegisterCallbacks() traced %v spans, want none without a context", len(spans))
+	}
+
+	ctx, parent := Tracer().Start(context.Background(), "request")
+	traced := WithContext(db, ctx)
+	created := &record{Name: "traced"}
+	if err := traced.Create(created).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := traced.Model(created).Update("name", "updated").Error; err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := traced.Model(&record{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := traced.First(&record{}, 1000).Error; !gorm.IsRecordNotFoundError(err) {
+		t.Fatalf("DB.First() error = %v, want not found", err)
+	}
+	if err := traced.Find(&[]record{}, "unknown = ?", 1).Error; err == nil {
+		t.Fatalf("DB.Find() error = %v, wantErr %v", err, true)
+	}
+	parent.End()
+
+	tests := []struct {
+		name       string
+		wantStatus codes.Code
+	}{
+		{"INSERT records", codes.Unset},
+		{"UPDATE records", codes.Unset},
+		{"SELECT records", codes.Unset},
+		// Records that aren't found are not a failure.
+		{"SELECT records", codes.Unset},
+		{"SELECT records", codes.Error},
+	}
+	spans := recorder.Ended()
+	if len(spans) != len(tests)+1 {
+		t.Fatalf("RegisterCallbacks() traced %v spans, want %v", len(spans), len(tests)+1)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			span := spans[i]
+			if span.Name() != tt.name || span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Errorf("RegisterCallbacks() span = %v, want %v as child of the request", span.Name(), tt.name)
+			}
+			if span.Status().Code != tt.wantStatus {
+				t.Errorf("RegisterCallbacks() status = %v, want %v", span.Status().Code, tt.wantStatus)
+			}
+			if statement := attributeValue(span, "db.statement"); statement == "" {
+				t.Errorf("RegisterCallbacks() span without the statement")
+			}
+		})
+	}
+}
+
+// Find the value of the attribute of the span, or an empty string when it doesn't have it.
+func attributeValue(span sdktrace.ReadOnlySpan, key string) string {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	recorder, restore := newRecorder(t)
+	defer restore()
+	// The propagator is set globally by `Start`.
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	tests := []struct {
+		name        string
+		traceparent string
+		status      int
+		// Trace the span must continue, if any.
+		wantTrace  string
+		wantStatus codes.Code
+	}{
+		{"new-trace", "", http.StatusOK, "", codes.Unset},
+		{
+			"continued-trace",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			http.StatusNotFound,
+			"4bf92f3577b34da6a3ce929d0e0e4736",
+			codes.Unset,
+		},
+		{"failed", "", http.StatusInternalServerError, "", codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var child trace.SpanContext
+			name := func(r *http.Request) string { return r.Method + " payments" }
+			handler := Middleware(name, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, span := Tracer().Start(r.Context(), "child")
+				child = span.SpanContext()
+				span.End()
+				w.WriteHeader(tt.status)
+			}))
+
+			req := httptest.NewRequest("PATCH", "/v0/payments/1", nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := recorder.Ended()
+			span := spans[len(spans)-1]
+			if span.Name() != "PATCH payments" || span.SpanKind() != trace.SpanKindServer {
+				t.Errorf("Middleware() span = %v (%v), want the server span of the request", span.Name(), span.SpanKind())
+			}
+			if tt.wantTrace != "" && (span.SpanContext().TraceID().String() != tt.wantTrace || !span.Parent().IsRemote()) {
+				t.Errorf("Middleware() trace = %v, want %v", span.SpanContext().TraceID(), tt.wantTrace)
+			}
+			if child.TraceID() != span.SpanContext().TraceID() {
+				t.Errorf("Middleware() child trace = %v, want %v", child.TraceID(), span.SpanContext().TraceID())
+			}
+			if span.Status().Code != tt.wantStatus {
+				t.Errorf("Middleware() status = %v, want %v", span.Status().Code, tt.wantStatus)
+			}
+		})
+	}
+}
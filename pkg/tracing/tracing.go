@@ -0,0 +1,76 @@
+// Package tracing traces requests with OpenTelemetry. Every request gets a span, which continues the trace of the
+// W3C `traceparent` header of the request when it has one, with child spans for its database queries, see
+// `Middleware` and `RegisterCallbacks`. Spans are exported over OTLP, or written to the standard output for local
+// debugging.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+)
+
+// Name of the tracer of the API, the instrumentation scope of its spans.
+const tracerName = "github.com/Shodske/payment-api"
+
+// Exporters of spans. None doesn't export them, but still propagates the trace of requests.
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Config of the tracing of the API.
+type Config struct {
+	// Exporter of the spans, one of `ExporterNone`, `ExporterOTLP` and `ExporterStdout`.
+	Exporter string
+	// URL of the OTLP/HTTP endpoint spans are exported to, e.g. `http://localhost:4318`, for `ExporterOTLP`.
+	Endpoint string
+	// Name of the service in the traces.
+	ServiceName string
+	// Writer spans are written to as JSON, for `ExporterStdout`.
+	Output io.Writer
+}
+
+// Start tracing with the exporter of the Config, which is used for all spans of the API. The trace context of requests
+// is propagated regardless of the exporter. The returned function exports the spans that are left, and stops tracing.
+func Start(cfg Config) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.Endpoint))
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(cfg.Output))
+	default:
+		err = fmt.Errorf("unknown exporter `%s`", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer creates the spans of the API, with the exporter of `Start`.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"strings"
+	"testing"
+)
+
+// Record the spans of the tracer of the API, which are returned once they have ended. The previous tracer provider is
+// restored with the returned function.
+func newRecorder(t *testing.T) (*tracetest.SpanRecorder, func()) {
+	previous := otel.GetTracerProvider()
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	return recorder, func() {
+		otel.SetTracerProvider(previous)
+	}
+}
+
+func TestStart(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+
+	shutdown, err := Start(Config{Exporter: ExporterNone})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Start() shutdown error = %v", err)
+	}
+	if otel.GetTracerProvider() != previous {
+		t.Errorf("Start() replaced the tracer provider, want spans not to be exported")
+	}
+
+	buf := &bytes.Buffer{}
+	shutdown, err = Start(Config{Exporter: ExporterStdout, ServiceName: "payment-api", Output: buf})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	_, span := Tracer().Start(context.Background(), "test")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Start() shutdown error = %v", err)
+	}
+	if got := buf.String(); !strings.Contains(got, `"Name":"test"`) || !strings.Contains(got, "payment-api") {
+		t.Errorf("Start() exported %v, want the span of the service", got)
+	}
+
+	if _, err := Start(Config{Exporter: "jaeger"}); err == nil {
+		t.Errorf("Start() error = %v, wantErr %v", err, true)
+	}
+}
@@ -0,0 +1,163 @@
+// Package validation provides the building blocks to validate the attributes of models. Every violation is reported
+// as an Error containing a JSON pointer (RFC 6901) to the offending attribute, so it can be traced back to the
+// attribute in the request document.
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format of dates, e.g. processing dates.
+const DateFormat = "2006-01-02"
+
+var decimalRegex = regexp.MustCompile(`^(\d+)(?:\.(\d+))?$`)
+
+// Error describes a single violation of an attribute.
+type Error struct {
+	// JSON pointer to the offending attribute, relative to the validated object.
+	Pointer string
+	Detail  string
+}
+
+// Error method required to implement `error`.
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s: %s", err.Pointer, err.Detail)
+}
+
+// Errors is a list of violations, which can be used as an `error`.
+type Errors []*Error
+
+// Error method required to implement `error`.
+func (errs Errors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Validator collects the violations of an object and its nested objects. All checks skip empty values, except for
+// Required, so optional attributes only have to be valid when they are set.
+type Validator struct {
+	path    string
+	partial bool
+	errs    *Errors
+}
+
+// New creates a Validator for complete objects, e.g. objects that are about to be created.
+func New() *Validator {
+	return &Validator{errs: &Errors{}}
+}
+
+// NewPartial creates a Validator for partial objects, e.g. the attributes of an update. Required attributes are not
+// reported when they are missing, as they will be left untouched.
+func NewPartial() *Validator {
+	return &Validator{partial: true, errs: &Errors{}}
+}
+
+// Field returns a Validator for a nested object, reporting its violations to the same list as its parent.
+func (v *Validator) Field(name string) *Validator {
+	return &Validator{path: v.path + "/" + name, partial: v.partial, errs: v.errs}
+}
+
+// Index returns a Validator for an element of a nested list, reporting its violations to the same list as its parent.
+func (v *Validator) Index(i int) *Validator {
+	return v.Field(strconv.Itoa(i))
+}
+
+// Errors returns all violations reported so far, or nil if there are none.
+func (v *Validator) Errors() Errors {
+	if len(*v.errs) == 0 {
+		return nil
+	}
+
+	return *v.errs
+}
+
+// Add reports a violation of the given field.
+func (v *Validator) Add(field, detail string) {
+	*v.errs = append(*v.errs, &Error{Pointer: v.path + "/" + field, Detail: detail})
+}
+
+// Missing reports a value that isn't set, unless the Validator is partial.
+func (v *Validator) Missing(field string) {
+	if !v.partial {
+		v.Add(field, "is required")
+	}
+}
+
+// Required reports an empty value, unless the Validator is partial. Returns whether the value is set.
+func (v *Validator) Required(field, value string) bool {
+	if value != "" {
+		return true
+	}
+
+	v.Missing(field)
+
+	return false
+}
+
+// MaxLength checks the value doesn't exceed the given number of characters.
+func (v *Validator) MaxLength(field, value string, max int) {
+	if len([]rune(value)) > max {
+		v.Add(field, fmt.Sprintf("must not be longer than %d characters", max))
+	}
+}
+
+// Pattern checks the value matches the regular expression, the detail describes the expected format.
+func (v *Validator) Pattern(field, value string, pattern *regexp.Regexp, detail string) {
+	if value != "" && !pattern.MatchString(value) {
+		v.Add(field, detail)
+	}
+}
+
+// OneOf checks the value is one of the allowed values.
+func (v *Validator) OneOf(field, value string, allowed ...string) {
+	if value == "" {
+		return
+	}
+
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+
+	v.Add(field, fmt.Sprintf("must be one of `%s`", strings.Join(allowed, "`, `")))
+}
+
+// Decimal checks the value is a non-negative decimal number, which fits a `decimal(precision,scale)` column.
+func (v *Validator) Decimal(field, value string, precision, scale int) {
+	if value == "" {
+		return
+	}
+
+	matches := decimalRegex.FindStringSubmatch(value)
+	if matches == nil {
+		v.Add(field, "must be a non-negative decimal number, e.g. `12.34`")
+		return
+	}
+
+	if len(matches[2]) > scale {
+		v.Add(field, fmt.Sprintf("must not have more than %d decimals", scale))
+	}
+	if len(strings.TrimLeft(matches[1], "0")) > precision-scale {
+		v.Add(field, fmt.Sprintf("must not have more than %d digits before the decimal point", precision-scale))
+	}
+}
+
+// Date checks the value is a valid date in the format `YYYY-MM-DD`.
+func (v *Validator) Date(field, value string) {
+	if value == "" {
+		return
+	}
+
+	if _, err := time.Parse(DateFormat, value); err != nil {
+		v.Add(field, "must be a valid date in the format `YYYY-MM-DD`")
+	}
+}
@@ -0,0 +1,165 @@
+package validation
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestValidator_Required(t *testing.T) {
+	tests := []struct {
+		name      string
+		validator *Validator
+		value     string
+		want      bool
+		wantErrs  Errors
+	}{
+		{"set", New(), "value", true, nil},
+		{"empty", New(), "", false, Errors{{"/field", "is required"}}},
+		{"partial-set", NewPartial(), "value", true, nil},
+		{"partial-empty", NewPartial(), "", false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.validator.Required("field", tt.value); got != tt.want {
+				t.Errorf("Validator.Required() = %v, want %v", got, tt.want)
+			}
+			if got := tt.validator.Errors(); !reflect.DeepEqual(got, tt.wantErrs) {
+				t.Errorf("Validator.Errors() = %v, want %v", got, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestValidator_Decimal(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		precision int
+		scale     int
+		wantErr   bool
+	}{
+		{"integer", "12", 10, 2, false},
+		{"decimal", "12.34", 10, 2, false},
+		{"empty", "", 10, 2, false},
+		{"leading-zeroes", "0000000012.34", 10, 2, false},
+		{"too-many-decimals", "12.345", 10, 2, true},
+		{"too-many-digits", "123456789", 10, 2, true},
+		{"negative", "-12.34", 10, 2, true},
+		{"letters", "abc", 10, 2, true},
+		{"trailing-point", "12.", 10, 2, true},
+		{"comma", "12,34", 10, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New()
+			v.Decimal("field", tt.value, tt.precision, tt.scale)
+			if errs := v.Errors(); (errs != nil) != tt.wantErr {
+				t.Errorf("Validator.Decimal() errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidator_Date(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"date", "2017-01-18", false},
+		{"empty", "", false},
+		{"words", "tomorrow", true},
+		{"invalid-day", "2017-02-30", true},
+		{"time", "2017-01-18T12:00:00Z", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New()
+			v.Date("field", tt.value)
+			if errs := v.Errors(); (errs != nil) != tt.wantErr {
+				t.Errorf("Validator.Date() errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidator_OneOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"allowed", "Credit", false},
+		{"empty", "", false},
+		{"not-allowed", "credit", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New()
+			v.OneOf("field", tt.value, "Credit", "Debit")
+			if errs := v.Errors(); (errs != nil) != tt.wantErr {
+				t.Errorf("Validator.OneOf() errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidator_Pattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"match", "123", false},
+		{"empty", "", false},
+		{"no-match", "12a", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New()
+			v.Pattern("field", tt.value, regexp.MustCompile(`^\d+$`), "must only contain digits")
+			if errs := v.Errors(); (errs != nil) != tt.wantErr {
+				t.Errorf("Validator.Pattern() errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidator_MaxLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"short", "abc", false},
+		{"exact", "abcde", false},
+		{"multi-byte", "€€€€€", false},
+		{"long", "abcdef", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New()
+			v.MaxLength("field", tt.value, 5)
+			if errs := v.Errors(); (errs != nil) != tt.wantErr {
+				t.Errorf("Validator.MaxLength() errors = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidator_Field(t *testing.T) {
+	v := New()
+	v.Add("amount", "is invalid")
+	v.Field("beneficiary_party").Add("account_number", "is invalid")
+	v.Field("charges_information").Field("sender_charges").Index(1).Add("amount", "is invalid")
+
+	want := Errors{
+		{"/amount", "is invalid"},
+		{"/beneficiary_party/account_number", "is invalid"},
+		{"/charges_information/sender_charges/1/amount", "is invalid"},
+	}
+	if got := v.Errors(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Validator.Errors() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,54 @@
+// Package webhook delivers the domain events of organisations to the webhooks they subscribed. The Sink of this
+// package turns events dispatched from the outbox into a delivery per webhook, which the Worker posts to the webhooks,
+// retrying failed attempts with exponential backoff.
+//
+// Every delivery is signed with the secret of the webhook, so receivers can verify it was sent by the API and hasn't
+// been tampered with, see `Sign`.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// Headers of every delivery, besides the content type.
+const (
+	// Id of the delivery, which is the same for all attempts of a delivery.
+	DeliveryHeader = "X-Webhook-Delivery"
+	// Type of the event, e.g. `payment.created`.
+	EventHeader = "X-Webhook-Event"
+	// Time of the attempt in seconds since the Unix epoch, which is part of the signature, so receivers can reject
+	// attempts that are replayed later.
+	TimestampHeader = "X-Webhook-Timestamp"
+	// Signature of the attempt, see `Sign`.
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Prefix of signatures, naming the algorithm.
+const signaturePrefix = "sha256="
+
+// Sign the body of an attempt at the time with the secret of a webhook. The signature is the hex encoded
+// HMAC-SHA256 of the timestamp, a dot and the body, prefixed with `sha256=`.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify the signature of the body of an attempt with the timestamp header, using the secret of the webhook. Compares
+// the signatures in constant time.
+func Verify(secret, timestamp, signature string, body []byte) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	expected := Sign(secret, time.Unix(seconds, 0), body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,46 @@
+package webhook
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	timestamp := time.Unix(1546344000, 0)
+	body := []byte(`{"id":1}`)
+
+	// Signature computed independently with `printf '1546344000.{"id":1}' | openssl dgst -sha256 -hmac secret`.
+	signature := "sha256=28590ef6a865104fdaca70436381ec91d1c35c76fdaef6e00580ad5e4c88e1d0"
+	if got := Sign("secret", timestamp, body); got != signature {
+		t.Errorf("Sign() = %v, want %v", got, signature)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	timestamp := time.Unix(1546344000, 0)
+	signature := Sign("secret", timestamp, []byte(`{"id":1}`))
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      string
+		want      bool
+	}{
+		{"valid", "secret", unix, signature, `{"id":1}`, true},
+		{"other-secret", "other", unix, signature, `{"id":1}`, false},
+		{"other-timestamp", "secret", "1546344001", signature, `{"id":1}`, false},
+		{"invalid-timestamp", "secret", "now", signature, `{"id":1}`, false},
+		{"other-body", "secret", unix, signature, `{"id":2}`, false},
+		{"missing-signature", "secret", unix, "", `{"id":1}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.timestamp, tt.signature, []byte(tt.body)); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
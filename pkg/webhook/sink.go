@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"time"
+)
+
+// Sink creates the deliveries of the events dispatched from the outbox, one for every enabled webhook of the
+// organisation of an event that subscribed to its type. Implements `outbox.Sink`.
+type Sink struct{}
+
+// NewSink creates a Sink.
+func NewSink() *Sink {
+	return &Sink{}
+}
+
+// Deliver method required to implement `outbox.Sink`. The deliveries are created in the transaction of the
+// dispatcher, and attempted by the Worker once it's committed. An event that is dispatched again, because a sink after
+// this one failed, only gets deliveries for the webhooks that don't have one yet.
+func (sink *Sink) Deliver(_ context.Context, tx repository.Repositories, event *model.OutboxEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := tx.Webhooks.List(event.OrganisationID)
+	if err != nil {
+		return err
+	}
+	existing, err := tx.Deliveries.ListByEvent(event.ID)
+	if err != nil {
+		return err
+	}
+	delivered := make(map[string]bool, len(existing))
+	for _, delivery := range existing {
+		delivered[delivery.WebhookID.String()] = true
+	}
+
+	now := time.Now()
+	for _, webhook := range webhooks {
+		if !webhook.Enabled || !webhook.Subscribes(event.Type) || delivered[webhook.ID.String()] {
+			continue
+		}
+
+		err := tx.Deliveries.Create(&model.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        model.DeliveryPending,
+			NextAttemptAt: &now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
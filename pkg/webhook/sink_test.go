@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"context"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/satori/go.uuid"
+	"testing"
+)
+
+// Create an organisation in the repositories.
+func addOrganisation(t *testing.T, repos repository.Repositories) *model.Organisation {
+	org := &model.Organisation{Name: "Organisation"}
+	if err := repos.Organisations.Create(org); err != nil {
+		t.Fatalf("OrganisationRepository.Create() error = %v", err)
+	}
+
+	return org
+}
+
+// Create a webhook of the organisation that posts to the url.
+func addWebhook(t *testing.T, repos repository.Repositories, orgID uuid.UUID, url string, types ...model.EventType) *model.Webhook {
+	webhook := &model.Webhook{
+		OrganisationID: orgID,
+		URL:            url,
+		EventTypes:     types,
+		Secret:         "whsec_0123456789abcdef",
+		Enabled:        true,
+	}
+	if err := repos.Webhooks.Create(webhook); err != nil {
+		t.Fatalf("WebhookRepository.Create() error = %v", err)
+	}
+
+	return webhook
+}
+
+func TestSink_Deliver(t *testing.T) {
+	repos := repository.NewMemory()
+	orgs := []*model.Organisation{addOrganisation(t, repos), addOrganisation(t, repos)}
+	subscribed := addWebhook(t, repos, orgs[0].ID, "https://example.com/a", model.EventPaymentCreated)
+	addWebhook(t, repos, orgs[0].ID, "https://example.com/b", model.EventPaymentDeleted)
+	disabled := addWebhook(t, repos, orgs[0].ID, "https://example.com/c", model.EventPaymentCreated)
+	disabled.Enabled = false
+	if err := repos.Webhooks.Update(disabled); err != nil {
+		t.Fatalf("WebhookRepository.Update() error = %v", err)
+	}
+	addWebhook(t, repos, orgs[1].ID, "https://example.com/d", model.EventPaymentCreated)
+
+	event := &model.OutboxEvent{
+		Type:           model.EventPaymentCreated,
+		OrganisationID: orgs[0].ID,
+		ResourceType:   "payments",
+		ResourceID:     uuid.NewV4(),
+		Data:           model.EventData(`{"amount":"1.00"}`),
+	}
+	if err := repos.Outbox.Add(event); err != nil {
+		t.Fatalf("OutboxRepository.Add() error = %v", err)
+	}
+
+	sink := NewSink()
+	// Dispatching the event again doesn't deliver it twice.
+	for i := 0; i < 2; i++ {
+		err := repos.Transaction(func(tx repository.Repositories) error {
+			return sink.Deliver(context.Background(), tx, event)
+		})
+		if err != nil {
+			t.Fatalf("Sink.Deliver() error = %v", err)
+		}
+	}
+
+	deliveries, err := repos.Deliveries.ListByEvent(event.ID)
+	if err != nil {
+		t.Fatalf("WebhookDeliveryRepository.ListByEvent() error = %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("Sink.Deliver() created %v deliveries, want 1", len(deliveries))
+	}
+	delivery := deliveries[0]
+	if delivery.WebhookID != subscribed.ID || delivery.Status != model.DeliveryPending || delivery.NextAttemptAt == nil {
+		t.Errorf("Sink.Deliver() created %+v, want a pending delivery to %v", delivery, subscribed.ID)
+	}
+	if delivery.EventType != event.Type || delivery.Payload == "" {
+		t.Errorf("Sink.Deliver() created %+v, want the payload of the event", delivery)
+	}
+}
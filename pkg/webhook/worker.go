@@ -0,0 +1,256 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// User agent of all deliveries.
+const userAgent = "payment-api-webhooks"
+
+// Maximum number of bytes of a response that are read, the rest is discarded.
+const maxResponseBytes = 64 << 10
+
+// WorkerConfig configures how a Worker attempts deliveries, and when it gives up.
+type WorkerConfig struct {
+	// Duration between looking for due deliveries, when there weren't any left the last time.
+	Interval time.Duration
+	// Maximum number of deliveries claimed at a time.
+	BatchSize int
+	// Maximum duration of a single attempt, including reading the response.
+	Timeout time.Duration
+	// Number of attempts after which a delivery fails permanently.
+	MaxAttempts int
+	// Delay before the first retry of a delivery, which doubles with every retry after it, up to the maximum.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Number of failed attempts in a row after which a webhook is disabled.
+	DisableAfter int
+	// Whether deliveries may go to loopback and private addresses. Only for local use, as it lets callers make the
+	// worker post to internal services.
+	AllowInsecure bool
+}
+
+// Worker posts the due deliveries to their webhooks. A failed attempt is retried with exponential backoff, until the
+// delivery succeeds or runs out of attempts.
+type Worker struct {
+	repos  repository.Repositories
+	config WorkerConfig
+	client *http.Client
+}
+
+// NewWorker creates a Worker of the deliveries in the repositories. Unless insecure deliveries are allowed, deliveries
+// only connect to public addresses.
+func NewWorker(repos repository.Repositories, config WorkerConfig) *Worker {
+	client := &http.Client{
+		Timeout: config.Timeout,
+		// Redirects aren't followed, so a delivery never ends up at another host than the webhook.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	if !config.AllowInsecure {
+		// The address is checked after the host is resolved, right before connecting, so a host that resolves to
+		// another address than it did before can't bypass the check. Proxies are never used, as the check would only
+		// apply to the proxy.
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: checkAddress}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+		client.Transport = transport
+	}
+
+	return &Worker{repos: repos, config: config, client: client}
+}
+
+// Run attempts the due deliveries every interval, until the context is done. Failures are logged and retried.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := w.Deliver(ctx)
+		if err != nil {
+			logrus.WithError(err).Error("cannot deliver webhooks")
+		}
+
+		// A full batch may have left deliveries behind, which are attempted right away.
+		if err != nil || n < w.config.BatchSize {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		} else if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Deliver a single batch of due deliveries, returning the number of deliveries that were attempted.
+func (w *Worker) Deliver(ctx context.Context) (int, error) {
+	now := time.Now()
+
+	// Deliveries are claimed by scheduling their next attempt as if this attempt fails, so other workers skip them, and
+	// they are retried when this worker stops before it stored the outcome.
+	var claimed []*model.WebhookDelivery
+	err := w.repos.Transaction(func(tx repository.Repositories) error {
+		due, err := tx.Deliveries.Due(now, w.config.BatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range due {
+			retry := now.Add(w.backoff(delivery.Attempts + 1))
+			delivery.NextAttemptAt = &retry
+			if err := tx.Deliveries.Update(delivery); err != nil {
+				return err
+			}
+		}
+		claimed = due
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, delivery := range claimed {
+		if err := w.attempt(ctx, delivery); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(claimed), nil
+}
+
+// Attempt the delivery and store the outcome. Deliveries to webhooks that are deleted or disabled fail without an
+// attempt.
+func (w *Worker) attempt(ctx context.Context, delivery *model.WebhookDelivery) error {
+	webhook, err := w.repos.Webhooks.Find(delivery.WebhookID)
+	if err == repository.ErrNotFound {
+		return w.fail(delivery, "webhook has been deleted")
+	}
+	if err != nil {
+		return err
+	}
+	if !webhook.Enabled {
+		return w.fail(delivery, "webhook is disabled")
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	code, postErr := w.post(ctx, webhook, delivery)
+	delivery.ResponseCode = code
+
+	return w.repos.Transaction(func(tx repository.Repositories) error {
+		if postErr == nil {
+			delivery.Status = model.DeliverySucceeded
+			delivery.NextAttemptAt = nil
+			delivery.LastError = ""
+			if err := tx.Deliveries.Update(delivery); err != nil {
+				return err
+			}
+			return tx.Webhooks.RecordSuccess(webhook)
+		}
+
+		// The next attempt has already been scheduled when the delivery was claimed.
+		delivery.LastError = postErr.Error()
+		if delivery.Attempts >= w.config.MaxAttempts {
+			delivery.Status = model.DeliveryFailed
+			delivery.NextAttemptAt = nil
+		}
+		if err := tx.Deliveries.Update(delivery); err != nil {
+			return err
+		}
+		return tx.Webhooks.RecordFailure(webhook, w.config.DisableAfter)
+	})
+}
+
+// Fail the delivery permanently, for the reason.
+func (w *Worker) fail(delivery *model.WebhookDelivery, reason string) error {
+	delivery.Status = model.DeliveryFailed
+	delivery.NextAttemptAt = nil
+	delivery.LastError = reason
+
+	return w.repos.Deliveries.Update(delivery)
+}
+
+// Post the payload of the delivery to the webhook, signed with its secret. Returns the status code of the response, if
+// there is one, and an error unless the status code is 2xx.
+func (w *Worker) post(ctx context.Context, webhook *model.Webhook, delivery *model.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(DeliveryHeader, delivery.GetID())
+	req.Header.Set(EventHeader, string(delivery.EventType))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, now, body))
+
+	res, err := w.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	// Read the response, so the connection can be reused.
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, maxResponseBytes))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return res.StatusCode, errors.New("unexpected response " + res.Status)
+	}
+
+	return res.StatusCode, nil
+}
+
+// Check the resolved address a delivery connects to, refusing loopback, private, link-local and unspecified addresses,
+// so webhooks can't be used to reach internal services.
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("invalid address %s", address)
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("address %s is not public", ip)
+	}
+
+	return nil
+}
+
+// Delay before retrying a delivery after the number of attempts, doubling for every attempt after the first, up to the
+// maximum.
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.config.Backoff
+	for i := 1; i < attempts && delay < w.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > w.config.MaxBackoff {
+		delay = w.config.MaxBackoff
+	}
+
+	return delay
+}
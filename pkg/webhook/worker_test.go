@@ -0,0 +1,331 @@
+package webhook
+
+import (
+	"context"
+	"github.com/Shodske/payment-api/pkg/model"
+	"github.com/Shodske/payment-api/pkg/repository"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Receiver of deliveries, that responds with the status and records the requests it received.
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rec *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.requests = append(rec.requests, req)
+	rec.bodies = append(rec.bodies, body)
+	w.WriteHeader(rec.status)
+}
+
+// Set the status the receiver responds with.
+func (rec *receiver) respond(status int) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.status = status
+}
+
+// Number of requests the receiver received.
+func (rec *receiver) received() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return len(rec.requests)
+}
+
+var testConfig = WorkerConfig{
+	Interval:     10 * time.Millisecond,
+	BatchSize:    10,
+	Timeout:      time.Second,
+	MaxAttempts:  3,
+	Backoff:      time.Minute,
+	MaxBackoff:   time.Hour,
+	DisableAfter: 5,
+	// The receivers listen on the loopback address.
+	AllowInsecure: true,
+}
+
+// Start a receiver, and create a webhook that posts to it with a pending delivery. The returned function stops the
+// receiver.
+func setup(t *testing.T, status int) (repository.Repositories, *receiver, *model.Webhook, func()) {
+	rec := &receiver{status: status}
+	server := httptest.NewServer(rec)
+
+	repos := repository.NewMemory()
+	org := addOrganisation(t, repos)
+	webhook := addWebhook(t, repos, org.ID, server.URL, model.EventPaymentCreated)
+	now := time.Now()
+	err := repos.Deliveries.Create(&model.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		EventID:       1,
+		EventType:     model.EventPaymentCreated,
+		Payload:       `{"id":1,"type":"payment.created"}`,
+		Status:        model.DeliveryPending,
+		NextAttemptAt: &now,
+	})
+	if err != nil {
+		server.Close()
+		t.Fatalf("WebhookDeliveryRepository.Create() error = %v", err)
+	}
+
+	return repos, rec, webhook, server.Close
+}
+
+// Get the last delivery to the webhook, and make it due when it's pending, so it's retried without waiting.
+func lastDelivery(t *testing.T, repos repository.Repositories, webhook *model.Webhook, due bool) *model.WebhookDelivery {
+	deliveries, err := repos.Deliveries.List(webhook.ID, 1)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("WebhookDeliveryRepository.List() = %v, error = %v", deliveries, err)
+	}
+	delivery := deliveries[0]
+
+	if due && delivery.Status == model.DeliveryPending {
+		past := time.Now().Add(-time.Second)
+		delivery.NextAttemptAt = &past
+		if err := repos.Deliveries.Update(delivery); err != nil {
+			t.Fatalf("WebhookDeliveryRepository.Update() error = %v", err)
+		}
+	}
+
+	return delivery
+}
+
+func TestWorker_Deliver(t *testing.T) {
+	repos, rec, webhook, stop := setup(t, http.StatusNoContent)
+	defer stop()
+	worker := NewWorker(repos, testConfig)
+
+	got, err := worker.Deliver(context.Background())
+	if err != nil {
+		t.Fatalf("Worker.Deliver() error = %v", err)
+	}
+	if got != 1 || rec.received() != 1 {
+		t.Fatalf("Worker.Deliver() = %v, received %v, want 1", got, rec.received())
+	}
+
+	req, body := rec.requests[0], rec.bodies[0]
+	if string(body) != `{"id":1,"type":"payment.created"}` {
+		t.Errorf("Worker.Deliver() posted %s, want the payload", body)
+	}
+	if req.Header.Get(EventHeader) != "payment.created" || req.Header.Get(DeliveryHeader) == "" {
+		t.Errorf("Worker.Deliver() headers = %v, want the event and delivery", req.Header)
+	}
+	if !Verify(webhook.Secret, req.Header.Get(TimestampHeader), req.Header.Get(SignatureHeader), body) {
+		t.Errorf("Worker.Deliver() signature = %v, want a valid signature", req.Header.Get(SignatureHeader))
+	}
+
+	delivery := lastDelivery(t, repos, webhook, false)
+	if delivery.Status != model.DeliverySucceeded || delivery.Attempts != 1 || delivery.ResponseCode != http.StatusNoContent {
+		t.Errorf("Worker.Deliver() delivery = %+v, want it succeeded", delivery)
+	}
+	if delivery.NextAttemptAt != nil || delivery.LastAttemptAt == nil {
+		t.Errorf("Worker.Deliver() delivery = %+v, want no next attempt", delivery)
+	}
+
+	// Succeeded deliveries aren't attempted again.
+	if got, err := worker.Deliver(context.Background()); err != nil || got != 0 {
+		t.Errorf("Worker.Deliver() = %v, error = %v, want 0", got, err)
+	}
+}
+
+func TestWorker_DeliverRetried(t *testing.T) {
+	repos, rec, webhook, stop := setup(t, http.StatusInternalServerError)
+	defer stop()
+	worker := NewWorker(repos, testConfig)
+
+	steps := []struct {
+		name     string
+		status   int
+		want     model.DeliveryStatus
+		failures int
+	}{
+		{"failed", http.StatusInternalServerError, model.DeliveryPending, 1},
+		{"retried", http.StatusServiceUnavailable, model.DeliveryPending, 2},
+		{"out-of-attempts", http.StatusBadRequest, model.DeliveryFailed, 3},
+	}
+	for i, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			rec.respond(step.status)
+			start := time.Now()
+			if _, err := worker.Deliver(context.Background()); err != nil {
+				t.Fatalf("Worker.Deliver() error = %v", err)
+			}
+
+			delivery := lastDelivery(t, repos, webhook, false)
+			if delivery.Status != step.want || delivery.Attempts != i+1 || delivery.ResponseCode != step.status {
+				t.Errorf("Worker.Deliver() delivery = %+v, want %v after %v attempts", delivery, step.want, i+1)
+			}
+			if delivery.LastError == "" {
+				t.Errorf("Worker.Deliver() delivery = %+v, want the last error", delivery)
+			}
+			if found, _ := repos.Webhooks.Find(webhook.ID); found.Failures != step.failures || !found.Enabled {
+				t.Errorf("Worker.Deliver() webhook = %+v, want %v failures", found, step.failures)
+			}
+
+			if delivery.Status == model.DeliveryPending {
+				// The retry is scheduled with backoff, so it isn't attempted right away.
+				backoff := worker.backoff(delivery.Attempts)
+				if delivery.NextAttemptAt == nil || delivery.NextAttemptAt.Before(start.Add(backoff)) {
+					t.Errorf("Worker.Deliver() next attempt = %v, want after %v", delivery.NextAttemptAt, start.Add(backoff))
+				}
+				if got, err := worker.Deliver(context.Background()); err != nil || got != 0 {
+					t.Errorf("Worker.Deliver() = %v, error = %v, want 0", got, err)
+				}
+				lastDelivery(t, repos, webhook, true)
+			} else if delivery.NextAttemptAt != nil {
+				t.Errorf("Worker.Deliver() next attempt = %v, want none", delivery.NextAttemptAt)
+			}
+		})
+	}
+
+	if rec.received() != len(steps) {
+		t.Errorf("Worker.Deliver() received %v, want %v", rec.received(), len(steps))
+	}
+}
+
+func TestWorker_DeliverDisabled(t *testing.T) {
+	repos, rec, webhook, stop := setup(t, http.StatusInternalServerError)
+	defer stop()
+	config := testConfig
+	config.MaxAttempts = 5
+	config.DisableAfter = 2
+	worker := NewWorker(repos, config)
+
+	// The webhook is disabled after failing twice in a row, after which the delivery fails without an attempt.
+	for i := 0; i < 3; i++ {
+		if _, err := worker.Deliver(context.Background()); err != nil {
+			t.Fatalf("Worker.Deliver() error = %v", err)
+		}
+		lastDelivery(t, repos, webhook, true)
+	}
+
+	if found, _ := repos.Webhooks.Find(webhook.ID); found.Enabled || found.Failures != 2 {
+		t.Errorf("Worker.Deliver() webhook = %+v, want it disabled", found)
+	}
+	delivery := lastDelivery(t, repos, webhook, false)
+	if delivery.Status != model.DeliveryFailed || delivery.Attempts != 2 || delivery.LastError != "webhook is disabled" {
+		t.Errorf("Worker.Deliver() delivery = %+v, want it failed", delivery)
+	}
+	if rec.received() != 2 {
+		t.Errorf("Worker.Deliver() received %v, want 2", rec.received())
+	}
+}
+
+func TestWorker_DeliverDeleted(t *testing.T) {
+	repos, rec, webhook, stop := setup(t, http.StatusOK)
+	defer stop()
+	if err := repos.Webhooks.Delete(webhook); err != nil {
+		t.Fatalf("WebhookRepository.Delete() error = %v", err)
+	}
+
+	if _, err := NewWorker(repos, testConfig).Deliver(context.Background()); err != nil {
+		t.Fatalf("Worker.Deliver() error = %v", err)
+	}
+	delivery := lastDelivery(t, repos, webhook, false)
+	if delivery.Status != model.DeliveryFailed || delivery.Attempts != 0 || delivery.LastError != "webhook has been deleted" {
+		t.Errorf("Worker.Deliver() delivery = %+v, want it failed", delivery)
+	}
+	if rec.received() != 0 {
+		t.Errorf("Worker.Deliver() received %v, want 0", rec.received())
+	}
+}
+
+// Deliveries to internal services fail without reaching them, unless insecure deliveries are allowed.
+func TestWorker_DeliverPrivate(t *testing.T) {
+	repos, rec, webhook, stop := setup(t, http.StatusOK)
+	defer stop()
+	config := testConfig
+	config.AllowInsecure = false
+
+	if _, err := NewWorker(repos, config).Deliver(context.Background()); err != nil {
+		t.Fatalf("Worker.Deliver() error = %v", err)
+	}
+	delivery := lastDelivery(t, repos, webhook, false)
+	if delivery.Status != model.DeliveryPending || !strings.Contains(delivery.LastError, "is not public") {
+		t.Errorf("Worker.Deliver() delivery = %+v, want the attempt refused", delivery)
+	}
+	if rec.received() != 0 {
+		t.Errorf("Worker.Deliver() received %v, want 0", rec.received())
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		wantErr bool
+	}{
+		{"public", "93.184.216.34:443", false},
+		{"public-ipv6", "[2606:2800:220:1:248:1893:25c8:1946]:443", false},
+		{"loopback", "127.0.0.1:80", true},
+		{"loopback-ipv6", "[::1]:80", true},
+		{"private", "10.0.0.1:443", true},
+		{"private-192", "192.168.1.1:443", true},
+		{"private-ipv6", "[fd00::1]:443", true},
+		{"link-local", "169.254.169.254:80", true},
+		{"link-local-ipv6", "[fe80::1]:80", true},
+		{"unspecified", "0.0.0.0:80", true},
+		{"invalid", "example.com:80", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkAddress("tcp", tt.address, nil); (err != nil) != tt.wantErr {
+				t.Errorf("checkAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWorker_Run(t *testing.T) {
+	repos, rec, webhook, stop := setup(t, http.StatusOK)
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewWorker(repos, testConfig).Run(ctx)
+		close(done)
+	}()
+
+	for deadline := time.Now().Add(time.Second); rec.received() == 0 && time.Now().Before(deadline); {
+		time.Sleep(testConfig.Interval)
+	}
+	cancel()
+	<-done
+
+	if delivery := lastDelivery(t, repos, webhook, false); delivery.Status != model.DeliverySucceeded {
+		t.Errorf("Worker.Run() delivery = %+v, want it succeeded", delivery)
+	}
+}
+
+func TestWorker_backoff(t *testing.T) {
+	worker := NewWorker(repository.NewMemory(), testConfig)
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{7, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := worker.backoff(tt.attempts); got != tt.want {
+			t.Errorf("Worker.backoff(%v) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}